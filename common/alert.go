@@ -0,0 +1,86 @@
+package common
+
+import (
+	"strings"
+	"time"
+)
+
+// AlertConfig controls operational alerting. A rule with a zero threshold is
+// disabled.
+type AlertConfig struct {
+	Enabled bool
+	// WebhookURL receives a JSON payload shaped by WebhookFormat.
+	WebhookURL    string
+	WebhookFormat string
+	// EmailReceivers is a ";"-separated list delivered through SMTP.
+	EmailReceivers string
+
+	BalanceThresholdUSD  float64
+	SyncFailureThreshold int
+	TokenCooldownMinutes int
+	CPAStoppedEnabled    bool
+
+	// QuietPeriod suppresses repeats of a still-firing alert.
+	QuietPeriod time.Duration
+}
+
+const (
+	AlertWebhookFormatGeneric  = "generic"
+	AlertWebhookFormatSlack    = "slack"
+	AlertWebhookFormatFeishu   = "feishu"
+	AlertWebhookFormatDingTalk = "dingtalk"
+)
+
+const (
+	alertEnabledOptionKey              = "AlertEnabled"
+	alertWebhookURLOptionKey           = "AlertWebhookURL"
+	alertWebhookFormatOptionKey        = "AlertWebhookFormat"
+	alertEmailReceiversOptionKey       = "AlertEmailReceivers"
+	alertBalanceThresholdOptionKey     = "AlertBalanceThresholdUSD"
+	alertSyncFailureThresholdOptionKey = "AlertSyncFailureThreshold"
+	// Option keys containing "Token" are hidden from GetOptions, hence "Key".
+	alertTokenCooldownMinutesOptionKey = "AlertKeyCooldownMinutes"
+	alertCPAStoppedEnabledOptionKey    = "AlertCPAStoppedEnabled"
+	alertQuietPeriodOptionKey          = "AlertQuietPeriodMinutes"
+)
+
+func IsValidAlertWebhookFormat(format string) bool {
+	switch format {
+	case AlertWebhookFormatGeneric, AlertWebhookFormatSlack, AlertWebhookFormatFeishu, AlertWebhookFormatDingTalk:
+		return true
+	}
+	return false
+}
+
+func LoadAlertConfig() AlertConfig {
+	defaultCfg := AlertConfig{
+		Enabled:              false,
+		WebhookFormat:        AlertWebhookFormatGeneric,
+		BalanceThresholdUSD:  0,
+		SyncFailureThreshold: 3,
+		TokenCooldownMinutes: 30,
+		CPAStoppedEnabled:    true,
+		QuietPeriod:          time.Hour,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Enabled = parseOptionBool(OptionMap[alertEnabledOptionKey], defaultCfg.Enabled)
+	out.WebhookURL = strings.TrimSpace(OptionMap[alertWebhookURLOptionKey])
+	if format := strings.ToLower(strings.TrimSpace(OptionMap[alertWebhookFormatOptionKey])); IsValidAlertWebhookFormat(format) {
+		out.WebhookFormat = format
+	}
+	out.EmailReceivers = strings.TrimSpace(OptionMap[alertEmailReceiversOptionKey])
+	out.BalanceThresholdUSD = parseOptionFloatInRange(OptionMap[alertBalanceThresholdOptionKey], defaultCfg.BalanceThresholdUSD, 0, 1000000)
+	out.SyncFailureThreshold = parseOptionIntInRange(OptionMap[alertSyncFailureThresholdOptionKey], defaultCfg.SyncFailureThreshold, 0, 1000)
+	out.TokenCooldownMinutes = parseOptionIntInRange(OptionMap[alertTokenCooldownMinutesOptionKey], defaultCfg.TokenCooldownMinutes, 0, 10080)
+	out.CPAStoppedEnabled = parseOptionBool(OptionMap[alertCPAStoppedEnabledOptionKey], defaultCfg.CPAStoppedEnabled)
+	quietMinutes := parseOptionIntInRange(OptionMap[alertQuietPeriodOptionKey], int(defaultCfg.QuietPeriod/time.Minute), 1, 10080)
+	out.QuietPeriod = time.Duration(quietMinutes) * time.Minute
+	return out
+}
@@ -0,0 +1,72 @@
+package common
+
+import "time"
+
+// HedgeConfig controls hedged requests: when a non-streaming attempt has not
+// answered within the hedge delay, a second attempt is sent to the next route
+// and the first success wins.
+type HedgeConfig struct {
+	// Models are hedged for every token; tokens can also opt in themselves.
+	Models []string
+	// Delay is used when the primary route has no usable latency estimate.
+	Delay time.Duration
+	// AdaptiveDelay uses the estimated p90 latency of the primary route.
+	AdaptiveDelay bool
+}
+
+const (
+	hedgeModelsOptionKey               = "HedgeModels"
+	hedgeDelayMsOptionKey              = "HedgeDelayMs"
+	hedgeAdaptiveDelayEnabledOptionKey = "HedgeAdaptiveDelayEnabled"
+
+	// hedgeMinAdaptiveSamples is the number of successful samples needed
+	// before the adaptive delay trusts the route's latency estimate.
+	hedgeMinAdaptiveSamples = 5
+	hedgeMinDelay           = 50 * time.Millisecond
+	hedgeMaxDelay           = 60 * time.Second
+)
+
+func LoadHedgeConfig() HedgeConfig {
+	defaultCfg := HedgeConfig{
+		Delay:         time.Second,
+		AdaptiveDelay: true,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Models = splitOptionList(OptionMap[hedgeModelsOptionKey])
+	delayMs := parseOptionIntInRange(OptionMap[hedgeDelayMsOptionKey], int(defaultCfg.Delay/time.Millisecond), int(hedgeMinDelay/time.Millisecond), int(hedgeMaxDelay/time.Millisecond))
+	out.Delay = time.Duration(delayMs) * time.Millisecond
+	out.AdaptiveDelay = parseOptionBool(OptionMap[hedgeAdaptiveDelayEnabledOptionKey], defaultCfg.AdaptiveDelay)
+	return out
+}
+
+// ModelEnabled reports whether modelName is hedged for every token.
+func (cfg HedgeConfig) ModelEnabled(modelName string) bool {
+	return modelListContains(cfg.Models, modelName)
+}
+
+// DelayFor returns how long to wait for the primary attempt on a route before
+// hedging.
+func (cfg HedgeConfig) DelayFor(providerTokenId int, modelName string) time.Duration {
+	if !cfg.AdaptiveDelay {
+		return cfg.Delay
+	}
+	stats, ok := GlobalRouteLatency.Get(providerTokenId, modelName)
+	if !ok || stats.LatencySamples < hedgeMinAdaptiveSamples {
+		return cfg.Delay
+	}
+	delay := time.Duration(stats.LatencyP90Ms() * float64(time.Millisecond))
+	if delay < hedgeMinDelay {
+		return hedgeMinDelay
+	}
+	if delay > hedgeMaxDelay {
+		return hedgeMaxDelay
+	}
+	return delay
+}
@@ -19,6 +19,9 @@ var (
 // UploadPath Maybe override by ENV_VAR
 var UploadPath = "upload"
 
+// MetricsToken protects /metrics with a bearer token when set.
+var MetricsToken = ""
+
 func printHelp() {
 	fmt.Println("Gin Template " + Version + " - Your next project starts from here.")
 	fmt.Println("Copyright (C) 2026 BrentXu. All rights reserved.")
@@ -55,6 +58,9 @@ func init() {
 	if os.Getenv("UPLOAD_PATH") != "" {
 		UploadPath = os.Getenv("UPLOAD_PATH")
 	}
+	if os.Getenv("METRICS_TOKEN") != "" {
+		MetricsToken = os.Getenv("METRICS_TOKEN")
+	}
 	if *LogDir != "" {
 		var err error
 		*LogDir, err = filepath.Abs(*LogDir)
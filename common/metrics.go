@@ -0,0 +1,222 @@
+package common
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// MetricsRegistry holds every metric exposed on /metrics. A dedicated registry
+// keeps tests free of global default-registry collisions.
+var MetricsRegistry = prometheus.NewRegistry()
+
+const metricsNamespace = "gateway"
+
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}
+
+var (
+	relayRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_requests_total",
+		Help:      "Upstream relay attempts by model, provider and status (success, HTTP status code or error).",
+	}, []string{"model", "provider", "status"})
+	relayTokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_tokens_total",
+		Help:      "Tokens consumed through the relay by model, provider and type.",
+	}, []string{"model", "provider", "type"})
+	upstreamLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_latency_seconds",
+		Help:      "Total upstream response time per relay attempt.",
+		Buckets:   latencyBuckets,
+	}, []string{"model", "provider", "stream"})
+	firstTokenLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "first_token_latency_seconds",
+		Help:      "Time to the first streamed event per relay attempt.",
+		Buckets:   latencyBuckets,
+	}, []string{"model", "provider"})
+	relayAttemptsPerRequest = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_attempts_per_request",
+		Help:      "Upstream attempts made for one client request, excluding routes skipped by cooldown.",
+		Buckets:   []float64{1, 2, 3, 4, 5, 6, 8, 10, 15, 20},
+	}, []string{"outcome"})
+	routeCooldownEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "route_cooldown_events_total",
+		Help:      "Cooldown transitions recorded by the route cooldown manager.",
+	}, []string{"event"})
+	responseCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "response_cache_total",
+		Help:      "Response cache lookups and writes by result (hit, miss, store, error).",
+	}, []string{"result"})
+	routeAffinityTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "route_affinity_total",
+		Help:      "Session affinity lookups by result (hit, miss, unavailable, error).",
+	}, []string{"result"})
+	routeConcurrencyTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "route_concurrency_total",
+		Help:      "Max-in-flight limit outcomes by result (saturated, queued, queue_full, queue_timeout).",
+	}, []string{"result"})
+	routeProbeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "route_probe_total",
+		Help:      "Active route health probes by result (success, failure, skipped).",
+	}, []string{"result"})
+	providerBreakerTransitionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_breaker_transitions_total",
+		Help:      "Provider circuit breaker transitions by new state (open, half_open, closed).",
+	}, []string{"state"})
+	providerSyncTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_sync_total",
+		Help:      "Provider synchronizations by provider and result (success, partial, failure).",
+	}, []string{"provider", "result"})
+	providerSyncDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_sync_duration_seconds",
+		Help:      "Duration of provider synchronizations.",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+	providerLastSyncSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_last_sync_success_timestamp_seconds",
+		Help:      "Unix time of the last fully successful provider synchronization.",
+	}, []string{"provider"})
+)
+
+var (
+	routeCooldownRoutesDesc      = prometheus.NewDesc(metricsNamespace+"_route_cooldown_routes", "Routes currently blocked or probing, by state (cooldown, half_open).", []string{"state"}, nil)
+	routeCooldownTokensDesc      = prometheus.NewDesc(metricsNamespace+"_route_cooldown_tokens", "Provider tokens currently in token-level cooldown.", nil, nil)
+	routeCooldownUnsupportedDesc = prometheus.NewDesc(metricsNamespace+"_route_cooldown_unsupported_models", "Route models currently marked unsupported.", nil, nil)
+	routeCooldownScrapeErrorDesc = prometheus.NewDesc(metricsNamespace+"_route_cooldown_scrape_error", "1 if the cooldown store could not be listed during this scrape.", nil, nil)
+)
+
+// routeCooldownCollector reads GlobalRouteCooldown at scrape time so the gauges
+// reflect the shared store rather than this replica's own events.
+type routeCooldownCollector struct{}
+
+func (routeCooldownCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- routeCooldownRoutesDesc
+	ch <- routeCooldownTokensDesc
+	ch <- routeCooldownUnsupportedDesc
+	ch <- routeCooldownScrapeErrorDesc
+}
+
+func (routeCooldownCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := GlobalRouteCooldown.Stats()
+	scrapeError := 0.0
+	if err != nil {
+		scrapeError = 1
+	}
+	ch <- prometheus.MustNewConstMetric(routeCooldownScrapeErrorDesc, prometheus.GaugeValue, scrapeError)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(routeCooldownRoutesDesc, prometheus.GaugeValue, float64(stats.RoutesInCooldown), "cooldown")
+	ch <- prometheus.MustNewConstMetric(routeCooldownRoutesDesc, prometheus.GaugeValue, float64(stats.RoutesHalfOpen), "half_open")
+	ch <- prometheus.MustNewConstMetric(routeCooldownTokensDesc, prometheus.GaugeValue, float64(stats.TokensInCooldown))
+	ch <- prometheus.MustNewConstMetric(routeCooldownUnsupportedDesc, prometheus.GaugeValue, float64(stats.UnsupportedModels))
+}
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequestsTotal,
+		relayTokensTotal,
+		upstreamLatencySeconds,
+		firstTokenLatencySeconds,
+		relayAttemptsPerRequest,
+		routeCooldownEventsTotal,
+		responseCacheTotal,
+		routeAffinityTotal,
+		routeConcurrencyTotal,
+		routeProbeTotal,
+		providerBreakerTransitionsTotal,
+		providerSyncTotal,
+		providerSyncDurationSeconds,
+		providerLastSyncSuccess,
+		routeCooldownCollector{},
+	)
+}
+
+// ObserveRelayAttempt records one upstream attempt as logged in UsageLog.
+// httpStatus is the upstream status for failures, 0 when unknown.
+func ObserveRelayAttempt(modelName string, provider string, success bool, httpStatus int, stream bool, promptTokens int, completionTokens int, responseTimeMs int, firstTokenMs int) {
+	status := "success"
+	if !success {
+		status = "error"
+		if httpStatus > 0 {
+			status = strconv.Itoa(httpStatus)
+		}
+	}
+	relayRequestsTotal.WithLabelValues(modelName, provider, status).Inc()
+	if promptTokens > 0 {
+		relayTokensTotal.WithLabelValues(modelName, provider, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		relayTokensTotal.WithLabelValues(modelName, provider, "completion").Add(float64(completionTokens))
+	}
+	upstreamLatencySeconds.WithLabelValues(modelName, provider, strconv.FormatBool(stream)).Observe(float64(responseTimeMs) / 1000)
+	if stream && firstTokenMs > 0 {
+		firstTokenLatencySeconds.WithLabelValues(modelName, provider).Observe(float64(firstTokenMs) / 1000)
+	}
+}
+
+// ObserveRelayRequest records how many upstream attempts one client request took.
+func ObserveRelayRequest(attempts int, success bool) {
+	outcome := "success"
+	if !success {
+		outcome = "failure"
+	}
+	relayAttemptsPerRequest.WithLabelValues(outcome).Observe(float64(attempts))
+}
+
+func observeRouteCooldownEvent(event string) {
+	routeCooldownEventsTotal.WithLabelValues(event).Inc()
+}
+
+// ObserveResponseCache records a response cache lookup or write.
+func ObserveResponseCache(result string) {
+	responseCacheTotal.WithLabelValues(result).Inc()
+}
+
+// ObserveRouteAffinity records a session affinity lookup.
+func ObserveRouteAffinity(result string) {
+	routeAffinityTotal.WithLabelValues(result).Inc()
+}
+
+// ObserveRouteConcurrency records an attempt rejected by a max-in-flight
+// limit or the outcome of waiting in the concurrency queue.
+func ObserveRouteConcurrency(result string) {
+	routeConcurrencyTotal.WithLabelValues(result).Inc()
+}
+
+// ObserveRouteProbe records the result of an active route health probe.
+func ObserveRouteProbe(result string) {
+	routeProbeTotal.WithLabelValues(result).Inc()
+}
+
+// ObserveProviderBreaker records a provider circuit breaker transition.
+func ObserveProviderBreaker(state string) {
+	providerBreakerTransitionsTotal.WithLabelValues(state).Inc()
+}
+
+// ObserveProviderSync records a provider synchronization. result is one of
+// "success", "partial" or "failure".
+func ObserveProviderSync(provider string, result string, duration time.Duration) {
+	providerSyncTotal.WithLabelValues(provider, result).Inc()
+	providerSyncDurationSeconds.WithLabelValues(provider).Observe(duration.Seconds())
+	if result == "success" {
+		providerLastSyncSuccess.WithLabelValues(provider).SetToCurrentTime()
+	}
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PriceBookEntry overrides the synced upstream price of a model and sets the
+// internal sale price used for chargeback. Nil fields keep the synced value;
+// unset sale fields sell at cost. ProviderId 0 applies to every provider.
+type PriceBookEntry struct {
+	Model               string   `json:"model"`
+	ProviderId          int      `json:"provider_id"`
+	ModelRatio          *float64 `json:"model_ratio,omitempty"`
+	CompletionRatio     *float64 `json:"completion_ratio,omitempty"`
+	ModelPrice          *float64 `json:"model_price,omitempty"`
+	SaleModelRatio      *float64 `json:"sale_model_ratio,omitempty"`
+	SaleCompletionRatio *float64 `json:"sale_completion_ratio,omitempty"`
+	SaleModelPrice      *float64 `json:"sale_model_price,omitempty"`
+}
+
+// HasSalePrice reports whether the entry sets its own internal sale price.
+func (e PriceBookEntry) HasSalePrice() bool {
+	return e.SaleModelRatio != nil || e.SaleCompletionRatio != nil || e.SaleModelPrice != nil
+}
+
+const (
+	// priceBookOptionKey holds a JSON array of PriceBookEntry.
+	priceBookOptionKey = "PriceBook"
+	// priceBookGroupMarkupOptionKey holds a JSON object mapping user groups to
+	// the multiplier applied to the internal sale price, e.g. {"research":1.2}.
+	priceBookGroupMarkupOptionKey = "PriceBookGroupMarkup"
+)
+
+// ParsePriceBook validates the PriceBook option. A model may appear once per
+// provider id.
+func ParsePriceBook(raw string) ([]PriceBookEntry, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var entries []PriceBookEntry
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, fmt.Errorf("价目表必须是 JSON 数组：%v", err)
+	}
+	seen := make(map[string]bool, len(entries))
+	for i := range entries {
+		entry := &entries[i]
+		entry.Model = strings.TrimSpace(entry.Model)
+		if entry.Model == "" {
+			return nil, fmt.Errorf("价目表第 %d 项的模型名称不能为空", i+1)
+		}
+		if entry.ProviderId < 0 {
+			return nil, fmt.Errorf("价目表模型 %s 的供应商 ID 不能为负数", entry.Model)
+		}
+		key := fmt.Sprintf("%d/%s", entry.ProviderId, strings.ToLower(entry.Model))
+		if seen[key] {
+			return nil, fmt.Errorf("价目表模型 %s 在同一供应商下重复", entry.Model)
+		}
+		seen[key] = true
+		for _, value := range []*float64{
+			entry.ModelRatio, entry.CompletionRatio, entry.ModelPrice,
+			entry.SaleModelRatio, entry.SaleCompletionRatio, entry.SaleModelPrice,
+		} {
+			if value != nil && *value < 0 {
+				return nil, fmt.Errorf("价目表模型 %s 的价格不能为负数", entry.Model)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// ParsePriceBookGroupMarkup validates the PriceBookGroupMarkup option.
+func ParsePriceBookGroupMarkup(raw string) (map[string]float64, error) {
+	out := make(map[string]float64)
+	if strings.TrimSpace(raw) == "" {
+		return out, nil
+	}
+	var parsed map[string]float64
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("分组加价倍率必须是 JSON 对象：%v", err)
+	}
+	for group, markup := range parsed {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			return nil, fmt.Errorf("分组名称不能为空")
+		}
+		if markup <= 0 {
+			return nil, fmt.Errorf("分组 %s 的加价倍率必须大于 0", group)
+		}
+		out[group] = markup
+	}
+	return out, nil
+}
+
+func loadPriceBookOption(key string) string {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return ""
+	}
+	return OptionMap[key]
+}
+
+// FindPriceBookEntry returns the price book entry of a model, preferring the
+// provider-specific one over the entry for all providers.
+func FindPriceBookEntry(providerId int, modelName string) (PriceBookEntry, bool) {
+	entries, err := ParsePriceBook(loadPriceBookOption(priceBookOptionKey))
+	if err != nil {
+		return PriceBookEntry{}, false
+	}
+	var fallback *PriceBookEntry
+	for i := range entries {
+		if !strings.EqualFold(entries[i].Model, modelName) {
+			continue
+		}
+		if entries[i].ProviderId == providerId {
+			return entries[i], true
+		}
+		if entries[i].ProviderId == 0 {
+			fallback = &entries[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return PriceBookEntry{}, false
+}
+
+// PriceBookGroupMarkup returns the markup of a user group; 1 when unset.
+func PriceBookGroupMarkup(group string) float64 {
+	markups, err := ParsePriceBookGroupMarkup(loadPriceBookOption(priceBookGroupMarkupOptionKey))
+	if err != nil {
+		return 1
+	}
+	if markup, ok := markups[strings.TrimSpace(group)]; ok {
+		return markup
+	}
+	return 1
+}
@@ -0,0 +1,18 @@
+package common
+
+import "testing"
+
+func TestParsePriceBookRejectsDuplicatesAndNegativePrices(t *testing.T) {
+	if _, err := ParsePriceBook(`[{"model":"gpt-4"},{"model":"GPT-4"}]`); err == nil {
+		t.Fatal("duplicate model for the same provider should be rejected")
+	}
+	if _, err := ParsePriceBook(`[{"model":"gpt-4","sale_model_ratio":-1}]`); err == nil {
+		t.Fatal("negative price should be rejected")
+	}
+	if _, err := ParsePriceBook(`[{"model":"gpt-4"},{"model":"gpt-4","provider_id":2}]`); err != nil {
+		t.Fatalf("per-provider entry next to a global one should be accepted: %v", err)
+	}
+	if _, err := ParsePriceBookGroupMarkup(`{"research":0}`); err == nil {
+		t.Fatal("non-positive markup should be rejected")
+	}
+}
@@ -0,0 +1,327 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderBreakerConfig controls the provider-level circuit breaker, which
+// takes a whole provider out of routing when its site looks down instead of
+// waiting for every token and model on it to cool down separately.
+type ProviderBreakerConfig struct {
+	Enabled bool
+	// FailureThreshold outage failures within Window trip the breaker; a
+	// 2xx/3xx response from the provider starts the count over.
+	FailureThreshold int
+	Window           time.Duration
+	// OpenDuration is how long the first trip lasts; each failed half-open
+	// probe doubles it up to MaxOpenDuration.
+	OpenDuration    time.Duration
+	MaxOpenDuration time.Duration
+}
+
+const (
+	providerBreakerEnabledOptionKey          = "ProviderBreakerEnabled"
+	providerBreakerFailureThresholdOptionKey = "ProviderBreakerFailureThreshold"
+	providerBreakerWindowSecondsOptionKey    = "ProviderBreakerWindowSeconds"
+	providerBreakerOpenSecondsOptionKey      = "ProviderBreakerOpenSeconds"
+	providerBreakerMaxOpenSecondsOptionKey   = "ProviderBreakerMaxOpenSeconds"
+)
+
+func LoadProviderBreakerConfig() ProviderBreakerConfig {
+	defaultCfg := ProviderBreakerConfig{
+		Enabled:          false,
+		FailureThreshold: 10,
+		Window:           time.Minute,
+		OpenDuration:     time.Minute,
+		MaxOpenDuration:  10 * time.Minute,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Enabled = parseOptionBool(OptionMap[providerBreakerEnabledOptionKey], defaultCfg.Enabled)
+	out.FailureThreshold = parseOptionIntInRange(OptionMap[providerBreakerFailureThresholdOptionKey], defaultCfg.FailureThreshold, 1, 1000)
+	windowSeconds := parseOptionIntInRange(OptionMap[providerBreakerWindowSecondsOptionKey], int(defaultCfg.Window/time.Second), 1, 3600)
+	out.Window = time.Duration(windowSeconds) * time.Second
+	openSeconds := parseOptionIntInRange(OptionMap[providerBreakerOpenSecondsOptionKey], int(defaultCfg.OpenDuration/time.Second), 1, 86400)
+	out.OpenDuration = time.Duration(openSeconds) * time.Second
+	maxOpenSeconds := parseOptionIntInRange(OptionMap[providerBreakerMaxOpenSecondsOptionKey], int(defaultCfg.MaxOpenDuration/time.Second), openSeconds, 86400)
+	out.MaxOpenDuration = time.Duration(maxOpenSeconds) * time.Second
+	return out
+}
+
+const (
+	ProviderBreakerStateClosed   = "closed"
+	ProviderBreakerStateOpen     = "open"
+	ProviderBreakerStateHalfOpen = "half_open"
+)
+
+type providerBreakerEntry struct {
+	failures []time.Time
+	open     bool
+	// trips counts consecutive trips without a successful half-open probe.
+	trips            int
+	openedAt         time.Time
+	openUntil        time.Time
+	halfOpenInFlight bool
+	lastError        string
+}
+
+// ProviderBreakerStatus is the breaker state of one provider.
+type ProviderBreakerStatus struct {
+	ProviderId     int    `json:"provider_id"`
+	State          string `json:"state"`
+	RecentFailures int    `json:"recent_failures"`
+	Trips          int    `json:"trips"`
+	OpenedAt       int64  `json:"opened_at"`
+	OpenUntil      int64  `json:"open_until"`
+	RemainingSecs  int    `json:"remaining_secs"`
+	LastError      string `json:"last_error"`
+}
+
+// ProviderCircuitBreaker tracks outage failures per provider. State is per
+// process: every replica counts failures and trips on its own.
+type ProviderCircuitBreaker struct {
+	mu             sync.Mutex
+	providers      map[int]*providerBreakerEntry
+	configProvider func() ProviderBreakerConfig
+	now            func() time.Time
+}
+
+func NewProviderCircuitBreaker(configProvider func() ProviderBreakerConfig) *ProviderCircuitBreaker {
+	return newProviderCircuitBreaker(configProvider, time.Now)
+}
+
+func newProviderCircuitBreaker(configProvider func() ProviderBreakerConfig, nowFn func() time.Time) *ProviderCircuitBreaker {
+	if configProvider == nil {
+		configProvider = func() ProviderBreakerConfig { return ProviderBreakerConfig{Enabled: false} }
+	}
+	if nowFn == nil {
+		nowFn = time.Now
+	}
+	return &ProviderCircuitBreaker{
+		providers:      make(map[int]*providerBreakerEntry),
+		configProvider: configProvider,
+		now:            nowFn,
+	}
+}
+
+var GlobalProviderBreaker = NewProviderCircuitBreaker(LoadProviderBreakerConfig)
+
+// ProviderBreakerPermit is the half-open probe slot of a provider. Release
+// frees the slot when the attempt ended without recording an outcome.
+type ProviderBreakerPermit struct {
+	breaker    *ProviderCircuitBreaker
+	providerId int
+	once       sync.Once
+}
+
+func (p *ProviderBreakerPermit) Release() {
+	if p == nil || p.breaker == nil {
+		return
+	}
+	p.once.Do(func() {
+		p.breaker.mu.Lock()
+		defer p.breaker.mu.Unlock()
+		if entry := p.breaker.providers[p.providerId]; entry != nil {
+			entry.halfOpenInFlight = false
+		}
+	})
+}
+
+// OpenRemaining reports whether the provider is cut from routing and for how
+// much longer. A provider whose open period has run out is routable again so
+// a half-open probe can reach it.
+func (b *ProviderCircuitBreaker) OpenRemaining(providerId int) (time.Duration, bool) {
+	if !b.configProvider().Enabled {
+		return 0, false
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.providers[providerId]
+	if entry == nil || !entry.open || !now.Before(entry.openUntil) {
+		return 0, false
+	}
+	return entry.openUntil.Sub(now), true
+}
+
+// IsProviderRoutable reports whether routes of the provider may be selected.
+func (b *ProviderCircuitBreaker) IsProviderRoutable(providerId int) bool {
+	_, open := b.OpenRemaining(providerId)
+	return !open
+}
+
+// TryAcquire gates one upstream attempt to the provider. While the breaker is
+// open it rejects the attempt with the time left; once the open period ends
+// a single attempt at a time is let through as the half-open probe and gets a
+// permit.
+func (b *ProviderCircuitBreaker) TryAcquire(providerId int) (*ProviderBreakerPermit, time.Duration, bool) {
+	if !b.configProvider().Enabled {
+		return nil, 0, true
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.providers[providerId]
+	if entry == nil || !entry.open {
+		return nil, 0, true
+	}
+	if now.Before(entry.openUntil) {
+		return nil, entry.openUntil.Sub(now), false
+	}
+	if entry.halfOpenInFlight {
+		return nil, 0, false
+	}
+	entry.halfOpenInFlight = true
+	ObserveProviderBreaker(ProviderBreakerStateHalfOpen)
+	return &ProviderBreakerPermit{breaker: b, providerId: providerId}, 0, true
+}
+
+// RecordSuccess records a 2xx/3xx response from the provider. It
+// closes a half-open breaker and restarts the failure count.
+func (b *ProviderCircuitBreaker) RecordSuccess(providerId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.providers[providerId]
+	if entry == nil {
+		return
+	}
+	if entry.open {
+		if b.now().Before(entry.openUntil) {
+			// A request sent before the trip; the half-open probe decides.
+			return
+		}
+		SysLog(fmt.Sprintf("[provider-breaker] provider_id=%d closed after half-open probe succeeded", providerId))
+		ObserveProviderBreaker(ProviderBreakerStateClosed)
+	}
+	delete(b.providers, providerId)
+}
+
+// RecordFailure records an outage failure (network error, gateway error or
+// Cloudflare challenge). It trips the breaker once the threshold is reached
+// within the window, and reopens it with a doubled open period when the
+// half-open probe fails.
+func (b *ProviderCircuitBreaker) RecordFailure(providerId int, reason string) {
+	cfg := b.configProvider()
+	if !cfg.Enabled {
+		return
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.providers[providerId]
+	if entry == nil {
+		entry = &providerBreakerEntry{}
+		b.providers[providerId] = entry
+	}
+	entry.lastError = reason
+	if entry.open {
+		if now.Before(entry.openUntil) {
+			return
+		}
+		entry.trips++
+		b.open(providerId, entry, now, cfg)
+		return
+	}
+
+	cutoff := now.Add(-cfg.Window)
+	kept := entry.failures[:0]
+	for _, failedAt := range entry.failures {
+		if failedAt.After(cutoff) {
+			kept = append(kept, failedAt)
+		}
+	}
+	entry.failures = append(kept, now)
+	if len(entry.failures) >= cfg.FailureThreshold {
+		entry.trips = 1
+		b.open(providerId, entry, now, cfg)
+	}
+}
+
+func (b *ProviderCircuitBreaker) open(providerId int, entry *providerBreakerEntry, now time.Time, cfg ProviderBreakerConfig) {
+	duration := cfg.OpenDuration
+	for i := 1; i < entry.trips && duration < cfg.MaxOpenDuration; i++ {
+		duration *= 2
+	}
+	if duration > cfg.MaxOpenDuration {
+		duration = cfg.MaxOpenDuration
+	}
+	entry.open = true
+	entry.openedAt = now
+	entry.openUntil = now.Add(duration)
+	entry.halfOpenInFlight = false
+	entry.failures = nil
+	SysLog(fmt.Sprintf("[provider-breaker] provider_id=%d opened for %s (trip %d): %s", providerId, duration, entry.trips, entry.lastError))
+	ObserveProviderBreaker(ProviderBreakerStateOpen)
+}
+
+// Reset closes the breaker of a provider and forgets its failures.
+func (b *ProviderCircuitBreaker) Reset(providerId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.providers, providerId)
+}
+
+// ResetAll closes every breaker and returns how many were open.
+func (b *ProviderCircuitBreaker) ResetAll() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	open := 0
+	for _, entry := range b.providers {
+		if entry.open {
+			open++
+		}
+	}
+	b.providers = make(map[int]*providerBreakerEntry)
+	return open
+}
+
+// List returns the providers that are open or half-open, or that have outage
+// failures within the window.
+func (b *ProviderCircuitBreaker) List() []ProviderBreakerStatus {
+	cfg := b.configProvider()
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	statuses := make([]ProviderBreakerStatus, 0, len(b.providers))
+	for providerId, entry := range b.providers {
+		status := ProviderBreakerStatus{
+			ProviderId: providerId,
+			State:      ProviderBreakerStateClosed,
+			Trips:      entry.trips,
+			LastError:  entry.lastError,
+		}
+		if entry.open {
+			status.State = ProviderBreakerStateHalfOpen
+			status.OpenedAt = entry.openedAt.Unix()
+			status.OpenUntil = entry.openUntil.Unix()
+			if remaining := entry.openUntil.Sub(now); remaining > 0 {
+				status.State = ProviderBreakerStateOpen
+				status.RemainingSecs = int(remaining.Seconds())
+			}
+		} else {
+			cutoff := now.Add(-cfg.Window)
+			for _, failedAt := range entry.failures {
+				if failedAt.After(cutoff) {
+					status.RecentFailures++
+				}
+			}
+			if status.RecentFailures == 0 {
+				continue
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ProviderId < statuses[j].ProviderId
+	})
+	return statuses
+}
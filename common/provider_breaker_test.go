@@ -0,0 +1,82 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProviderCircuitBreaker_TripHalfOpenAndBackoff(t *testing.T) {
+	clock := time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return clock }
+	cfgFn := func() ProviderBreakerConfig {
+		return ProviderBreakerConfig{
+			Enabled:          true,
+			FailureThreshold: 3,
+			Window:           time.Minute,
+			OpenDuration:     time.Minute,
+			MaxOpenDuration:  3 * time.Minute,
+		}
+	}
+	breaker := newProviderCircuitBreaker(cfgFn, nowFn)
+	providerID := 7
+
+	breaker.RecordFailure(providerID, "dial tcp: no such host")
+	breaker.RecordFailure(providerID, "dial tcp: no such host")
+	breaker.RecordSuccess(providerID)
+	breaker.RecordFailure(providerID, "dial tcp: no such host")
+	breaker.RecordFailure(providerID, "dial tcp: no such host")
+	if !breaker.IsProviderRoutable(providerID) {
+		t.Fatalf("expected a success to restart the failure count")
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		breaker.RecordFailure(providerID, "dial tcp: no such host")
+	}
+	if breaker.IsProviderRoutable(providerID) {
+		t.Fatalf("expected provider cut after reaching the threshold")
+	}
+	if _, retryAfter, ok := breaker.TryAcquire(providerID); ok || retryAfter != time.Minute {
+		t.Fatalf("expected attempt rejected for 1m, got ok=%v retryAfter=%s", ok, retryAfter)
+	}
+
+	// Half-open: one probe at a time; a failed probe doubles the open period.
+	clock = clock.Add(time.Minute)
+	if !breaker.IsProviderRoutable(providerID) {
+		t.Fatalf("expected provider routable for half-open probing")
+	}
+	permit, _, ok := breaker.TryAcquire(providerID)
+	if !ok || permit == nil {
+		t.Fatalf("expected half-open probe permit")
+	}
+	if _, _, ok := breaker.TryAcquire(providerID); ok {
+		t.Fatalf("expected a second concurrent probe to be rejected")
+	}
+	breaker.RecordFailure(providerID, "upstream status 522")
+	permit.Release()
+	if remaining, open := breaker.OpenRemaining(providerID); !open || remaining != 2*time.Minute {
+		t.Fatalf("expected reopened for 2m, got open=%v remaining=%s", open, remaining)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	breaker.RecordFailure(providerID, "upstream status 522")
+	if remaining, _ := breaker.OpenRemaining(providerID); remaining != 3*time.Minute {
+		t.Fatalf("expected open period capped at 3m, got %s", remaining)
+	}
+	statuses := breaker.List()
+	if len(statuses) != 1 || statuses[0].State != ProviderBreakerStateOpen || statuses[0].Trips != 3 || statuses[0].LastError != "upstream status 522" {
+		t.Fatalf("unexpected breaker status: %+v", statuses)
+	}
+
+	// A successful half-open probe closes the breaker.
+	clock = clock.Add(3 * time.Minute)
+	permit, _, ok = breaker.TryAcquire(providerID)
+	if !ok || permit == nil {
+		t.Fatalf("expected half-open probe permit after the capped period")
+	}
+	breaker.RecordSuccess(providerID)
+	permit.Release()
+	if _, _, ok := breaker.TryAcquire(providerID); !ok || len(breaker.List()) != 0 {
+		t.Fatalf("expected breaker closed after a successful probe")
+	}
+}
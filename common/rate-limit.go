@@ -68,3 +68,108 @@ func (l *InMemoryRateLimiter) Request(key string, maxRequestNum int, duration in
 	}
 	return true
 }
+
+// RequestWithRemaining behaves like Request over a sliding window, but also
+// reports how many requests remain and how many seconds until the oldest
+// request leaves the window.
+func (l *InMemoryRateLimiter) RequestWithRemaining(key string, maxRequestNum int, duration int64) (bool, int, int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now().Unix()
+	queue, ok := l.store[key]
+	if !ok {
+		s := make([]int64, 0, maxRequestNum)
+		queue = &s
+		l.store[key] = queue
+	}
+	for len(*queue) > 0 && now-(*queue)[0] >= duration {
+		*queue = (*queue)[1:]
+	}
+	if len(*queue) >= maxRequestNum {
+		resetAfter := duration - (now - (*queue)[0])
+		return false, 0, resetAfter
+	}
+	*queue = append(*queue, now)
+	resetAfter := duration - (now - (*queue)[0])
+	return true, maxRequestNum - len(*queue), resetAfter
+}
+
+// InMemoryWindowCounter accumulates weighted amounts (e.g. tokens) per key
+// over a sliding window.
+type InMemoryWindowCounter struct {
+	store map[string]*[]windowAmount
+	mutex sync.Mutex
+}
+
+type windowAmount struct {
+	at     int64
+	amount int64
+}
+
+func (l *InMemoryWindowCounter) Init(expirationDuration time.Duration) {
+	if l.store == nil {
+		l.mutex.Lock()
+		if l.store == nil {
+			l.store = make(map[string]*[]windowAmount)
+			if expirationDuration > 0 {
+				go l.clearExpiredItems(expirationDuration)
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+func (l *InMemoryWindowCounter) clearExpiredItems(expirationDuration time.Duration) {
+	for {
+		time.Sleep(expirationDuration)
+		l.mutex.Lock()
+		now := time.Now().Unix()
+		for key, queue := range l.store {
+			size := len(*queue)
+			if size == 0 || now-(*queue)[size-1].at > int64(expirationDuration.Seconds()) {
+				delete(l.store, key)
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+// Get returns the amount accumulated in the last duration seconds and the
+// seconds until the oldest amount leaves the window.
+func (l *InMemoryWindowCounter) Get(key string, duration int64) (int64, int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	queue, ok := l.store[key]
+	if !ok {
+		return 0, duration
+	}
+	now := time.Now().Unix()
+	for len(*queue) > 0 && now-(*queue)[0].at >= duration {
+		*queue = (*queue)[1:]
+	}
+	if len(*queue) == 0 {
+		return 0, duration
+	}
+	var total int64
+	for _, item := range *queue {
+		total += item.amount
+	}
+	return total, duration - (now - (*queue)[0].at)
+}
+
+// Add records amount for key at the current time. Duration's unit is seconds.
+func (l *InMemoryWindowCounter) Add(key string, amount int64, duration int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now().Unix()
+	queue, ok := l.store[key]
+	if !ok {
+		s := make([]windowAmount, 0, 1)
+		queue = &s
+		l.store[key] = queue
+	}
+	for len(*queue) > 0 && now-(*queue)[0].at >= duration {
+		*queue = (*queue)[1:]
+	}
+	*queue = append(*queue, windowAmount{at: now, amount: amount})
+}
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error body shapes of the client SDKs served by the relay.
+const (
+	RelayErrorFormatOpenAI    = "openai"
+	RelayErrorFormatAnthropic = "anthropic"
+	RelayErrorFormatGemini    = "gemini"
+)
+
+// RelayError is a catalog entry for an error the gateway generates itself.
+// Type and Code are the OpenAI error fields; the Anthropic error type and the
+// Gemini status are derived from Status.
+type RelayError struct {
+	Status int
+	Type   string
+	Code   string
+}
+
+// Relay error catalog.
+var (
+	RelayErrInvalidAPIKey     = RelayError{Status: http.StatusUnauthorized, Type: "authentication_error", Code: "invalid_api_key"}
+	RelayErrIPNotAllowed      = RelayError{Status: http.StatusForbidden, Type: "permission_error", Code: "ip_not_allowed"}
+	RelayErrModelNotAllowed   = RelayError{Status: http.StatusForbidden, Type: "permission_error", Code: "model_not_allowed"}
+	RelayErrModelNotFound     = RelayError{Status: http.StatusNotFound, Type: "invalid_request_error", Code: "model_not_found"}
+	RelayErrInsufficientQuota = RelayError{Status: http.StatusTooManyRequests, Type: "insufficient_quota", Code: "insufficient_quota"}
+	RelayErrRateLimited       = RelayError{Status: http.StatusTooManyRequests, Type: "rate_limit_error", Code: "rate_limit_exceeded"}
+	RelayErrConcurrencyLimit  = RelayError{Status: http.StatusTooManyRequests, Type: "rate_limit_error", Code: "concurrency_limit_exceeded"}
+	RelayErrInvalidRequest    = RelayError{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "invalid_request"}
+	RelayErrNoRoute           = RelayError{Status: http.StatusServiceUnavailable, Type: "server_error", Code: "service_unavailable"}
+	RelayErrRetryLimit        = RelayError{Status: http.StatusServiceUnavailable, Type: "server_error", Code: "retry_limit_exceeded"}
+	RelayErrDeadlineExceeded  = RelayError{Status: http.StatusGatewayTimeout, Type: "server_error", Code: "deadline_exceeded"}
+	RelayErrUpstreamFailed    = RelayError{Status: http.StatusBadGateway, Type: "server_error", Code: "upstream_request_failed"}
+	RelayErrInternal          = RelayError{Status: http.StatusInternalServerError, Type: "server_error", Code: "internal_error"}
+)
+
+// WithStatus returns the entry with another HTTP status.
+func (e RelayError) WithStatus(status int) RelayError {
+	e.Status = status
+	return e
+}
+
+// Body renders the error in the given format.
+func (e RelayError) Body(format string, message string) map[string]any {
+	if format == RelayErrorFormatAnthropic || format == RelayErrorFormatGemini {
+		return RenderRelayErrorBody(format, e.Status, "", "", message)
+	}
+	return RenderRelayErrorBody(format, e.Status, e.Type, e.Code, message)
+}
+
+// RenderRelayErrorBody builds an error body in the shape of the format:
+// Anthropic {"type":"error","error":{"type","message"}}, Gemini
+// {"error":{"code","message","status"}} or OpenAI {"error":{"message","type","code"}}.
+// The Anthropic type and Gemini status fall back to the ones of the status
+// when errorType or code is not native to the format.
+func RenderRelayErrorBody(format string, status int, errorType string, code string, message string) map[string]any {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	switch format {
+	case RelayErrorFormatAnthropic:
+		if !anthropicErrorTypes[errorType] {
+			errorType = AnthropicErrorType(status)
+		}
+		return map[string]any{"type": "error", "error": map[string]any{"type": errorType, "message": message}}
+	case RelayErrorFormatGemini:
+		if !isGeminiErrorStatus(code) {
+			code = GeminiErrorStatus(status)
+		}
+		return map[string]any{"error": map[string]any{"code": status, "message": message, "status": code}}
+	default:
+		if errorType == "" {
+			errorType = "upstream_error"
+		}
+		return map[string]any{"error": map[string]any{"message": message, "type": errorType, "code": code}}
+	}
+}
+
+var anthropicErrorTypes = map[string]bool{
+	"invalid_request_error": true,
+	"authentication_error":  true,
+	"permission_error":      true,
+	"not_found_error":       true,
+	"request_too_large":     true,
+	"rate_limit_error":      true,
+	"api_error":             true,
+	"overloaded_error":      true,
+}
+
+// AnthropicErrorType returns the Anthropic error type of an HTTP status.
+func AnthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	}
+	if status >= 400 && status < 500 {
+		return "invalid_request_error"
+	}
+	return "api_error"
+}
+
+// GeminiErrorStatus returns the Google RPC status name of an HTTP status.
+func GeminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "ABORTED"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case 499:
+		return "CANCELLED"
+	case http.StatusNotImplemented:
+		return "UNIMPLEMENTED"
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	}
+	if status >= 400 && status < 500 {
+		return "FAILED_PRECONDITION"
+	}
+	return "INTERNAL"
+}
+
+func isGeminiErrorStatus(code string) bool {
+	if code == "" {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// RelayErrorFormatOf returns the error shape expected by the caller's SDK:
+// Anthropic for /v1/messages, Gemini for /v1beta paths and OpenAI otherwise.
+func RelayErrorFormatOf(c *gin.Context) string {
+	path := c.Request.URL.Path
+	switch {
+	case path == "/v1/messages" || strings.HasPrefix(path, "/v1/messages/"):
+		return RelayErrorFormatAnthropic
+	case strings.HasPrefix(path, "/v1beta/"):
+		return RelayErrorFormatGemini
+	}
+	return RelayErrorFormatOpenAI
+}
+
+// WriteRelayError writes a catalog error in the caller's protocol.
+func WriteRelayError(c *gin.Context, e RelayError, message string) {
+	c.JSON(e.Status, e.Body(RelayErrorFormatOf(c), message))
+}
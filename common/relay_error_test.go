@@ -0,0 +1,46 @@
+package common
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRelayErrorBodyPerProtocol(t *testing.T) {
+	openAI := RelayErrNoRoute.Body(RelayErrorFormatOpenAI, "no available provider for model: gpt-4o")
+	wantOpenAI := map[string]any{"error": map[string]any{"message": "no available provider for model: gpt-4o", "type": "server_error", "code": "service_unavailable"}}
+	if !reflect.DeepEqual(openAI, wantOpenAI) {
+		t.Fatalf("unexpected OpenAI body: %v", openAI)
+	}
+
+	anthropic := RelayErrModelNotFound.Body(RelayErrorFormatAnthropic, "model not found: x")
+	wantAnthropic := map[string]any{"type": "error", "error": map[string]any{"type": "not_found_error", "message": "model not found: x"}}
+	if !reflect.DeepEqual(anthropic, wantAnthropic) {
+		t.Fatalf("unexpected Anthropic body: %v", anthropic)
+	}
+
+	gemini := RelayErrInsufficientQuota.Body(RelayErrorFormatGemini, "daily budget exceeded")
+	wantGemini := map[string]any{"error": map[string]any{"code": http.StatusTooManyRequests, "message": "daily budget exceeded", "status": "RESOURCE_EXHAUSTED"}}
+	if !reflect.DeepEqual(gemini, wantGemini) {
+		t.Fatalf("unexpected Gemini body: %v", gemini)
+	}
+}
+
+func TestRenderRelayErrorBodyKeepsNativeUpstreamFields(t *testing.T) {
+	body := RenderRelayErrorBody(RelayErrorFormatAnthropic, http.StatusBadRequest, "new_api_error", "", "bad")
+	if got := body["error"].(map[string]any)["type"]; got != "invalid_request_error" {
+		t.Fatalf("expected non-Anthropic type mapped from status, got %v", got)
+	}
+	body = RenderRelayErrorBody(RelayErrorFormatAnthropic, 529, "overloaded_error", "", "busy")
+	if got := body["error"].(map[string]any)["type"]; got != "overloaded_error" {
+		t.Fatalf("expected native Anthropic type kept, got %v", got)
+	}
+	body = RenderRelayErrorBody(RelayErrorFormatGemini, http.StatusBadRequest, "", "FAILED_PRECONDITION", "bad")
+	if got := body["error"].(map[string]any)["status"]; got != "FAILED_PRECONDITION" {
+		t.Fatalf("expected native Gemini status kept, got %v", got)
+	}
+	body = RenderRelayErrorBody(RelayErrorFormatGemini, http.StatusGatewayTimeout, "", "deadline_exceeded", "slow")
+	if got := body["error"].(map[string]any)["status"]; got != "DEADLINE_EXCEEDED" {
+		t.Fatalf("expected Gemini status mapped from 504, got %v", got)
+	}
+}
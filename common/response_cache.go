@@ -0,0 +1,218 @@
+package common
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ResponseCacheConfig controls the exact-match cache for non-streaming
+// completions and embeddings. Caching is opt-in per aggregated token or per
+// model; these options only bound what is stored.
+type ResponseCacheConfig struct {
+	// Models lists models cached for every token. Matching is case-insensitive
+	// and also accepts normalized model names.
+	Models        []string
+	TTL           time.Duration
+	MaxEntryBytes int
+	// MaxEntries caps the in-memory store; Redis relies on TTL and its own
+	// eviction policy.
+	MaxEntries int
+}
+
+const (
+	responseCacheModelsOptionKey        = "ResponseCacheModels"
+	responseCacheTTLOptionKey           = "ResponseCacheTTLSeconds"
+	responseCacheMaxEntryBytesOptionKey = "ResponseCacheMaxEntryBytes"
+	responseCacheMaxEntriesOptionKey    = "ResponseCacheMaxEntries"
+)
+
+func LoadResponseCacheConfig() ResponseCacheConfig {
+	defaultCfg := ResponseCacheConfig{
+		TTL:           time.Hour,
+		MaxEntryBytes: 1024 * 1024,
+		MaxEntries:    1000,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Models = splitOptionList(OptionMap[responseCacheModelsOptionKey])
+	ttlSeconds := parseOptionIntInRange(OptionMap[responseCacheTTLOptionKey], int(defaultCfg.TTL/time.Second), 1, 7*24*3600)
+	out.TTL = time.Duration(ttlSeconds) * time.Second
+	out.MaxEntryBytes = parseOptionIntInRange(OptionMap[responseCacheMaxEntryBytesOptionKey], defaultCfg.MaxEntryBytes, 1024, 16*1024*1024)
+	out.MaxEntries = parseOptionIntInRange(OptionMap[responseCacheMaxEntriesOptionKey], defaultCfg.MaxEntries, 1, 100000)
+	return out
+}
+
+// ModelEnabled reports whether modelName is cached for every token.
+func (cfg ResponseCacheConfig) ModelEnabled(modelName string) bool {
+	return modelListContains(cfg.Models, modelName)
+}
+
+// ResponseCacheEntry is a cached upstream response as written to the client,
+// together with the usage needed to log a hit.
+type ResponseCacheEntry struct {
+	StatusCode       int     `json:"status_code"`
+	ContentType      string  `json:"content_type"`
+	Body             []byte  `json:"body"`
+	ModelName        string  `json:"model_name"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	CreatedAt        int64   `json:"created_at"`
+}
+
+// ResponseCacheStore holds cached responses keyed by request fingerprint.
+type ResponseCacheStore interface {
+	Get(key string) (*ResponseCacheEntry, bool, error)
+	Set(key string, entry *ResponseCacheEntry, ttl time.Duration, maxEntries int) error
+}
+
+const (
+	ResponseCacheStoreMemory = "memory"
+	ResponseCacheStoreRedis  = "redis"
+)
+
+var (
+	responseCacheStoreMu sync.RWMutex
+	responseCacheStore   ResponseCacheStore = NewMemoryResponseCacheStore()
+)
+
+// InitResponseCacheStore selects the backend named by RESPONSE_CACHE_STORE.
+// It must be called after InitRedisClient.
+func InitResponseCacheStore() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("RESPONSE_CACHE_STORE")))
+	switch backend {
+	case "", ResponseCacheStoreMemory:
+		return nil
+	case ResponseCacheStoreRedis:
+		if !RedisEnabled || RDB == nil {
+			return fmt.Errorf("RESPONSE_CACHE_STORE=redis requires REDIS_CONN_STRING")
+		}
+		SetResponseCacheStore(NewRedisResponseCacheStore(RDB))
+		SysLog("response cache is shared via Redis")
+		return nil
+	default:
+		return fmt.Errorf("unsupported RESPONSE_CACHE_STORE: %s (supported: memory, redis)", backend)
+	}
+}
+
+func SetResponseCacheStore(store ResponseCacheStore) {
+	responseCacheStoreMu.Lock()
+	defer responseCacheStoreMu.Unlock()
+	responseCacheStore = store
+}
+
+func GetResponseCacheStore() ResponseCacheStore {
+	responseCacheStoreMu.RLock()
+	defer responseCacheStoreMu.RUnlock()
+	return responseCacheStore
+}
+
+// MemoryResponseCacheStore is a process-local LRU with per-entry expiry.
+type MemoryResponseCacheStore struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryResponseCacheItem struct {
+	key       string
+	entry     ResponseCacheEntry
+	expiresAt time.Time
+}
+
+func NewMemoryResponseCacheStore() *MemoryResponseCacheStore {
+	return &MemoryResponseCacheStore{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryResponseCacheStore) Get(key string) (*ResponseCacheEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := element.Value.(*memoryResponseCacheItem)
+	if time.Now().After(item.expiresAt) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	entry := item.entry
+	return &entry, true, nil
+}
+
+func (s *MemoryResponseCacheStore) Set(key string, entry *ResponseCacheEntry, ttl time.Duration, maxEntries int) error {
+	if entry == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := &memoryResponseCacheItem{key: key, entry: *entry, expiresAt: time.Now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = item
+		s.order.MoveToFront(element)
+	} else {
+		s.entries[key] = s.order.PushFront(item)
+	}
+	for maxEntries > 0 && s.order.Len() > maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryResponseCacheItem).key)
+	}
+	return nil
+}
+
+// RedisResponseCacheStore shares cached responses across gateway replicas.
+type RedisResponseCacheStore struct {
+	client *redis.Client
+}
+
+func NewRedisResponseCacheStore(client *redis.Client) *RedisResponseCacheStore {
+	return &RedisResponseCacheStore{client: client}
+}
+
+const redisResponseCacheKeyPrefix = "responseCache:"
+
+func (s *RedisResponseCacheStore) Get(key string) (*ResponseCacheEntry, bool, error) {
+	raw, err := s.client.Get(context.Background(), redisResponseCacheKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var entry ResponseCacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false, err
+	}
+	return &entry, true, nil
+}
+
+func (s *RedisResponseCacheStore) Set(key string, entry *ResponseCacheEntry, ttl time.Duration, _ int) error {
+	if entry == nil {
+		return nil
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(context.Background(), redisResponseCacheKeyPrefix+key, raw, ttl).Err()
+}
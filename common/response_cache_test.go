@@ -0,0 +1,41 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryResponseCacheStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewMemoryResponseCacheStore()
+	for _, key := range []string{"a", "b"} {
+		if err := store.Set(key, &ResponseCacheEntry{Body: []byte(key)}, time.Minute, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := store.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	_ = store.Set("c", &ResponseCacheEntry{Body: []byte("c")}, time.Minute, 2)
+
+	if _, ok, _ := store.Get("b"); ok {
+		t.Fatal("expected least recently used entry b to be evicted")
+	}
+	if entry, ok, _ := store.Get("a"); !ok || string(entry.Body) != "a" {
+		t.Fatalf("expected a to survive eviction, got %v %v", entry, ok)
+	}
+
+	_ = store.Set("short", &ResponseCacheEntry{}, -time.Second, 10)
+	if _, ok, _ := store.Get("short"); ok {
+		t.Fatal("expected expired entry to be dropped")
+	}
+}
+
+func TestResponseCacheConfigModelEnabled(t *testing.T) {
+	cfg := ResponseCacheConfig{Models: []string{"GPT-4o", "text-embedding-3-small"}}
+	if !cfg.ModelEnabled("gpt-4o") || !cfg.ModelEnabled("text-embedding-3-small") {
+		t.Fatal("expected listed models to be enabled case-insensitively")
+	}
+	if cfg.ModelEnabled("gpt-4") || cfg.ModelEnabled("") {
+		t.Fatal("expected unlisted models to be disabled")
+	}
+}
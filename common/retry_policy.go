@@ -0,0 +1,255 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry rules for an upstream status code.
+const (
+	// RetryRuleRetry tries the next route even when the error would
+	// otherwise be returned to the client.
+	RetryRuleRetry = "retry"
+	// RetryRuleNever returns the error to the client without retrying.
+	RetryRuleNever = "never"
+	// RetryRuleOtherProvider retries only on routes of other providers.
+	RetryRuleOtherProvider = "other_provider"
+)
+
+const (
+	retryMaxAttemptsOptionKey     = "RetryMaxAttempts"
+	retryDeadlineSecondsOptionKey = "RetryDeadlineSeconds"
+	retryBackoffMsOptionKey       = "RetryBackoffMs"
+	retryBackoffMaxMsOptionKey    = "RetryBackoffMaxMs"
+	retryStatusRulesOptionKey     = "RetryStatusRules"
+	retryModelPoliciesOptionKey   = "RetryModelPolicies"
+
+	retryMaxAttemptsLimit     = 100
+	retryDeadlineSecondsLimit = 3600
+	retryBackoffMsLimit       = 60000
+)
+
+// RetryPolicy bounds how a relay request walks its routes.
+type RetryPolicy struct {
+	// MaxAttempts caps upstream attempts across routes and fallback models;
+	// 0 is unlimited. Attempts rejected locally by cooldown or concurrency
+	// limits are not counted.
+	MaxAttempts int
+	// Deadline is the wall-clock budget of the request: no new attempt starts
+	// after it and the running attempt is cut off, a stream only until its
+	// first byte. 0 is unlimited.
+	Deadline time.Duration
+	// Backoff is the wait before the second upstream attempt, doubled for
+	// each further attempt up to BackoffMax; 0 retries immediately.
+	Backoff    time.Duration
+	BackoffMax time.Duration
+	// StatusRules maps a status code ("429") or class ("5xx") to a RetryRule*.
+	StatusRules map[string]string
+}
+
+// RetryPolicyOverride is a partial policy for a model or an aggregated token;
+// unset fields keep the inherited value and status rules are merged by key.
+type RetryPolicyOverride struct {
+	MaxAttempts     *int              `json:"max_attempts,omitempty"`
+	DeadlineSeconds *int              `json:"deadline_seconds,omitempty"`
+	BackoffMs       *int              `json:"backoff_ms,omitempty"`
+	BackoffMaxMs    *int              `json:"backoff_max_ms,omitempty"`
+	StatusRules     map[string]string `json:"status_rules,omitempty"`
+}
+
+// ParseRetryStatusRules validates a JSON object such as
+// {"400":"never","429":"other_provider","5xx":"retry"}.
+func ParseRetryStatusRules(raw string) (map[string]string, error) {
+	out := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return out, nil
+	}
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("重试状态码规则必须是 JSON 对象：%v", err)
+	}
+	return normalizeRetryStatusRules(parsed)
+}
+
+func normalizeRetryStatusRules(rules map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(rules))
+	for key, rule := range rules {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !isRetryStatusKey(key) {
+			return nil, fmt.Errorf("无效的状态码 %s，应为 400 ~ 599 的状态码或 4xx/5xx", key)
+		}
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch rule {
+		case RetryRuleRetry, RetryRuleNever, RetryRuleOtherProvider:
+		default:
+			return nil, fmt.Errorf("状态码 %s 的规则只能为 retry、never 或 other_provider", key)
+		}
+		out[key] = rule
+	}
+	return out, nil
+}
+
+func isRetryStatusKey(key string) bool {
+	if key == "4xx" || key == "5xx" {
+		return true
+	}
+	code, err := strconv.Atoi(key)
+	return err == nil && code >= 400 && code <= 599
+}
+
+// ParseRetryPolicyOverride validates a partial retry policy JSON object.
+func ParseRetryPolicyOverride(raw string) (*RetryPolicyOverride, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var override RetryPolicyOverride
+	if err := json.Unmarshal([]byte(raw), &override); err != nil {
+		return nil, fmt.Errorf("重试策略必须是 JSON 对象：%v", err)
+	}
+	if err := override.validate(); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+func (o *RetryPolicyOverride) validate() error {
+	if o.MaxAttempts != nil && (*o.MaxAttempts < 0 || *o.MaxAttempts > retryMaxAttemptsLimit) {
+		return fmt.Errorf("最大尝试次数必须在 0 到 %d 之间", retryMaxAttemptsLimit)
+	}
+	if o.DeadlineSeconds != nil && (*o.DeadlineSeconds < 0 || *o.DeadlineSeconds > retryDeadlineSecondsLimit) {
+		return fmt.Errorf("总时限必须在 0 到 %d 秒之间", retryDeadlineSecondsLimit)
+	}
+	if o.BackoffMs != nil && (*o.BackoffMs < 0 || *o.BackoffMs > retryBackoffMsLimit) {
+		return fmt.Errorf("重试间隔必须在 0 到 %d 毫秒之间", retryBackoffMsLimit)
+	}
+	if o.BackoffMaxMs != nil && (*o.BackoffMaxMs < 0 || *o.BackoffMaxMs > retryBackoffMsLimit) {
+		return fmt.Errorf("最大重试间隔必须在 0 到 %d 毫秒之间", retryBackoffMsLimit)
+	}
+	rules, err := normalizeRetryStatusRules(o.StatusRules)
+	if err != nil {
+		return err
+	}
+	o.StatusRules = rules
+	return nil
+}
+
+// ParseRetryModelPolicies validates the RetryModelPolicies option, a JSON
+// object mapping model names to partial policies.
+func ParseRetryModelPolicies(raw string) (map[string]RetryPolicyOverride, error) {
+	out := make(map[string]RetryPolicyOverride)
+	if strings.TrimSpace(raw) == "" {
+		return out, nil
+	}
+	var parsed map[string]RetryPolicyOverride
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("模型重试策略必须是 JSON 对象：%v", err)
+	}
+	for name, override := range parsed {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("模型名称不能为空")
+		}
+		if err := override.validate(); err != nil {
+			return nil, fmt.Errorf("模型 %s：%v", name, err)
+		}
+		out[name] = override
+	}
+	return out, nil
+}
+
+// LoadRetryPolicy returns the retry policy of a request for modelName: the
+// global options, overridden by the RetryModelPolicies entry of the model,
+// overridden by the token's own policy.
+func LoadRetryPolicy(modelName string, tokenOverride *RetryPolicyOverride) RetryPolicy {
+	policy := RetryPolicy{
+		BackoffMax:  5 * time.Second,
+		StatusRules: map[string]string{},
+	}
+
+	OptionMapRWMutex.RLock()
+	modelPoliciesRaw := ""
+	if OptionMap != nil {
+		policy.MaxAttempts = parseOptionIntInRange(OptionMap[retryMaxAttemptsOptionKey], 0, 0, retryMaxAttemptsLimit)
+		policy.Deadline = time.Duration(parseOptionIntInRange(OptionMap[retryDeadlineSecondsOptionKey], 0, 0, retryDeadlineSecondsLimit)) * time.Second
+		policy.Backoff = time.Duration(parseOptionIntInRange(OptionMap[retryBackoffMsOptionKey], 0, 0, retryBackoffMsLimit)) * time.Millisecond
+		policy.BackoffMax = time.Duration(parseOptionIntInRange(OptionMap[retryBackoffMaxMsOptionKey], int(policy.BackoffMax/time.Millisecond), 0, retryBackoffMsLimit)) * time.Millisecond
+		if rules, err := ParseRetryStatusRules(OptionMap[retryStatusRulesOptionKey]); err == nil {
+			policy.StatusRules = rules
+		}
+		modelPoliciesRaw = OptionMap[retryModelPoliciesOptionKey]
+	}
+	OptionMapRWMutex.RUnlock()
+
+	if modelPolicies, err := ParseRetryModelPolicies(modelPoliciesRaw); err == nil {
+		if override, ok := modelPolicies[modelName]; ok {
+			policy.apply(override)
+		} else {
+			for name, override := range modelPolicies {
+				if modelListContains([]string{name}, modelName) {
+					policy.apply(override)
+					break
+				}
+			}
+		}
+	}
+	if tokenOverride != nil {
+		policy.apply(*tokenOverride)
+	}
+	return policy
+}
+
+func (p *RetryPolicy) apply(override RetryPolicyOverride) {
+	if override.MaxAttempts != nil {
+		p.MaxAttempts = *override.MaxAttempts
+	}
+	if override.DeadlineSeconds != nil {
+		p.Deadline = time.Duration(*override.DeadlineSeconds) * time.Second
+	}
+	if override.BackoffMs != nil {
+		p.Backoff = time.Duration(*override.BackoffMs) * time.Millisecond
+	}
+	if override.BackoffMaxMs != nil {
+		p.BackoffMax = time.Duration(*override.BackoffMaxMs) * time.Millisecond
+	}
+	if len(override.StatusRules) > 0 {
+		merged := make(map[string]string, len(p.StatusRules)+len(override.StatusRules))
+		for key, rule := range p.StatusRules {
+			merged[key] = rule
+		}
+		for key, rule := range override.StatusRules {
+			merged[key] = rule
+		}
+		p.StatusRules = merged
+	}
+}
+
+// RuleFor returns the rule of an upstream status code, preferring the exact
+// code over its class, or "" when no rule applies.
+func (p RetryPolicy) RuleFor(statusCode int) string {
+	if statusCode < 400 || statusCode > 599 {
+		return ""
+	}
+	if rule, ok := p.StatusRules[strconv.Itoa(statusCode)]; ok {
+		return rule
+	}
+	return p.StatusRules[strconv.Itoa(statusCode/100)+"xx"]
+}
+
+// BackoffBefore returns the wait before the upstream attempt that follows
+// failedAttempts failed ones.
+func (p RetryPolicy) BackoffBefore(failedAttempts int) time.Duration {
+	if p.Backoff <= 0 || failedAttempts <= 0 {
+		return 0
+	}
+	delay := p.Backoff
+	for i := 1; i < failedAttempts && delay < p.BackoffMax; i++ {
+		delay *= 2
+	}
+	if p.BackoffMax > 0 && delay > p.BackoffMax {
+		delay = p.BackoffMax
+	}
+	return delay
+}
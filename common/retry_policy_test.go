@@ -0,0 +1,69 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadRetryPolicyMergesModelAndTokenOverrides(t *testing.T) {
+	OptionMapRWMutex.Lock()
+	previous := OptionMap
+	OptionMap = map[string]string{
+		retryMaxAttemptsOptionKey:   "5",
+		retryBackoffMsOptionKey:     "100",
+		retryStatusRulesOptionKey:   `{"400":"never","5xx":"retry"}`,
+		retryModelPoliciesOptionKey: `{"gpt-4o":{"max_attempts":3,"deadline_seconds":30,"status_rules":{"429":"other_provider"}}}`,
+	}
+	OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		OptionMapRWMutex.Lock()
+		OptionMap = previous
+		OptionMapRWMutex.Unlock()
+	})
+
+	policy := LoadRetryPolicy("claude-sonnet-4", nil)
+	if policy.MaxAttempts != 5 || policy.Deadline != 0 || policy.Backoff != 100*time.Millisecond || policy.BackoffMax != 5*time.Second {
+		t.Fatalf("unexpected global policy: %+v", policy)
+	}
+
+	override, err := ParseRetryPolicyOverride(`{"max_attempts":2,"status_rules":{"5XX":"never"}}`)
+	if err != nil {
+		t.Fatalf("ParseRetryPolicyOverride() error = %v", err)
+	}
+	policy = LoadRetryPolicy("gpt-4o", override)
+	if policy.MaxAttempts != 2 || policy.Deadline != 30*time.Second {
+		t.Fatalf("expected token over model over global, got %+v", policy)
+	}
+	for status, want := range map[int]string{400: RetryRuleNever, 413: "", 429: RetryRuleOtherProvider, 503: RetryRuleNever, 200: ""} {
+		if got := policy.RuleFor(status); got != want {
+			t.Fatalf("RuleFor(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestParseRetryPolicyOverrideRejectsInvalidRules(t *testing.T) {
+	for _, raw := range []string{
+		`{"max_attempts":-1}`,
+		`{"deadline_seconds":7200}`,
+		`{"status_rules":{"200":"retry"}}`,
+		`{"status_rules":{"429":"later"}}`,
+		`[1,2]`,
+	} {
+		if _, err := ParseRetryPolicyOverride(raw); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+	if override, err := ParseRetryPolicyOverride("  "); err != nil || override != nil {
+		t.Fatalf("expected empty override to inherit, got %+v err=%v", override, err)
+	}
+}
+
+func TestRetryPolicyBackoffBeforeDoublesUpToMax(t *testing.T) {
+	policy := RetryPolicy{Backoff: 200 * time.Millisecond, BackoffMax: time.Second}
+	want := []time.Duration{0, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for failed, expected := range want {
+		if got := policy.BackoffBefore(failed); got != expected {
+			t.Fatalf("BackoffBefore(%d) = %s, want %s", failed, got, expected)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package common
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RouteAffinityConfig controls session affinity: consecutive turns of a
+// conversation prefer the route that served the previous turn, so upstream
+// prompt caches are reused.
+type RouteAffinityConfig struct {
+	Enabled bool
+	TTL     time.Duration
+	// Header names the client header carrying an explicit session id.
+	Header string
+}
+
+const (
+	routeAffinityEnabledOptionKey    = "RouteAffinityEnabled"
+	routeAffinityTTLSecondsOptionKey = "RouteAffinityTTLSeconds"
+	routeAffinityHeaderOptionKey     = "RouteAffinityHeader"
+
+	DefaultRouteAffinityHeader = "X-Session-Id"
+)
+
+func LoadRouteAffinityConfig() RouteAffinityConfig {
+	defaultCfg := RouteAffinityConfig{
+		TTL:    time.Hour,
+		Header: DefaultRouteAffinityHeader,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Enabled = parseOptionBool(OptionMap[routeAffinityEnabledOptionKey], false)
+	ttlSeconds := parseOptionIntInRange(OptionMap[routeAffinityTTLSecondsOptionKey], int(defaultCfg.TTL/time.Second), 60, 24*3600)
+	out.TTL = time.Duration(ttlSeconds) * time.Second
+	if header, ok := OptionMap[routeAffinityHeaderOptionKey]; ok {
+		out.Header = strings.TrimSpace(header)
+	}
+	return out
+}
+
+// RouteAffinityPin is the route that served the last turn of a session.
+type RouteAffinityPin struct {
+	ProviderTokenId int    `json:"provider_token_id"`
+	ModelName       string `json:"model_name"`
+}
+
+// RouteAffinityStore maps session keys to pinned routes with expiry.
+type RouteAffinityStore interface {
+	Get(key string) (*RouteAffinityPin, bool, error)
+	Set(key string, pin RouteAffinityPin, ttl time.Duration) error
+}
+
+const (
+	RouteAffinityStoreMemory = "memory"
+	RouteAffinityStoreRedis  = "redis"
+
+	// routeAffinityMaxMemoryEntries bounds the memory store; the least
+	// recently used sessions are evicted first.
+	routeAffinityMaxMemoryEntries = 100000
+)
+
+var (
+	routeAffinityStoreMu sync.RWMutex
+	routeAffinityStore   RouteAffinityStore = NewMemoryRouteAffinityStore(routeAffinityMaxMemoryEntries)
+)
+
+// InitRouteAffinityStore selects the backend named by ROUTE_AFFINITY_STORE.
+// It must be called after InitRedisClient.
+func InitRouteAffinityStore() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("ROUTE_AFFINITY_STORE")))
+	switch backend {
+	case "", RouteAffinityStoreMemory:
+		return nil
+	case RouteAffinityStoreRedis:
+		if !RedisEnabled || RDB == nil {
+			return fmt.Errorf("ROUTE_AFFINITY_STORE=redis requires REDIS_CONN_STRING")
+		}
+		SetRouteAffinityStore(NewRedisRouteAffinityStore(RDB))
+		SysLog("route affinity is shared via Redis")
+		return nil
+	default:
+		return fmt.Errorf("unsupported ROUTE_AFFINITY_STORE: %s (supported: memory, redis)", backend)
+	}
+}
+
+func SetRouteAffinityStore(store RouteAffinityStore) {
+	routeAffinityStoreMu.Lock()
+	defer routeAffinityStoreMu.Unlock()
+	routeAffinityStore = store
+}
+
+func GetRouteAffinityStore() RouteAffinityStore {
+	routeAffinityStoreMu.RLock()
+	defer routeAffinityStoreMu.RUnlock()
+	return routeAffinityStore
+}
+
+// MemoryRouteAffinityStore is a process-local LRU with per-entry expiry.
+type MemoryRouteAffinityStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type memoryRouteAffinityItem struct {
+	key       string
+	pin       RouteAffinityPin
+	expiresAt time.Time
+}
+
+func NewMemoryRouteAffinityStore(maxEntries int) *MemoryRouteAffinityStore {
+	return &MemoryRouteAffinityStore{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryRouteAffinityStore) Get(key string) (*RouteAffinityPin, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := element.Value.(*memoryRouteAffinityItem)
+	if time.Now().After(item.expiresAt) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	pin := item.pin
+	return &pin, true, nil
+}
+
+func (s *MemoryRouteAffinityStore) Set(key string, pin RouteAffinityPin, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := &memoryRouteAffinityItem{key: key, pin: pin, expiresAt: time.Now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = item
+		s.order.MoveToFront(element)
+	} else {
+		s.entries[key] = s.order.PushFront(item)
+	}
+	for s.maxEntries > 0 && s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryRouteAffinityItem).key)
+	}
+	return nil
+}
+
+// RedisRouteAffinityStore shares session pins across gateway replicas.
+type RedisRouteAffinityStore struct {
+	client *redis.Client
+}
+
+func NewRedisRouteAffinityStore(client *redis.Client) *RedisRouteAffinityStore {
+	return &RedisRouteAffinityStore{client: client}
+}
+
+const redisRouteAffinityKeyPrefix = "routeAffinity:"
+
+func (s *RedisRouteAffinityStore) Get(key string) (*RouteAffinityPin, bool, error) {
+	raw, err := s.client.Get(context.Background(), redisRouteAffinityKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var pin RouteAffinityPin
+	if err := json.Unmarshal(raw, &pin); err != nil {
+		return nil, false, err
+	}
+	return &pin, true, nil
+}
+
+func (s *RedisRouteAffinityStore) Set(key string, pin RouteAffinityPin, ttl time.Duration) error {
+	raw, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(context.Background(), redisRouteAffinityKeyPrefix+key, raw, ttl).Err()
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimit caps the in-flight upstream requests sharing Key.
+// Max <= 0 means unlimited.
+type ConcurrencyLimit struct {
+	Key string
+	Max int
+}
+
+var (
+	ErrConcurrencyQueueFull    = errors.New("concurrency queue is full")
+	ErrConcurrencyQueueTimeout = errors.New("timed out waiting for a free upstream slot")
+)
+
+// ConcurrencyLimiter counts in-flight upstream requests per key. State is per
+// process; every gateway replica enforces the limits on its own traffic.
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	waiting  int
+	// changed is closed and replaced whenever a slot is released.
+	changed chan struct{}
+}
+
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		inFlight: make(map[string]int),
+		changed:  make(chan struct{}),
+	}
+}
+
+var GlobalRouteConcurrency = NewConcurrencyLimiter()
+
+func (l *ConcurrencyLimiter) hasCapacityLocked(limits []ConcurrencyLimit) bool {
+	for _, limit := range limits {
+		if limit.Max > 0 && l.inFlight[limit.Key] >= limit.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// TryAcquire takes one slot of every limit, or none when any is saturated.
+func (l *ConcurrencyLimiter) TryAcquire(limits []ConcurrencyLimit) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.hasCapacityLocked(limits) {
+		return nil, false
+	}
+	for _, limit := range limits {
+		if limit.Max > 0 {
+			l.inFlight[limit.Key]++
+		}
+	}
+	var once sync.Once
+	return func() { once.Do(func() { l.release(limits) }) }, true
+}
+
+func (l *ConcurrencyLimiter) release(limits []ConcurrencyLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, limit := range limits {
+		if limit.Max <= 0 {
+			continue
+		}
+		if l.inFlight[limit.Key] <= 1 {
+			delete(l.inFlight, limit.Key)
+		} else {
+			l.inFlight[limit.Key]--
+		}
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// InFlight returns the number of in-flight requests counted under key.
+func (l *ConcurrencyLimiter) InFlight(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight[key]
+}
+
+// Wait blocks until one of the candidates has a free slot in every limit and
+// returns its index. At most maxWaiting callers wait at the same time. The
+// slot is not reserved: the caller must still TryAcquire and wait again when
+// another request took it first.
+func (l *ConcurrencyLimiter) Wait(ctx context.Context, candidates [][]ConcurrencyLimit, deadline time.Time, maxWaiting int) (int, error) {
+	l.mu.Lock()
+	if index := l.firstAvailableLocked(candidates); index >= 0 {
+		l.mu.Unlock()
+		return index, nil
+	}
+	if l.waiting >= maxWaiting {
+		l.mu.Unlock()
+		return -1, ErrConcurrencyQueueFull
+	}
+	l.waiting++
+	changed := l.changed
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-timer.C:
+			return -1, ErrConcurrencyQueueTimeout
+		case <-changed:
+		}
+		l.mu.Lock()
+		index := l.firstAvailableLocked(candidates)
+		changed = l.changed
+		l.mu.Unlock()
+		if index >= 0 {
+			return index, nil
+		}
+	}
+}
+
+func (l *ConcurrencyLimiter) firstAvailableLocked(candidates [][]ConcurrencyLimit) int {
+	for i, limits := range candidates {
+		if l.hasCapacityLocked(limits) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ConcurrencyQueueConfig bounds how requests wait when every candidate route
+// is at its max-in-flight limit.
+type ConcurrencyQueueConfig struct {
+	// Size is the number of requests allowed to wait; 0 rejects immediately.
+	Size    int
+	Timeout time.Duration
+}
+
+const (
+	concurrencyQueueSizeOptionKey      = "ConcurrencyQueueSize"
+	concurrencyQueueTimeoutMsOptionKey = "ConcurrencyQueueTimeoutMs"
+)
+
+func LoadConcurrencyQueueConfig() ConcurrencyQueueConfig {
+	defaultCfg := ConcurrencyQueueConfig{
+		Size:    100,
+		Timeout: 10 * time.Second,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Size = parseOptionIntInRange(OptionMap[concurrencyQueueSizeOptionKey], defaultCfg.Size, 0, 10000)
+	timeoutMs := parseOptionIntInRange(OptionMap[concurrencyQueueTimeoutMsOptionKey], int(defaultCfg.Timeout/time.Millisecond), 100, 300000)
+	out.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	return out
+}
@@ -0,0 +1,67 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterAcquiresAllLimitsOrNone(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	provider := ConcurrencyLimit{Key: "provider:1", Max: 2}
+	first := []ConcurrencyLimit{provider, {Key: "token:1", Max: 1}}
+	second := []ConcurrencyLimit{provider, {Key: "token:2", Max: 0}}
+
+	releaseFirst, ok := limiter.TryAcquire(first)
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+	if _, ok := limiter.TryAcquire(first); ok {
+		t.Fatal("token limit of 1 should reject a second request")
+	}
+	if got := limiter.InFlight("provider:1"); got != 1 {
+		t.Fatalf("rejected acquire must not count against the provider, in flight = %d", got)
+	}
+	releaseSecond, ok := limiter.TryAcquire(second)
+	if !ok {
+		t.Fatal("unlimited token under a free provider slot should be accepted")
+	}
+	if _, ok := limiter.TryAcquire(second); ok {
+		t.Fatal("provider limit of 2 should reject a third request")
+	}
+	releaseFirst()
+	releaseFirst()
+	if got := limiter.InFlight("provider:1"); got != 1 {
+		t.Fatalf("release must be idempotent, in flight = %d", got)
+	}
+	releaseSecond()
+	if got := limiter.InFlight("provider:1"); got != 0 {
+		t.Fatalf("in flight after release = %d", got)
+	}
+}
+
+func TestConcurrencyLimiterWaitWakesOnReleaseAndIsBounded(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	busy := []ConcurrencyLimit{{Key: "route:1", Max: 1}}
+	release, ok := limiter.TryAcquire(busy)
+	if !ok {
+		t.Fatal("acquire should succeed")
+	}
+
+	if _, err := limiter.Wait(context.Background(), [][]ConcurrencyLimit{busy}, time.Now().Add(time.Second), 0); !errors.Is(err, ErrConcurrencyQueueFull) {
+		t.Fatalf("wait with no queue slots: err = %v", err)
+	}
+	if _, err := limiter.Wait(context.Background(), [][]ConcurrencyLimit{busy}, time.Now().Add(20*time.Millisecond), 1); !errors.Is(err, ErrConcurrencyQueueTimeout) {
+		t.Fatalf("wait past deadline: err = %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	index, err := limiter.Wait(context.Background(), [][]ConcurrencyLimit{busy}, time.Now().Add(time.Second), 1)
+	if err != nil || index != 0 {
+		t.Fatalf("wait after release: index = %d, err = %v", index, err)
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"strconv"
@@ -34,25 +35,11 @@ type routeCooldownKey struct {
 	modelName       string
 }
 
-type routeCooldownState struct {
-	consecutiveFailures int
-	cooldownUntil       time.Time
-	lastFailureTime     time.Time
-
-	halfOpenInFlight int
-}
-
-type tokenCooldownState struct {
-	consecutiveFailures int
-	cooldownUntil       time.Time
-	lastFailureTime     time.Time
-}
-
 type RouteCooldownPermit struct {
-	manager *RouteCooldownManager
-	key     routeCooldownKey
+	manager  *RouteCooldownManager
+	key      routeCooldownKey
 	halfOpen bool
-	released bool
+	once     sync.Once
 }
 
 func (p *RouteCooldownPermit) Release() {
@@ -63,17 +50,18 @@ func (p *RouteCooldownPermit) Release() {
 }
 
 type RouteCooldownManager struct {
-	mu sync.Mutex
-
-	routeStates map[routeCooldownKey]*routeCooldownState
-	tokenStates map[int]*tokenCooldownState
-	unsupported map[routeCooldownKey]time.Time
+	storeMu sync.RWMutex
+	store   RouteCooldownStore
 
 	configProvider func() RouteCooldownConfig
 	now            func() time.Time
 	randFloat64    func() float64
 }
 
+// cooldownRecordRetention bounds how long failure counters are kept when
+// decay is disabled.
+const cooldownRecordRetention = 24 * time.Hour
+
 var GlobalRouteCooldown = NewRouteCooldownManager(LoadRouteCooldownConfig)
 
 func NewRouteCooldownManager(configProvider func() RouteCooldownConfig) *RouteCooldownManager {
@@ -91,13 +79,77 @@ func newRouteCooldownManager(configProvider func() RouteCooldownConfig, nowFn fu
 		randFn = rand.Float64
 	}
 	return &RouteCooldownManager{
-		routeStates:     make(map[routeCooldownKey]*routeCooldownState),
-		tokenStates:     make(map[int]*tokenCooldownState),
-		unsupported:     make(map[routeCooldownKey]time.Time),
-		configProvider:  configProvider,
-		now:             nowFn,
-		randFloat64:     randFn,
+		store:          NewMemoryRouteCooldownStore(),
+		configProvider: configProvider,
+		now:            nowFn,
+		randFloat64:    randFn,
+	}
+}
+
+// SetStore replaces the backend holding cooldown state. Passing nil restores
+// a fresh in-memory store.
+func (m *RouteCooldownManager) SetStore(store RouteCooldownStore) {
+	if store == nil {
+		store = NewMemoryRouteCooldownStore()
+	}
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	m.store = store
+}
+
+func (m *RouteCooldownManager) currentStore() RouteCooldownStore {
+	m.storeMu.RLock()
+	defer m.storeMu.RUnlock()
+	return m.store
+}
+
+// reportStoreError logs backend failures. Callers fail open so that a broken
+// store never takes every route offline.
+func reportStoreError(op string, err error) bool {
+	if err == nil {
+		return false
+	}
+	SysError(fmt.Sprintf("[route-cooldown] %s failed: %v", op, err))
+	return true
+}
+
+type routeCooldownVerdict struct {
+	reason    string // "", "unsupported", "token", "route"
+	remaining time.Duration
+	halfOpen  bool
+}
+
+// inspectEntry applies decay to a loaded entry and reports what blocks the
+// route. It never writes: stale records are left to expire through their TTL,
+// since another replica may have updated them after this read.
+func (m *RouteCooldownManager) inspectEntry(entry RouteCooldownEntry, now time.Time, cfg RouteCooldownConfig) routeCooldownVerdict {
+	if !entry.UnsupportedUntil.IsZero() && now.Before(entry.UnsupportedUntil) {
+		return routeCooldownVerdict{reason: "unsupported", remaining: entry.UnsupportedUntil.Sub(now)}
+	}
+
+	if state := entry.Token; state != nil {
+		applyCooldownDecay(state, now, cfg)
+		if now.Before(state.CooldownUntil) {
+			return routeCooldownVerdict{reason: "token", remaining: state.CooldownUntil.Sub(now)}
+		}
+	}
+
+	if state := entry.Route; state != nil {
+		applyCooldownDecay(state, now, cfg)
+		if now.Before(state.CooldownUntil) {
+			return routeCooldownVerdict{reason: "route", remaining: state.CooldownUntil.Sub(now)}
+		}
+
+		// At this point, cooldown has already expired (now >= cooldownUntil).
+		// Half-open gating applies only after a real cooldown was triggered:
+		// when consecutiveFailures < MinConsecutiveFailures, we intentionally set cooldownUntil == lastFailureTime
+		// to avoid treating the route as half-open yet.
+		if state.ConsecutiveFailures > 0 && state.CooldownUntil.After(state.LastFailureTime) {
+			return routeCooldownVerdict{halfOpen: true}
+		}
 	}
+
+	return routeCooldownVerdict{}
 }
 
 func (m *RouteCooldownManager) IsRouteSelectable(providerTokenId int, modelName string) bool {
@@ -113,24 +165,12 @@ func (m *RouteCooldownManager) IsRouteSelectable(providerTokenId int, modelName
 		return true
 	}
 
-	now := m.now()
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if m.isUnsupportedLocked(key, now) {
-		return false
-	}
-
-	if m.isTokenInCooldownLocked(providerTokenId, now, cfg) {
-		return false
-	}
-
-	if m.isRouteInCooldownLocked(key, now, cfg) {
-		return false
+	store := m.currentStore()
+	entry, err := store.Load(key.providerTokenId, key.modelName)
+	if reportStoreError("load", err) {
+		return true
 	}
-
-	return true
+	return m.inspectEntry(entry, m.now(), cfg).reason == ""
 }
 
 func (m *RouteCooldownManager) TryAcquireRouteAttempt(providerTokenId int, modelName string) (*RouteCooldownPermit, time.Duration, bool) {
@@ -146,84 +186,45 @@ func (m *RouteCooldownManager) TryAcquireRouteAttempt(providerTokenId int, model
 		return &RouteCooldownPermit{}, 0, true
 	}
 
-	now := m.now()
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if until, ok := m.unsupported[key]; ok {
-		if !now.Before(until) {
-			delete(m.unsupported, key)
-		} else {
-			return nil, until.Sub(now), false
-		}
+	store := m.currentStore()
+	entry, err := store.Load(key.providerTokenId, key.modelName)
+	if reportStoreError("load", err) {
+		return &RouteCooldownPermit{manager: m, key: key}, 0, true
 	}
-
-	if state, ok := m.tokenStates[providerTokenId]; ok {
-		m.applyTokenDecayLocked(state, now, cfg)
-		if now.Before(state.cooldownUntil) {
-			return nil, state.cooldownUntil.Sub(now), false
-		}
-		if state.consecutiveFailures <= 0 && !now.Before(state.cooldownUntil) {
-			delete(m.tokenStates, providerTokenId)
-		}
+	verdict := m.inspectEntry(entry, m.now(), cfg)
+	if verdict.reason != "" {
+		observeRouteCooldownEvent("rejected_" + verdict.reason)
+		return nil, verdict.remaining, false
 	}
-
-	routeState, ok := m.routeStates[key]
-	if ok {
-		m.applyRouteDecayLocked(routeState, now, cfg)
-		if now.Before(routeState.cooldownUntil) {
-			return nil, routeState.cooldownUntil.Sub(now), false
-		}
-
-		// At this point, cooldown has already expired (now >= cooldownUntil).
-		// Half-open gating applies only after a real cooldown was triggered:
-		// when consecutiveFailures < MinConsecutiveFailures, we intentionally set cooldownUntil == lastFailureTime
-		// to avoid treating the route as half-open yet.
-		halfOpen := routeState.consecutiveFailures > 0 && routeState.cooldownUntil.After(routeState.lastFailureTime)
-
-		if halfOpen {
-			limit := cfg.HalfOpenMaxInFlight
-			if limit <= 0 {
-				limit = 1
-			}
-			if routeState.halfOpenInFlight >= limit {
-				return nil, 0, false
-			}
-			routeState.halfOpenInFlight++
-			return &RouteCooldownPermit{manager: m, key: key, halfOpen: true}, 0, true
-		}
-
-		if routeState.consecutiveFailures <= 0 && !now.Before(routeState.cooldownUntil) {
-			delete(m.routeStates, key)
-		}
+	if !verdict.halfOpen {
+		return &RouteCooldownPermit{manager: m, key: key, halfOpen: false}, 0, true
 	}
 
-	return &RouteCooldownPermit{manager: m, key: key, halfOpen: false}, 0, true
+	limit := cfg.HalfOpenMaxInFlight
+	if limit <= 0 {
+		limit = 1
+	}
+	acquired, err := store.AcquireHalfOpen(key.providerTokenId, key.modelName, limit)
+	if reportStoreError("acquire half-open slot", err) {
+		return &RouteCooldownPermit{manager: m, key: key}, 0, true
+	}
+	if !acquired {
+		observeRouteCooldownEvent("rejected_half_open")
+		return nil, 0, false
+	}
+	return &RouteCooldownPermit{manager: m, key: key, halfOpen: true}, 0, true
 }
 
 func (m *RouteCooldownManager) releasePermit(permit *RouteCooldownPermit) {
 	if permit == nil || permit.manager != m {
 		return
 	}
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if permit.released {
-		return
-	}
-	permit.released = true
-
-	if !permit.halfOpen {
-		return
-	}
-	state, ok := m.routeStates[permit.key]
-	if !ok {
-		return
-	}
-	if state.halfOpenInFlight > 0 {
-		state.halfOpenInFlight--
-	}
+	permit.once.Do(func() {
+		if !permit.halfOpen {
+			return
+		}
+		reportStoreError("release half-open slot", m.currentStore().ReleaseHalfOpen(permit.key.providerTokenId, permit.key.modelName))
+	})
 }
 
 func (m *RouteCooldownManager) RecordRouteSuccess(providerTokenId int, modelName string) {
@@ -238,10 +239,9 @@ func (m *RouteCooldownManager) RecordRouteSuccess(providerTokenId int, modelName
 	if key.modelName == "" {
 		return
 	}
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.routeStates, key)
-	delete(m.unsupported, key)
+	store := m.currentStore()
+	reportStoreError("delete route state", store.DeleteRoute(key.providerTokenId, key.modelName))
+	reportStoreError("delete unsupported mark", store.DeleteUnsupported(key.providerTokenId, key.modelName))
 }
 
 func (m *RouteCooldownManager) RecordRouteFailure(providerTokenId int, modelName string) {
@@ -262,51 +262,34 @@ func (m *RouteCooldownManager) RecordRouteFailureWithMinimum(providerTokenId int
 	}
 
 	now := m.now()
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	state, ok := m.routeStates[key]
-	if !ok {
-		state = &routeCooldownState{}
-		m.routeStates[key] = state
-	} else {
-		m.applyRouteDecayLocked(state, now, cfg)
-	}
-
-	if cfg.FailureWindowSeconds > 0 && !state.lastFailureTime.IsZero() {
-		window := time.Duration(cfg.FailureWindowSeconds) * time.Second
-		if window > 0 && now.Sub(state.lastFailureTime) > window {
-			state.consecutiveFailures = 0
-			state.halfOpenInFlight = 0
+	err := m.currentStore().UpdateRoute(key.providerTokenId, key.modelName, func(state *RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		state = countCooldownFailure(state, now, cfg)
+		minFailures := cfg.MinConsecutiveFailures
+		if minFailures <= 0 {
+			minFailures = 1
 		}
-	}
-
-	state.consecutiveFailures++
-	state.lastFailureTime = now
-	state.halfOpenInFlight = 0
-
-	minFailures := cfg.MinConsecutiveFailures
-	if minFailures <= 0 {
-		minFailures = 1
-	}
-	if state.consecutiveFailures < minFailures {
-		state.cooldownUntil = now
+		if state.ConsecutiveFailures < minFailures {
+			state.CooldownUntil = now
+		} else {
+			duration := computeCooldownDurationSeconds(
+				cfg.BaseSeconds,
+				cfg.Multiplier,
+				cfg.MaxSeconds,
+				state.ConsecutiveFailures,
+				cfg.JitterRatio,
+				m.randFloat64,
+			)
+			if minCooldownSeconds > duration {
+				duration = minCooldownSeconds
+			}
+			state.CooldownUntil = now.Add(time.Duration(duration) * time.Second)
+		}
+		return state, cooldownRecordTTL(state, now, cfg)
+	})
+	if reportStoreError("update route state", err) {
 		return
 	}
-
-	duration := computeCooldownDurationSeconds(
-		cfg.BaseSeconds,
-		cfg.Multiplier,
-		cfg.MaxSeconds,
-		state.consecutiveFailures,
-		cfg.JitterRatio,
-		m.randFloat64,
-	)
-	if minCooldownSeconds > duration {
-		duration = minCooldownSeconds
-	}
-	state.cooldownUntil = now.Add(time.Duration(duration) * time.Second)
+	observeRouteCooldownEvent("route_failure")
 }
 
 func (m *RouteCooldownManager) RecordTokenFailure(providerTokenId int) {
@@ -319,40 +302,26 @@ func (m *RouteCooldownManager) RecordTokenFailureWithMinimum(providerTokenId int
 		return
 	}
 	now := m.now()
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	state, ok := m.tokenStates[providerTokenId]
-	if !ok {
-		state = &tokenCooldownState{}
-		m.tokenStates[providerTokenId] = state
-	} else {
-		m.applyTokenDecayLocked(state, now, cfg)
-	}
-
-	if cfg.FailureWindowSeconds > 0 && !state.lastFailureTime.IsZero() {
-		window := time.Duration(cfg.FailureWindowSeconds) * time.Second
-		if window > 0 && now.Sub(state.lastFailureTime) > window {
-			state.consecutiveFailures = 0
+	err := m.currentStore().UpdateToken(providerTokenId, func(state *RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		state = countCooldownFailure(state, now, cfg)
+		duration := computeCooldownDurationSeconds(
+			cfg.TokenBaseSeconds,
+			cfg.Multiplier,
+			cfg.TokenMaxSeconds,
+			state.ConsecutiveFailures,
+			cfg.JitterRatio,
+			m.randFloat64,
+		)
+		if minCooldownSeconds > duration {
+			duration = minCooldownSeconds
 		}
+		state.CooldownUntil = now.Add(time.Duration(duration) * time.Second)
+		return state, cooldownRecordTTL(state, now, cfg)
+	})
+	if reportStoreError("update token state", err) {
+		return
 	}
-
-	state.consecutiveFailures++
-	state.lastFailureTime = now
-
-	duration := computeCooldownDurationSeconds(
-		cfg.TokenBaseSeconds,
-		cfg.Multiplier,
-		cfg.TokenMaxSeconds,
-		state.consecutiveFailures,
-		cfg.JitterRatio,
-		m.randFloat64,
-	)
-	if minCooldownSeconds > duration {
-		duration = minCooldownSeconds
-	}
-	state.cooldownUntil = now.Add(time.Duration(duration) * time.Second)
+	observeRouteCooldownEvent("token_failure")
 }
 
 func (m *RouteCooldownManager) MarkUnsupportedModel(providerTokenId int, modelName string) {
@@ -372,101 +341,66 @@ func (m *RouteCooldownManager) MarkUnsupportedModel(providerTokenId int, modelNa
 		return
 	}
 	now := m.now()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.unsupported[key] = now.Add(ttl)
-}
-
-func (m *RouteCooldownManager) isUnsupportedLocked(key routeCooldownKey, now time.Time) bool {
-	until, ok := m.unsupported[key]
-	if !ok {
-		return false
-	}
-	if !now.Before(until) {
-		delete(m.unsupported, key)
-		return false
-	}
-	return true
-}
-
-func (m *RouteCooldownManager) isTokenInCooldownLocked(providerTokenId int, now time.Time, cfg RouteCooldownConfig) bool {
-	state, ok := m.tokenStates[providerTokenId]
-	if !ok {
-		return false
-	}
-	m.applyTokenDecayLocked(state, now, cfg)
-	if now.Before(state.cooldownUntil) {
-		return true
-	}
-	if state.consecutiveFailures <= 0 && !now.Before(state.cooldownUntil) {
-		delete(m.tokenStates, providerTokenId)
-	}
-	return false
+	store := m.currentStore()
+	reportStoreError("save unsupported mark", store.SaveUnsupported(key.providerTokenId, key.modelName, now.Add(ttl)))
+	observeRouteCooldownEvent("unsupported_model")
 }
 
-func (m *RouteCooldownManager) isRouteInCooldownLocked(key routeCooldownKey, now time.Time, cfg RouteCooldownConfig) bool {
-	state, ok := m.routeStates[key]
-	if !ok {
-		return false
-	}
-	m.applyRouteDecayLocked(state, now, cfg)
-	if now.Before(state.cooldownUntil) {
-		return true
+// countCooldownFailure decays the stored record, restarts the count when the
+// failure window has passed and adds one failure at now.
+func countCooldownFailure(state *RouteCooldownRecord, now time.Time, cfg RouteCooldownConfig) *RouteCooldownRecord {
+	if state == nil {
+		state = &RouteCooldownRecord{}
+	} else {
+		applyCooldownDecay(state, now, cfg)
 	}
-	if state.consecutiveFailures <= 0 && !now.Before(state.cooldownUntil) {
-		delete(m.routeStates, key)
+	if cfg.FailureWindowSeconds > 0 && !state.LastFailureTime.IsZero() {
+		window := time.Duration(cfg.FailureWindowSeconds) * time.Second
+		if window > 0 && now.Sub(state.LastFailureTime) > window {
+			state.ConsecutiveFailures = 0
+		}
 	}
-	return false
+	state.ConsecutiveFailures++
+	state.LastFailureTime = now
+	return state
 }
 
-func (m *RouteCooldownManager) applyRouteDecayLocked(state *routeCooldownState, now time.Time, cfg RouteCooldownConfig) {
-	if state == nil {
-		return
-	}
-	if cfg.DecayMinutes <= 0 || state.consecutiveFailures <= 0 {
-		return
-	}
-	if state.lastFailureTime.IsZero() || !now.After(state.lastFailureTime) {
-		return
-	}
-	interval := time.Duration(cfg.DecayMinutes) * time.Minute
-	if interval <= 0 {
-		return
+// cooldownRecordTTL is how long a record can still influence routing: until
+// its cooldown ends or its failure counter has fully decayed, whichever is later.
+func cooldownRecordTTL(state *RouteCooldownRecord, now time.Time, cfg RouteCooldownConfig) time.Duration {
+	expiresAt := state.LastFailureTime.Add(cooldownRecordRetention)
+	if cfg.DecayMinutes > 0 {
+		expiresAt = state.LastFailureTime.Add(time.Duration(state.ConsecutiveFailures*cfg.DecayMinutes) * time.Minute)
 	}
-	periods := int(now.Sub(state.lastFailureTime) / interval)
-	if periods <= 0 {
-		return
-	}
-	state.consecutiveFailures -= periods
-	if state.consecutiveFailures < 0 {
-		state.consecutiveFailures = 0
+	if state.CooldownUntil.After(expiresAt) {
+		expiresAt = state.CooldownUntil
 	}
-	state.lastFailureTime = state.lastFailureTime.Add(time.Duration(periods) * interval)
+	return expiresAt.Sub(now)
 }
 
-func (m *RouteCooldownManager) applyTokenDecayLocked(state *tokenCooldownState, now time.Time, cfg RouteCooldownConfig) {
+func applyCooldownDecay(state *RouteCooldownRecord, now time.Time, cfg RouteCooldownConfig) {
 	if state == nil {
 		return
 	}
-	if cfg.DecayMinutes <= 0 || state.consecutiveFailures <= 0 {
+	if cfg.DecayMinutes <= 0 || state.ConsecutiveFailures <= 0 {
 		return
 	}
-	if state.lastFailureTime.IsZero() || !now.After(state.lastFailureTime) {
+	if state.LastFailureTime.IsZero() || !now.After(state.LastFailureTime) {
 		return
 	}
 	interval := time.Duration(cfg.DecayMinutes) * time.Minute
 	if interval <= 0 {
 		return
 	}
-	periods := int(now.Sub(state.lastFailureTime) / interval)
+	periods := int(now.Sub(state.LastFailureTime) / interval)
 	if periods <= 0 {
 		return
 	}
-	state.consecutiveFailures -= periods
-	if state.consecutiveFailures < 0 {
-		state.consecutiveFailures = 0
+	state.ConsecutiveFailures -= periods
+	if state.ConsecutiveFailures < 0 {
+		state.ConsecutiveFailures = 0
 	}
-	state.lastFailureTime = state.lastFailureTime.Add(time.Duration(periods) * interval)
+	state.LastFailureTime = state.LastFailureTime.Add(time.Duration(periods) * interval)
 }
 
 func normalizeCooldownModelName(modelName string) string {
@@ -636,72 +570,30 @@ func (m *RouteCooldownManager) GetRouteCooldownStatus(providerTokenId int, model
 		return result
 	}
 
-	normalizedModel := normalizeCooldownModelName(modelName)
-	now := m.now()
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Check unsupported model first (highest priority, blocks everything)
-	if until, ok := m.unsupported[routeCooldownKey{providerTokenId: providerTokenId, modelName: normalizedModel}]; ok {
-		if !now.Before(until) {
-			delete(m.unsupported, routeCooldownKey{providerTokenId: providerTokenId, modelName: normalizedModel})
-		} else {
-			result.InCooldown = true
-			result.Reason = "unsupported"
-			result.RemainingSecs = int(until.Sub(now).Seconds())
-			if result.RemainingSecs < 0 {
-				result.RemainingSecs = 0
-			}
-			return result
-		}
-	}
-
-	// Check token-level cooldown
-	if state, ok := m.tokenStates[providerTokenId]; ok {
-		m.applyTokenDecayLocked(state, now, cfg)
-		if now.Before(state.cooldownUntil) {
-			result.InCooldown = true
-			result.Reason = "token"
-			result.RemainingSecs = int(state.cooldownUntil.Sub(now).Seconds())
-			if result.RemainingSecs < 0 {
-				result.RemainingSecs = 0
-			}
-			return result
-		}
-		if state.consecutiveFailures <= 0 && !now.Before(state.cooldownUntil) {
-			delete(m.tokenStates, providerTokenId)
-		}
+	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: normalizeCooldownModelName(modelName)}
+	store := m.currentStore()
+	entry, err := store.Load(key.providerTokenId, key.modelName)
+	if reportStoreError("load", err) {
+		return result
 	}
 
-	// Check route-level cooldown
-	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: normalizedModel}
-	if state, ok := m.routeStates[key]; ok {
-		m.applyRouteDecayLocked(state, now, cfg)
-		if now.Before(state.cooldownUntil) {
-			result.InCooldown = true
-			result.Reason = "route"
-			result.RemainingSecs = int(state.cooldownUntil.Sub(now).Seconds())
-			if result.RemainingSecs < 0 {
-				result.RemainingSecs = 0
-			}
-			result.HalfOpenInflight = state.halfOpenInFlight
-			return result
-		}
-
-		// Check half-open state (cooldown expired but still has failures)
-		halfOpen := state.consecutiveFailures > 0 && state.cooldownUntil.After(state.lastFailureTime)
-		if halfOpen {
-			result.HalfOpen = true
-			result.HalfOpenInflight = state.halfOpenInFlight
+	verdict := m.inspectEntry(entry, m.now(), cfg)
+	if verdict.reason != "" {
+		result.InCooldown = true
+		result.Reason = verdict.reason
+		result.RemainingSecs = int(verdict.remaining.Seconds())
+		if result.RemainingSecs < 0 {
 			result.RemainingSecs = 0
 		}
-
-		if state.consecutiveFailures <= 0 && !now.Before(state.cooldownUntil) {
-			delete(m.routeStates, key)
+		if verdict.reason == "route" {
+			result.HalfOpenInflight = entry.HalfOpenInFlight
 		}
+		return result
+	}
+	if verdict.halfOpen {
+		result.HalfOpen = true
+		result.HalfOpenInflight = entry.HalfOpenInFlight
 	}
-
 	return result
 }
 
@@ -709,27 +601,81 @@ func (m *RouteCooldownManager) GetRouteCooldownStatus(providerTokenId int, model
 func (m *RouteCooldownManager) GetTokenCooldownStatus(providerTokenId int) (inCooldown bool, reason string, remainingSecs int) {
 	cfg := m.configProvider()
 	now := m.now()
+	store := m.currentStore()
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	state, ok := m.tokenStates[providerTokenId]
-	if !ok {
+	state, err := store.LoadToken(providerTokenId)
+	if reportStoreError("load token state", err) || state == nil {
 		return false, "", 0
 	}
 
-	m.applyTokenDecayLocked(state, now, cfg)
-	if now.Before(state.cooldownUntil) {
-		remainingSecs = int(state.cooldownUntil.Sub(now).Seconds())
+	applyCooldownDecay(state, now, cfg)
+	if now.Before(state.CooldownUntil) {
+		remainingSecs = int(state.CooldownUntil.Sub(now).Seconds())
 		if remainingSecs < 0 {
 			remainingSecs = 0
 		}
 		return true, "token", remainingSecs
 	}
+	return false, "", 0
+}
+
+// RouteCooldownStats summarizes the cooldown state of all routes and tokens.
+type RouteCooldownStats struct {
+	RoutesInCooldown  int
+	RoutesHalfOpen    int
+	TokensInCooldown  int
+	UnsupportedModels int
+}
 
-	if state.consecutiveFailures <= 0 && !now.Before(state.cooldownUntil) {
-		delete(m.tokenStates, providerTokenId)
+// Stats lists the store and counts what currently blocks routing.
+func (m *RouteCooldownManager) Stats() (RouteCooldownStats, error) {
+	stats := RouteCooldownStats{}
+	cfg := m.configProvider()
+	if !cfg.Enabled {
+		return stats, nil
 	}
+	snapshot, err := m.currentStore().List()
+	if err != nil {
+		return stats, err
+	}
+	now := m.now()
+	for _, item := range snapshot.Routes {
+		record := item.Record
+		applyCooldownDecay(&record, now, cfg)
+		if now.Before(record.CooldownUntil) {
+			stats.RoutesInCooldown++
+		} else if record.ConsecutiveFailures > 0 && record.CooldownUntil.After(record.LastFailureTime) {
+			stats.RoutesHalfOpen++
+		}
+	}
+	for _, item := range snapshot.Tokens {
+		if now.Before(item.Record.CooldownUntil) {
+			stats.TokensInCooldown++
+		}
+	}
+	for _, item := range snapshot.Unsupported {
+		if now.Before(item.Until) {
+			stats.UnsupportedModels++
+		}
+	}
+	return stats, nil
+}
 
-	return false, "", 0
+// CooldownTokens returns the provider tokens currently in token-level cooldown.
+func (m *RouteCooldownManager) CooldownTokens() ([]RouteCooldownTokenItem, error) {
+	if !m.configProvider().Enabled {
+		return nil, nil
+	}
+	snapshot, err := m.currentStore().List()
+	if err != nil {
+		return nil, err
+	}
+	now := m.now()
+	items := make([]RouteCooldownTokenItem, 0, len(snapshot.Tokens))
+	for _, item := range snapshot.Tokens {
+		if now.Before(item.Record.CooldownUntil) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
 }
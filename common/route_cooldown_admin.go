@@ -0,0 +1,223 @@
+package common
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Kinds of cooldown entries.
+const (
+	RouteCooldownKindRoute       = "route"
+	RouteCooldownKindToken       = "token"
+	RouteCooldownKindUnsupported = "unsupported"
+)
+
+// RouteCooldownActiveItem is a cooldown entry that currently affects routing.
+type RouteCooldownActiveItem struct {
+	Kind                string `json:"kind"`
+	ProviderTokenId     int    `json:"provider_token_id"`
+	ModelName           string `json:"model_name"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	CooldownUntil       int64  `json:"cooldown_until"`
+	RemainingSecs       int    `json:"remaining_secs"`
+	HalfOpen            bool   `json:"half_open"`
+	HalfOpenInFlight    int    `json:"half_open_in_flight"`
+	LastFailureTime     int64  `json:"last_failure_time"`
+}
+
+// SharedStore reports whether cooldown state lives outside this process and
+// therefore survives restarts on its own.
+func (m *RouteCooldownManager) SharedStore() bool {
+	_, memory := m.currentStore().(*MemoryRouteCooldownStore)
+	return !memory
+}
+
+// ListActive returns the routes in cooldown or half-open, the tokens in
+// cooldown and the unexpired unsupported-model marks, soonest to expire first.
+func (m *RouteCooldownManager) ListActive() ([]RouteCooldownActiveItem, error) {
+	snapshot, err := m.currentStore().List()
+	if err != nil {
+		return nil, err
+	}
+	cfg := m.configProvider()
+	now := m.now()
+	items := make([]RouteCooldownActiveItem, 0, len(snapshot.Routes)+len(snapshot.Tokens)+len(snapshot.Unsupported))
+	for _, route := range snapshot.Routes {
+		record := route.Record
+		applyCooldownDecay(&record, now, cfg)
+		inCooldown := now.Before(record.CooldownUntil)
+		halfOpen := !inCooldown && record.ConsecutiveFailures > 0 && record.CooldownUntil.After(record.LastFailureTime)
+		if !inCooldown && !halfOpen {
+			continue
+		}
+		items = append(items, newRouteCooldownActiveItem(RouteCooldownKindRoute, route.ProviderTokenId, route.ModelName, record, now, halfOpen, route.HalfOpenInFlight))
+	}
+	for _, token := range snapshot.Tokens {
+		record := token.Record
+		applyCooldownDecay(&record, now, cfg)
+		if !now.Before(record.CooldownUntil) {
+			continue
+		}
+		items = append(items, newRouteCooldownActiveItem(RouteCooldownKindToken, token.ProviderTokenId, "", record, now, false, 0))
+	}
+	for _, mark := range snapshot.Unsupported {
+		if !now.Before(mark.Until) {
+			continue
+		}
+		items = append(items, newRouteCooldownActiveItem(RouteCooldownKindUnsupported, mark.ProviderTokenId, mark.ModelName, RouteCooldownRecord{CooldownUntil: mark.Until}, now, false, 0))
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].CooldownUntil != items[j].CooldownUntil {
+			return items[i].CooldownUntil < items[j].CooldownUntil
+		}
+		return items[i].ProviderTokenId < items[j].ProviderTokenId
+	})
+	return items, nil
+}
+
+func newRouteCooldownActiveItem(kind string, providerTokenId int, modelName string, record RouteCooldownRecord, now time.Time, halfOpen bool, halfOpenInFlight int) RouteCooldownActiveItem {
+	item := RouteCooldownActiveItem{
+		Kind:                kind,
+		ProviderTokenId:     providerTokenId,
+		ModelName:           modelName,
+		ConsecutiveFailures: record.ConsecutiveFailures,
+		CooldownUntil:       record.CooldownUntil.Unix(),
+		HalfOpen:            halfOpen,
+		HalfOpenInFlight:    halfOpenInFlight,
+	}
+	if !record.LastFailureTime.IsZero() {
+		item.LastFailureTime = record.LastFailureTime.Unix()
+	}
+	if remaining := record.CooldownUntil.Sub(now); remaining > 0 {
+		item.RemainingSecs = int(remaining.Seconds())
+	}
+	return item
+}
+
+// Clear removes one cooldown entry. Clearing a route also resets its failure
+// counter and half-open slots.
+func (m *RouteCooldownManager) Clear(kind string, providerTokenId int, modelName string) error {
+	modelName = normalizeCooldownModelName(modelName)
+	store := m.currentStore()
+	switch kind {
+	case RouteCooldownKindRoute:
+		return store.DeleteRoute(providerTokenId, modelName)
+	case RouteCooldownKindToken:
+		return store.DeleteToken(providerTokenId)
+	case RouteCooldownKindUnsupported:
+		return store.DeleteUnsupported(providerTokenId, modelName)
+	}
+	return errors.New("unknown cooldown kind: " + kind)
+}
+
+// ClearAll removes every stored cooldown entry and returns how many there were.
+func (m *RouteCooldownManager) ClearAll() (int, error) {
+	store := m.currentStore()
+	snapshot, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, route := range snapshot.Routes {
+		if err := store.DeleteRoute(route.ProviderTokenId, route.ModelName); err != nil {
+			return 0, err
+		}
+	}
+	for _, token := range snapshot.Tokens {
+		if err := store.DeleteToken(token.ProviderTokenId); err != nil {
+			return 0, err
+		}
+	}
+	for _, mark := range snapshot.Unsupported {
+		if err := store.DeleteUnsupported(mark.ProviderTokenId, mark.ModelName); err != nil {
+			return 0, err
+		}
+	}
+	return len(snapshot.Routes) + len(snapshot.Tokens) + len(snapshot.Unsupported), nil
+}
+
+// ForceCooldown puts a route or token in cooldown, or marks a model as
+// unsupported, for duration from now. Existing failure counters are kept so
+// the next real failure keeps backing off from where it was.
+func (m *RouteCooldownManager) ForceCooldown(kind string, providerTokenId int, modelName string, duration time.Duration) error {
+	if duration <= 0 {
+		return errors.New("cooldown duration must be positive")
+	}
+	modelName = normalizeCooldownModelName(modelName)
+	cfg := m.configProvider()
+	now := m.now()
+	store := m.currentStore()
+
+	force := func(state *RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		if state == nil {
+			state = &RouteCooldownRecord{}
+		} else {
+			applyCooldownDecay(state, now, cfg)
+		}
+		if state.ConsecutiveFailures < 1 {
+			state.ConsecutiveFailures = 1
+		}
+		state.LastFailureTime = now
+		state.CooldownUntil = now.Add(duration)
+		return state, cooldownRecordTTL(state, now, cfg)
+	}
+	switch kind {
+	case RouteCooldownKindRoute:
+		return store.UpdateRoute(providerTokenId, modelName, force)
+	case RouteCooldownKindToken:
+		return store.UpdateToken(providerTokenId, force)
+	case RouteCooldownKindUnsupported:
+		return store.SaveUnsupported(providerTokenId, modelName, now.Add(duration))
+	}
+	return errors.New("unknown cooldown kind: " + kind)
+}
+
+// Snapshot returns every stored cooldown record for persistence.
+func (m *RouteCooldownManager) Snapshot() (RouteCooldownSnapshot, error) {
+	return m.currentStore().List()
+}
+
+// Restore loads records saved by Snapshot, keeping their absolute expiry
+// times. Records that no longer affect routing are skipped. It returns the
+// number of records restored.
+func (m *RouteCooldownManager) Restore(snapshot RouteCooldownSnapshot) (int, error) {
+	cfg := m.configProvider()
+	now := m.now()
+	store := m.currentStore()
+
+	restored := 0
+	for _, route := range snapshot.Routes {
+		record := route.Record
+		applyCooldownDecay(&record, now, cfg)
+		ttl := cooldownRecordTTL(&record, now, cfg)
+		if ttl <= 0 || (record.ConsecutiveFailures <= 0 && !now.Before(record.CooldownUntil)) {
+			continue
+		}
+		if err := store.SaveRoute(route.ProviderTokenId, normalizeCooldownModelName(route.ModelName), &record, ttl); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	for _, token := range snapshot.Tokens {
+		record := token.Record
+		applyCooldownDecay(&record, now, cfg)
+		ttl := cooldownRecordTTL(&record, now, cfg)
+		if ttl <= 0 || (record.ConsecutiveFailures <= 0 && !now.Before(record.CooldownUntil)) {
+			continue
+		}
+		if err := store.SaveToken(token.ProviderTokenId, &record, ttl); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	for _, mark := range snapshot.Unsupported {
+		if !now.Before(mark.Until) {
+			continue
+		}
+		if err := store.SaveUnsupported(mark.ProviderTokenId, normalizeCooldownModelName(mark.ModelName), mark.Until); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRouteCooldownManager_AdminForceClearAndRestore(t *testing.T) {
+	clock := time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return clock }
+
+	cfgFn := func() RouteCooldownConfig {
+		return RouteCooldownConfig{
+			Enabled:               true,
+			BaseSeconds:           30,
+			Multiplier:            2,
+			MaxSeconds:            1800,
+			DecayMinutes:          10,
+			JitterRatio:           0,
+			HalfOpenMaxInFlight:   1,
+			UnsupportedModelHours: 24,
+			TokenBaseSeconds:      600,
+			TokenMaxSeconds:       7200,
+		}
+	}
+
+	mgr := newRouteCooldownManager(cfgFn, nowFn, func() float64 { return 0.5 })
+	if mgr.SharedStore() {
+		t.Fatalf("expected the default store to be process-local")
+	}
+
+	if err := mgr.ForceCooldown(RouteCooldownKindRoute, 1, "GPT-5.2", time.Hour); err != nil {
+		t.Fatalf("force route cooldown: %v", err)
+	}
+	if err := mgr.ForceCooldown(RouteCooldownKindToken, 2, "", 10*time.Minute); err != nil {
+		t.Fatalf("force token cooldown: %v", err)
+	}
+	if err := mgr.ForceCooldown(RouteCooldownKindUnsupported, 3, "gpt-5.2", 2*time.Hour); err != nil {
+		t.Fatalf("force unsupported mark: %v", err)
+	}
+	if mgr.IsRouteSelectable(1, "gpt-5.2") || mgr.IsRouteSelectable(2, "gpt-5.2") || mgr.IsRouteSelectable(3, "gpt-5.2") {
+		t.Fatalf("expected forced entries to block routing")
+	}
+
+	items, err := mgr.ListActive()
+	if err != nil {
+		t.Fatalf("list active: %v", err)
+	}
+	if len(items) != 3 || items[0].Kind != RouteCooldownKindToken || items[1].Kind != RouteCooldownKindRoute || items[2].Kind != RouteCooldownKindUnsupported {
+		t.Fatalf("unexpected active items: %+v", items)
+	}
+	if items[1].ModelName != "gpt-5.2" || items[1].RemainingSecs != 3600 || items[1].ConsecutiveFailures != 1 {
+		t.Fatalf("unexpected route item: %+v", items[1])
+	}
+
+	snapshot, err := mgr.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	if err := mgr.Clear(RouteCooldownKindRoute, 1, "gpt-5.2"); err != nil {
+		t.Fatalf("clear route: %v", err)
+	}
+	if !mgr.IsRouteSelectable(1, "gpt-5.2") {
+		t.Fatalf("expected route selectable after clear")
+	}
+	cleared, err := mgr.ClearAll()
+	if err != nil || cleared != 2 {
+		t.Fatalf("expected two remaining entries cleared, got %d (%v)", cleared, err)
+	}
+
+	// Restore into a fresh manager after the token cooldown has expired.
+	clock = clock.Add(15 * time.Minute)
+	restoredMgr := newRouteCooldownManager(cfgFn, nowFn, func() float64 { return 0.5 })
+	restored, err := restoredMgr.Restore(snapshot)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored != 2 {
+		t.Fatalf("expected the expired token record to be skipped, got %d restored", restored)
+	}
+	if restoredMgr.IsRouteSelectable(1, "gpt-5.2") || restoredMgr.IsRouteSelectable(3, "gpt-5.2") {
+		t.Fatalf("expected restored route and unsupported mark to keep blocking")
+	}
+	if !restoredMgr.IsRouteSelectable(2, "gpt-5.2") {
+		t.Fatalf("expected expired token cooldown not to block after restore")
+	}
+	status := restoredMgr.GetRouteCooldownStatus(1, "gpt-5.2")
+	if !status.InCooldown || status.RemainingSecs != 45*60 {
+		t.Fatalf("expected the remaining 45m cooldown to be kept, got %+v", status)
+	}
+}
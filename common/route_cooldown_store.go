@@ -0,0 +1,603 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RouteCooldownRecord is the persisted failure state of a route or a token.
+type RouteCooldownRecord struct {
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CooldownUntil       time.Time `json:"cooldown_until"`
+	LastFailureTime     time.Time `json:"last_failure_time"`
+}
+
+// RouteCooldownEntry is everything needed to decide whether a route can be used.
+type RouteCooldownEntry struct {
+	Route            *RouteCooldownRecord
+	Token            *RouteCooldownRecord
+	UnsupportedUntil time.Time
+	HalfOpenInFlight int
+}
+
+// RouteCooldownUpdate computes a new record from the stored one (nil when
+// absent) and returns it with its TTL.
+type RouteCooldownUpdate func(current *RouteCooldownRecord) (*RouteCooldownRecord, time.Duration)
+
+// RouteCooldownStore persists cooldown state for RouteCooldownManager. Model
+// names passed in are already normalized. Returned records are copies.
+type RouteCooldownStore interface {
+	Load(providerTokenId int, modelName string) (RouteCooldownEntry, error)
+	LoadToken(providerTokenId int) (*RouteCooldownRecord, error)
+	// SaveRoute stores the route record and resets its half-open counter.
+	SaveRoute(providerTokenId int, modelName string, record *RouteCooldownRecord, ttl time.Duration) error
+	// UpdateRoute replaces the route record with the result of update in one
+	// atomic step and resets its half-open counter. update may run more than
+	// once and must not have side effects.
+	UpdateRoute(providerTokenId int, modelName string, update RouteCooldownUpdate) error
+	// DeleteRoute removes the route record and its half-open counter.
+	DeleteRoute(providerTokenId int, modelName string) error
+	SaveToken(providerTokenId int, record *RouteCooldownRecord, ttl time.Duration) error
+	// UpdateToken is UpdateRoute for the token record.
+	UpdateToken(providerTokenId int, update RouteCooldownUpdate) error
+	DeleteToken(providerTokenId int) error
+	SaveUnsupported(providerTokenId int, modelName string, until time.Time) error
+	DeleteUnsupported(providerTokenId int, modelName string) error
+	// AcquireHalfOpen takes one half-open probe slot if fewer than limit are in use.
+	AcquireHalfOpen(providerTokenId int, modelName string, limit int) (bool, error)
+	ReleaseHalfOpen(providerTokenId int, modelName string) error
+	// List returns every stored record, for telemetry and administration.
+	List() (RouteCooldownSnapshot, error)
+}
+
+type RouteCooldownRouteItem struct {
+	ProviderTokenId  int                 `json:"provider_token_id"`
+	ModelName        string              `json:"model_name"`
+	Record           RouteCooldownRecord `json:"record"`
+	HalfOpenInFlight int                 `json:"half_open_in_flight"`
+}
+
+type RouteCooldownTokenItem struct {
+	ProviderTokenId int                 `json:"provider_token_id"`
+	Record          RouteCooldownRecord `json:"record"`
+}
+
+type RouteCooldownUnsupportedItem struct {
+	ProviderTokenId int       `json:"provider_token_id"`
+	ModelName       string    `json:"model_name"`
+	Until           time.Time `json:"until"`
+}
+
+// RouteCooldownSnapshot is the full content of a RouteCooldownStore.
+type RouteCooldownSnapshot struct {
+	Routes      []RouteCooldownRouteItem       `json:"routes"`
+	Tokens      []RouteCooldownTokenItem       `json:"tokens"`
+	Unsupported []RouteCooldownUnsupportedItem `json:"unsupported"`
+}
+
+const (
+	RouteCooldownStoreMemory = "memory"
+	RouteCooldownStoreRedis  = "redis"
+)
+
+// InitRouteCooldownStore switches GlobalRouteCooldown to the backend named by
+// ROUTE_COOLDOWN_STORE. It must be called after InitRedisClient.
+func InitRouteCooldownStore() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("ROUTE_COOLDOWN_STORE")))
+	switch backend {
+	case "", RouteCooldownStoreMemory:
+		return nil
+	case RouteCooldownStoreRedis:
+		if !RedisEnabled || RDB == nil {
+			return fmt.Errorf("ROUTE_COOLDOWN_STORE=redis requires REDIS_CONN_STRING")
+		}
+		GlobalRouteCooldown.SetStore(NewRedisRouteCooldownStore(RDB))
+		SysLog("route cooldown state is shared via Redis")
+		return nil
+	default:
+		return fmt.Errorf("unsupported ROUTE_COOLDOWN_STORE: %s (supported: memory, redis)", backend)
+	}
+}
+
+func copyRouteCooldownRecord(record *RouteCooldownRecord) *RouteCooldownRecord {
+	if record == nil {
+		return nil
+	}
+	out := *record
+	return &out
+}
+
+// memoryCooldownSweepInterval is how often MemoryRouteCooldownStore drops
+// expired records on write.
+const memoryCooldownSweepInterval = time.Minute
+
+type memoryCooldownRecord struct {
+	record    *RouteCooldownRecord
+	expiresAt time.Time
+}
+
+func (r memoryCooldownRecord) live(now time.Time) *RouteCooldownRecord {
+	if r.record == nil || !now.Before(r.expiresAt) {
+		return nil
+	}
+	return r.record
+}
+
+// MemoryRouteCooldownStore keeps cooldown state in process memory. Records
+// expire after their TTL like they do in Redis.
+type MemoryRouteCooldownStore struct {
+	mu sync.Mutex
+
+	routes      map[routeCooldownKey]memoryCooldownRecord
+	tokens      map[int]memoryCooldownRecord
+	unsupported map[routeCooldownKey]time.Time
+	// halfOpen counts the half-open permits in flight. Record updates leave
+	// it alone; only releasing the permits brings it down.
+	halfOpen  map[routeCooldownKey]int
+	lastSweep time.Time
+}
+
+func NewMemoryRouteCooldownStore() *MemoryRouteCooldownStore {
+	return &MemoryRouteCooldownStore{
+		routes:      make(map[routeCooldownKey]memoryCooldownRecord),
+		tokens:      make(map[int]memoryCooldownRecord),
+		unsupported: make(map[routeCooldownKey]time.Time),
+		halfOpen:    make(map[routeCooldownKey]int),
+		lastSweep:   time.Now(),
+	}
+}
+
+// sweepLocked drops expired records so keys that are never read again do not
+// accumulate.
+func (s *MemoryRouteCooldownStore) sweepLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryCooldownSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, item := range s.routes {
+		if item.live(now) == nil {
+			delete(s.routes, key)
+		}
+	}
+	for providerTokenId, item := range s.tokens {
+		if item.live(now) == nil {
+			delete(s.tokens, providerTokenId)
+		}
+	}
+	for key, until := range s.unsupported {
+		if !now.Before(until) {
+			delete(s.unsupported, key)
+		}
+	}
+}
+
+func (s *MemoryRouteCooldownStore) Load(providerTokenId int, modelName string) (RouteCooldownEntry, error) {
+	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return RouteCooldownEntry{
+		Route:            copyRouteCooldownRecord(s.routes[key].live(now)),
+		Token:            copyRouteCooldownRecord(s.tokens[providerTokenId].live(now)),
+		UnsupportedUntil: s.unsupported[key],
+		HalfOpenInFlight: s.halfOpen[key],
+	}, nil
+}
+
+func (s *MemoryRouteCooldownStore) LoadToken(providerTokenId int) (*RouteCooldownRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyRouteCooldownRecord(s.tokens[providerTokenId].live(time.Now())), nil
+}
+
+func (s *MemoryRouteCooldownStore) SaveRoute(providerTokenId int, modelName string, record *RouteCooldownRecord, ttl time.Duration) error {
+	return s.UpdateRoute(providerTokenId, modelName, func(*RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		return record, ttl
+	})
+}
+
+func (s *MemoryRouteCooldownStore) UpdateRoute(providerTokenId int, modelName string, update RouteCooldownUpdate) error {
+	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked(now)
+	record, ttl := update(copyRouteCooldownRecord(s.routes[key].live(now)))
+	s.routes[key] = memoryCooldownRecord{record: copyRouteCooldownRecord(record), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) DeleteRoute(providerTokenId int, modelName string) error {
+	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.routes, key)
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) SaveToken(providerTokenId int, record *RouteCooldownRecord, ttl time.Duration) error {
+	return s.UpdateToken(providerTokenId, func(*RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		return record, ttl
+	})
+}
+
+func (s *MemoryRouteCooldownStore) UpdateToken(providerTokenId int, update RouteCooldownUpdate) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked(now)
+	record, ttl := update(copyRouteCooldownRecord(s.tokens[providerTokenId].live(now)))
+	s.tokens[providerTokenId] = memoryCooldownRecord{record: copyRouteCooldownRecord(record), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) DeleteToken(providerTokenId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, providerTokenId)
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) SaveUnsupported(providerTokenId int, modelName string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked(time.Now())
+	s.unsupported[routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName}] = until
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) DeleteUnsupported(providerTokenId int, modelName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.unsupported, routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName})
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) AcquireHalfOpen(providerTokenId int, modelName string, limit int) (bool, error) {
+	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.halfOpen[key] >= limit {
+		return false, nil
+	}
+	s.halfOpen[key]++
+	return true, nil
+}
+
+func (s *MemoryRouteCooldownStore) ReleaseHalfOpen(providerTokenId int, modelName string) error {
+	key := routeCooldownKey{providerTokenId: providerTokenId, modelName: modelName}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.halfOpen[key] > 1 {
+		s.halfOpen[key]--
+	} else {
+		delete(s.halfOpen, key)
+	}
+	return nil
+}
+
+func (s *MemoryRouteCooldownStore) List() (RouteCooldownSnapshot, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := RouteCooldownSnapshot{}
+	for key, item := range s.routes {
+		record := item.live(now)
+		if record == nil {
+			continue
+		}
+		snapshot.Routes = append(snapshot.Routes, RouteCooldownRouteItem{
+			ProviderTokenId:  key.providerTokenId,
+			ModelName:        key.modelName,
+			Record:           *record,
+			HalfOpenInFlight: s.halfOpen[key],
+		})
+	}
+	for providerTokenId, item := range s.tokens {
+		if record := item.live(now); record != nil {
+			snapshot.Tokens = append(snapshot.Tokens, RouteCooldownTokenItem{ProviderTokenId: providerTokenId, Record: *record})
+		}
+	}
+	for key, until := range s.unsupported {
+		snapshot.Unsupported = append(snapshot.Unsupported, RouteCooldownUnsupportedItem{
+			ProviderTokenId: key.providerTokenId,
+			ModelName:       key.modelName,
+			Until:           until,
+		})
+	}
+	return snapshot, nil
+}
+
+// redisHalfOpenTTL bounds how long a half-open slot survives a replica that
+// crashed before releasing it.
+const redisHalfOpenTTL = 5 * time.Minute
+
+var redisAcquireHalfOpenScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("INCR", KEYS[1])
+redis.call("EXPIRE", KEYS[1], ARGV[2])
+return 1
+`)
+
+var redisReleaseHalfOpenScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if current > 1 then
+	return redis.call("DECR", KEYS[1])
+end
+redis.call("DEL", KEYS[1])
+return 0
+`)
+
+// RedisRouteCooldownStore shares cooldown state between gateway replicas.
+// Records expire through Redis TTLs, so a replica that never reads a key again
+// does not leak it.
+type RedisRouteCooldownStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisRouteCooldownStore(client *redis.Client) *RedisRouteCooldownStore {
+	return &RedisRouteCooldownStore{client: client, prefix: "routeCooldown"}
+}
+
+func (s *RedisRouteCooldownStore) routeKey(kind string, providerTokenId int, modelName string) string {
+	return fmt.Sprintf("%s:%s:%d:%s", s.prefix, kind, providerTokenId, modelName)
+}
+
+func (s *RedisRouteCooldownStore) tokenKey(providerTokenId int) string {
+	return fmt.Sprintf("%s:token:%d", s.prefix, providerTokenId)
+}
+
+func decodeRedisCooldownRecord(value interface{}) (*RouteCooldownRecord, error) {
+	raw, ok := value.(string)
+	if !ok || raw == "" {
+		return nil, nil
+	}
+	record := &RouteCooldownRecord{}
+	if err := json.Unmarshal([]byte(raw), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *RedisRouteCooldownStore) Load(providerTokenId int, modelName string) (RouteCooldownEntry, error) {
+	entry := RouteCooldownEntry{}
+	values, err := s.client.MGet(context.Background(),
+		s.routeKey("route", providerTokenId, modelName),
+		s.tokenKey(providerTokenId),
+		s.routeKey("unsupported", providerTokenId, modelName),
+		s.routeKey("halfopen", providerTokenId, modelName),
+	).Result()
+	if err != nil {
+		return entry, err
+	}
+	if entry.Route, err = decodeRedisCooldownRecord(values[0]); err != nil {
+		return entry, err
+	}
+	if entry.Token, err = decodeRedisCooldownRecord(values[1]); err != nil {
+		return entry, err
+	}
+	if raw, ok := values[2].(string); ok {
+		var unix int64
+		if _, err := fmt.Sscan(raw, &unix); err == nil {
+			entry.UnsupportedUntil = time.Unix(unix, 0)
+		}
+	}
+	if raw, ok := values[3].(string); ok {
+		_, _ = fmt.Sscan(raw, &entry.HalfOpenInFlight)
+	}
+	return entry, nil
+}
+
+func (s *RedisRouteCooldownStore) LoadToken(providerTokenId int) (*RouteCooldownRecord, error) {
+	raw, err := s.client.Get(context.Background(), s.tokenKey(providerTokenId)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeRedisCooldownRecord(raw)
+}
+
+// redisUpdateMaxAttempts bounds the optimistic transaction retries when other
+// replicas keep changing the same record.
+const redisUpdateMaxAttempts = 10
+
+// updateRecord runs update inside WATCH/MULTI on key so that concurrent
+// replicas never overwrite each other's changes.
+func (s *RedisRouteCooldownStore) updateRecord(key string, update RouteCooldownUpdate) error {
+	ctx := context.Background()
+	txn := func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		current, err := decodeRedisCooldownRecord(raw)
+		if err != nil {
+			return err
+		}
+		record, ttl := update(current)
+		payload, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if ttl < time.Second {
+			ttl = time.Second
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, ttl)
+			return nil
+		})
+		return err
+	}
+	for attempt := 0; attempt < redisUpdateMaxAttempts; attempt++ {
+		err := s.client.Watch(ctx, txn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+func (s *RedisRouteCooldownStore) SaveRoute(providerTokenId int, modelName string, record *RouteCooldownRecord, ttl time.Duration) error {
+	return s.UpdateRoute(providerTokenId, modelName, func(*RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		return record, ttl
+	})
+}
+
+func (s *RedisRouteCooldownStore) UpdateRoute(providerTokenId int, modelName string, update RouteCooldownUpdate) error {
+	return s.updateRecord(s.routeKey("route", providerTokenId, modelName), update)
+}
+
+func (s *RedisRouteCooldownStore) DeleteRoute(providerTokenId int, modelName string) error {
+	return s.client.Del(context.Background(), s.routeKey("route", providerTokenId, modelName)).Err()
+}
+
+func (s *RedisRouteCooldownStore) SaveToken(providerTokenId int, record *RouteCooldownRecord, ttl time.Duration) error {
+	return s.UpdateToken(providerTokenId, func(*RouteCooldownRecord) (*RouteCooldownRecord, time.Duration) {
+		return record, ttl
+	})
+}
+
+func (s *RedisRouteCooldownStore) UpdateToken(providerTokenId int, update RouteCooldownUpdate) error {
+	return s.updateRecord(s.tokenKey(providerTokenId), update)
+}
+
+func (s *RedisRouteCooldownStore) DeleteToken(providerTokenId int) error {
+	return s.client.Del(context.Background(), s.tokenKey(providerTokenId)).Err()
+}
+
+func (s *RedisRouteCooldownStore) SaveUnsupported(providerTokenId int, modelName string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(context.Background(), s.routeKey("unsupported", providerTokenId, modelName), until.Unix(), ttl).Err()
+}
+
+func (s *RedisRouteCooldownStore) DeleteUnsupported(providerTokenId int, modelName string) error {
+	return s.client.Del(context.Background(), s.routeKey("unsupported", providerTokenId, modelName)).Err()
+}
+
+func (s *RedisRouteCooldownStore) AcquireHalfOpen(providerTokenId int, modelName string, limit int) (bool, error) {
+	key := s.routeKey("halfopen", providerTokenId, modelName)
+	acquired, err := redisAcquireHalfOpenScript.Run(context.Background(), s.client, []string{key}, limit, int(redisHalfOpenTTL.Seconds())).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+func (s *RedisRouteCooldownStore) ReleaseHalfOpen(providerTokenId int, modelName string) error {
+	key := s.routeKey("halfopen", providerTokenId, modelName)
+	return redisReleaseHalfOpenScript.Run(context.Background(), s.client, []string{key}).Err()
+}
+
+// parseRouteKey splits "<prefix>:<kind>:<id>:<model>"; model names may contain ':'.
+func (s *RedisRouteCooldownStore) parseRouteKey(key string, kind string) (int, string, bool) {
+	rest := strings.TrimPrefix(key, s.prefix+":"+kind+":")
+	if rest == key {
+		return 0, "", false
+	}
+	idPart, modelName, found := strings.Cut(rest, ":")
+	if !found && kind != "token" {
+		return 0, "", false
+	}
+	providerTokenId, err := strconv.Atoi(idPart)
+	if err != nil {
+		return 0, "", false
+	}
+	return providerTokenId, modelName, true
+}
+
+func (s *RedisRouteCooldownStore) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := s.client.Scan(ctx, 0, pattern, 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+func (s *RedisRouteCooldownStore) List() (RouteCooldownSnapshot, error) {
+	ctx := context.Background()
+	snapshot := RouteCooldownSnapshot{}
+
+	routeKeys, err := s.scanKeys(ctx, s.prefix+":route:*")
+	if err != nil {
+		return snapshot, err
+	}
+	for _, key := range routeKeys {
+		providerTokenId, modelName, ok := s.parseRouteKey(key, "route")
+		if !ok {
+			continue
+		}
+		entry, err := s.Load(providerTokenId, modelName)
+		if err != nil {
+			return snapshot, err
+		}
+		if entry.Route == nil {
+			continue
+		}
+		snapshot.Routes = append(snapshot.Routes, RouteCooldownRouteItem{
+			ProviderTokenId:  providerTokenId,
+			ModelName:        modelName,
+			Record:           *entry.Route,
+			HalfOpenInFlight: entry.HalfOpenInFlight,
+		})
+	}
+
+	tokenKeys, err := s.scanKeys(ctx, s.prefix+":token:*")
+	if err != nil {
+		return snapshot, err
+	}
+	for _, key := range tokenKeys {
+		providerTokenId, _, ok := s.parseRouteKey(key, "token")
+		if !ok {
+			continue
+		}
+		record, err := s.LoadToken(providerTokenId)
+		if err != nil {
+			return snapshot, err
+		}
+		if record != nil {
+			snapshot.Tokens = append(snapshot.Tokens, RouteCooldownTokenItem{ProviderTokenId: providerTokenId, Record: *record})
+		}
+	}
+
+	unsupportedKeys, err := s.scanKeys(ctx, s.prefix+":unsupported:*")
+	if err != nil {
+		return snapshot, err
+	}
+	for _, key := range unsupportedKeys {
+		providerTokenId, modelName, ok := s.parseRouteKey(key, "unsupported")
+		if !ok {
+			continue
+		}
+		unix, err := s.client.Get(ctx, key).Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.Unsupported = append(snapshot.Unsupported, RouteCooldownUnsupportedItem{
+			ProviderTokenId: providerTokenId,
+			ModelName:       modelName,
+			Until:           time.Unix(unix, 0),
+		})
+	}
+	return snapshot, nil
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"errors"
+	"sync"
 	"testing"
 	"time"
 )
@@ -344,3 +346,173 @@ func TestRouteCooldownManager_GetRouteCooldownStatusReturnsEmptyWhenDisabled(t *
 	}
 }
 
+
+type failingRouteCooldownStore struct {
+	*MemoryRouteCooldownStore
+}
+
+func (s *failingRouteCooldownStore) Load(providerTokenId int, modelName string) (RouteCooldownEntry, error) {
+	return RouteCooldownEntry{}, errors.New("store unavailable")
+}
+
+func TestRouteCooldownManager_SharedStoreAcrossReplicas(t *testing.T) {
+	clock := time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return clock }
+	cfgFn := func() RouteCooldownConfig {
+		return RouteCooldownConfig{
+			Enabled:               true,
+			BaseSeconds:           30,
+			Multiplier:            2,
+			MaxSeconds:            1800,
+			DecayMinutes:          10,
+			HalfOpenMaxInFlight:   1,
+			UnsupportedModelHours: 24,
+			TokenBaseSeconds:      600,
+			TokenMaxSeconds:       7200,
+		}
+	}
+
+	shared := NewMemoryRouteCooldownStore()
+	nodeA := newRouteCooldownManager(cfgFn, nowFn, func() float64 { return 0.5 })
+	nodeB := newRouteCooldownManager(cfgFn, nowFn, func() float64 { return 0.5 })
+	nodeA.SetStore(shared)
+	nodeB.SetStore(shared)
+
+	nodeA.RecordRouteFailure(1, "gpt-5.2")
+	if nodeB.IsRouteSelectable(1, "GPT-5.2") {
+		t.Fatalf("expected failure recorded on node A to block node B")
+	}
+
+	clock = clock.Add(30 * time.Second)
+	permit, _, ok := nodeA.TryAcquireRouteAttempt(1, "gpt-5.2")
+	if !ok || !permit.halfOpen {
+		t.Fatalf("expected node A to take the half-open slot")
+	}
+	if _, _, ok := nodeB.TryAcquireRouteAttempt(1, "gpt-5.2"); ok {
+		t.Fatalf("expected node B to see the half-open slot taken")
+	}
+	if status := nodeB.GetRouteCooldownStatus(1, "gpt-5.2"); !status.HalfOpen || status.HalfOpenInflight != 1 {
+		t.Fatalf("unexpected status on node B: %+v", status)
+	}
+	permit.Release()
+	permit.Release()
+	if _, _, ok := nodeB.TryAcquireRouteAttempt(1, "gpt-5.2"); !ok {
+		t.Fatalf("expected node B to acquire after node A released")
+	}
+
+	nodeB.MarkUnsupportedModel(2, "claude-x")
+	if nodeA.IsRouteSelectable(2, "claude-x") {
+		t.Fatalf("expected unsupported mark to be shared")
+	}
+	nodeB.RecordTokenFailure(3)
+	if inCooldown, reason, _ := nodeA.GetTokenCooldownStatus(3); !inCooldown || reason != "token" {
+		t.Fatalf("expected token cooldown to be shared")
+	}
+}
+
+func TestRouteCooldownManager_HalfOpenSlotsSurviveRecordUpdates(t *testing.T) {
+	clock := time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return clock }
+	cfgFn := func() RouteCooldownConfig {
+		return RouteCooldownConfig{Enabled: true, BaseSeconds: 30, Multiplier: 2, MaxSeconds: 1800, HalfOpenMaxInFlight: 1, TokenBaseSeconds: 600, TokenMaxSeconds: 7200}
+	}
+	manager := newRouteCooldownManager(cfgFn, nowFn, func() float64 { return 0.5 })
+
+	manager.RecordRouteFailure(1, "gpt-5.2")
+	clock = clock.Add(30 * time.Second)
+	first, _, ok := manager.TryAcquireRouteAttempt(1, "gpt-5.2")
+	if !ok || !first.halfOpen {
+		t.Fatalf("expected the first half-open probe to be admitted")
+	}
+
+	// The probe fails and reopens the route before its permit is released.
+	manager.RecordRouteFailure(1, "gpt-5.2")
+	clock = clock.Add(time.Hour)
+	if _, _, ok := manager.TryAcquireRouteAttempt(1, "gpt-5.2"); ok {
+		t.Fatalf("expected the unreleased probe to keep holding the half-open slot")
+	}
+
+	first.Release()
+	second, _, ok := manager.TryAcquireRouteAttempt(1, "gpt-5.2")
+	if !ok || !second.halfOpen {
+		t.Fatalf("expected a new probe once the first permit was released")
+	}
+	if _, _, ok := manager.TryAcquireRouteAttempt(1, "gpt-5.2"); ok {
+		t.Fatalf("expected no more than one half-open probe in flight")
+	}
+	second.Release()
+}
+
+func TestRouteCooldownManager_ConcurrentReplicasKeepEveryFailure(t *testing.T) {
+	cfgFn := func() RouteCooldownConfig {
+		return RouteCooldownConfig{Enabled: true, BaseSeconds: 30, MaxSeconds: 60, TokenBaseSeconds: 30, TokenMaxSeconds: 60}
+	}
+	shared := NewMemoryRouteCooldownStore()
+	nodeA := NewRouteCooldownManager(cfgFn)
+	nodeB := NewRouteCooldownManager(cfgFn)
+	nodeA.SetStore(shared)
+	nodeB.SetStore(shared)
+
+	const perNode = 50
+	var wg sync.WaitGroup
+	for _, node := range []*RouteCooldownManager{nodeA, nodeB} {
+		wg.Add(1)
+		go func(node *RouteCooldownManager) {
+			defer wg.Done()
+			for i := 0; i < perNode; i++ {
+				node.RecordRouteFailure(1, "gpt-5.2")
+				node.RecordTokenFailure(1)
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	snapshot, err := shared.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Routes) != 1 || snapshot.Routes[0].Record.ConsecutiveFailures != 2*perNode {
+		t.Fatalf("expected %d route failures, got %+v", 2*perNode, snapshot.Routes)
+	}
+	if len(snapshot.Tokens) != 1 || snapshot.Tokens[0].Record.ConsecutiveFailures != 2*perNode {
+		t.Fatalf("expected %d token failures, got %+v", 2*perNode, snapshot.Tokens)
+	}
+}
+
+func TestRouteCooldownManager_StoreErrorsFailOpen(t *testing.T) {
+	mgr := newRouteCooldownManager(func() RouteCooldownConfig {
+		return RouteCooldownConfig{Enabled: true, BaseSeconds: 30, MaxSeconds: 60}
+	}, nil, nil)
+	mgr.SetStore(&failingRouteCooldownStore{MemoryRouteCooldownStore: NewMemoryRouteCooldownStore()})
+
+	mgr.RecordRouteFailure(1, "gpt-5.2")
+	if !mgr.IsRouteSelectable(1, "gpt-5.2") {
+		t.Fatalf("expected route selectable when the store is unavailable")
+	}
+	if permit, _, ok := mgr.TryAcquireRouteAttempt(1, "gpt-5.2"); !ok || permit == nil {
+		t.Fatalf("expected permit when the store is unavailable")
+	}
+}
+
+func TestRouteCooldownManager_Stats(t *testing.T) {
+	clock := time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	mgr := newRouteCooldownManager(func() RouteCooldownConfig {
+		return RouteCooldownConfig{Enabled: true, BaseSeconds: 30, MaxSeconds: 60, UnsupportedModelHours: 1, TokenBaseSeconds: 60, TokenMaxSeconds: 60}
+	}, func() time.Time { return clock }, func() float64 { return 0.5 })
+
+	mgr.RecordRouteFailure(1, "a")
+	mgr.RecordRouteFailure(1, "b")
+	mgr.RecordTokenFailure(2)
+	mgr.MarkUnsupportedModel(3, "c")
+	clock = clock.Add(45 * time.Second)
+	mgr.RecordRouteFailure(1, "a")
+
+	stats, err := mgr.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RouteCooldownStats{RoutesInCooldown: 1, RoutesHalfOpen: 1, TokensInCooldown: 1, UnsupportedModels: 1}
+	if stats != want {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,200 @@
+package common
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// routeLatencyAlpha weights the newest sample in every EWMA.
+	routeLatencyAlpha = 0.3
+	// routeLatencyStaleAfter drops statistics of routes that stopped
+	// receiving traffic, so they are probed again. Stale entries are evicted
+	// on write at most once per period.
+	routeLatencyStaleAfter = 15 * time.Minute
+)
+
+// RouteLatencyStats are live EWMA statistics of one (provider token, model)
+// route. Latencies only include successful attempts. Streaming and
+// non-streaming requests are tracked apart: streams by time to first token,
+// other requests by total latency.
+type RouteLatencyStats struct {
+	// LatencyMs is the total latency of non-streaming requests.
+	LatencyMs float64 `json:"latency_ms"`
+	// LatencyVar is the EWMA variance of LatencyMs.
+	LatencyVar     float64 `json:"latency_var"`
+	LatencySamples int64   `json:"latency_samples"`
+	// FirstTokenMs is the time to first token of streaming requests.
+	FirstTokenMs      float64   `json:"first_token_ms"`
+	FirstTokenSamples int64     `json:"first_token_samples"`
+	ErrorRate         float64   `json:"error_rate"`
+	Samples           int64     `json:"samples"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Latency returns the EWMA matching the request kind and whether it has any
+// sample yet.
+func (s RouteLatencyStats) Latency(stream bool) (float64, bool) {
+	if stream {
+		return s.FirstTokenMs, s.FirstTokenSamples > 0
+	}
+	return s.LatencyMs, s.LatencySamples > 0
+}
+
+// RouteLatencyTracker keeps RouteLatencyStats in memory. State is per process.
+type RouteLatencyTracker struct {
+	mu        sync.RWMutex
+	stats     map[string]*RouteLatencyStats
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRouteLatencyTracker() *RouteLatencyTracker {
+	return &RouteLatencyTracker{
+		stats: make(map[string]*RouteLatencyStats),
+		now:   time.Now,
+	}
+}
+
+var GlobalRouteLatency = NewRouteLatencyTracker()
+
+func routeLatencyKey(providerTokenId int, modelName string) string {
+	return strconv.Itoa(providerTokenId) + "#" + strings.TrimSpace(modelName)
+}
+
+func ewma(current float64, sample float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return current + routeLatencyAlpha*(sample-current)
+}
+
+// Observe records one upstream attempt. Streaming requests sample
+// firstTokenMs, falling back to latencyMs when the upstream answered without
+// streaming; other requests sample latencyMs.
+func (t *RouteLatencyTracker) Observe(providerTokenId int, modelName string, stream bool, success bool, latencyMs int, firstTokenMs int) {
+	if providerTokenId <= 0 || strings.TrimSpace(modelName) == "" {
+		return
+	}
+	key := routeLatencyKey(providerTokenId, modelName)
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(now)
+	stats, ok := t.stats[key]
+	if !ok || now.Sub(stats.UpdatedAt) > routeLatencyStaleAfter {
+		stats = &RouteLatencyStats{}
+		t.stats[key] = stats
+	}
+	errorSample := 0.0
+	if !success {
+		errorSample = 1
+	}
+	stats.ErrorRate = ewma(stats.ErrorRate, errorSample, stats.Samples == 0)
+	stats.Samples++
+	if success && stream {
+		if firstTokenMs <= 0 {
+			firstTokenMs = latencyMs
+		}
+		if firstTokenMs > 0 {
+			stats.FirstTokenMs = ewma(stats.FirstTokenMs, float64(firstTokenMs), stats.FirstTokenSamples == 0)
+			stats.FirstTokenSamples++
+		}
+	} else if success && latencyMs > 0 {
+		if stats.LatencySamples == 0 {
+			stats.LatencyMs = float64(latencyMs)
+		} else {
+			diff := float64(latencyMs) - stats.LatencyMs
+			stats.LatencyMs += routeLatencyAlpha * diff
+			stats.LatencyVar = (1 - routeLatencyAlpha) * (stats.LatencyVar + routeLatencyAlpha*diff*diff)
+		}
+		stats.LatencySamples++
+	}
+	stats.UpdatedAt = now
+}
+
+// sweepLocked evicts stale entries, so deleted tokens and renamed models do
+// not accumulate.
+func (t *RouteLatencyTracker) sweepLocked(now time.Time) {
+	if now.Sub(t.lastSweep) < routeLatencyStaleAfter {
+		return
+	}
+	t.lastSweep = now
+	for key, stats := range t.stats {
+		if now.Sub(stats.UpdatedAt) > routeLatencyStaleAfter {
+			delete(t.stats, key)
+		}
+	}
+}
+
+// LatencyP90Ms estimates the 90th percentile latency assuming a normal
+// distribution around the EWMA.
+func (s RouteLatencyStats) LatencyP90Ms() float64 {
+	return s.LatencyMs + 1.2816*math.Sqrt(s.LatencyVar)
+}
+
+// Get returns the statistics of a route; stale entries are reported missing.
+func (t *RouteLatencyTracker) Get(providerTokenId int, modelName string) (RouteLatencyStats, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	stats, ok := t.stats[routeLatencyKey(providerTokenId, modelName)]
+	if !ok || t.now().Sub(stats.UpdatedAt) > routeLatencyStaleAfter {
+		return RouteLatencyStats{}, false
+	}
+	return *stats, true
+}
+
+// RouteLatencyConfig selects the models routed by latency for tokens that do
+// not pick a strategy themselves.
+type RouteLatencyConfig struct {
+	Models []string
+}
+
+const routingLatencyModelsOptionKey = "RoutingLatencyModels"
+
+func LoadRouteLatencyConfig() RouteLatencyConfig {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return RouteLatencyConfig{}
+	}
+	return RouteLatencyConfig{Models: splitOptionList(OptionMap[routingLatencyModelsOptionKey])}
+}
+
+// ModelEnabled reports whether modelName defaults to latency routing.
+func (cfg RouteLatencyConfig) ModelEnabled(modelName string) bool {
+	return modelListContains(cfg.Models, modelName)
+}
+
+func splitOptionList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// modelListContains matches modelName against models case-insensitively and
+// by normalized model name.
+func modelListContains(models []string, modelName string) bool {
+	requested := strings.ToLower(strings.TrimSpace(modelName))
+	if requested == "" {
+		return false
+	}
+	normalized := NormalizeModelName(requested)
+	for _, candidate := range models {
+		if strings.ToLower(candidate) == requested {
+			return true
+		}
+		if normalized != "" && NormalizeModelName(candidate) == normalized {
+			return true
+		}
+	}
+	return false
+}
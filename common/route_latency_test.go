@@ -0,0 +1,54 @@
+package common
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRouteLatencyTrackerEWMAAndStaleness(t *testing.T) {
+	clock := time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	tracker := NewRouteLatencyTracker()
+	tracker.now = func() time.Time { return clock }
+
+	if _, ok := tracker.Get(1, "gpt-4o"); ok {
+		t.Fatalf("expected no stats before the first observation")
+	}
+	tracker.Observe(1, "gpt-4o", true, true, 9000, 400)
+	tracker.Observe(1, "gpt-4o", false, true, 1000, 0)
+	tracker.Observe(1, "gpt-4o", false, true, 2000, 0)
+	tracker.Observe(1, "gpt-4o", false, false, 50, 0)
+
+	stats, ok := tracker.Get(1, "gpt-4o")
+	if !ok {
+		t.Fatalf("expected stats after observations")
+	}
+	if stats.LatencyMs != 1300 || stats.LatencySamples != 2 || stats.Samples != 4 {
+		t.Fatalf("unexpected latency stats: %+v", stats)
+	}
+	if stats.FirstTokenMs != 400 || stats.FirstTokenSamples != 1 {
+		t.Fatalf("expected the stream sample kept apart, got %+v", stats)
+	}
+	if latency, ok := stats.Latency(true); !ok || latency != 400 {
+		t.Fatalf("expected stream latency 400, got %v", latency)
+	}
+	if math.Abs(stats.ErrorRate-0.3) > 1e-9 {
+		t.Fatalf("expected error rate 0.3 after one failure, got %v", stats.ErrorRate)
+	}
+
+	clock = clock.Add(routeLatencyStaleAfter + time.Second)
+	if _, ok := tracker.Get(1, "gpt-4o"); ok {
+		t.Fatalf("expected stale stats to be reported missing")
+	}
+	tracker.Observe(1, "gpt-4o", false, true, 500, 0)
+	if stats, _ = tracker.Get(1, "gpt-4o"); stats.LatencyMs != 500 || stats.ErrorRate != 0 || stats.Samples != 1 {
+		t.Fatalf("expected stale stats to restart from the new sample, got %+v", stats)
+	}
+
+	tracker.Observe(2, "renamed-model", false, true, 800, 0)
+	clock = clock.Add(2*routeLatencyStaleAfter + time.Second)
+	tracker.Observe(1, "gpt-4o", false, true, 500, 0)
+	if _, ok := tracker.stats[routeLatencyKey(2, "renamed-model")]; ok || len(tracker.stats) != 1 {
+		t.Fatalf("expected stale entries to be evicted on write, got %d entries", len(tracker.stats))
+	}
+}
@@ -0,0 +1,221 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// RouteProbeConfig controls active health probing: every enabled model route
+// is periodically sent a minimal request through the normal relay path.
+type RouteProbeConfig struct {
+	Enabled  bool
+	Interval time.Duration
+	// ProviderDailyCostUSD caps the estimated probe spend per provider per
+	// local calendar day; 0 disables the cap.
+	ProviderDailyCostUSD float64
+	// DeadAfterFailures consecutive failed probes flag a route as dead.
+	DeadAfterFailures int
+}
+
+const (
+	routeProbeEnabledOptionKey              = "RouteProbeEnabled"
+	routeProbeIntervalMinutesOptionKey      = "RouteProbeIntervalMinutes"
+	routeProbeProviderDailyCostUSDOptionKey = "RouteProbeProviderDailyCostUSD"
+	routeProbeDeadAfterFailuresOptionKey    = "RouteProbeDeadAfterFailures"
+)
+
+func LoadRouteProbeConfig() RouteProbeConfig {
+	defaultCfg := RouteProbeConfig{
+		Enabled:              false,
+		Interval:             10 * time.Minute,
+		ProviderDailyCostUSD: 0.1,
+		DeadAfterFailures:    3,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Enabled = parseOptionBool(OptionMap[routeProbeEnabledOptionKey], defaultCfg.Enabled)
+	minutes := parseOptionIntInRange(OptionMap[routeProbeIntervalMinutesOptionKey], int(defaultCfg.Interval/time.Minute), 1, 24*60)
+	out.Interval = time.Duration(minutes) * time.Minute
+	out.ProviderDailyCostUSD = parseOptionFloatInRange(OptionMap[routeProbeProviderDailyCostUSDOptionKey], defaultCfg.ProviderDailyCostUSD, 0, 1000)
+	out.DeadAfterFailures = parseOptionIntInRange(OptionMap[routeProbeDeadAfterFailuresOptionKey], defaultCfg.DeadAfterFailures, 1, 100)
+	return out
+}
+
+const (
+	RouteProbeStatusSuccess = "success"
+	RouteProbeStatusFailure = "failure"
+	// RouteProbeStatusSkipped means the route was not probed this round, e.g.
+	// it was in cooldown or the provider reached its probe cost cap.
+	RouteProbeStatusSkipped = "skipped"
+)
+
+// RouteProbeResult is the last probe of one (provider token, model) route.
+type RouteProbeResult struct {
+	Status              string    `json:"status"`
+	LatencyMs           int       `json:"latency_ms"`
+	HttpStatus          int       `json:"http_status"`
+	Message             string    `json:"message"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Dead                bool      `json:"dead"`
+	ProbedAt            time.Time `json:"probed_at"`
+}
+
+// RouteProbeDeadRoute is a route flagged dead by the prober.
+type RouteProbeDeadRoute struct {
+	ProviderTokenId int
+	ModelName       string
+	Result          RouteProbeResult
+}
+
+type routeProbeKey struct {
+	providerTokenId int
+	modelName       string
+}
+
+type routeProbeSpend struct {
+	day     string
+	costUSD float64
+}
+
+// RouteProbeTracker keeps the last probe result of every route and the daily
+// probe spend of every provider. State is per process.
+type RouteProbeTracker struct {
+	mu      sync.RWMutex
+	results map[routeProbeKey]*RouteProbeResult
+	spend   map[int]*routeProbeSpend
+	now     func() time.Time
+}
+
+func NewRouteProbeTracker() *RouteProbeTracker {
+	return &RouteProbeTracker{
+		results: make(map[routeProbeKey]*RouteProbeResult),
+		spend:   make(map[int]*routeProbeSpend),
+		now:     time.Now,
+	}
+}
+
+var GlobalRouteProbe = NewRouteProbeTracker()
+
+func newRouteProbeKey(providerTokenId int, modelName string) routeProbeKey {
+	return routeProbeKey{providerTokenId: providerTokenId, modelName: strings.TrimSpace(modelName)}
+}
+
+// Record stores the outcome of a probe that reached the route. A route is
+// flagged dead after deadAfterFailures consecutive failures and cleared by
+// the next success.
+func (t *RouteProbeTracker) Record(providerTokenId int, modelName string, success bool, latencyMs int, httpStatus int, message string, deadAfterFailures int) RouteProbeResult {
+	key := newRouteProbeKey(providerTokenId, modelName)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result, ok := t.results[key]
+	if !ok {
+		result = &RouteProbeResult{}
+		t.results[key] = result
+	}
+	result.LatencyMs = latencyMs
+	result.HttpStatus = httpStatus
+	result.Message = message
+	result.ProbedAt = t.now()
+	if success {
+		result.Status = RouteProbeStatusSuccess
+		result.ConsecutiveFailures = 0
+		result.Dead = false
+	} else {
+		result.Status = RouteProbeStatusFailure
+		result.ConsecutiveFailures++
+		result.Dead = deadAfterFailures > 0 && result.ConsecutiveFailures >= deadAfterFailures
+	}
+	return *result
+}
+
+// RecordSkip notes that a route was not probed. The failure streak and the
+// dead flag are kept until the route is probed again.
+func (t *RouteProbeTracker) RecordSkip(providerTokenId int, modelName string, reason string) {
+	key := newRouteProbeKey(providerTokenId, modelName)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result, ok := t.results[key]
+	if !ok {
+		result = &RouteProbeResult{}
+		t.results[key] = result
+	}
+	result.Status = RouteProbeStatusSkipped
+	result.LatencyMs = 0
+	result.HttpStatus = 0
+	result.Message = reason
+	result.ProbedAt = t.now()
+}
+
+// Get returns the last probe result of a route.
+func (t *RouteProbeTracker) Get(providerTokenId int, modelName string) (RouteProbeResult, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result, ok := t.results[newRouteProbeKey(providerTokenId, modelName)]
+	if !ok {
+		return RouteProbeResult{}, false
+	}
+	return *result, true
+}
+
+// DeadRoutes lists the routes currently flagged dead.
+func (t *RouteProbeTracker) DeadRoutes() []RouteProbeDeadRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var out []RouteProbeDeadRoute
+	for key, result := range t.results {
+		if result.Dead {
+			out = append(out, RouteProbeDeadRoute{
+				ProviderTokenId: key.providerTokenId,
+				ModelName:       key.modelName,
+				Result:          *result,
+			})
+		}
+	}
+	return out
+}
+
+// Retain drops the results of routes for which keep returns false, so
+// deleted or disabled routes stop being reported.
+func (t *RouteProbeTracker) Retain(keep func(providerTokenId int, modelName string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.results {
+		if !keep(key.providerTokenId, key.modelName) {
+			delete(t.results, key)
+		}
+	}
+}
+
+func (t *RouteProbeTracker) spendLocked(providerId int) *routeProbeSpend {
+	day := t.now().Format("2006-01-02")
+	spend, ok := t.spend[providerId]
+	if !ok || spend.day != day {
+		spend = &routeProbeSpend{day: day}
+		t.spend[providerId] = spend
+	}
+	return spend
+}
+
+// ProviderSpentUSD returns the estimated probe spend of a provider today.
+func (t *RouteProbeTracker) ProviderSpentUSD(providerId int) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spendLocked(providerId).costUSD
+}
+
+// AddProviderCost adds the estimated cost of a probe to today's spend.
+func (t *RouteProbeTracker) AddProviderCost(providerId int, costUSD float64) {
+	if costUSD <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spendLocked(providerId).costUSD += costUSD
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRouteProbeTrackerFlagsDeadRoutesAndTracksDailySpend(t *testing.T) {
+	clock := time.Date(2026, 10, 17, 23, 0, 0, 0, time.Local)
+	tracker := NewRouteProbeTracker()
+	tracker.now = func() time.Time { return clock }
+
+	tracker.Record(1, "gpt-4o", false, 100, 502, "bad gateway", 2)
+	tracker.RecordSkip(1, "gpt-4o", "route in cooldown")
+	result := tracker.Record(1, "gpt-4o", false, 120, 502, "bad gateway", 2)
+	if !result.Dead || result.ConsecutiveFailures != 2 {
+		t.Fatalf("expected the route to be dead after two failed probes, got %+v", result)
+	}
+	tracker.RecordSkip(1, "gpt-4o", "provider probe cost cap reached")
+	if result, _ = tracker.Get(1, "gpt-4o"); result.Status != RouteProbeStatusSkipped || !result.Dead {
+		t.Fatalf("a skipped probe should keep the dead flag, got %+v", result)
+	}
+	if dead := tracker.DeadRoutes(); len(dead) != 1 || dead[0].ProviderTokenId != 1 || dead[0].ModelName != "gpt-4o" {
+		t.Fatalf("unexpected dead routes: %+v", dead)
+	}
+	if result = tracker.Record(1, "gpt-4o", true, 80, 200, "", 2); result.Dead || result.ConsecutiveFailures != 0 {
+		t.Fatalf("a successful probe should clear the dead flag, got %+v", result)
+	}
+
+	tracker.Retain(func(providerTokenId int, modelName string) bool { return false })
+	if _, ok := tracker.Get(1, "gpt-4o"); ok {
+		t.Fatalf("expected results of dropped routes to be removed")
+	}
+
+	tracker.AddProviderCost(7, 0.03)
+	tracker.AddProviderCost(7, 0.02)
+	if spent := tracker.ProviderSpentUSD(7); spent < 0.049 || spent > 0.051 {
+		t.Fatalf("expected 0.05 spent today, got %v", spent)
+	}
+	clock = clock.Add(2 * time.Hour)
+	if spent := tracker.ProviderSpentUSD(7); spent != 0 {
+		t.Fatalf("expected the spend to reset on a new day, got %v", spent)
+	}
+}
@@ -0,0 +1,42 @@
+package common
+
+import "time"
+
+// StreamFailoverConfig controls buffering of SSE responses so that a stream
+// which fails before producing content can still be retried on another route.
+type StreamFailoverConfig struct {
+	Enabled bool
+	// MaxBufferBytes releases the buffered stream to the client once exceeded,
+	// even if no content delta has been seen yet.
+	MaxBufferBytes int
+	// FirstContentTimeout aborts and fails over a stream that produced no
+	// content in time. Zero leaves stalls to the stream idle timeout.
+	FirstContentTimeout time.Duration
+}
+
+const (
+	streamFailoverEnabledOptionKey             = "StreamFailoverEnabled"
+	streamFailoverMaxBufferBytesOptionKey      = "StreamFailoverMaxBufferBytes"
+	streamFailoverFirstContentTimeoutOptionKey = "StreamFailoverFirstContentTimeoutSeconds"
+)
+
+func LoadStreamFailoverConfig() StreamFailoverConfig {
+	defaultCfg := StreamFailoverConfig{
+		Enabled:             false,
+		MaxBufferBytes:      64 * 1024,
+		FirstContentTimeout: 15 * time.Second,
+	}
+
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return defaultCfg
+	}
+
+	out := defaultCfg
+	out.Enabled = parseOptionBool(OptionMap[streamFailoverEnabledOptionKey], defaultCfg.Enabled)
+	out.MaxBufferBytes = parseOptionIntInRange(OptionMap[streamFailoverMaxBufferBytesOptionKey], defaultCfg.MaxBufferBytes, 1024, 8*1024*1024)
+	timeoutSeconds := parseOptionIntInRange(OptionMap[streamFailoverFirstContentTimeoutOptionKey], int(defaultCfg.FirstContentTimeout/time.Second), 0, 600)
+	out.FirstContentTimeout = time.Duration(timeoutSeconds) * time.Second
+	return out
+}
@@ -0,0 +1,35 @@
+package common
+
+// UsageRetentionConfig controls how long raw usage logs and LLM traces are
+// kept. Zero keeps rows forever. Pruned usage logs stay visible in dashboard
+// and summary totals through the usage rollups.
+type UsageRetentionConfig struct {
+	UsageLogDays int
+	LLMTraceDays int
+}
+
+// MinUsageLogRetentionDays keeps a full calendar month of raw usage logs,
+// which budgets and the routing usage window still read directly.
+const MinUsageLogRetentionDays = 32
+
+const (
+	usageLogRetentionDaysOptionKey = "UsageLogRetentionDays"
+	llmTraceRetentionDaysOptionKey = "LLMTraceRetentionDays"
+)
+
+func LoadUsageRetentionConfig() UsageRetentionConfig {
+	OptionMapRWMutex.RLock()
+	defer OptionMapRWMutex.RUnlock()
+	if OptionMap == nil {
+		return UsageRetentionConfig{}
+	}
+
+	out := UsageRetentionConfig{
+		UsageLogDays: parseOptionIntInRange(OptionMap[usageLogRetentionDaysOptionKey], 0, 0, 3650),
+		LLMTraceDays: parseOptionIntInRange(OptionMap[llmTraceRetentionDaysOptionKey], 0, 0, 3650),
+	}
+	if out.UsageLogDays > 0 && out.UsageLogDays < MinUsageLogRetentionDays {
+		out.UsageLogDays = MinUsageLogRetentionDays
+	}
+	return out
+}
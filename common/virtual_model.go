@@ -0,0 +1,140 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// VirtualModelTarget is one concrete model behind a virtual model. Targets
+// with a positive weight are tried in weighted random order; zero-weight
+// targets are standbys tried afterwards in listed order.
+type VirtualModelTarget struct {
+	Model  string `json:"model"`
+	Weight int    `json:"weight"`
+}
+
+// virtualModelsOptionKey holds a JSON object mapping virtual model names to
+// their targets, e.g. {"team-default":[{"model":"gpt-4o","weight":3}]}.
+const virtualModelsOptionKey = "VirtualModels"
+
+// ParseVirtualModels validates the VirtualModels option. Names are matched
+// case-insensitively and must be unique; targets are concrete models and are
+// never expanded again.
+func ParseVirtualModels(raw string) (map[string][]VirtualModelTarget, error) {
+	out := make(map[string][]VirtualModelTarget)
+	if strings.TrimSpace(raw) == "" {
+		return out, nil
+	}
+	var parsed map[string][]VirtualModelTarget
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("虚拟模型配置必须是 JSON 对象：%v", err)
+	}
+	seenNames := make(map[string]bool, len(parsed))
+	for name, targets := range parsed {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("虚拟模型名称不能为空")
+		}
+		if seenNames[strings.ToLower(name)] {
+			return nil, fmt.Errorf("虚拟模型 %s 重复定义", name)
+		}
+		seenNames[strings.ToLower(name)] = true
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("虚拟模型 %s 至少需要一个目标模型", name)
+		}
+		seenTargets := make(map[string]bool, len(targets))
+		clean := make([]VirtualModelTarget, 0, len(targets))
+		for _, target := range targets {
+			target.Model = strings.TrimSpace(target.Model)
+			if target.Model == "" {
+				return nil, fmt.Errorf("虚拟模型 %s 的目标模型不能为空", name)
+			}
+			if target.Weight < 0 {
+				return nil, fmt.Errorf("虚拟模型 %s 的目标 %s 权重不能为负数", name, target.Model)
+			}
+			if seenTargets[strings.ToLower(target.Model)] {
+				return nil, fmt.Errorf("虚拟模型 %s 的目标 %s 重复", name, target.Model)
+			}
+			seenTargets[strings.ToLower(target.Model)] = true
+			clean = append(clean, target)
+		}
+		out[name] = clean
+	}
+	return out, nil
+}
+
+func loadVirtualModels() map[string][]VirtualModelTarget {
+	OptionMapRWMutex.RLock()
+	raw := ""
+	if OptionMap != nil {
+		raw = OptionMap[virtualModelsOptionKey]
+	}
+	OptionMapRWMutex.RUnlock()
+	models, err := ParseVirtualModels(raw)
+	if err != nil {
+		return nil
+	}
+	return models
+}
+
+// GetVirtualModelTargets returns the targets of a virtual model. A virtual
+// model shadows a concrete model with the same name.
+func GetVirtualModelTargets(name string) ([]VirtualModelTarget, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, false
+	}
+	for virtualName, targets := range loadVirtualModels() {
+		if strings.EqualFold(virtualName, name) {
+			return targets, true
+		}
+	}
+	return nil, false
+}
+
+// VirtualModelNames returns the configured virtual model names, sorted.
+func VirtualModelNames() []string {
+	models := loadVirtualModels()
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OrderVirtualModelTargets returns the target models in the order to try:
+// weighted random without replacement, then zero-weight standbys.
+func OrderVirtualModelTargets(targets []VirtualModelTarget) []string {
+	weighted := make([]VirtualModelTarget, 0, len(targets))
+	var standby []string
+	for _, target := range targets {
+		if target.Weight > 0 {
+			weighted = append(weighted, target)
+		} else {
+			standby = append(standby, target.Model)
+		}
+	}
+
+	ordered := make([]string, 0, len(targets))
+	for len(weighted) > 0 {
+		total := 0
+		for _, target := range weighted {
+			total += target.Weight
+		}
+		pick := rand.Intn(total)
+		idx := 0
+		for ; idx < len(weighted)-1; idx++ {
+			if pick < weighted[idx].Weight {
+				break
+			}
+			pick -= weighted[idx].Weight
+		}
+		ordered = append(ordered, weighted[idx].Model)
+		weighted = append(weighted[:idx], weighted[idx+1:]...)
+	}
+	return append(ordered, standby...)
+}
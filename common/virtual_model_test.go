@@ -0,0 +1,74 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVirtualModelsValidates(t *testing.T) {
+	models, err := ParseVirtualModels(`{" team-default ":[{"model":" gpt-4o ","weight":3},{"model":"claude-sonnet-4","weight":0}]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []VirtualModelTarget{{Model: "gpt-4o", Weight: 3}, {Model: "claude-sonnet-4", Weight: 0}}
+	if !reflect.DeepEqual(models["team-default"], want) {
+		t.Fatalf("unexpected targets: %+v", models)
+	}
+
+	for _, raw := range []string{
+		`[]`,
+		`{"a":[]}`,
+		`{"a":[{"model":"","weight":1}]}`,
+		`{"a":[{"model":"m","weight":-1}]}`,
+		`{"a":[{"model":"m","weight":1},{"model":"M","weight":1}]}`,
+		`{"a":[{"model":"m","weight":1}],"A":[{"model":"n","weight":1}]}`,
+	} {
+		if _, err := ParseVirtualModels(raw); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestOrderVirtualModelTargetsKeepsStandbysLast(t *testing.T) {
+	targets := []VirtualModelTarget{
+		{Model: "standby-a", Weight: 0},
+		{Model: "primary-a", Weight: 1},
+		{Model: "standby-b", Weight: 0},
+		{Model: "primary-b", Weight: 1000000},
+	}
+	sawPrimaryBFirst := false
+	for i := 0; i < 20; i++ {
+		ordered := OrderVirtualModelTargets(targets)
+		if len(ordered) != 4 || ordered[2] != "standby-a" || ordered[3] != "standby-b" {
+			t.Fatalf("unexpected order: %v", ordered)
+		}
+		if ordered[0] == "primary-b" {
+			sawPrimaryBFirst = true
+		}
+	}
+	if !sawPrimaryBFirst {
+		t.Fatal("expected the heavily weighted target to come first")
+	}
+}
+
+func TestGetVirtualModelTargetsIsCaseInsensitive(t *testing.T) {
+	OptionMapRWMutex.Lock()
+	previous := OptionMap
+	OptionMap = map[string]string{"VirtualModels": `{"Team-Default":[{"model":"gpt-4o","weight":1}]}`}
+	OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		OptionMapRWMutex.Lock()
+		OptionMap = previous
+		OptionMapRWMutex.Unlock()
+	})
+
+	if _, ok := GetVirtualModelTargets("team-default"); !ok {
+		t.Fatal("expected case-insensitive lookup")
+	}
+	if _, ok := GetVirtualModelTargets("gpt-4o"); ok {
+		t.Fatal("expected concrete model not to be virtual")
+	}
+	if names := VirtualModelNames(); !reflect.DeepEqual(names, []string{"Team-Default"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -96,6 +97,49 @@ func GetAllLogs(c *gin.Context) {
 	})
 }
 
+// GetChargebackReport totals upstream cost and internal chargeback per user
+// and user group. The period defaults to the current month.
+func GetChargebackReport(c *gin.Context) {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Unix()
+	end := now.Unix()
+	if raw := strings.TrimSpace(c.Query("start_timestamp")); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的开始时间"})
+			return
+		}
+		start = value
+	}
+	if raw := strings.TrimSpace(c.Query("end_timestamp")); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的结束时间"})
+			return
+		}
+		end = value
+	}
+	if end <= start {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "结束时间必须晚于开始时间"})
+		return
+	}
+	users, groups, err := model.QueryChargebackReport(start, end)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"start_timestamp": start,
+			"end_timestamp":   end,
+			"users":           users,
+			"groups":          groups,
+		},
+	})
+}
+
 func GetDashboard(c *gin.Context) {
 	stats, err := model.GetDashboardStats()
 	if err != nil {
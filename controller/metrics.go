@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"NewAPI-Gateway/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsHandler = promhttp.HandlerFor(common.MetricsRegistry, promhttp.HandlerOpts{})
+
+// GetMetrics serves relay, routing, cooldown, sync and CPA telemetry in the
+// Prometheus text format.
+// GET /metrics
+func GetMetrics(c *gin.Context) {
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/middleware"
+	"NewAPI-Gateway/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newMetricsTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("metrics-test"))))
+	router.GET("/metrics", middleware.MetricsAuth(), GetMetrics)
+	return router
+}
+
+func withMetricsToken(t *testing.T, token string) {
+	t.Helper()
+	original := common.MetricsToken
+	common.MetricsToken = token
+	t.Cleanup(func() { common.MetricsToken = original })
+}
+
+func scrapeMetrics(t *testing.T, router *gin.Engine, bearer string) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	return recorder.Body.String()
+}
+
+// metricValue returns the value of the series named exactly series, or 0 when
+// it has not been exported yet.
+func metricValue(body string, series string) float64 {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), series+" ")
+		if !found {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err == nil {
+			return parsed
+		}
+	}
+	return 0
+}
+
+func TestGetMetricsExposesRelayCounters(t *testing.T) {
+	withMetricsToken(t, "scrape-secret")
+	router := newMetricsTestRouter()
+	series := map[string]float64{
+		`gateway_relay_requests_total{model="metrics-test-model",provider="metrics-test-provider",status="429"}`: 1,
+		`gateway_relay_tokens_total{model="metrics-test-model",provider="metrics-test-provider",type="prompt"}`:  10,
+		`gateway_first_token_latency_seconds_count{model="metrics-test-model",provider="metrics-test-provider"}`: 1,
+		`gateway_relay_attempts_per_request_count{outcome="failure"}`:                                            1,
+	}
+	before := scrapeMetrics(t, router, "scrape-secret")
+
+	common.ObserveRelayAttempt("metrics-test-model", "metrics-test-provider", false, 429, true, 10, 0, 1500, 200)
+	common.ObserveRelayRequest(2, false)
+
+	after := scrapeMetrics(t, router, "scrape-secret")
+	for name, delta := range series {
+		if got := metricValue(after, name) - metricValue(before, name); got != delta {
+			t.Fatalf("expected %s to grow by %v, got %v", name, delta, got)
+		}
+	}
+	if !strings.Contains(after, "gateway_route_cooldown_scrape_error 0") {
+		t.Fatal("expected cooldown scrape error gauge")
+	}
+}
+
+func TestGetMetricsRequiresRootWithoutToken(t *testing.T) {
+	withMetricsToken(t, "")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	model.DB = db
+	if err := model.DB.AutoMigrate(&model.User{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	users := []model.User{
+		{Username: "metrics-root", Role: common.RoleRootUser, Status: common.UserStatusEnabled, Token: "root-access-token"},
+		{Username: "metrics-user", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, Token: "user-access-token"},
+	}
+	if err := model.DB.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	router := newMetricsTestRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer user-access-token")
+	router.ServeHTTP(recorder, req)
+	if strings.Contains(recorder.Body.String(), "gateway_") {
+		t.Fatal("expected metrics hidden from non-root users")
+	}
+
+	if body := scrapeMetrics(t, router, "root-access-token"); !strings.Contains(body, "gateway_route_cooldown_scrape_error") {
+		t.Fatal("expected metrics for the root user")
+	}
+}
+
+func TestGetMetricsRequiresTokenWhenConfigured(t *testing.T) {
+	withMetricsToken(t, "scrape-secret")
+	router := newMetricsTestRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	modelListFormatOpenAI    = "openai"
+	modelListFormatAnthropic = "anthropic"
+	modelListFormatGemini    = "gemini"
+
+	modelOwner = "aggregated-gateway"
+)
+
+// modelListFormat picks the listing format of the caller's SDK: Gemini for
+// /v1beta paths, Anthropic when an anthropic-version header is sent.
+func modelListFormat(c *gin.Context) string {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
+		return modelListFormatGemini
+	}
+	if c.GetHeader("anthropic-version") != "" {
+		return modelListFormatAnthropic
+	}
+	return modelListFormatOpenAI
+}
+
+// ListModels lists the models the calling token may use, in the format of
+// the caller's SDK.
+func ListModels(c *gin.Context) {
+	entries, err := gatewayModels(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.RelayErrInternal.Body(modelListFormat(c), "failed to load models"))
+		return
+	}
+	switch modelListFormat(c) {
+	case modelListFormatAnthropic:
+		data := make([]gin.H, 0, len(entries))
+		for _, entry := range entries {
+			data = append(data, anthropicModelObject(entry))
+		}
+		response := gin.H{"data": data, "has_more": false, "first_id": nil, "last_id": nil}
+		if len(entries) > 0 {
+			response["first_id"] = entries[0].Id
+			response["last_id"] = entries[len(entries)-1].Id
+		}
+		c.JSON(http.StatusOK, response)
+	case modelListFormatGemini:
+		models := make([]gin.H, 0, len(entries))
+		for _, entry := range entries {
+			models = append(models, geminiModelObject(entry))
+		}
+		c.JSON(http.StatusOK, gin.H{"models": models})
+	default:
+		data := make([]gin.H, 0, len(entries))
+		for _, entry := range entries {
+			data = append(data, openAIModelObject(entry))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"object": "list",
+			"data":   data,
+		})
+	}
+}
+
+// GetModel returns one model of ListModels.
+func GetModel(c *gin.Context) {
+	modelName := c.Param("model")
+	if modelName == "" {
+		// Gemini paths are registered as a catch-all: /v1beta/models/*path.
+		modelName = strings.TrimPrefix(c.Param("path"), "/")
+	}
+	format := modelListFormat(c)
+	entries, err := gatewayModels(c)
+	if err == nil {
+		if entry, ok := model.FindModelCatalogEntry(entries, modelName); ok {
+			switch format {
+			case modelListFormatAnthropic:
+				c.JSON(http.StatusOK, anthropicModelObject(entry))
+			case modelListFormatGemini:
+				c.JSON(http.StatusOK, geminiModelObject(entry))
+			default:
+				c.JSON(http.StatusOK, openAIModelObject(entry))
+			}
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, common.RelayErrModelNotFound.Body(format, "model not found: "+modelName))
+}
+
+// gatewayModels lists the routable models the calling token is allowed and
+// its client type can reach, followed by its virtual models. A virtual model
+// shadows a routable model with the same name and is listed when one of its
+// targets is.
+func gatewayModels(c *gin.Context) ([]model.ModelCatalogEntry, error) {
+	aggToken := c.MustGet("agg_token").(*model.AggregatedToken)
+	catalog, err := model.GetModelCatalog(c.GetString("client_type"))
+	if err != nil {
+		return nil, err
+	}
+	virtualNames := common.VirtualModelNames()
+	shadowed := make(map[string]bool, len(virtualNames))
+	for _, name := range virtualNames {
+		shadowed[strings.ToLower(name)] = true
+	}
+
+	entries := make([]model.ModelCatalogEntry, 0, len(catalog)+len(virtualNames))
+	for _, entry := range catalog {
+		if shadowed[strings.ToLower(entry.Id)] || !aggToken.IsModelAllowed(entry.Id) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	for _, name := range virtualNames {
+		if !aggToken.IsModelAllowed(name) {
+			continue
+		}
+		targets, _ := aggToken.VirtualModelCandidates(name)
+		if entry, ok := virtualModelCatalogEntry(name, targets, catalog); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// virtualModelCatalogEntry merges the metadata of the routable targets:
+// every endpoint type of any target and the smallest known context length.
+// Prices differ per target and are left out.
+func virtualModelCatalogEntry(name string, targets []string, catalog []model.ModelCatalogEntry) (model.ModelCatalogEntry, bool) {
+	out := model.ModelCatalogEntry{Id: name}
+	found := false
+	endpointSeen := make(map[string]bool)
+	for _, target := range targets {
+		entry, ok := model.FindModelCatalogEntry(catalog, target)
+		if !ok {
+			continue
+		}
+		found = true
+		for _, endpointType := range entry.SupportedEndpointTypes {
+			if !endpointSeen[endpointType] {
+				endpointSeen[endpointType] = true
+				out.SupportedEndpointTypes = append(out.SupportedEndpointTypes, endpointType)
+			}
+		}
+		if entry.ContextLength > 0 && (out.ContextLength == 0 || entry.ContextLength < out.ContextLength) {
+			out.ContextLength = entry.ContextLength
+		}
+	}
+	sort.Strings(out.SupportedEndpointTypes)
+	return out, found
+}
+
+func openAIModelObject(entry model.ModelCatalogEntry) gin.H {
+	endpointTypes := entry.SupportedEndpointTypes
+	if endpointTypes == nil {
+		endpointTypes = []string{}
+	}
+	object := gin.H{
+		"id":                       entry.Id,
+		"object":                   "model",
+		"owned_by":                 modelOwner,
+		"supported_endpoint_types": endpointTypes,
+	}
+	if entry.ContextLength > 0 {
+		object["context_length"] = entry.ContextLength
+	}
+	if entry.Pricing.PromptPer1M != nil || entry.Pricing.PerCall != nil {
+		object["pricing"] = entry.Pricing
+	}
+	return object
+}
+
+func anthropicModelObject(entry model.ModelCatalogEntry) gin.H {
+	return gin.H{
+		"type":         "model",
+		"id":           entry.Id,
+		"display_name": entry.Id,
+		// Upstreams do not report release dates.
+		"created_at": "1970-01-01T00:00:00Z",
+	}
+}
+
+func geminiModelObject(entry model.ModelCatalogEntry) gin.H {
+	object := gin.H{
+		"name":                       "models/" + entry.Id,
+		"baseModelId":                entry.Id,
+		"version":                    "",
+		"displayName":                entry.Id,
+		"description":                "",
+		"supportedGenerationMethods": []string{"generateContent", "streamGenerateContent"},
+	}
+	if entry.ContextLength > 0 {
+		object["inputTokenLimit"] = entry.ContextLength
+	}
+	return object
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"NewAPI-Gateway/model"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupModelListTest(t *testing.T) {
+	t.Helper()
+	setupRouteControllerTestDB(t)
+	for i, endpoints := range []string{`["openai"]`, `["openai-response"]`} {
+		provider := model.Provider{Name: "provider", BaseURL: "https://example.test", Status: 1}
+		if err := model.DB.Create(&provider).Error; err != nil {
+			t.Fatal(err)
+		}
+		token := model.ProviderToken{ProviderId: provider.Id, SkKey: "sk", Status: 1}
+		if err := model.DB.Create(&token).Error; err != nil {
+			t.Fatal(err)
+		}
+		routes := []model.ModelRoute{
+			{ModelName: "gpt-4o", ProviderId: provider.Id, ProviderTokenId: token.Id, Enabled: true},
+			{ModelName: "secret-model", ProviderId: provider.Id, ProviderTokenId: token.Id, Enabled: true},
+			{ModelName: "codex-only", ProviderId: provider.Id, ProviderTokenId: token.Id, Enabled: true, AllowCodex: true},
+		}
+		if err := model.DB.Create(&routes).Error; err != nil {
+			t.Fatal(err)
+		}
+		pricing := model.ModelPricing{
+			ProviderId:             provider.Id,
+			ModelName:              "gpt-4o",
+			ModelRatio:             1.25 * float64(i+1),
+			CompletionRatio:        4,
+			SupportedEndpointTypes: endpoints,
+			ContextLength:          128000 / (i + 1),
+		}
+		if err := model.DB.Create(&pricing).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func serveModelList(t *testing.T, handler gin.HandlerFunc, path string, header http.Header, params gin.Params) (int, map[string]any) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+	for key, values := range header {
+		c.Request.Header[key] = values
+	}
+	c.Params = params
+	c.Set("agg_token", &model.AggregatedToken{ModelLimitsEnabled: true, ModelLimits: "gpt-4o,codex-only"})
+	handler(c)
+	var body map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v (%s)", path, err, recorder.Body.String())
+	}
+	return recorder.Code, body
+}
+
+func TestListModelsFiltersByTokenAndReportsMetadata(t *testing.T) {
+	setupModelListTest(t)
+
+	_, body := serveModelList(t, ListModels, "/v1/models", nil, nil)
+	data := body["data"].([]any)
+	if len(data) != 1 {
+		t.Fatalf("expected only gpt-4o to be listed, got %v", data)
+	}
+	entry := data[0].(map[string]any)
+	if entry["id"] != "gpt-4o" || entry["context_length"] != float64(64000) {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+	endpoints := entry["supported_endpoint_types"].([]any)
+	if len(endpoints) != 2 || endpoints[0] != "openai" || endpoints[1] != "openai-response" {
+		t.Fatalf("endpoint types should be merged across routes, got %v", endpoints)
+	}
+	pricing := entry["pricing"].(map[string]any)
+	if pricing["prompt_per_1m"] != 2.5 || pricing["completion_per_1m"] != float64(10) {
+		t.Fatalf("pricing should come from the cheapest route, got %v", pricing)
+	}
+
+	_, body = serveModelList(t, ListModels, "/v1/models", http.Header{"Anthropic-Version": {"2023-06-01"}}, nil)
+	data = body["data"].([]any)
+	if len(data) != 1 || data[0].(map[string]any)["type"] != "model" || body["first_id"] != "gpt-4o" || body["has_more"] != false {
+		t.Fatalf("unexpected anthropic listing: %v", body)
+	}
+
+	_, body = serveModelList(t, ListModels, "/v1beta/models", nil, nil)
+	models := body["models"].([]any)
+	if len(models) != 1 {
+		t.Fatalf("unexpected gemini listing: %v", body)
+	}
+	if gemini := models[0].(map[string]any); gemini["name"] != "models/gpt-4o" || gemini["inputTokenLimit"] != float64(64000) {
+		t.Fatalf("unexpected gemini model: %v", gemini)
+	}
+}
+
+func TestGetModelHidesModelsOutsideTokenLimits(t *testing.T) {
+	setupModelListTest(t)
+
+	code, body := serveModelList(t, GetModel, "/v1beta/models/gpt-4o", nil, gin.Params{{Key: "path", Value: "/gpt-4o"}})
+	if code != http.StatusOK || body["name"] != "models/gpt-4o" {
+		t.Fatalf("status = %d, body = %v", code, body)
+	}
+	code, body = serveModelList(t, GetModel, "/v1/models/secret-model", nil, gin.Params{{Key: "model", Value: "secret-model"}})
+	if code != http.StatusNotFound {
+		t.Fatalf("model outside the token limits should be hidden, status = %d, body = %v", code, body)
+	}
+	code, body = serveModelList(t, GetModel, "/v1/models/codex-only", http.Header{"Anthropic-Version": {"2023-06-01"}}, gin.Params{{Key: "model", Value: "codex-only"}})
+	if code != http.StatusNotFound || body["type"] != "error" {
+		t.Fatalf("codex-only route should be hidden from other clients, status = %d, body = %v", code, body)
+	}
+}
@@ -3,7 +3,9 @@ package controller
 import (
 	"NewAPI-Gateway/common"
 	"NewAPI-Gateway/model"
+	"NewAPI-Gateway/service"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -146,6 +148,352 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "StreamFailoverEnabled":
+		normalized := strings.TrimSpace(strings.ToLower(option.Value))
+		if normalized != "true" && normalized != "false" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "流式故障转移开关必须是 true 或 false",
+			})
+			return
+		}
+	case "StreamFailoverMaxBufferBytes":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1024 || value > 8*1024*1024 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "流式缓冲上限必须是 1024 到 8388608 字节的整数",
+			})
+			return
+		}
+	case "StreamFailoverFirstContentTimeoutSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 600 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "首个内容超时必须是 0 到 600 秒的整数",
+			})
+			return
+		}
+	case "RouteAffinityEnabled":
+		normalized := strings.TrimSpace(strings.ToLower(option.Value))
+		if normalized != "true" && normalized != "false" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "会话粘性开关必须是 true 或 false",
+			})
+			return
+		}
+	case "RouteAffinityTTLSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 60 || value > 24*3600 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "会话粘性有效期必须是 60 到 86400 秒的整数",
+			})
+			return
+		}
+	case "RouteAffinityHeader":
+		if strings.ContainsAny(strings.TrimSpace(option.Value), " :\t\r\n") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "会话请求头名称不能包含空白或冒号",
+			})
+			return
+		}
+	case "HedgeDelayMs":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 50 || value > 60000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "对冲延迟必须是 50 到 60000 毫秒的整数",
+			})
+			return
+		}
+	case "HedgeAdaptiveDelayEnabled":
+		normalized := strings.TrimSpace(strings.ToLower(option.Value))
+		if normalized != "true" && normalized != "false" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "自适应对冲延迟开关必须是 true 或 false",
+			})
+			return
+		}
+	case "RouteProbeEnabled":
+		normalized := strings.TrimSpace(strings.ToLower(option.Value))
+		if normalized != "true" && normalized != "false" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "主动探测开关必须是 true 或 false",
+			})
+			return
+		}
+	case "RouteProbeIntervalMinutes":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 1440 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "探测间隔必须是 1 到 1440 分钟的整数",
+			})
+			return
+		}
+	case "RouteProbeProviderDailyCostUSD":
+		value, err := strconv.ParseFloat(strings.TrimSpace(option.Value), 64)
+		if err != nil || value < 0 || value > 1000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "每个供应商的每日探测成本上限必须是 0 到 1000 的数字",
+			})
+			return
+		}
+	case "RouteProbeDeadAfterFailures":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 100 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "判定失效的连续失败次数必须是 1 到 100 的整数",
+			})
+			return
+		}
+	case "ProviderBreakerEnabled":
+		normalized := strings.TrimSpace(strings.ToLower(option.Value))
+		if normalized != "true" && normalized != "false" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "供应商熔断开关必须是 true 或 false",
+			})
+			return
+		}
+	case "ProviderBreakerFailureThreshold":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 1000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "熔断失败次数阈值必须是 1 到 1000 的整数",
+			})
+			return
+		}
+	case "ProviderBreakerWindowSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 3600 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "熔断统计窗口必须是 1 到 3600 秒的整数",
+			})
+			return
+		}
+	case "ProviderBreakerOpenSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 86400 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "熔断时长必须是 1 到 86400 秒的整数",
+			})
+			return
+		}
+	case "ProviderBreakerMaxOpenSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 86400 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "最长熔断时长必须是 1 到 86400 秒的整数",
+			})
+			return
+		}
+	case "RetryMaxAttempts":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 100 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "最大尝试次数必须是 0 到 100 的整数",
+			})
+			return
+		}
+	case "RetryDeadlineSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 3600 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请求总时限必须是 0 到 3600 秒的整数",
+			})
+			return
+		}
+	case "RetryBackoffMs", "RetryBackoffMaxMs":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 60000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "重试间隔必须是 0 到 60000 毫秒的整数",
+			})
+			return
+		}
+	case "RetryStatusRules":
+		if _, err := common.ParseRetryStatusRules(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "RetryModelPolicies":
+		if _, err := common.ParseRetryModelPolicies(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ConcurrencyQueueSize":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 10000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "并发排队上限必须是 0 到 10000 的整数",
+			})
+			return
+		}
+	case "ConcurrencyQueueTimeoutMs":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 100 || value > 300000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "并发排队超时必须是 100 到 300000 毫秒的整数",
+			})
+			return
+		}
+	case "ResponseCacheTTLSeconds":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 7*24*3600 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "响应缓存有效期必须是 1 到 604800 秒的整数",
+			})
+			return
+		}
+	case "ResponseCacheMaxEntryBytes":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1024 || value > 16*1024*1024 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "单条缓存上限必须是 1024 到 16777216 字节的整数",
+			})
+			return
+		}
+	case "ResponseCacheMaxEntries":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 100000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "内存缓存条目上限必须是 1 到 100000 的整数",
+			})
+			return
+		}
+	case "AlertEnabled", "AlertCPAStoppedEnabled":
+		normalized := strings.TrimSpace(strings.ToLower(option.Value))
+		if normalized != "true" && normalized != "false" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "告警开关必须是 true 或 false",
+			})
+			return
+		}
+	case "AlertWebhookURL":
+		if raw := strings.TrimSpace(option.Value); raw != "" {
+			parsed, err := url.Parse(raw)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "Webhook 地址必须是 http 或 https URL",
+				})
+				return
+			}
+		}
+	case "AlertWebhookFormat":
+		if !common.IsValidAlertWebhookFormat(strings.TrimSpace(strings.ToLower(option.Value))) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Webhook 格式必须是 generic、slack、feishu 或 dingtalk",
+			})
+			return
+		}
+	case "AlertBalanceThresholdUSD":
+		value, err := strconv.ParseFloat(strings.TrimSpace(option.Value), 64)
+		if err != nil || value < 0 || value > 1000000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "余额告警阈值必须是 0 到 1000000 的数字",
+			})
+			return
+		}
+	case "AlertSyncFailureThreshold":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 1000 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "同步失败次数阈值必须是 0 到 1000 的整数",
+			})
+			return
+		}
+	case "AlertKeyCooldownMinutes":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 10080 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "令牌冷却告警时长必须是 0 到 10080 分钟的整数",
+			})
+			return
+		}
+	case "AlertQuietPeriodMinutes":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 1 || value > 10080 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "告警静默期必须是 1 到 10080 分钟的整数",
+			})
+			return
+		}
+	case "VirtualModels":
+		if _, err := common.ParseVirtualModels(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "PriceBook":
+		if _, err := common.ParsePriceBook(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "PriceBookGroupMarkup":
+		if _, err := common.ParsePriceBookGroupMarkup(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "UsageLogRetentionDays":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 3650 || (value > 0 && value < common.MinUsageLogRetentionDays) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("使用日志保留天数必须是 0 或 %d 到 3650 的整数", common.MinUsageLogRetentionDays),
+			})
+			return
+		}
+	case "LLMTraceRetentionDays":
+		value, err := strconv.Atoi(strings.TrimSpace(option.Value))
+		if err != nil || value < 0 || value > 3650 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "LLM 追踪保留天数必须是 0 到 3650 的整数",
+			})
+			return
+		}
 	case "RoutingBaseWeightFactor", "RoutingValueScoreFactor":
 		value, err := strconv.ParseFloat(strings.TrimSpace(option.Value), 64)
 		if err != nil || value < 0 || value > 10 {
@@ -254,3 +602,18 @@ func TestProxy(c *gin.Context) {
 		"message": "代理返回错误状态码: " + strconv.Itoa(resp.StatusCode),
 	})
 }
+
+// TestAlert sends a test notification through the configured alert channels.
+func TestAlert(c *gin.Context) {
+	if err := service.SendTestAlert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "测试告警发送失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -134,6 +134,7 @@ func ExportProviders(c *gin.Context) {
 		PricingSupported  string `json:"pricing_supported_endpoint,omitempty"`
 		ModelAliasMapping string `json:"model_alias_mapping,omitempty"`
 		Remark            string `json:"remark,omitempty"`
+		MaxConcurrency    int    `json:"max_concurrency,omitempty"`
 		CreatedAt         int64  `json:"created_at,omitempty"`
 	}
 	var items []ExportItem
@@ -158,6 +159,7 @@ func ExportProviders(c *gin.Context) {
 			PricingSupported:  p.PricingSupportedEndpoint,
 			ModelAliasMapping: p.ModelAliasMapping,
 			Remark:            p.Remark,
+			MaxConcurrency:    p.MaxConcurrency,
 			CreatedAt:         p.CreatedAt,
 		})
 	}
@@ -201,6 +203,7 @@ func ImportProviders(c *gin.Context) {
 		PricingSupported  string          `json:"pricing_supported_endpoint"`
 		ModelAliasMapping json.RawMessage `json:"model_alias_mapping"`
 		Remark            string          `json:"remark"`
+		MaxConcurrency    int             `json:"max_concurrency"`
 		CreatedAt         int64           `json:"created_at"`
 	}
 	var items []ImportItem
@@ -253,6 +256,7 @@ func ImportProviders(c *gin.Context) {
 			PricingSupportedEndpoint: item.PricingSupported,
 			ModelAliasMapping:        modelAliasMapping,
 			Remark:                   item.Remark,
+			MaxConcurrency:           item.MaxConcurrency,
 			CreatedAt:                item.CreatedAt,
 		}
 		if p.CreatedAt == 0 {
@@ -331,6 +335,10 @@ func UpdateProvider(c *gin.Context) {
 			return
 		}
 	}
+	if provider.MaxConcurrency < 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "最大并发不能为负数"})
+		return
+	}
 	if err := provider.Update(); err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 		return
@@ -510,6 +518,56 @@ func GetProviderPricing(c *gin.Context) {
 	})
 }
 
+// UpdateModelPricingBilling sets the cache, audio, image and long-context
+// tier billing of a synced pricing record. Syncs keep these values unless the
+// upstream reports its own.
+func UpdateModelPricingBilling(c *gin.Context) {
+	pricingId, err := strconv.Atoi(c.Param("pricing_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的定价 ID"})
+		return
+	}
+	var patch model.ModelPricingBillingPatch
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	for _, ratio := range []float64{
+		patch.CacheRatio,
+		patch.CacheCreationRatio,
+		patch.CacheCreation1hRatio,
+		patch.AudioRatio,
+		patch.AudioCompletionRatio,
+		patch.ImageRatio,
+	} {
+		if ratio < 0 {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "倍率不能为负数"})
+			return
+		}
+	}
+	tiers, err := model.ParsePriceTiers(patch.PriceTiers)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "长上下文分段必须是 JSON 数组"})
+		return
+	}
+	for i, tier := range tiers {
+		if tier.MinPromptTokens <= 0 || tier.ModelRatio <= 0 || tier.CompletionRatio < 0 {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "长上下文分段的 min_prompt_tokens 与 model_ratio 必须为正数"})
+			return
+		}
+		if i > 0 && tier.MinPromptTokens == tiers[i-1].MinPromptTokens {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "长上下文分段的 min_prompt_tokens 不能重复"})
+			return
+		}
+	}
+	pricing, err := model.UpdateModelPricingBilling(pricingId, patch)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "定价记录不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": pricing})
+}
+
 func CreateProviderToken(c *gin.Context) {
 	providerId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -635,6 +693,10 @@ func UpdateProviderToken(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
 		return
 	}
+	if err := decodeField("max_concurrency", &token.MaxConcurrency); err != nil || token.MaxConcurrency < 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "最大并发不能为负数"})
+		return
+	}
 	token.Id = tokenId
 	if err := token.Update(); err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,8 +17,12 @@ import (
 func Relay(c *gin.Context) {
 	aggToken := c.MustGet("agg_token").(*model.AggregatedToken)
 
-	// 1. Extract model from request body
+	// 1. Extract model from request body; Gemini native requests carry it in
+	// the path instead.
 	originalModel := extractModelFromBody(c)
+	if modelName, _, ok := service.ParseGeminiModelPath(c.Request.URL.Path); ok {
+		originalModel = modelName
+	}
 	if originalModel == "" {
 		originalModel = "unknown"
 	}
@@ -26,18 +31,18 @@ func Relay(c *gin.Context) {
 
 	// 2. Check model whitelist
 	if !aggToken.IsModelAllowed(originalModel) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": gin.H{
-				"message": "model not allowed: " + originalModel,
-				"type":    "permission_error",
-				"code":    "model_not_allowed",
-			},
-		})
+		common.WriteRelayError(c, common.RelayErrModelNotAllowed, "model not allowed: "+originalModel)
 		return
 	}
 
+	// Virtual models resolve to their targets, each tried as a primary model;
+	// otherwise the fallback chain only runs when the original model had no
+	// usable route.
 	modelsToTry := []string{originalModel}
-	if chain, _, ok := common.GetModelFallbackChain(originalModel); ok && len(chain) > 0 {
+	candidates, isVirtual := aggToken.VirtualModelCandidates(originalModel)
+	if isVirtual {
+		modelsToTry = candidates
+	} else if chain, _, ok := common.GetModelFallbackChain(originalModel); ok && len(chain) > 0 {
 		modelsToTry = append(modelsToTry, chain...)
 	}
 
@@ -49,69 +54,193 @@ func Relay(c *gin.Context) {
 		}
 	}
 
+	affinity := service.NewRouteAffinity(c, aggToken)
+	queue := service.NewConcurrencyQueue()
+	budget := service.NewRetryBudget(aggToken, originalModel)
+	budget.BindDeadline(c)
+	stream := service.RequestedStream(c)
+
 	var lastErr *service.ProxyAttemptError
+	attempts := 0
+	backoffPending := false
+	// Routes at their max-in-flight limit are skipped first and waited for once
+	// every other candidate of every model has been tried. saturatedModels
+	// maps their route id to the model they were selected for.
+	var saturated []model.RouteAttempt
+	saturatedModels := make(map[int]string)
+	addSaturated := func(routingModel string, attempt model.RouteAttempt) {
+		if _, ok := saturatedModels[attempt.Route.Id]; ok {
+			return
+		}
+		saturatedModels[attempt.Route.Id] = routingModel
+		saturated = append(saturated, attempt)
+	}
+	// finish records the outcome of an attempt and reports whether the
+	// response has been written to the client.
+	finish := func(routingModel string, attempt model.RouteAttempt, proxyErr *service.ProxyAttemptError, upstreamAttempts int) bool {
+		if proxyErr == nil {
+			// A cache hit was answered without the route; it neither pins
+			// the route nor counts as an upstream attempt.
+			if service.ServedFromCache(c) {
+				common.ObserveRelayRequest(attempts, true)
+				return true
+			}
+			affinity.Pin(routingModel, attempt.Route)
+			common.ObserveRelayRequest(attempts+upstreamAttempts, true)
+			return true
+		}
+		lastErr = proxyErr
+		if upstreamAttempts == 0 {
+			return false
+		}
+		attempts += upstreamAttempts
+		budget.Apply(attempt, proxyErr)
+		if !proxyErr.Retryable {
+			common.ObserveRelayRequest(attempts, false)
+			statusCode := proxyErr.StatusCode
+			if statusCode <= 0 {
+				statusCode = http.StatusBadGateway
+			}
+			if len(proxyErr.UpstreamBody) > 0 {
+				contentType := proxyErr.UpstreamContentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				c.Data(statusCode, contentType, proxyErr.UpstreamBody)
+			} else {
+				common.WriteRelayError(c, common.RelayErrUpstreamFailed.WithStatus(statusCode), proxyErr.Message)
+			}
+			return true
+		}
+		backoffPending = true
+		return false
+	}
+	// ready checks the retry budget before the next attempt.
+	ready := func() bool {
+		if budget.Exhausted(attempts) {
+			return false
+		}
+		if backoffPending {
+			backoffPending = false
+			return budget.Wait(c, attempts)
+		}
+		return true
+	}
+	useRoute := func(attempt model.RouteAttempt) {
+		if attempt.Route.ModelName != "" {
+			c.Set("request_model_resolved", attempt.Route.ModelName)
+			c.Set("request_model", attempt.Route.ModelName)
+		}
+	}
+
+	budgetStopped := false
+models:
 	for idx, routingModel := range modelsToTry {
-		if idx > 0 && !aggToken.IsModelAllowed(routingModel) {
+		if idx > 0 && !isVirtual && !aggToken.IsModelAllowed(routingModel) {
 			continue
 		}
 
 		// 3. Build retry plan for all selectable routes.
-		plan, err := model.BuildRouteAttemptsByPriority(routingModel, clientType)
+		plan, err := model.BuildRouteAttemptsWithStrategy(routingModel, clientType, aggToken.RoutingStrategyFor(originalModel, routingModel), stream)
 		if err != nil {
 			continue
 		}
 
-		if idx > 0 {
+		if idx > 0 && !isVirtual {
 			common.SysLog(fmt.Sprintf("[relay-fallback] original_model=%s fallback_model=%s", originalModel, routingModel))
 		}
 
+		// Hedging races a slow non-streaming attempt against the next route.
+		hedge := service.NewHedgePolicy(c, aggToken, routingModel)
 		sawNonCooldownFailure := false
 		for _, retryGroup := range plan {
-			for _, attempt := range retryGroup {
-				if attempt.Route.ModelName != "" {
-					c.Set("request_model_resolved", attempt.Route.ModelName)
-					c.Set("request_model", attempt.Route.ModelName)
+			ordered := budget.Filter(affinity.Prefer(routingModel, retryGroup))
+			for i := 0; i < len(ordered); {
+				if !ready() {
+					budgetStopped = true
+					break models
 				}
-
-				if proxyErr := service.ProxyToUpstream(c, attempt.Route, attempt.Token, attempt.Provider); proxyErr == nil {
-					return
+				attempt := ordered[i]
+				var proxyErr *service.ProxyAttemptError
+				upstreamAttempts := 1
+				if hedge != nil && i+1 < len(ordered) && budget.CanHedge(attempts) {
+					result := hedge.Run(c, ordered[i:])
+					i += result.Used
+					attempt, proxyErr, upstreamAttempts = result.Served, result.Err, result.Upstream
+					for _, busy := range result.Saturated {
+						addSaturated(routingModel, busy)
+					}
+					if proxyErr == nil {
+						useRoute(attempt)
+					}
 				} else {
-					lastErr = proxyErr
-					if proxyErr.CooldownRejected {
-						continue
+					i++
+					useRoute(attempt)
+					proxyErr = service.ProxyToUpstream(c, attempt.Route, attempt.Token, attempt.Provider)
+					if proxyErr != nil && proxyErr.Saturated {
+						addSaturated(routingModel, attempt)
 					}
-					if !proxyErr.Retryable {
-						statusCode := proxyErr.StatusCode
-						if statusCode <= 0 {
-							statusCode = http.StatusBadGateway
-						}
-						if len(proxyErr.UpstreamBody) > 0 {
-							contentType := proxyErr.UpstreamContentType
-							if contentType == "" {
-								contentType = "application/json"
-							}
-							c.Data(statusCode, contentType, proxyErr.UpstreamBody)
-						} else {
-							c.JSON(statusCode, gin.H{
-								"error": gin.H{
-									"message": proxyErr.Message,
-									"type":    "server_error",
-									"code":    "upstream_request_failed",
-								},
-							})
-						}
-						return
+					if proxyErr != nil && (proxyErr.CooldownRejected || proxyErr.Saturated) {
+						upstreamAttempts = 0
 					}
-					sawNonCooldownFailure = true
 				}
+
+				if finish(routingModel, attempt, proxyErr, upstreamAttempts) {
+					return
+				}
+				if upstreamAttempts == 0 {
+					continue
+				}
+				sawNonCooldownFailure = true
+				ordered = append(append([]model.RouteAttempt(nil), ordered[:i]...), budget.Filter(ordered[i:])...)
 			}
 		}
 
-		if idx == 0 && sawNonCooldownFailure {
+		if idx == 0 && !isVirtual && sawNonCooldownFailure {
 			break
 		}
 	}
 
+	// 4. Queue for the saturated routes once nothing else is left.
+	for !budgetStopped && len(saturated) > 0 {
+		saturated = budget.Filter(saturated)
+		if len(saturated) == 0 {
+			break
+		}
+		if !ready() {
+			break
+		}
+		index, queueErr := queue.Wait(c, saturated)
+		if queueErr != nil {
+			lastErr = queueErr
+			break
+		}
+		attempt := saturated[index]
+		saturated = append(saturated[:index], saturated[index+1:]...)
+		useRoute(attempt)
+		proxyErr := service.ProxyToUpstream(c, attempt.Route, attempt.Token, attempt.Provider)
+		upstreamAttempts := 1
+		if proxyErr != nil && proxyErr.Saturated {
+			// Another request took the freed slot first.
+			saturated = append(saturated, attempt)
+		}
+		if proxyErr != nil && (proxyErr.CooldownRejected || proxyErr.Saturated) {
+			upstreamAttempts = 0
+		}
+		if finish(saturatedModels[attempt.Route.Id], attempt, proxyErr, upstreamAttempts) {
+			return
+		}
+	}
+
+	common.ObserveRelayRequest(attempts, false)
+	switch budget.StopReason() {
+	case service.RetryStopDeadline:
+		common.WriteRelayError(c, common.RelayErrDeadlineExceeded, fmt.Sprintf("request deadline exceeded after %d upstream attempt(s) for model: %s", attempts, originalModel))
+		return
+	case service.RetryStopMaxAttempts:
+		common.WriteRelayError(c, common.RelayErrRetryLimit, fmt.Sprintf("retry limit of %d upstream attempt(s) reached for model: %s", attempts, originalModel))
+		return
+	}
 	message := "no available provider for model: " + originalModel
 	if lastErr != nil && lastErr.Message != "" {
 		message = "all providers failed for model: " + originalModel
@@ -119,78 +248,73 @@ func Relay(c *gin.Context) {
 	if lastErr != nil && lastErr.RetryAfterSeconds > 0 {
 		c.Header("Retry-After", fmt.Sprintf("%d", lastErr.RetryAfterSeconds))
 	}
-	c.JSON(http.StatusServiceUnavailable, gin.H{
-		"error": gin.H{
-			"message": message,
-			"type":    "server_error",
-			"code":    "service_unavailable",
-		},
-	})
-}
-
-// ListModels returns all available models across all providers
-func ListModels(c *gin.Context) {
-	models, err := model.GetDistinctModels()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"object": "list",
-			"data":   []gin.H{},
-		})
+	if lastErr != nil && lastErr.Saturated {
+		common.WriteRelayError(c, common.RelayErrConcurrencyLimit, "all providers are at max concurrency for model: "+originalModel)
 		return
 	}
-
-	var modelList []gin.H
-	for _, m := range models {
-		modelList = append(modelList, gin.H{
-			"id":       m,
-			"object":   "model",
-			"owned_by": "aggregated-gateway",
-		})
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"object": "list",
-		"data":   modelList,
-	})
+	common.WriteRelayError(c, common.RelayErrNoRoute, message)
 }
 
-func GetModel(c *gin.Context) {
-	modelName := c.Param("model")
-	models, _ := model.GetDistinctModels()
-	for _, m := range models {
-		if m == modelName {
-			c.JSON(http.StatusOK, gin.H{
-				"id":       m,
-				"object":   "model",
-				"owned_by": "aggregated-gateway",
-			})
-			return
-		}
-	}
-	c.JSON(http.StatusNotFound, gin.H{
-		"error": gin.H{
-			"message": "model not found: " + modelName,
-			"type":    "invalid_request_error",
-		},
-	})
-}
+// billingUnlimitedUSD is reported as the hard limit when a token has no budget.
+const billingUnlimitedUSD = 999999
 
-// BillingSubscription returns a fake billing subscription for compatibility
+// BillingSubscription reports the aggregated token's monthly budget in the
+// OpenAI billing format.
 func BillingSubscription(c *gin.Context) {
+	aggToken := c.MustGet("agg_token").(*model.AggregatedToken)
+
+	hardLimit := float64(billingUnlimitedUSD)
+	if aggToken.MonthlyBudgetUSD > 0 {
+		hardLimit = aggToken.MonthlyBudgetUSD
+	}
+	accessUntil := int64(4102444800) // 2100-01-01
+	if aggToken.ExpiredTime != -1 {
+		accessUntil = aggToken.ExpiredTime
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"object":                "billing_subscription",
 		"has_payment_method":    true,
-		"hard_limit_usd":        999999,
-		"soft_limit_usd":        999999,
-		"system_hard_limit_usd": 999999,
-		"access_until":          4102444800, // 2100-01-01
+		"hard_limit_usd":        hardLimit,
+		"soft_limit_usd":        hardLimit,
+		"system_hard_limit_usd": hardLimit,
+		"access_until":          accessUntil,
 	})
 }
 
-// BillingUsage returns usage data for compatibility
+// BillingUsage returns the aggregated token's spend between start_date
+// (inclusive) and end_date (exclusive), defaulting to the current month.
+// total_usage is expressed in cents, as in the OpenAI API.
 func BillingUsage(c *gin.Context) {
+	aggToken := c.MustGet("agg_token").(*model.AggregatedToken)
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	if raw := c.Query("start_date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, now.Location())
+		if err != nil {
+			common.WriteRelayError(c, common.RelayErrInvalidRequest, "invalid start_date, expected YYYY-MM-DD")
+			return
+		}
+		start = parsed
+	}
+	if raw := c.Query("end_date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, now.Location())
+		if err != nil {
+			common.WriteRelayError(c, common.RelayErrInvalidRequest, "invalid end_date, expected YYYY-MM-DD")
+			return
+		}
+		end = parsed
+	}
+
+	costUSD, err := model.GetAggTokenCostBetween(aggToken.Id, start.Unix(), end.Unix())
+	if err != nil {
+		common.WriteRelayError(c, common.RelayErrInternal, "failed to load usage")
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"object":      "list",
-		"total_usage": 0,
+		"total_usage": costUSD * 100,
 	})
 }
 
@@ -46,6 +46,10 @@ func UpdateRoute(c *gin.Context) {
 		return
 	}
 	patch.Id = id
+	if patch.MaxConcurrency != nil && *patch.MaxConcurrency < 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "最大并发不能为负数"})
+		return
+	}
 	updates := patch.ToUpdates()
 	if len(updates) == 0 {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "没有可更新的字段"})
@@ -102,3 +106,32 @@ func RebuildRoutes(c *gin.Context) {
 	}()
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "路由重建任务已启动"})
 }
+
+func ExplainRoute(c *gin.Context) {
+	modelName := strings.TrimSpace(c.Query("model"))
+	if modelName == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "模型名称不能为空"})
+		return
+	}
+	clientType := strings.TrimSpace(c.Query("client_type"))
+	if clientType != "" && clientType != "codex" && clientType != "cc" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "客户端类型只能为 codex 或 cc"})
+		return
+	}
+	var aggToken *model.AggregatedToken
+	if tokenId, _ := strconv.Atoi(c.Query("token_id")); tokenId > 0 {
+		token, err := model.GetAggTokenByIdForAdmin(tokenId)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "令牌不存在"})
+			return
+		}
+		aggToken = token
+	}
+	stream, _ := strconv.ParseBool(c.Query("stream"))
+	explanation, err := service.ExplainRouting(modelName, clientType, stream, aggToken)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": explanation})
+}
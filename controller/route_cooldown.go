@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/service"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// providerBreakerCooldownKind clears the circuit breaker of a whole provider.
+const providerBreakerCooldownKind = "provider"
+
+// maxForcedCooldownSeconds caps manually set cooldowns at seven days.
+const maxForcedCooldownSeconds = 7 * 24 * 3600
+
+type routeCooldownRequest struct {
+	All             bool   `json:"all"`
+	Kind            string `json:"kind"`
+	ProviderId      int    `json:"provider_id"`
+	ProviderTokenId int    `json:"provider_token_id"`
+	ModelName       string `json:"model_name"`
+	Seconds         int    `json:"seconds"`
+}
+
+func GetRouteCooldowns(c *gin.Context) {
+	items, err := common.GlobalRouteCooldown.ListActive()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{
+		"enabled": common.LoadRouteCooldownConfig().Enabled,
+		"shared":  common.GlobalRouteCooldown.SharedStore(),
+		"items":   items,
+		// Provider breakers are kept per process even with a shared store.
+		"provider_breaker_enabled": common.LoadProviderBreakerConfig().Enabled,
+		"provider_breakers":        common.GlobalProviderBreaker.List(),
+	}})
+}
+
+func SetRouteCooldown(c *gin.Context) {
+	var req routeCooldownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if !common.LoadRouteCooldownConfig().Enabled {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "路由冷却未启用"})
+		return
+	}
+	if message := validateRouteCooldownTarget(&req); message != "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": message})
+		return
+	}
+	if req.Seconds <= 0 || req.Seconds > maxForcedCooldownSeconds {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "冷却时长必须在 1 到 604800 秒之间"})
+		return
+	}
+	if err := common.GlobalRouteCooldown.ForceCooldown(req.Kind, req.ProviderTokenId, req.ModelName, time.Duration(req.Seconds)*time.Second); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	service.SnapshotRouteCooldowns()
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
+
+func ClearRouteCooldown(c *gin.Context) {
+	var req routeCooldownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	cleared := 1
+	if req.All {
+		count, err := common.GlobalRouteCooldown.ClearAll()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		cleared = count + common.GlobalProviderBreaker.ResetAll()
+	} else if strings.TrimSpace(req.Kind) == providerBreakerCooldownKind {
+		if req.ProviderId <= 0 {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的供应商 ID"})
+			return
+		}
+		common.GlobalProviderBreaker.Reset(req.ProviderId)
+	} else {
+		if message := validateRouteCooldownTarget(&req); message != "" {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": message})
+			return
+		}
+		if err := common.GlobalRouteCooldown.Clear(req.Kind, req.ProviderTokenId, req.ModelName); err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+	}
+	service.SnapshotRouteCooldowns()
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"cleared": cleared}})
+}
+
+func validateRouteCooldownTarget(req *routeCooldownRequest) string {
+	req.Kind = strings.TrimSpace(req.Kind)
+	req.ModelName = strings.TrimSpace(req.ModelName)
+	switch req.Kind {
+	case common.RouteCooldownKindRoute, common.RouteCooldownKindUnsupported:
+		if req.ModelName == "" {
+			return "模型名称不能为空"
+		}
+	case common.RouteCooldownKindToken:
+		req.ModelName = ""
+	default:
+		return "冷却类型只能为 route、token 或 unsupported"
+	}
+	if req.ProviderTokenId <= 0 {
+		return "无效的供应商令牌 ID"
+	}
+	return ""
+}
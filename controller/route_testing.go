@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"NewAPI-Gateway/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoute(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的 ID"})
+		return
+	}
+	var req struct {
+		Stream      bool `json:"stream"`
+		AutoDisable bool `json:"auto_disable"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+			return
+		}
+	}
+	attempts, err := model.GetRouteTestAttempts(model.RouteTestQuery{RouteIds: []int{id}})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if len(attempts) == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "路由不存在"})
+		return
+	}
+	result := service.RunRouteTest(attempts[0], service.RouteTestOptions{
+		Stream:      req.Stream,
+		AutoDisable: req.AutoDisable,
+	}, "")
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": result})
+}
+
+func StartRouteTests(c *gin.Context) {
+	var req struct {
+		RouteIds    []int  `json:"route_ids"`
+		Model       string `json:"model"`
+		ProviderId  int    `json:"provider_id"`
+		EnabledOnly bool   `json:"enabled_only"`
+		Stream      bool   `json:"stream"`
+		AutoDisable bool   `json:"auto_disable"`
+		Concurrency int    `json:"concurrency"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无效的参数"})
+		return
+	}
+	if req.Concurrency < 0 || req.Concurrency > service.RouteTestMaxConcurrency {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "并发数必须在 0 到 " + strconv.Itoa(service.RouteTestMaxConcurrency) + " 之间"})
+		return
+	}
+	attempts, err := model.GetRouteTestAttempts(model.RouteTestQuery{
+		RouteIds:    req.RouteIds,
+		ModelName:   req.Model,
+		ProviderId:  req.ProviderId,
+		EnabledOnly: req.EnabledOnly,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if len(attempts) == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "没有匹配的路由"})
+		return
+	}
+	batch := service.StartRouteTestBatch(attempts, service.RouteTestOptions{
+		Stream:      req.Stream,
+		AutoDisable: req.AutoDisable,
+		Concurrency: req.Concurrency,
+	})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "路由测试任务已启动", "data": batch})
+}
+
+func GetRouteTestBatch(c *gin.Context) {
+	batchId := strings.TrimSpace(c.Param("batch_id"))
+	results, _, err := model.QueryRouteTestResults(model.RouteTestResultQuery{BatchId: batchId})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	batch, ok := service.GetRouteTestBatch(batchId)
+	if !ok {
+		// Batches started before a restart or on another instance are
+		// summarized from their stored results.
+		if len(results) == 0 {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "测试任务不存在"})
+			return
+		}
+		batch = service.RouteTestBatch{Id: batchId, Total: len(results), Done: len(results)}
+		for _, result := range results {
+			if result.Success {
+				batch.Succeeded++
+			} else {
+				batch.Failed++
+			}
+			if result.AutoDisabled {
+				batch.AutoDisabled++
+			}
+			if batch.StartedAt == 0 || result.CreatedAt < batch.StartedAt {
+				batch.StartedAt = result.CreatedAt
+			}
+			if result.CreatedAt > batch.FinishedAt {
+				batch.FinishedAt = result.CreatedAt
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{
+		"batch":   batch,
+		"results": results,
+	}})
+}
+
+func GetRouteTestResults(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(common.ItemsPerPage)))
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	routeId, _ := strconv.Atoi(c.Query("route_id"))
+	providerId, _ := strconv.Atoi(c.Query("provider_id"))
+	results, total, err := model.QueryRouteTestResults(model.RouteTestResultQuery{
+		Offset:     p * pageSize,
+		Limit:      pageSize,
+		BatchId:    c.Query("batch_id"),
+		RouteId:    routeId,
+		ProviderId: providerId,
+		ModelName:  c.Query("model"),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{
+		"items":     results,
+		"total":     total,
+		"page":      p,
+		"page_size": pageSize,
+	}})
+}
@@ -7,8 +7,12 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"math/big"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"NewAPI-Gateway/common"
@@ -56,10 +60,25 @@ func main() {
 	if err != nil {
 		common.FatalLog(err)
 	}
+	err = common.InitRouteCooldownStore()
+	if err != nil {
+		common.FatalLog(err)
+	}
+	err = common.InitResponseCacheStore()
+	if err != nil {
+		common.FatalLog(err)
+	}
+	err = common.InitRouteAffinityStore()
+	if err != nil {
+		common.FatalLog(err)
+	}
 
 	// Initialize options
 	model.InitOptionMap()
 
+	// Restore route cooldowns saved before the last shutdown
+	service.RestoreRouteCooldowns()
+
 	// Start cron jobs (sync & checkin)
 	service.StartCronJobs()
 	defer service.StopCronJobs()
@@ -73,6 +92,10 @@ func main() {
 		common.FatalLog("failed to initialize CPA runtime: " + err.Error())
 	}
 	cpa.SetDefaultRuntime(cpaRuntime)
+	service.SetCPAAlertStatusSource(func() service.CPAAlertStatus {
+		status := cpaRuntime.Manager.Status()
+		return service.CPAAlertStatus{Enabled: status.Enabled, State: string(status.State), LastError: status.LastError}
+	})
 
 	// Start CPA from DB if enabled
 	if err := cpaRuntime.Manager.StartFromDB(context.Background()); err != nil {
@@ -107,6 +130,13 @@ func main() {
 	httpsCertFile := os.Getenv("HTTPS_CERT_FILE")
 	httpsKeyFile := os.Getenv("HTTPS_KEY_FILE")
 
+	// Stop on SIGINT/SIGTERM so the deferred cleanup (cron stop, cooldown
+	// snapshot, database close) runs before exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: ":" + port, Handler: server}
+	serveErr := make(chan error, 1)
+
 	if httpsEnabled {
 		// HTTPS mode
 		common.SysLog("HTTPS mode enabled")
@@ -125,15 +155,30 @@ func main() {
 
 		// Run HTTPS server
 		common.SysLog("Starting HTTPS server on :" + port)
-		err = server.RunTLS(":"+port, httpsCertFile, httpsKeyFile)
-		if err != nil {
-			common.FatalLog(err)
-		}
+		go func() {
+			serveErr <- srv.ListenAndServeTLS(httpsCertFile, httpsKeyFile)
+		}()
 	} else {
 		// HTTP mode
 		common.SysLog("Starting HTTP server on :" + port)
-		err = server.Run(":" + port)
-		if err != nil {
+		go func() {
+			serveErr <- srv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err = <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			if httpsEnabled {
+				common.FatalLog(err)
+			}
+			log.Println(err)
+		}
+	case <-ctx.Done():
+		common.SysLog("shutting down server...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
 			log.Println(err)
 		}
 	}
@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"NewAPI-Gateway/common"
 	"NewAPI-Gateway/model"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,13 +17,7 @@ func AggTokenAuth() func(c *gin.Context) {
 		// 1. Extract token from various sources
 		key := extractAggToken(c)
 		if key == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": gin.H{
-					"message": "missing authentication token",
-					"type":    "authentication_error",
-					"code":    "invalid_api_key",
-				},
-			})
+			common.WriteRelayError(c, common.RelayErrInvalidAPIKey, "missing authentication token")
 			c.Abort()
 			return
 		}
@@ -28,36 +25,37 @@ func AggTokenAuth() func(c *gin.Context) {
 		// 2. Validate token
 		token, user, err := model.ValidateAggToken(key)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": gin.H{
-					"message": err.Error(),
-					"type":    "authentication_error",
-					"code":    "invalid_api_key",
-				},
-			})
+			common.WriteRelayError(c, common.RelayErrInvalidAPIKey, err.Error())
 			c.Abort()
 			return
 		}
 
 		// 3. Check IP whitelist
 		if !token.IsIPAllowed(c.ClientIP()) {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": gin.H{
-					"message": "IP not in allowed list",
-					"type":    "permission_error",
-					"code":    "ip_not_allowed",
-				},
-			})
+			common.WriteRelayError(c, common.RelayErrIPNotAllowed, "IP not in allowed list")
 			c.Abort()
 			return
 		}
 
-		// 4. Set context
+		// 4. Enforce spend/token budgets. Listing and billing endpoints (GET)
+		// stay reachable so clients can still inspect why they are blocked.
+		if c.Request.Method != http.MethodGet && token.HasBudget() {
+			usage, err := model.GetAggTokenBudgetUsage(token, time.Now())
+			if err != nil {
+				common.SysError(fmt.Sprintf("[agg-token-budget] token_id=%d load usage failed: %v", token.Id, err))
+			} else if reason := usage.ExceededReason(); reason != "" {
+				common.WriteRelayError(c, common.RelayErrInsufficientQuota, reason)
+				c.Abort()
+				return
+			}
+		}
+
+		// 5. Set context
 		c.Set("agg_token", token)
 		c.Set("user", user)
 		c.Set("user_id", user.Id)
 
-		// 5. Extract client type from User-Agent
+		// 6. Extract client type from User-Agent
 		userAgent := strings.ToLower(strings.TrimSpace(c.GetHeader("User-Agent")))
 		clientType := identifyClientType(userAgent)
 		c.Set("client_type", clientType)
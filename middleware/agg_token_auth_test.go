@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAggTokenAuthRendersErrorsInCallerProtocol(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AggTokenAuth())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.POST("/v1/chat/completions", ok)
+	router.POST("/v1/messages", ok)
+	router.POST("/v1beta/models/*path", ok)
+
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/v1/chat/completions", `{"error":{"code":"invalid_api_key","message":"missing authentication token","type":"authentication_error"}}`},
+		{"/v1/messages", `{"error":{"message":"missing authentication token","type":"authentication_error"},"type":"error"}`},
+		{"/v1beta/models/gemini-2.5-pro:generateContent", `{"error":{"code":401,"message":"missing authentication token","status":"UNAUTHENTICATED"}}`},
+	}
+	for _, tc := range cases {
+		recorder := performRelayRequest(router, http.MethodPost, tc.path)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %d", tc.path, recorder.Code)
+		}
+		var got, want any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: invalid body %s", tc.path, recorder.Body.String())
+		}
+		_ = json.Unmarshal([]byte(tc.want), &want)
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Fatalf("%s: body = %s, want %s", tc.path, gotJSON, wantJSON)
+		}
+	}
+}
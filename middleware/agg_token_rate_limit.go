@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// aggTokenRateLimitWindow is the window (seconds) for RPM/TPM limits.
+const aggTokenRateLimitWindow int64 = 60
+
+var inMemoryTokenCounter common.InMemoryWindowCounter
+
+// aggTokenRateLimitStore abstracts the Redis and in-memory backends. Both count
+// over a sliding window of aggTokenRateLimitWindow seconds.
+type aggTokenRateLimitStore interface {
+	// takeRequest records one request and reports whether it fits in limit.
+	takeRequest(key string, limit int) (allowed bool, remaining int, resetAfter int64, err error)
+	// tokensUsed returns the tokens consumed in the current window.
+	tokensUsed(key string) (used int64, resetAfter int64, err error)
+	addTokens(key string, amount int64) error
+}
+
+type memoryAggTokenRateLimitStore struct {
+	requests *common.InMemoryRateLimiter
+	tokens   *common.InMemoryWindowCounter
+}
+
+func (s memoryAggTokenRateLimitStore) takeRequest(key string, limit int) (bool, int, int64, error) {
+	allowed, remaining, resetAfter := s.requests.RequestWithRemaining(key, limit, aggTokenRateLimitWindow)
+	return allowed, remaining, resetAfter, nil
+}
+
+func (s memoryAggTokenRateLimitStore) tokensUsed(key string) (int64, int64, error) {
+	used, resetAfter := s.tokens.Get(key, aggTokenRateLimitWindow)
+	return used, resetAfter, nil
+}
+
+func (s memoryAggTokenRateLimitStore) addTokens(key string, amount int64) error {
+	s.tokens.Add(key, amount, aggTokenRateLimitWindow)
+	return nil
+}
+
+// redisAggTokenRateLimitStore keeps one sorted set per key, scored by the
+// millisecond timestamp of each entry, so that every instance sharing the
+// Redis sees the same sliding window. Token entries carry their amount in the
+// member as "<amount>:<id>".
+type redisAggTokenRateLimitStore struct{}
+
+// KEYS[1] key; ARGV: now ms, window ms, limit, member.
+// Returns {allowed, count, oldest ms}.
+var redisTakeRequestScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < tonumber(ARGV[3]) then
+	redis.call("ZADD", KEYS[1], ARGV[1], ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local oldestAt = tonumber(ARGV[1])
+if oldest[2] then
+	oldestAt = tonumber(oldest[2])
+end
+return {allowed, count, oldestAt}
+`)
+
+// KEYS[1] key; ARGV: now ms, window ms. Returns {used, oldest ms}.
+var redisTokensUsedScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local entries = redis.call("ZRANGE", KEYS[1], 0, -1, "WITHSCORES")
+local used = 0
+local oldestAt = tonumber(ARGV[1])
+for i = 1, #entries, 2 do
+	local amount = tonumber(string.match(entries[i], "^(%d+):"))
+	if amount then
+		used = used + amount
+	end
+	if i == 1 then
+		oldestAt = tonumber(entries[i + 1])
+	end
+end
+return {used, oldestAt}
+`)
+
+func redisResetAfter(nowMs int64, oldestMs int64) int64 {
+	windowMs := aggTokenRateLimitWindow * 1000
+	remainingMs := oldestMs + windowMs - nowMs
+	if remainingMs <= 0 {
+		return 0
+	}
+	return (remainingMs + 999) / 1000
+}
+
+func (redisAggTokenRateLimitStore) takeRequest(key string, limit int) (bool, int, int64, error) {
+	nowMs := time.Now().UnixMilli()
+	result, err := redisTakeRequestScript.Run(context.Background(), common.RDB, []string{"rateLimit:" + key},
+		nowMs, aggTokenRateLimitWindow*1000, limit, common.GetUUID()).Int64Slice()
+	if err != nil || len(result) != 3 {
+		return true, limit, aggTokenRateLimitWindow, err
+	}
+	resetAfter := redisResetAfter(nowMs, result[2])
+	if result[0] == 0 {
+		return false, 0, resetAfter, nil
+	}
+	return true, limit - int(result[1]), resetAfter, nil
+}
+
+func (redisAggTokenRateLimitStore) tokensUsed(key string) (int64, int64, error) {
+	nowMs := time.Now().UnixMilli()
+	result, err := redisTokensUsedScript.Run(context.Background(), common.RDB, []string{"rateLimit:" + key},
+		nowMs, aggTokenRateLimitWindow*1000).Int64Slice()
+	if err != nil || len(result) != 2 {
+		return 0, aggTokenRateLimitWindow, err
+	}
+	return result[0], redisResetAfter(nowMs, result[1]), nil
+}
+
+func (redisAggTokenRateLimitStore) addTokens(key string, amount int64) error {
+	ctx := context.Background()
+	redisKey := "rateLimit:" + key
+	member := fmt.Sprintf("%d:%s", amount, common.GetUUID())
+	if err := common.RDB.ZAdd(ctx, redisKey, &redis.Z{Score: float64(time.Now().UnixMilli()), Member: member}).Err(); err != nil {
+		return err
+	}
+	return common.RDB.PExpire(ctx, redisKey, time.Duration(aggTokenRateLimitWindow)*time.Second).Err()
+}
+
+// AggTokenRateLimit enforces the per aggregated token RPM/TPM limits. It must
+// run after AggTokenAuth. TPM is checked against tokens already consumed in the
+// current window, since the cost of the incoming request is unknown upfront.
+func AggTokenRateLimit() func(c *gin.Context) {
+	var store aggTokenRateLimitStore
+	if common.RedisEnabled {
+		store = redisAggTokenRateLimitStore{}
+	} else {
+		// It's safe to call multi times.
+		inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+		inMemoryTokenCounter.Init(common.RateLimitKeyExpirationDuration)
+		store = memoryAggTokenRateLimitStore{requests: &inMemoryRateLimiter, tokens: &inMemoryTokenCounter}
+	}
+	return aggTokenRateLimitWithStore(store)
+}
+
+func aggTokenRateLimitWithStore(store aggTokenRateLimitStore) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		value, ok := c.Get("agg_token")
+		token, _ := value.(*model.AggregatedToken)
+		if !ok || token == nil || !token.HasRateLimit() || c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+		rpmKey := fmt.Sprintf("AR:rpm:%d", token.Id)
+		tpmKey := fmt.Sprintf("AR:tpm:%d", token.Id)
+
+		// Redis failures fail open: throttling must not take the relay down.
+		if token.RateLimitTPM > 0 {
+			used, resetAfter, err := store.tokensUsed(tpmKey)
+			if err != nil {
+				common.SysError(fmt.Sprintf("[agg-token-rate-limit] token_id=%d read tpm failed: %v", token.Id, err))
+			}
+			remaining := token.RateLimitTPM - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			setRateLimitHeaders(c, "tokens", token.RateLimitTPM, remaining, resetAfter)
+			if err == nil && used >= token.RateLimitTPM {
+				abortRateLimited(c, resetAfter, fmt.Sprintf("rate limit exceeded: used %d of %d tokens per minute", used, token.RateLimitTPM))
+				return
+			}
+		}
+		if token.RateLimitRPM > 0 {
+			allowed, remaining, resetAfter, err := store.takeRequest(rpmKey, token.RateLimitRPM)
+			if err != nil {
+				common.SysError(fmt.Sprintf("[agg-token-rate-limit] token_id=%d take rpm failed: %v", token.Id, err))
+			}
+			setRateLimitHeaders(c, "requests", int64(token.RateLimitRPM), int64(remaining), resetAfter)
+			if !allowed {
+				abortRateLimited(c, resetAfter, fmt.Sprintf("rate limit exceeded: %d requests per minute", token.RateLimitRPM))
+				return
+			}
+		}
+
+		c.Next()
+
+		if token.RateLimitTPM > 0 {
+			if used := c.GetInt64("relay_usage_tokens"); used > 0 {
+				if err := store.addTokens(tpmKey, used); err != nil {
+					common.SysError(fmt.Sprintf("[agg-token-rate-limit] token_id=%d record tpm failed: %v", token.Id, err))
+				}
+			}
+		}
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, kind string, limit int64, remaining int64, resetAfter int64) {
+	c.Header("x-ratelimit-limit-"+kind, strconv.FormatInt(limit, 10))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(remaining, 10))
+	c.Header("x-ratelimit-reset-"+kind, strconv.FormatInt(resetAfter, 10)+"s")
+}
+
+func abortRateLimited(c *gin.Context, retryAfter int64, message string) {
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	common.WriteRelayError(c, common.RelayErrRateLimited, message)
+	c.Abort()
+}
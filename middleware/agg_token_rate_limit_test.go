@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAggTokenRateLimitRouter(token *model.AggregatedToken, consumed int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	// Each router gets its own counters so repeated runs start empty.
+	store := memoryAggTokenRateLimitStore{
+		requests: &common.InMemoryRateLimiter{},
+		tokens:   &common.InMemoryWindowCounter{},
+	}
+	store.requests.Init(0)
+	store.tokens.Init(0)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("agg_token", token)
+		c.Next()
+	})
+	router.Use(aggTokenRateLimitWithStore(store))
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set("relay_usage_tokens", consumed)
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/v1/models", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func performRelayRequest(router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestAggTokenRateLimitRejectsAfterRPM(t *testing.T) {
+	token := &model.AggregatedToken{Id: 9001, RateLimitRPM: 2}
+	router := newAggTokenRateLimitRouter(token, 0)
+
+	for i := 0; i < 2; i++ {
+		recorder := performRelayRequest(router, http.MethodPost, "/v1/chat/completions")
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected 204, got %d", i, recorder.Code)
+		}
+		if got := recorder.Header().Get("x-ratelimit-limit-requests"); got != "2" {
+			t.Fatalf("unexpected limit header %q", got)
+		}
+	}
+
+	recorder := performRelayRequest(router, http.MethodPost, "/v1/chat/completions")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", recorder.Code)
+	}
+	if recorder.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+	if got := recorder.Header().Get("x-ratelimit-remaining-requests"); got != "0" {
+		t.Fatalf("expected remaining 0, got %q", got)
+	}
+
+	if recorder := performRelayRequest(router, http.MethodGet, "/v1/models"); recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected model listing to bypass limits, got %d", recorder.Code)
+	}
+}
+
+func TestAggTokenRateLimitRejectsAfterTPM(t *testing.T) {
+	token := &model.AggregatedToken{Id: 9002, RateLimitTPM: 100}
+	router := newAggTokenRateLimitRouter(token, 120)
+
+	recorder := performRelayRequest(router, http.MethodPost, "/v1/chat/completions")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected first request to pass, got %d", recorder.Code)
+	}
+	if got := recorder.Header().Get("x-ratelimit-remaining-tokens"); got != "100" {
+		t.Fatalf("expected remaining tokens 100 before consumption, got %q", got)
+	}
+
+	recorder = performRelayRequest(router, http.MethodPost, "/v1/chat/completions")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once TPM is consumed, got %d", recorder.Code)
+	}
+	if got := recorder.Header().Get("x-ratelimit-remaining-tokens"); got != "0" {
+		t.Fatalf("expected remaining tokens 0, got %q", got)
+	}
+}
+
+func TestInMemoryWindowCounterResetsPerKey(t *testing.T) {
+	var counter common.InMemoryWindowCounter
+	counter.Init(0)
+	counter.Add("a", 5, 60)
+	counter.Add("a", 7, 60)
+	if used, _ := counter.Get("a", 60); used != 12 {
+		t.Fatalf("expected 12, got %d", used)
+	}
+	if used, _ := counter.Get("b", 60); used != 0 {
+		t.Fatalf("expected empty counter for other key, got %d", used)
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"NewAPI-Gateway/common"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth guards /metrics with METRICS_TOKEN. When the token is unset the
+// endpoint requires a root session or a root user's access token, so metrics
+// are never exposed by default.
+func MetricsAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := common.MetricsToken
+		if expected == "" {
+			authHelper(c, common.RoleRootUser)
+			return
+		}
+		provided := strings.TrimSpace(c.GetHeader("Authorization"))
+		provided = strings.TrimSpace(strings.TrimPrefix(provided, "Bearer "))
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+			c.String(http.StatusUnauthorized, "unauthorized\n")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
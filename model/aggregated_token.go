@@ -3,6 +3,7 @@ package model
 import (
 	"NewAPI-Gateway/common"
 	"errors"
+	"fmt"
 	"math/rand"
 	"strings"
 	"time"
@@ -18,10 +19,37 @@ type AggregatedToken struct {
 	ModelLimitsEnabled bool   `json:"model_limits_enabled"`
 	ModelLimits        string `json:"model_limits" gorm:"type:varchar(2048)"`
 	AllowIps           string `json:"allow_ips" gorm:"type:text"`
-	CreatedAt          int64  `json:"created_at"`
-	AccessedAt         int64  `json:"accessed_at"`
+	// Budgets are hard caps evaluated against usage_logs; 0 means unlimited.
+	DailyBudgetUSD     float64 `json:"daily_budget_usd" gorm:"default:0"`
+	MonthlyBudgetUSD   float64 `json:"monthly_budget_usd" gorm:"default:0"`
+	DailyTokenBudget   int64   `json:"daily_token_budget" gorm:"default:0"`
+	MonthlyTokenBudget int64   `json:"monthly_token_budget" gorm:"default:0"`
+	// Per-minute relay throttling; 0 means unlimited.
+	RateLimitRPM int   `json:"rate_limit_rpm" gorm:"default:0"`
+	RateLimitTPM int64 `json:"rate_limit_tpm" gorm:"default:0"`
+	// Replays byte-identical non-streaming completions from the response cache.
+	ResponseCacheEnabled bool `json:"response_cache_enabled" gorm:"default:false"`
+	// Hedges non-streaming requests that are slower than the hedge delay.
+	HedgeEnabled bool `json:"hedge_enabled" gorm:"default:false"`
+	// RoutingStrategy overrides the routing strategy; empty follows the
+	// per-model default.
+	RoutingStrategy string `json:"routing_strategy" gorm:"type:varchar(16);default:''"`
+	// RetryPolicy is a partial retry policy JSON overriding the global and
+	// per-model settings; empty inherits them.
+	RetryPolicy string `json:"retry_policy" gorm:"type:text"`
+	CreatedAt   int64  `json:"created_at"`
+	AccessedAt  int64  `json:"accessed_at"`
 }
 
+const (
+	// RoutingStrategyValue weights routes by value score (cost, balance and
+	// recent spend), optionally tiered by health.
+	RoutingStrategyValue = "value"
+	// RoutingStrategyLatency prefers the route with the lowest live
+	// first-token latency within a health tier.
+	RoutingStrategyLatency = "latency"
+)
+
 const aggTokenKeyChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 func generateAggTokenKey() string {
@@ -47,6 +75,16 @@ func GetAggTokenById(id int, userId int) (*AggregatedToken, error) {
 	return &token, err
 }
 
+// GetAggTokenByIdForAdmin loads a token of any user.
+func GetAggTokenByIdForAdmin(id int) (*AggregatedToken, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空")
+	}
+	var token AggregatedToken
+	err := DB.First(&token, "id = ?", id).Error
+	return &token, err
+}
+
 func GetAggTokenByKey(key string) (*AggregatedToken, error) {
 	if key == "" {
 		return nil, errors.New("key 为空")
@@ -90,8 +128,46 @@ func ValidateAggToken(key string) (*AggregatedToken, *User, error) {
 	return token, user, nil
 }
 
-// IsModelAllowed checks if the requested model is allowed by this token
+// IsModelAllowed checks if the requested model is allowed by this token. A
+// virtual model is allowed when it is listed itself or when any of its targets is.
 func (t *AggregatedToken) IsModelAllowed(model string) bool {
+	if t.matchesModelLimits(model) {
+		return true
+	}
+	targets, ok := common.GetVirtualModelTargets(model)
+	if !ok {
+		return false
+	}
+	for _, target := range targets {
+		if t.matchesModelLimits(target.Model) {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualModelCandidates resolves a virtual model into the concrete models to
+// try, in order. Listing the virtual name allows all of its targets; otherwise
+// only the targets the token lists are kept.
+func (t *AggregatedToken) VirtualModelCandidates(name string) ([]string, bool) {
+	targets, ok := common.GetVirtualModelTargets(name)
+	if !ok {
+		return nil, false
+	}
+	ordered := common.OrderVirtualModelTargets(targets)
+	if t.matchesModelLimits(name) {
+		return ordered, true
+	}
+	allowed := make([]string, 0, len(ordered))
+	for _, candidate := range ordered {
+		if t.matchesModelLimits(candidate) {
+			allowed = append(allowed, candidate)
+		}
+	}
+	return allowed, true
+}
+
+func (t *AggregatedToken) matchesModelLimits(model string) bool {
 	if !t.ModelLimitsEnabled || t.ModelLimits == "" {
 		return true
 	}
@@ -148,6 +224,173 @@ func (t *AggregatedToken) IsIPAllowed(ip string) bool {
 	return false
 }
 
+// HasBudget reports whether any spend or token budget is configured.
+func (t *AggregatedToken) HasBudget() bool {
+	return t.DailyBudgetUSD > 0 || t.MonthlyBudgetUSD > 0 || t.DailyTokenBudget > 0 || t.MonthlyTokenBudget > 0
+}
+
+// ValidateBudgets rejects negative budget values.
+func (t *AggregatedToken) ValidateBudgets() error {
+	if t.DailyBudgetUSD < 0 || t.MonthlyBudgetUSD < 0 || t.DailyTokenBudget < 0 || t.MonthlyTokenBudget < 0 {
+		return errors.New("预算不能为负数")
+	}
+	return nil
+}
+
+// HasRateLimit reports whether an RPM or TPM limit is configured.
+func (t *AggregatedToken) HasRateLimit() bool {
+	return t.RateLimitRPM > 0 || t.RateLimitTPM > 0
+}
+
+// ValidateRateLimits rejects negative RPM/TPM values.
+func (t *AggregatedToken) ValidateRateLimits() error {
+	if t.RateLimitRPM < 0 || t.RateLimitTPM < 0 {
+		return errors.New("速率限制不能为负数")
+	}
+	return nil
+}
+
+// ValidateRoutingStrategy rejects unknown routing strategies.
+func (t *AggregatedToken) ValidateRoutingStrategy() error {
+	t.RoutingStrategy = strings.TrimSpace(t.RoutingStrategy)
+	switch t.RoutingStrategy {
+	case "", RoutingStrategyValue, RoutingStrategyLatency:
+		return nil
+	}
+	return errors.New("路由策略只能为 value 或 latency")
+}
+
+// ValidateRetryPolicy rejects malformed retry policy overrides.
+func (t *AggregatedToken) ValidateRetryPolicy() error {
+	t.RetryPolicy = strings.TrimSpace(t.RetryPolicy)
+	_, err := common.ParseRetryPolicyOverride(t.RetryPolicy)
+	return err
+}
+
+// RetryPolicyFor returns the retry policy of a request for modelName.
+func (t *AggregatedToken) RetryPolicyFor(modelName string) common.RetryPolicy {
+	override, err := common.ParseRetryPolicyOverride(t.RetryPolicy)
+	if err != nil {
+		override = nil
+	}
+	return common.LoadRetryPolicy(modelName, override)
+}
+
+// RoutingStrategyFor returns the routing strategy of a request: the token
+// setting if any, otherwise latency when one of modelNames is listed in the
+// RoutingLatencyModels option.
+func (t *AggregatedToken) RoutingStrategyFor(modelNames ...string) string {
+	if t.RoutingStrategy != "" {
+		return t.RoutingStrategy
+	}
+	cfg := common.LoadRouteLatencyConfig()
+	for _, name := range modelNames {
+		if cfg.ModelEnabled(name) {
+			return RoutingStrategyLatency
+		}
+	}
+	return RoutingStrategyValue
+}
+
+// AggTokenBudgetUsage is the consumption of an aggregated token in the
+// current local day and month, together with the configured limits.
+type AggTokenBudgetUsage struct {
+	DailyCostUSD       float64 `json:"daily_cost_usd"`
+	MonthlyCostUSD     float64 `json:"monthly_cost_usd"`
+	DailyTokens        int64   `json:"daily_tokens"`
+	MonthlyTokens      int64   `json:"monthly_tokens"`
+	DailyBudgetUSD     float64 `json:"daily_budget_usd"`
+	MonthlyBudgetUSD   float64 `json:"monthly_budget_usd"`
+	DailyTokenBudget   int64   `json:"daily_token_budget"`
+	MonthlyTokenBudget int64   `json:"monthly_token_budget"`
+}
+
+// ExceededReason returns a client-facing description of the first exhausted
+// budget, or an empty string when the token is still within all limits.
+func (u *AggTokenBudgetUsage) ExceededReason() string {
+	if u == nil {
+		return ""
+	}
+	if u.DailyBudgetUSD > 0 && u.DailyCostUSD >= u.DailyBudgetUSD {
+		return fmt.Sprintf("daily budget exceeded: spent $%.4f of $%.4f", u.DailyCostUSD, u.DailyBudgetUSD)
+	}
+	if u.MonthlyBudgetUSD > 0 && u.MonthlyCostUSD >= u.MonthlyBudgetUSD {
+		return fmt.Sprintf("monthly budget exceeded: spent $%.4f of $%.4f", u.MonthlyCostUSD, u.MonthlyBudgetUSD)
+	}
+	if u.DailyTokenBudget > 0 && u.DailyTokens >= u.DailyTokenBudget {
+		return fmt.Sprintf("daily token budget exceeded: used %d of %d tokens", u.DailyTokens, u.DailyTokenBudget)
+	}
+	if u.MonthlyTokenBudget > 0 && u.MonthlyTokens >= u.MonthlyTokenBudget {
+		return fmt.Sprintf("monthly token budget exceeded: used %d of %d tokens", u.MonthlyTokens, u.MonthlyTokenBudget)
+	}
+	return ""
+}
+
+// GetAggTokenBudgetUsage sums usage_logs of the token for the local day and
+// month containing now.
+func GetAggTokenBudgetUsage(t *AggregatedToken, now time.Time) (*AggTokenBudgetUsage, error) {
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := now.Unix() + 1
+
+	usage := &AggTokenBudgetUsage{
+		DailyBudgetUSD:     t.DailyBudgetUSD,
+		MonthlyBudgetUSD:   t.MonthlyBudgetUSD,
+		DailyTokenBudget:   t.DailyTokenBudget,
+		MonthlyTokenBudget: t.MonthlyTokenBudget,
+	}
+	var err error
+	usage.DailyCostUSD, usage.DailyTokens, err = GetAggTokenUsageBetween(t.Id, dayStart.Unix(), end)
+	if err != nil {
+		return nil, err
+	}
+	usage.MonthlyCostUSD, usage.MonthlyTokens, err = GetAggTokenUsageBetween(t.Id, monthStart.Unix(), end)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// GetAggTokenUsageBetween returns the cost and prompt+completion tokens
+// logged for the token within [start, end). Response cache hits are free and
+// do not count towards token budgets. It reads raw usage logs only, which
+// always cover the current budget windows; use GetAggTokenCostBetween for
+// arbitrary ranges.
+func GetAggTokenUsageBetween(tokenId int, start int64, end int64) (float64, int64, error) {
+	type usageRow struct {
+		CostUSD float64 `gorm:"column:cost_usd"`
+		Tokens  int64   `gorm:"column:tokens"`
+	}
+	var row usageRow
+	err := DB.Model(&UsageLog{}).
+		Select("COALESCE(SUM(cost_usd), 0) AS cost_usd, COALESCE(SUM(CASE WHEN cache_hit THEN 0 ELSE prompt_tokens + completion_tokens END), 0) AS tokens").
+		Where("aggregated_token_id = ? AND created_at >= ? AND created_at < ?", tokenId, start, end).
+		Scan(&row).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return row.CostUSD, row.Tokens, nil
+}
+
+// GetAggTokenCostBetween returns the cost logged for the token within
+// [start, end). It reads the hourly rollups plus the raw rows after the
+// watermark, so pruned logs still count; both bounds are rounded down to the
+// hour.
+func GetAggTokenCostBetween(tokenId int, start int64, end int64) (float64, error) {
+	start -= start % 3600
+	end -= end % 3600
+	watermark, err := GetUsageRollupWatermark()
+	if err != nil {
+		return 0, err
+	}
+	var costUSD float64
+	err = usageStatsSource(UsageRollupHour, start, watermark).
+		Select("COALESCE(SUM(cost_usd), 0)").
+		Where("aggregated_token_id = ? AND created_at < ?", tokenId, end).
+		Scan(&costUSD).Error
+	return costUSD, err
+}
+
 func (t *AggregatedToken) Insert() error {
 	t.Key = generateAggTokenKey()
 	t.CreatedAt = time.Now().Unix()
@@ -156,7 +399,9 @@ func (t *AggregatedToken) Insert() error {
 
 func (t *AggregatedToken) Update() error {
 	return DB.Model(t).Select("name", "status", "expired_time", "model_limits_enabled",
-		"model_limits", "allow_ips").Updates(t).Error
+		"model_limits", "allow_ips", "daily_budget_usd", "monthly_budget_usd",
+		"daily_token_budget", "monthly_token_budget", "rate_limit_rpm", "rate_limit_tpm",
+		"response_cache_enabled", "routing_strategy", "hedge_enabled", "retry_policy").Updates(t).Error
 }
 
 func (t *AggregatedToken) Delete() error {
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"NewAPI-Gateway/common"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAggTokenTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open in-memory sqlite: %v", err)
+	}
+	DB = db
+	if err := DB.AutoMigrate(&AggregatedToken{}, &UsageLog{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+}
+
+func insertBudgetUsageLog(t *testing.T, tokenId int, createdAt time.Time, cost float64, prompt int, completion int) {
+	t.Helper()
+	log := UsageLog{
+		AggregatedTokenId: tokenId,
+		CostUSD:           cost,
+		PromptTokens:      prompt,
+		CompletionTokens:  completion,
+		Status:            1,
+		CreatedAt:         createdAt.Unix(),
+	}
+	if err := DB.Create(&log).Error; err != nil {
+		t.Fatalf("insert usage log: %v", err)
+	}
+}
+
+func TestGetAggTokenBudgetUsageSplitsDayAndMonth(t *testing.T) {
+	setupAggTokenTestDB(t)
+
+	now := time.Date(2026, 5, 20, 15, 0, 0, 0, time.Local)
+	token := &AggregatedToken{Id: 7, DailyBudgetUSD: 5, MonthlyBudgetUSD: 50}
+
+	insertBudgetUsageLog(t, 7, now.Add(-time.Hour), 1.5, 100, 50)
+	insertBudgetUsageLog(t, 7, now.AddDate(0, 0, -3), 10, 1000, 500)
+	insertBudgetUsageLog(t, 7, now.AddDate(0, -1, 0), 99, 9999, 9999)
+	insertBudgetUsageLog(t, 8, now.Add(-time.Hour), 42, 1, 1)
+
+	usage, err := GetAggTokenBudgetUsage(token, now)
+	if err != nil {
+		t.Fatalf("GetAggTokenBudgetUsage: %v", err)
+	}
+	if usage.DailyCostUSD != 1.5 || usage.DailyTokens != 150 {
+		t.Fatalf("unexpected daily usage: %+v", usage)
+	}
+	if usage.MonthlyCostUSD != 11.5 || usage.MonthlyTokens != 1650 {
+		t.Fatalf("unexpected monthly usage: %+v", usage)
+	}
+	if reason := usage.ExceededReason(); reason != "" {
+		t.Fatalf("expected within budget, got %q", reason)
+	}
+}
+
+func TestAggTokenBudgetExceededReason(t *testing.T) {
+	cases := []struct {
+		name  string
+		usage AggTokenBudgetUsage
+		want  string
+	}{
+		{name: "unlimited", usage: AggTokenBudgetUsage{DailyCostUSD: 1000, MonthlyTokens: 1 << 40}, want: ""},
+		{name: "daily cost", usage: AggTokenBudgetUsage{DailyBudgetUSD: 1, DailyCostUSD: 1}, want: "daily budget"},
+		{name: "monthly cost", usage: AggTokenBudgetUsage{MonthlyBudgetUSD: 10, MonthlyCostUSD: 12}, want: "monthly budget"},
+		{name: "daily tokens", usage: AggTokenBudgetUsage{DailyTokenBudget: 100, DailyTokens: 101}, want: "daily token budget"},
+		{name: "monthly tokens", usage: AggTokenBudgetUsage{MonthlyTokenBudget: 100, MonthlyTokens: 100}, want: "monthly token budget"},
+		{name: "below limits", usage: AggTokenBudgetUsage{DailyBudgetUSD: 1, DailyCostUSD: 0.5, MonthlyTokenBudget: 100, MonthlyTokens: 99}, want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.usage.ExceededReason()
+			if tc.want == "" {
+				if got != "" {
+					t.Fatalf("expected no reason, got %q", got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, tc.want) {
+				t.Fatalf("expected reason starting with %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAggTokenUpdatePersistsBudgets(t *testing.T) {
+	setupAggTokenTestDB(t)
+
+	token := &AggregatedToken{UserId: 1, Name: "ci", Status: 1, ExpiredTime: -1}
+	if err := token.Insert(); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	token.DailyBudgetUSD = 2.5
+	token.MonthlyTokenBudget = 1000000
+	if err := token.Update(); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	stored, err := GetAggTokenById(token.Id, 1)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if stored.DailyBudgetUSD != 2.5 || stored.MonthlyTokenBudget != 1000000 {
+		t.Fatalf("budgets not persisted: %+v", stored)
+	}
+	if !stored.HasBudget() {
+		t.Fatal("expected HasBudget to be true")
+	}
+}
+
+func TestAggTokenVirtualModelAllowance(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	previous := common.OptionMap
+	common.OptionMap = map[string]string{"VirtualModels": `{"team-default":[{"model":"gpt-4o","weight":1},{"model":"claude-sonnet-4","weight":1}]}`}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = previous
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	listed := &AggregatedToken{ModelLimitsEnabled: true, ModelLimits: "team-default"}
+	if !listed.IsModelAllowed("team-default") {
+		t.Fatal("expected a listed virtual model to be allowed")
+	}
+	if candidates, ok := listed.VirtualModelCandidates("team-default"); !ok || len(candidates) != 2 {
+		t.Fatalf("expected every target through the virtual name, got %v", candidates)
+	}
+
+	concrete := &AggregatedToken{ModelLimitsEnabled: true, ModelLimits: "gpt-4o"}
+	if !concrete.IsModelAllowed("team-default") {
+		t.Fatal("expected a virtual model to be allowed through one of its targets")
+	}
+	if candidates, _ := concrete.VirtualModelCandidates("team-default"); len(candidates) != 1 || candidates[0] != "gpt-4o" {
+		t.Fatalf("expected only the listed target, got %v", candidates)
+	}
+
+	other := &AggregatedToken{ModelLimitsEnabled: true, ModelLimits: "gemini-2.5-pro"}
+	if other.IsModelAllowed("team-default") {
+		t.Fatal("expected a virtual model without allowed targets to be rejected")
+	}
+	if _, ok := other.VirtualModelCandidates("gpt-4o"); ok {
+		t.Fatal("expected concrete models not to resolve as virtual")
+	}
+}
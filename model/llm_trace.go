@@ -122,3 +122,8 @@ func DeleteAllLLMTraces() (int64, error) {
 	result := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&LLMTrace{})
 	return result.RowsAffected, result.Error
 }
+
+// DeleteLLMTracesBefore deletes traces created before cutoff in batches.
+func DeleteLLMTracesBefore(cutoff int64) (int64, error) {
+	return deleteRowsCreatedBefore(&LLMTrace{}, cutoff)
+}
@@ -257,10 +257,22 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&UsageRollup{})
+		if err != nil {
+			return err
+		}
 		err = db.AutoMigrate(&LLMTrace{})
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&RouteTestResult{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&RouteCooldownState{})
+		if err != nil {
+			return err
+		}
 
 		// Run migrations for new features
 		err = runMigrations(db)
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// ModelCatalogPricing is the cheapest upstream price of a model in USD, after
+// the group ratio of the serving token. Per-token prices are per 1M tokens.
+type ModelCatalogPricing struct {
+	PromptPer1M     *float64 `json:"prompt_per_1m,omitempty"`
+	CompletionPer1M *float64 `json:"completion_per_1m,omitempty"`
+	PerCall         *float64 `json:"per_call,omitempty"`
+}
+
+// ModelCatalogEntry describes a routable model.
+type ModelCatalogEntry struct {
+	Id string
+	// SupportedEndpointTypes is the union of the endpoint types advertised by
+	// the upstreams serving the model; empty when unknown.
+	SupportedEndpointTypes []string
+	// ContextLength is the smallest known context window among those
+	// upstreams, so every route can hold it; 0 when unknown.
+	ContextLength int
+	Pricing       ModelCatalogPricing
+}
+
+// GetModelCatalog lists the models of enabled routes that can serve
+// clientType, sorted by name. Routes in cooldown are still listed.
+func GetModelCatalog(clientType string) ([]ModelCatalogEntry, error) {
+	var routes []ModelRoute
+	if err := DB.Where("enabled = ?", true).Order("model_name ASC, id ASC").Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	providerIds := make([]int, 0)
+	providerSeen := make(map[int]bool)
+	tokenIds := make([]int, 0)
+	tokenSeen := make(map[int]bool)
+	for _, route := range routes {
+		if !providerSeen[route.ProviderId] {
+			providerSeen[route.ProviderId] = true
+			providerIds = append(providerIds, route.ProviderId)
+		}
+		if !tokenSeen[route.ProviderTokenId] {
+			tokenSeen[route.ProviderTokenId] = true
+			tokenIds = append(tokenIds, route.ProviderTokenId)
+		}
+	}
+	providerLookup, err := loadProvidersByIDs(providerIds)
+	if err != nil {
+		return nil, err
+	}
+	tokenLookup, err := loadProviderTokensByIDs(tokenIds)
+	if err != nil {
+		return nil, err
+	}
+	pricingLookup := make(map[string]ModelPricing)
+	for _, batch := range chunkInts(providerIds, sqliteSingleInChunkSize) {
+		var pricings []ModelPricing
+		if err := DB.Where("provider_id IN ?", batch).Find(&pricings).Error; err != nil {
+			return nil, err
+		}
+		for _, pricing := range pricings {
+			pricingLookup[routePricingKey(pricing.ProviderId, pricing.ModelName)] = pricing
+		}
+	}
+
+	entries := make(map[string]*ModelCatalogEntry)
+	endpointSets := make(map[string]map[string]bool)
+	var names []string
+	for _, route := range routes {
+		provider := providerLookup[route.ProviderId]
+		token := tokenLookup[route.ProviderTokenId]
+		if !isRouteServable(route, provider, token, clientType) {
+			continue
+		}
+		entry, ok := entries[route.ModelName]
+		if !ok {
+			entry = &ModelCatalogEntry{Id: route.ModelName}
+			entries[route.ModelName] = entry
+			endpointSets[route.ModelName] = make(map[string]bool)
+			names = append(names, route.ModelName)
+		}
+		pricing, ok := pricingLookup[routePricingKey(route.ProviderId, route.ModelName)]
+		if !ok {
+			continue
+		}
+		for _, endpointType := range parseSupportedEndpointTypes(pricing.SupportedEndpointTypes) {
+			endpointSets[route.ModelName][endpointType] = true
+		}
+		if pricing.ContextLength > 0 && (entry.ContextLength == 0 || pricing.ContextLength < entry.ContextLength) {
+			entry.ContextLength = pricing.ContextLength
+		}
+		groupRatio := getGroupRatio(token.GroupName, parseGroupRatioMap(provider.PricingGroupRatio))
+		mergeModelCatalogPricing(&entry.Pricing, pricing, groupRatio)
+	}
+
+	sort.Strings(names)
+	out := make([]ModelCatalogEntry, 0, len(names))
+	for _, name := range names {
+		entry := entries[name]
+		for endpointType := range endpointSets[name] {
+			entry.SupportedEndpointTypes = append(entry.SupportedEndpointTypes, endpointType)
+		}
+		sort.Strings(entry.SupportedEndpointTypes)
+		out = append(out, *entry)
+	}
+	return out, nil
+}
+
+// mergeModelCatalogPricing keeps the cheapest per-call price and the per-token
+// prices of the route with the cheapest prompt price.
+func mergeModelCatalogPricing(out *ModelCatalogPricing, pricing ModelPricing, groupRatio float64) {
+	if pricing.ModelPrice > 0 || pricing.QuotaType == 1 {
+		perCall := pricing.ModelPrice * groupRatio
+		if out.PerCall == nil || perCall < *out.PerCall {
+			out.PerCall = &perCall
+		}
+		return
+	}
+	if pricing.ModelRatio <= 0 {
+		return
+	}
+	prompt := pricing.ModelRatio * 2 * groupRatio
+	completionRatio := pricing.CompletionRatio
+	if completionRatio <= 0 {
+		completionRatio = 1
+	}
+	completion := prompt * completionRatio
+	if out.PromptPer1M == nil || prompt < *out.PromptPer1M {
+		out.PromptPer1M = &prompt
+		out.CompletionPer1M = &completion
+	}
+}
+
+// FindModelCatalogEntry looks a model up by exact, then case-insensitive name.
+func FindModelCatalogEntry(entries []ModelCatalogEntry, name string) (ModelCatalogEntry, bool) {
+	for _, entry := range entries {
+		if entry.Id == name {
+			return entry, true
+		}
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Id, name) {
+			return entry, true
+		}
+	}
+	return ModelCatalogEntry{}, false
+}
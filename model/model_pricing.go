@@ -1,6 +1,9 @@
 package model
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,7 +20,51 @@ type ModelPricing struct {
 	ModelPrice             float64 `json:"model_price"`
 	EnableGroups           string  `json:"enable_groups" gorm:"type:text"`
 	SupportedEndpointTypes string  `json:"supported_endpoint_types" gorm:"type:text"`
-	LastSynced             int64   `json:"last_synced"`
+	ContextLength          int     `json:"context_length"`
+	// Billing ratios relative to the input price (ModelRatio), except
+	// AudioCompletionRatio which is relative to the audio input price. 0 means
+	// unset: those tokens are billed as plain prompt/completion tokens.
+	CacheRatio           float64 `json:"cache_ratio"`
+	CacheCreationRatio   float64 `json:"cache_creation_ratio"`
+	CacheCreation1hRatio float64 `json:"cache_creation_1h_ratio"`
+	AudioRatio           float64 `json:"audio_ratio"`
+	AudioCompletionRatio float64 `json:"audio_completion_ratio"`
+	ImageRatio           float64 `json:"image_ratio"`
+	// PriceTiers is a JSON array of PriceTier for long-context pricing.
+	PriceTiers string `json:"price_tiers" gorm:"type:text"`
+	LastSynced int64  `json:"last_synced"`
+}
+
+// PriceTier replaces ModelRatio and CompletionRatio for requests whose input
+// (prompt plus cache tokens) exceeds MinPromptTokens.
+type PriceTier struct {
+	MinPromptTokens int     `json:"min_prompt_tokens"`
+	ModelRatio      float64 `json:"model_ratio"`
+	CompletionRatio float64 `json:"completion_ratio"`
+}
+
+// billingExtensionUpdates returns the cache, audio, image and tier fields the
+// caller actually provides. Syncs only overwrite what the upstream reports,
+// so values set by admins survive upstreams that do not report them.
+func (p *ModelPricing) billingExtensionUpdates() map[string]interface{} {
+	updates := make(map[string]interface{})
+	ratios := map[string]float64{
+		"cache_ratio":             p.CacheRatio,
+		"cache_creation_ratio":    p.CacheCreationRatio,
+		"cache_creation_1h_ratio": p.CacheCreation1hRatio,
+		"audio_ratio":             p.AudioRatio,
+		"audio_completion_ratio":  p.AudioCompletionRatio,
+		"image_ratio":             p.ImageRatio,
+	}
+	for column, ratio := range ratios {
+		if ratio > 0 {
+			updates[column] = ratio
+		}
+	}
+	if strings.TrimSpace(p.PriceTiers) != "" {
+		updates["price_tiers"] = p.PriceTiers
+	}
+	return updates
 }
 
 func upsertModelPricingWithDB(db *gorm.DB, p *ModelPricing) error {
@@ -25,15 +72,20 @@ func upsertModelPricingWithDB(db *gorm.DB, p *ModelPricing) error {
 	result := db.Where("model_name = ? AND provider_id = ?", p.ModelName, p.ProviderId).First(&existing)
 	if result.RowsAffected > 0 {
 		p.Id = existing.Id
-		return db.Model(&existing).Updates(map[string]interface{}{
+		updates := map[string]interface{}{
 			"quota_type":               p.QuotaType,
 			"model_ratio":              p.ModelRatio,
 			"completion_ratio":         p.CompletionRatio,
 			"model_price":              p.ModelPrice,
 			"enable_groups":            p.EnableGroups,
 			"supported_endpoint_types": p.SupportedEndpointTypes,
+			"context_length":           p.ContextLength,
 			"last_synced":              p.LastSynced,
-		}).Error
+		}
+		for column, value := range p.billingExtensionUpdates() {
+			updates[column] = value
+		}
+		return db.Model(&existing).Updates(updates).Error
 	}
 	p.LastSynced = time.Now().Unix()
 	return db.Create(p).Error
@@ -66,12 +118,101 @@ func GetModelPricingByProviderAndModel(providerId int, modelName string) (*Model
 	return &pricing, nil
 }
 
+// GetModelSupportedEndpointTypes returns the endpoint types (e.g. "openai",
+// "anthropic", "gemini") the provider advertises for a model. An empty result
+// means the capability is unknown.
+func GetModelSupportedEndpointTypes(providerId int, modelName string) []string {
+	pricing, err := GetModelPricingByProviderAndModel(providerId, modelName)
+	if err != nil {
+		return nil
+	}
+	return parseSupportedEndpointTypes(pricing.SupportedEndpointTypes)
+}
+
+func parseSupportedEndpointTypes(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal([]byte(raw), &types); err != nil {
+		return nil
+	}
+	return types
+}
+
 func GetAllModelPricing() ([]*ModelPricing, error) {
 	var pricing []*ModelPricing
 	err := DB.Find(&pricing).Error
 	return pricing, err
 }
 
+// ParsePriceTiers decodes PriceTiers sorted by ascending MinPromptTokens.
+func ParsePriceTiers(raw string) ([]PriceTier, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var tiers []PriceTier
+	if err := json.Unmarshal([]byte(raw), &tiers); err != nil {
+		return nil, err
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinPromptTokens < tiers[j].MinPromptTokens })
+	return tiers, nil
+}
+
+// PricingRatiosForPrompt returns the model and completion ratios that apply
+// to a request with promptTokens of input, after long-context tiers.
+func (p *ModelPricing) PricingRatiosForPrompt(promptTokens int) (modelRatio float64, completionRatio float64) {
+	modelRatio, completionRatio = p.ModelRatio, p.CompletionRatio
+	tiers, err := ParsePriceTiers(p.PriceTiers)
+	if err != nil {
+		return modelRatio, completionRatio
+	}
+	for _, tier := range tiers {
+		if promptTokens <= tier.MinPromptTokens {
+			break
+		}
+		modelRatio = tier.ModelRatio
+		if tier.CompletionRatio > 0 {
+			completionRatio = tier.CompletionRatio
+		}
+	}
+	return modelRatio, completionRatio
+}
+
+// ModelPricingBillingPatch holds the admin-editable billing fields of a
+// pricing record.
+type ModelPricingBillingPatch struct {
+	CacheRatio           float64 `json:"cache_ratio"`
+	CacheCreationRatio   float64 `json:"cache_creation_ratio"`
+	CacheCreation1hRatio float64 `json:"cache_creation_1h_ratio"`
+	AudioRatio           float64 `json:"audio_ratio"`
+	AudioCompletionRatio float64 `json:"audio_completion_ratio"`
+	ImageRatio           float64 `json:"image_ratio"`
+	PriceTiers           string  `json:"price_tiers"`
+}
+
+// UpdateModelPricingBilling overwrites the billing fields of a pricing record.
+// Zero values clear a field.
+func UpdateModelPricingBilling(id int, patch ModelPricingBillingPatch) (*ModelPricing, error) {
+	var pricing ModelPricing
+	if err := DB.First(&pricing, id).Error; err != nil {
+		return nil, err
+	}
+	err := DB.Model(&pricing).Updates(map[string]interface{}{
+		"cache_ratio":             patch.CacheRatio,
+		"cache_creation_ratio":    patch.CacheCreationRatio,
+		"cache_creation_1h_ratio": patch.CacheCreation1hRatio,
+		"audio_ratio":             patch.AudioRatio,
+		"audio_completion_ratio":  patch.AudioCompletionRatio,
+		"image_ratio":             patch.ImageRatio,
+		"price_tiers":             strings.TrimSpace(patch.PriceTiers),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return GetModelPricingByProviderAndModel(pricing.ProviderId, pricing.ModelName)
+}
+
 // DeletePricingForProvider removes all pricing records for a provider
 func DeletePricingForProvider(providerId int) error {
 	return DB.Where("provider_id = ?", providerId).Delete(&ModelPricing{}).Error
@@ -4,6 +4,7 @@ import (
 	"NewAPI-Gateway/common"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"regexp"
@@ -84,6 +85,7 @@ type ModelRoute struct {
 	AllowCC         bool   `json:"allow_cc" gorm:"default:false"`
 	BlockClients    bool   `json:"block_clients" gorm:"default:false"`
 	SystemPromptId  *int   `json:"system_prompt_id" gorm:"index"`
+	MaxConcurrency  int    `json:"max_concurrency" gorm:"default:0"`
 }
 
 // IsClientAllowed checks if a route allows the specified client type
@@ -130,6 +132,7 @@ type ModelRoutePatch struct {
 	AllowCC        *bool                  `json:"allow_cc,omitempty"`
 	BlockClients   *bool                  `json:"block_clients,omitempty"`
 	SystemPromptId NullableSystemPromptID `json:"system_prompt_id"`
+	MaxConcurrency *int                   `json:"max_concurrency,omitempty"`
 }
 
 // NullableSystemPromptID distinguishes an omitted field from an explicit JSON
@@ -173,6 +176,9 @@ func (p *ModelRoutePatch) ToUpdates() map[string]interface{} {
 	if p.BlockClients != nil {
 		updates["block_clients"] = *p.BlockClients
 	}
+	if p.MaxConcurrency != nil {
+		updates["max_concurrency"] = *p.MaxConcurrency
+	}
 	if p.SystemPromptId.Set {
 		if p.SystemPromptId.Value == nil {
 			updates["system_prompt_id"] = nil
@@ -254,6 +260,7 @@ type ModelRouteOverviewItem struct {
 	Enabled                 bool     `json:"enabled"`
 	Priority                int      `json:"priority"`
 	Weight                  int      `json:"weight"`
+	MaxConcurrency          int      `json:"max_concurrency"`
 	BillingType             string   `json:"billing_type"`
 	GroupRatio              float64  `json:"group_ratio"`
 	PromptPricePer1M        *float64 `json:"prompt_price_per_1m"`
@@ -276,6 +283,14 @@ type ModelRouteOverviewItem struct {
 	CooldownRemainingSecs    int    `json:"cooldown_remaining_secs"`
 	CooldownHalfOpen         bool   `json:"cooldown_half_open"`
 	CooldownHalfOpenInflight int    `json:"cooldown_half_open_inflight"`
+	// Active probe fields; empty until the route has been probed
+	ProbeStatus              string `json:"probe_status"`
+	ProbeLatencyMs           int    `json:"probe_latency_ms"`
+	ProbeHttpStatus          int    `json:"probe_http_status"`
+	ProbeMessage             string `json:"probe_message"`
+	ProbeConsecutiveFailures int    `json:"probe_consecutive_failures"`
+	ProbeDead                bool   `json:"probe_dead"`
+	ProbedAt                 int64  `json:"probed_at"`
 }
 
 type modelRouteOverviewRow struct {
@@ -301,6 +316,7 @@ type modelRouteOverviewRow struct {
 	Enabled             bool    `gorm:"column:enabled"`
 	Priority            int     `gorm:"column:priority"`
 	Weight              int     `gorm:"column:weight"`
+	MaxConcurrency      int     `gorm:"column:max_concurrency"`
 	PricingGroupRatio   string  `gorm:"column:pricing_group_ratio"`
 	QuotaType           int     `gorm:"column:quota_type"`
 	ModelRatio          float64 `gorm:"column:model_ratio"`
@@ -317,6 +333,10 @@ type RouteAttempt struct {
 	ValueScore         float64
 	ProviderBalance    float64
 	RecentUsageCostUSD float64
+	// Latency is the live EWMA of the route; LatencyKnown is false for
+	// routes without fresh samples.
+	Latency      common.RouteLatencyStats
+	LatencyKnown bool
 }
 
 type routeRuntimeMetrics struct {
@@ -381,10 +401,43 @@ func SelectProviderToken(modelName string, retry int) (*ProviderToken, *Provider
 // existing callers. Stored priority and weight no longer affect routing.
 // It filters routes based on client type restrictions.
 func BuildRouteAttemptsByPriority(modelName string, clientType string) ([][]RouteAttempt, error) {
+	return BuildRouteAttemptsWithStrategy(modelName, clientType, RoutingStrategyValue, false)
+}
+
+// BuildRouteAttemptsWithStrategy orders the candidate routes with the given
+// routing strategy. Unknown strategies fall back to RoutingStrategyValue.
+// stream selects the latency measured by RoutingStrategyLatency.
+func BuildRouteAttemptsWithStrategy(modelName string, clientType string, strategy string, stream bool) ([][]RouteAttempt, error) {
+	selection, err := selectRouteAttempts(modelName, clientType, nil)
+	if err != nil {
+		return nil, err
+	}
+	return [][]RouteAttempt{orderRouteAttempts(selection.attempts, strategy, selection.config, stream)}, nil
+}
+
+// routeSelection is the set of routes eligible for a request together with
+// the metrics their contributions were computed from.
+type routeSelection struct {
+	attempts []RouteAttempt
+	metrics  map[int]routeRuntimeMetrics
+	config   routingTuningConfig
+}
+
+// routeExclusionRecorder is told about every matching route dropped while
+// selecting routes, with one of the RouteExclusion* reasons.
+type routeExclusionRecorder func(route ModelRoute, reason string, detail string)
+
+// selectRouteAttempts returns the enabled routes serving modelName for
+// clientType, skipping routes in cooldown, unreachable routes and routes
+// above the price guard. exclude may be nil.
+func selectRouteAttempts(modelName string, clientType string, exclude routeExclusionRecorder) (*routeSelection, error) {
 	requestedModel := strings.TrimSpace(modelName)
 	if requestedModel == "" {
 		return nil, errors.New("无效的模型名称")
 	}
+	if exclude == nil {
+		exclude = func(ModelRoute, string, string) {}
+	}
 
 	candidateRoutes, err := getCandidateRoutesByModel(requestedModel)
 	if err != nil {
@@ -398,7 +451,10 @@ func BuildRouteAttemptsByPriority(modelName string, clientType string) ([][]Rout
 	for _, route := range candidateRoutes {
 		if common.GlobalRouteCooldown.IsRouteSelectable(route.ProviderTokenId, route.ModelName) {
 			filteredRoutes = append(filteredRoutes, route)
+			continue
 		}
+		status := common.GlobalRouteCooldown.GetRouteCooldownStatus(route.ProviderTokenId, route.ModelName)
+		exclude(route, RouteExclusionCooldown, fmt.Sprintf("%s cooldown, %ds remaining", status.Reason, status.RemainingSecs))
 	}
 	candidateRoutes = filteredRoutes
 	if len(candidateRoutes) == 0 {
@@ -446,24 +502,22 @@ func BuildRouteAttemptsByPriority(modelName string, clientType string) ([][]Rout
 	for _, route := range candidateRoutes {
 		provider := providerLookup[route.ProviderId]
 		token := tokenLookup[route.ProviderTokenId]
-		if provider == nil || token == nil {
-			continue
-		}
-		if provider.Status != common.UserStatusEnabled || token.Status != common.UserStatusEnabled {
-			continue
-		}
-		if common.IsEmbeddedCPAProviderName(provider.Name) && !common.IsLocalEmbeddedCPAProviderName(provider.Name) {
-			continue
-		}
-		if !common.IsProviderRuntimeAvailable(route.ProviderId) {
+		if reason := routeUnreachableReason(route, provider, token); reason != "" {
+			detail := ""
+			if reason == RouteExclusionProviderCircuitOpen {
+				remaining, _ := common.GlobalProviderBreaker.OpenRemaining(route.ProviderId)
+				detail = fmt.Sprintf("provider circuit open, %ds remaining", int(math.Ceil(remaining.Seconds())))
+			}
+			exclude(route, reason, detail)
 			continue
 		}
-		// Filter by client type restrictions
 		if !route.IsClientAllowed(clientType) {
+			exclude(route, RouteExclusionClientNotAllowed, "")
 			continue
 		}
 		metric := metricLookup[route.Id]
 		if routeExceedsPriceGuard(metric, config) {
+			exclude(route, RouteExclusionPriceGuard, fmt.Sprintf("max unit price %.4f > %.4f USD", metric.MaxUnitPriceUSD, config.PriceGuardMaxUnitPrice))
 			continue
 		}
 		if metric.ValueScore > maxScore {
@@ -480,7 +534,7 @@ func BuildRouteAttemptsByPriority(modelName string, clientType string) ([][]Rout
 		})
 	}
 	if len(attempts) == 0 {
-		return nil, errors.New("鏃犲彲鐢ㄧ殑妯″瀷璺敱: " + requestedModel)
+		return nil, errors.New("鏃犲彲鐢ㄧ殑妯″瀷璺敱: " + requestedModel)
 	}
 	for i := range attempts {
 		attempts[i].Contribution = computeRouteContribution(
@@ -491,10 +545,21 @@ func BuildRouteAttemptsByPriority(modelName string, clientType string) ([][]Rout
 			config.ValueScoreFactor,
 		)
 	}
+	return &routeSelection{attempts: attempts, metrics: metricLookup, config: config}, nil
+}
+
+// orderRouteAttempts returns the retry order of the selected routes.
+func orderRouteAttempts(attempts []RouteAttempt, strategy string, config routingTuningConfig, stream bool) []RouteAttempt {
+	if strategy == RoutingStrategyLatency {
+		for i := range attempts {
+			attempts[i].Latency, attempts[i].LatencyKnown = common.GlobalRouteLatency.Get(attempts[i].Route.ProviderTokenId, attempts[i].Route.ModelName)
+		}
+		return orderAttemptsByLatency(attempts, config.HealthEnabled, stream)
+	}
 	if config.HealthEnabled {
-		return [][]RouteAttempt{orderAttemptsByHealthValue(attempts)}, nil
+		return orderAttemptsByHealthValue(attempts)
 	}
-	return [][]RouteAttempt{weightedShuffleAttempts(attempts)}, nil
+	return weightedShuffleAttempts(attempts)
 }
 
 func getCandidateRoutesByModel(requestedModel string) ([]ModelRoute, error) {
@@ -554,33 +619,40 @@ func loadProviderAliasLookups(routes []ModelRoute) (map[int]providerModelAliasLo
 
 func routeMatchesRequestedModel(routeModelName string, requestedModel string, requestedNormalized string,
 	requestedVersionKey string, lookup providerModelAliasLookup) bool {
+	return routeModelMatch(routeModelName, requestedModel, requestedNormalized, requestedVersionKey, lookup) != ""
+}
+
+// routeModelMatch returns how a route model matches the requested model, one
+// of the RouteMatch* kinds, or "" when it does not match.
+func routeModelMatch(routeModelName string, requestedModel string, requestedNormalized string,
+	requestedVersionKey string, lookup providerModelAliasLookup) string {
 	routeName := strings.TrimSpace(routeModelName)
 	if routeName == "" {
-		return false
+		return ""
 	}
 
 	if strings.EqualFold(routeName, requestedModel) {
-		return true
+		return RouteMatchExact
 	}
 
 	routeNormalized := common.NormalizeModelName(routeName)
 	if requestedNormalized != "" && routeNormalized != "" && routeNormalized == requestedNormalized {
-		return true
+		return RouteMatchNormalized
 	}
 	if requestedVersionKey != "" && routeNormalized != "" && common.ToVersionAgnosticKey(routeNormalized) == requestedVersionKey {
-		return true
+		return RouteMatchVersionAgnostic
 	}
 
 	if mappedModel, ok := lookup.Resolve(requestedModel); ok {
 		if strings.EqualFold(routeName, mappedModel) {
-			return true
+			return RouteMatchAlias
 		}
 		mappedNormalized := common.NormalizeModelName(mappedModel)
 		if mappedNormalized != "" && routeNormalized != "" && mappedNormalized == routeNormalized {
-			return true
+			return RouteMatchAlias
 		}
 	}
-	return false
+	return ""
 }
 
 func loadProvidersByIDs(providerIds []int) (map[int]*Provider, error) {
@@ -698,6 +770,113 @@ func buildRouteRuntimeMetrics(routes []ModelRoute, providers map[int]*Provider,
 	return metrics, nil
 }
 
+// isRouteServable reports whether a route may serve clientType: it is
+// reachable and the route's client restrictions allow the client.
+func isRouteServable(route ModelRoute, provider *Provider, token *ProviderToken, clientType string) bool {
+	return isRouteReachable(route, provider, token) && route.IsClientAllowed(clientType)
+}
+
+// isRouteReachable reports whether a route's provider and token exist and are
+// enabled and the provider is reachable from this instance.
+func isRouteReachable(route ModelRoute, provider *Provider, token *ProviderToken) bool {
+	return routeUnreachableReason(route, provider, token) == ""
+}
+
+// routeUnreachableReason returns the RouteExclusion* reason a route is not
+// reachable, or "" when it is.
+func routeUnreachableReason(route ModelRoute, provider *Provider, token *ProviderToken) string {
+	if provider == nil {
+		return RouteExclusionProviderMissing
+	}
+	if token == nil {
+		return RouteExclusionTokenMissing
+	}
+	if provider.Status != common.UserStatusEnabled {
+		return RouteExclusionProviderDisabled
+	}
+	if token.Status != common.UserStatusEnabled {
+		return RouteExclusionTokenDisabled
+	}
+	if common.IsEmbeddedCPAProviderName(provider.Name) && !common.IsLocalEmbeddedCPAProviderName(provider.Name) {
+		return RouteExclusionRemoteCPA
+	}
+	if !common.IsProviderRuntimeAvailable(route.ProviderId) {
+		return RouteExclusionProviderUnavailable
+	}
+	if !common.GlobalProviderBreaker.IsProviderRoutable(route.ProviderId) {
+		return RouteExclusionProviderCircuitOpen
+	}
+	return ""
+}
+
+// GetProbeRouteAttempts returns one attempt per enabled, reachable
+// (provider token, model) route for the health prober, ignoring client
+// restrictions. Attempts are ordered by provider.
+func GetProbeRouteAttempts() ([]RouteAttempt, error) {
+	var routes []ModelRoute
+	if err := DB.Where("enabled = ?", true).
+		Order("provider_id ASC, provider_token_id ASC, model_name ASC, id ASC").
+		Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	candidates, err := buildRouteAttemptsForRoutes(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]RouteAttempt, 0, len(candidates))
+	routeSeen := make(map[string]bool, len(candidates))
+	for _, attempt := range candidates {
+		if !isRouteReachable(attempt.Route, attempt.Provider, attempt.Token) {
+			continue
+		}
+		key := routeUsageKey(attempt.Route.ProviderTokenId, attempt.Route.ModelName)
+		if routeSeen[key] {
+			continue
+		}
+		routeSeen[key] = true
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// buildRouteAttemptsForRoutes loads the provider and token of every route.
+// Missing providers or tokens are left nil.
+func buildRouteAttemptsForRoutes(routes []ModelRoute) ([]RouteAttempt, error) {
+	providerIds := make([]int, 0)
+	tokenIds := make([]int, 0)
+	providerSeen := make(map[int]bool)
+	tokenSeen := make(map[int]bool)
+	for _, route := range routes {
+		if !providerSeen[route.ProviderId] {
+			providerSeen[route.ProviderId] = true
+			providerIds = append(providerIds, route.ProviderId)
+		}
+		if !tokenSeen[route.ProviderTokenId] {
+			tokenSeen[route.ProviderTokenId] = true
+			tokenIds = append(tokenIds, route.ProviderTokenId)
+		}
+	}
+	providerLookup, err := loadProvidersByIDs(providerIds)
+	if err != nil {
+		return nil, err
+	}
+	tokenLookup, err := loadProviderTokensByIDs(tokenIds)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]RouteAttempt, 0, len(routes))
+	for _, route := range routes {
+		attempts = append(attempts, RouteAttempt{
+			Route:    route,
+			Token:    tokenLookup[route.ProviderTokenId],
+			Provider: providerLookup[route.ProviderId],
+		})
+	}
+	return attempts, nil
+}
+
 func routeExceedsPriceGuard(metric routeRuntimeMetrics, config routingTuningConfig) bool {
 	if !config.PriceGuardEnabled || config.PriceGuardMaxUnitPrice <= 0 || metric.MaxUnitPriceUSD <= 0 {
 		return false
@@ -775,6 +954,57 @@ func orderAttemptsByHealthValue(attempts []RouteAttempt) []RouteAttempt {
 	return ordered
 }
 
+// orderAttemptsByLatency keeps the health tiers (when health routing is on)
+// and orders each tier by live latency: routes without fresh samples first so
+// they get measured, then by TTFT for streams or total latency otherwise,
+// inflated by the EWMA error rate. Routes failing most of the time go last.
+// Ties break randomly.
+func orderAttemptsByLatency(attempts []RouteAttempt, healthEnabled bool, stream bool) []RouteAttempt {
+	ordered := make([]RouteAttempt, len(attempts))
+	copy(ordered, attempts)
+	rand.Shuffle(len(ordered), func(i, j int) {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	})
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if healthEnabled && a.HealthValue != b.HealthValue {
+			return a.HealthValue > b.HealthValue
+		}
+		aFailing, bFailing := routeLatencyFailing(a), routeLatencyFailing(b)
+		if aFailing != bFailing {
+			return !aFailing
+		}
+		aMeasured, bMeasured := routeLatencyMeasured(a, stream), routeLatencyMeasured(b, stream)
+		if aMeasured != bMeasured {
+			return !aMeasured
+		}
+		if !aMeasured {
+			return false
+		}
+		return routeLatencyScore(a.Latency, stream) < routeLatencyScore(b.Latency, stream)
+	})
+	return ordered
+}
+
+const routeLatencyFailingErrorRate = 0.5
+
+func routeLatencyFailing(attempt RouteAttempt) bool {
+	return attempt.LatencyKnown && attempt.Latency.ErrorRate >= routeLatencyFailingErrorRate
+}
+
+func routeLatencyMeasured(attempt RouteAttempt, stream bool) bool {
+	if !attempt.LatencyKnown {
+		return false
+	}
+	_, measured := attempt.Latency.Latency(stream)
+	return measured
+}
+
+func routeLatencyScore(stats common.RouteLatencyStats, stream bool) float64 {
+	score, _ := stats.Latency(stream)
+	return score / (1 - math.Min(stats.ErrorRate, 0.9))
+}
+
 func routePricingKey(providerId int, modelName string) string {
 	return strconv.Itoa(providerId) + "#" + strings.TrimSpace(modelName)
 }
@@ -1072,6 +1302,7 @@ func loadRouteHealthStatsByTokenModel(tokenIds []int, modelNames []string) (map[
 					"COUNT(*) AS sample_count",
 				).
 				Where("created_at >= ? AND provider_token_id IN ? AND model_name IN ?", since, tokenBatch, modelBatch).
+				Where("(error_type IS NULL OR error_type <> ?)", UsageLogErrorTypeHedgeCancelled).
 				Group("provider_token_id, model_name").
 				Scan(&rows).Error; err != nil {
 				return nil, err
@@ -1196,6 +1427,9 @@ func BatchUpdateModelRoutes(patches []ModelRoutePatch) error {
 			if patch.Id <= 0 {
 				return errors.New("存在无效的路由 ID")
 			}
+			if patch.MaxConcurrency != nil && *patch.MaxConcurrency < 0 {
+				return errors.New("最大并发不能为负数")
+			}
 			normalizeModelRoutePatch(patch)
 			if err := validateModelRoutePromptBinding(tx, patch.Id, patch.ToUpdates()); err != nil {
 				return err
@@ -1241,6 +1475,7 @@ func GetModelRouteOverview(modelName string, providerId int, enabledOnly bool) (
 			"mr.enabled",
 			"mr.priority",
 			"mr.weight",
+			"mr.max_concurrency",
 			"COALESCE(p.pricing_group_ratio, '') AS pricing_group_ratio",
 			"COALESCE(mp.quota_type, 0) AS quota_type",
 			"COALESCE(mp.model_ratio, 0) AS model_ratio",
@@ -1324,6 +1559,7 @@ func GetModelRouteOverview(modelName string, providerId int, enabledOnly bool) (
 			Enabled:                 row.Enabled,
 			Priority:                row.Priority,
 			Weight:                  row.Weight,
+			MaxConcurrency:          row.MaxConcurrency,
 			GroupRatio:              groupRatio,
 			UsageWindowHours:        config.UsageWindowHours,
 			BaseWeightFactor:        config.BaseWeightFactor,
@@ -1450,7 +1686,7 @@ func GetModelRouteOverview(modelName string, providerId int, enabledOnly bool) (
 		item.EffectiveSharePercent = &percent
 	}
 
-	// Fill cooldown status for each route
+	// Fill cooldown and probe status for each route
 	for _, item := range items {
 		cooldownStatus := common.GlobalRouteCooldown.GetRouteCooldownStatus(item.ProviderTokenId, item.ModelName)
 		item.CooldownInCooldown = cooldownStatus.InCooldown
@@ -1458,6 +1694,15 @@ func GetModelRouteOverview(modelName string, providerId int, enabledOnly bool) (
 		item.CooldownRemainingSecs = cooldownStatus.RemainingSecs
 		item.CooldownHalfOpen = cooldownStatus.HalfOpen
 		item.CooldownHalfOpenInflight = cooldownStatus.HalfOpenInflight
+		if probe, ok := common.GlobalRouteProbe.Get(item.ProviderTokenId, item.ModelName); ok {
+			item.ProbeStatus = probe.Status
+			item.ProbeLatencyMs = probe.LatencyMs
+			item.ProbeHttpStatus = probe.HttpStatus
+			item.ProbeMessage = probe.Message
+			item.ProbeConsecutiveFailures = probe.ConsecutiveFailures
+			item.ProbeDead = probe.Dead
+			item.ProbedAt = probe.ProbedAt.Unix()
+		}
 	}
 
 	return items, nil
@@ -738,3 +738,55 @@ func TestBatchUpdateModelRoutesRollsBackWhenRouteMissing(t *testing.T) {
 		t.Fatal("expected valid route update to be rolled back")
 	}
 }
+
+func TestBuildRouteAttemptsLatencyStrategyPrefersFastestMeasuredRoute(t *testing.T) {
+	setupModelRouteTestDB(t)
+	previous := common.GlobalRouteLatency
+	common.GlobalRouteLatency = common.NewRouteLatencyTracker()
+	t.Cleanup(func() { common.GlobalRouteLatency = previous })
+
+	insertRouteCandidate(t, 1, 101, 0, 10)
+	insertRouteCandidate(t, 2, 102, 0, 10)
+	insertRouteCandidate(t, 3, 103, 0, 10)
+	insertRouteCandidate(t, 4, 104, 0, 10)
+	common.GlobalRouteLatency.Observe(101, "gpt-test", true, true, 3000, 900)
+	common.GlobalRouteLatency.Observe(101, "gpt-test", false, true, 1000, 0)
+	common.GlobalRouteLatency.Observe(102, "gpt-test", true, true, 3000, 150)
+	common.GlobalRouteLatency.Observe(102, "gpt-test", false, true, 4000, 0)
+	common.GlobalRouteLatency.Observe(104, "gpt-test", true, false, 50, 0)
+
+	plan, err := BuildRouteAttemptsWithStrategy("gpt-test", "", RoutingStrategyLatency, true)
+	if err != nil {
+		t.Fatalf("build route attempts: %v", err)
+	}
+	if len(plan) != 1 || len(plan[0]) != 4 {
+		t.Fatalf("expected all routes in one retry group, got %#v", plan)
+	}
+	got := make([]int, 0, 4)
+	for _, attempt := range plan[0] {
+		got = append(got, attempt.Route.ProviderTokenId)
+	}
+	// Unmeasured first, then by first-token latency, failing routes last.
+	want := []int{103, 102, 101, 104}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected order %v, got %v", want, got)
+		}
+	}
+
+	// Non-streaming requests compare total latency instead.
+	plan, err = BuildRouteAttemptsWithStrategy("gpt-test", "", RoutingStrategyLatency, false)
+	if err != nil {
+		t.Fatalf("build route attempts: %v", err)
+	}
+	got = got[:0]
+	for _, attempt := range plan[0] {
+		got = append(got, attempt.Route.ProviderTokenId)
+	}
+	want = []int{103, 101, 102, 104}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected non-stream order %v, got %v", want, got)
+		}
+	}
+}
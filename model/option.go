@@ -60,6 +60,51 @@ func InitOptionMap() {
 	common.OptionMap["RoutingHealthAdjustmentEnabled"] = "true"
 	common.OptionMap["RoutingPriceGuardEnabled"] = "true"
 	common.OptionMap["RoutingPriceGuardMaxUnitPrice"] = "75"
+	common.OptionMap["RoutingLatencyModels"] = ""
+	common.OptionMap["RouteAffinityEnabled"] = "false"
+	common.OptionMap["RouteAffinityTTLSeconds"] = "3600"
+	common.OptionMap["RouteAffinityHeader"] = common.DefaultRouteAffinityHeader
+	common.OptionMap["HedgeModels"] = ""
+	common.OptionMap["HedgeDelayMs"] = "1000"
+	common.OptionMap["HedgeAdaptiveDelayEnabled"] = "true"
+	common.OptionMap["RouteProbeEnabled"] = "false"
+	common.OptionMap["RouteProbeIntervalMinutes"] = "10"
+	common.OptionMap["RouteProbeProviderDailyCostUSD"] = "0.1"
+	common.OptionMap["RouteProbeDeadAfterFailures"] = "3"
+	common.OptionMap["ProviderBreakerEnabled"] = "false"
+	common.OptionMap["ProviderBreakerFailureThreshold"] = "10"
+	common.OptionMap["ProviderBreakerWindowSeconds"] = "60"
+	common.OptionMap["ProviderBreakerOpenSeconds"] = "60"
+	common.OptionMap["ProviderBreakerMaxOpenSeconds"] = "600"
+	common.OptionMap["RetryMaxAttempts"] = "0"
+	common.OptionMap["RetryDeadlineSeconds"] = "0"
+	common.OptionMap["RetryBackoffMs"] = "0"
+	common.OptionMap["RetryBackoffMaxMs"] = "5000"
+	common.OptionMap["RetryStatusRules"] = ""
+	common.OptionMap["RetryModelPolicies"] = ""
+	common.OptionMap["ConcurrencyQueueSize"] = "100"
+	common.OptionMap["ConcurrencyQueueTimeoutMs"] = "10000"
+	common.OptionMap["StreamFailoverEnabled"] = "false"
+	common.OptionMap["StreamFailoverMaxBufferBytes"] = "65536"
+	common.OptionMap["StreamFailoverFirstContentTimeoutSeconds"] = "15"
+	common.OptionMap["ResponseCacheModels"] = ""
+	common.OptionMap["ResponseCacheTTLSeconds"] = "3600"
+	common.OptionMap["ResponseCacheMaxEntryBytes"] = "1048576"
+	common.OptionMap["ResponseCacheMaxEntries"] = "1000"
+	common.OptionMap["AlertEnabled"] = "false"
+	common.OptionMap["AlertWebhookURL"] = ""
+	common.OptionMap["AlertWebhookFormat"] = common.AlertWebhookFormatGeneric
+	common.OptionMap["AlertEmailReceivers"] = ""
+	common.OptionMap["AlertBalanceThresholdUSD"] = "0"
+	common.OptionMap["AlertSyncFailureThreshold"] = "3"
+	common.OptionMap["AlertKeyCooldownMinutes"] = "30"
+	common.OptionMap["AlertCPAStoppedEnabled"] = "true"
+	common.OptionMap["AlertQuietPeriodMinutes"] = "60"
+	common.OptionMap["VirtualModels"] = ""
+	common.OptionMap["PriceBook"] = ""
+	common.OptionMap["PriceBookGroupMarkup"] = ""
+	common.OptionMap["UsageLogRetentionDays"] = "0"
+	common.OptionMap["LLMTraceRetentionDays"] = "0"
 	// Embedded CPA (CLIProxyAPI) settings. Only base fields are managed here;
 	// upstream credentials come from the CPA auth directory (OAuth login).
 	common.OptionMap["CPAEnabled"] = "false"
@@ -27,6 +27,7 @@ type Provider struct {
 	PricingSupportedEndpoint string `json:"pricing_supported_endpoint" gorm:"type:text"`
 	ModelAliasMapping        string `json:"model_alias_mapping" gorm:"type:text"`
 	Remark                   string `json:"remark" gorm:"type:text"`
+	MaxConcurrency           int    `json:"max_concurrency" gorm:"default:0"`
 	CreatedAt                int64  `json:"created_at"`
 }
 
@@ -108,6 +109,7 @@ func (p *Provider) Update() error {
 		"checkin_enabled": p.CheckinEnabled,
 		"remark":          p.Remark,
 		"provider_type":   NormalizeProviderType(p.ProviderType),
+		"max_concurrency": p.MaxConcurrency,
 	}
 	if strings.TrimSpace(p.AccessToken) != "" {
 		updates["access_token"] = p.AccessToken
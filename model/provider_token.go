@@ -26,6 +26,7 @@ type ProviderToken struct {
 	AllowCC         bool   `json:"allow_cc" gorm:"default:false"`
 	BlockClients    bool   `json:"block_clients" gorm:"default:false"`
 	LastSynced      int64  `json:"last_synced"`
+	MaxConcurrency  int    `json:"max_concurrency" gorm:"default:0"`
 	CreatedAt       int64  `json:"created_at"`
 }
 
@@ -77,6 +78,7 @@ func (pt *ProviderToken) Update() error {
 		"allow_cc":          pt.AllowCC,
 		"block_clients":     pt.BlockClients,
 		"last_synced":       pt.LastSynced,
+		"max_concurrency":   pt.MaxConcurrency,
 	}).Error
 }
 
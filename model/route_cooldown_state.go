@@ -0,0 +1,37 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// RouteCooldownState is one persisted route cooldown record, written by the
+// periodic snapshot and read back on startup.
+type RouteCooldownState struct {
+	Id                  int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind                string `json:"kind" gorm:"type:varchar(16)"`
+	ProviderTokenId     int    `json:"provider_token_id"`
+	ModelName           string `json:"model_name" gorm:"type:varchar(255)"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	CooldownUntil       int64  `json:"cooldown_until"`
+	LastFailureTime     int64  `json:"last_failure_time"`
+	SnapshotAt          int64  `json:"snapshot_at"`
+}
+
+// ReplaceRouteCooldownStates swaps the stored snapshot for states.
+func ReplaceRouteCooldownStates(states []RouteCooldownState) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&RouteCooldownState{}).Error; err != nil {
+			return err
+		}
+		if len(states) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(states, 200).Error
+	})
+}
+
+func GetRouteCooldownStates() ([]RouteCooldownState, error) {
+	var states []RouteCooldownState
+	err := DB.Order("id ASC").Find(&states).Error
+	return states, err
+}
@@ -0,0 +1,289 @@
+package model
+
+import (
+	"NewAPI-Gateway/common"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// How a route model matched the requested model.
+const (
+	RouteMatchExact           = "exact"
+	RouteMatchNormalized      = "normalized"
+	RouteMatchVersionAgnostic = "version_agnostic"
+	RouteMatchAlias           = "alias"
+)
+
+// Why a route matching the requested model was left out of the plan.
+const (
+	RouteExclusionDisabled            = "disabled"
+	RouteExclusionCooldown            = "cooldown"
+	RouteExclusionProviderMissing     = "provider_missing"
+	RouteExclusionTokenMissing        = "token_missing"
+	RouteExclusionProviderDisabled    = "provider_disabled"
+	RouteExclusionTokenDisabled       = "token_disabled"
+	RouteExclusionRemoteCPA           = "remote_cpa"
+	RouteExclusionProviderUnavailable = "provider_unavailable"
+	RouteExclusionProviderCircuitOpen = "provider_circuit_open"
+	RouteExclusionClientNotAllowed    = "client_not_allowed"
+	RouteExclusionPriceGuard          = "price_guard"
+)
+
+// RouteExplanation is the routing plan of one model without sending any
+// upstream request.
+type RouteExplanation struct {
+	Model                  string                  `json:"model"`
+	ClientType             string                  `json:"client_type"`
+	Strategy               string                  `json:"strategy"`
+	Stream                 bool                    `json:"stream"`
+	HealthEnabled          bool                    `json:"health_enabled"`
+	BaseWeightFactor       float64                 `json:"base_weight_factor"`
+	ValueScoreFactor       float64                 `json:"value_score_factor"`
+	PriceGuardMaxUnitPrice float64                 `json:"price_guard_max_unit_price"`
+	Plan                   []RouteExplainCandidate `json:"plan"`
+	Excluded               []RouteExplainExclusion `json:"excluded"`
+	// Error is set when no route can serve the model.
+	Error string `json:"error,omitempty"`
+}
+
+// RouteExplainCandidate is one route of the plan with its score components.
+type RouteExplainCandidate struct {
+	Rank               int     `json:"rank"`
+	RouteId            int     `json:"route_id"`
+	ModelName          string  `json:"model_name"`
+	Match              string  `json:"match"`
+	ProviderId         int     `json:"provider_id"`
+	ProviderName       string  `json:"provider_name"`
+	ProviderTokenId    int     `json:"provider_token_id"`
+	TokenName          string  `json:"token_name"`
+	TokenGroupName     string  `json:"token_group_name"`
+	HealthValue        int64   `json:"health_value"`
+	HealthSuccessCount int64   `json:"health_success_count"`
+	HealthErrorCount   int64   `json:"health_error_count"`
+	UnitCostUSD        float64 `json:"unit_cost_usd"`
+	MaxUnitPriceUSD    float64 `json:"max_unit_price_usd"`
+	ProviderBalanceUSD float64 `json:"provider_balance_usd"`
+	RecentUsageCostUSD float64 `json:"recent_usage_cost_usd"`
+	ValueScore         float64 `json:"value_score"`
+	Contribution       float64 `json:"contribution"`
+	// FirstPickProbability is the chance the route is tried first among the
+	// routes of its health tier under the value strategy.
+	FirstPickProbability float64                   `json:"first_pick_probability"`
+	LatencyKnown         bool                      `json:"latency_known"`
+	Latency              *common.RouteLatencyStats `json:"latency,omitempty"`
+	CooldownHalfOpen     bool                      `json:"cooldown_half_open"`
+}
+
+// RouteExplainExclusion is a route matching the model that is not in the plan.
+type RouteExplainExclusion struct {
+	RouteId         int    `json:"route_id"`
+	ModelName       string `json:"model_name"`
+	Match           string `json:"match"`
+	ProviderId      int    `json:"provider_id"`
+	ProviderName    string `json:"provider_name"`
+	ProviderTokenId int    `json:"provider_token_id"`
+	Reason          string `json:"reason"`
+	Detail          string `json:"detail"`
+}
+
+// ExplainRoutePlan builds the routing plan of modelName for clientType the
+// way a relay request would and reports every matching route left out with
+// its reason. The value strategy draws its order at random; its plan lists
+// each health tier by descending contribution with the first-pick chance of
+// every route instead. stream selects the latency the latency strategy
+// compares.
+func ExplainRoutePlan(modelName string, clientType string, strategy string, stream bool) (*RouteExplanation, error) {
+	requestedModel := strings.TrimSpace(modelName)
+	if requestedModel == "" {
+		return nil, errors.New("无效的模型名称")
+	}
+	if strategy != RoutingStrategyLatency {
+		strategy = RoutingStrategyValue
+	}
+	config := loadRoutingTuningConfig()
+	explanation := &RouteExplanation{
+		Model:            requestedModel,
+		ClientType:       clientType,
+		Strategy:         strategy,
+		Stream:           stream,
+		HealthEnabled:    config.HealthEnabled,
+		BaseWeightFactor: config.BaseWeightFactor,
+		ValueScoreFactor: config.ValueScoreFactor,
+		Plan:             []RouteExplainCandidate{},
+		Excluded:         []RouteExplainExclusion{},
+	}
+	if config.PriceGuardEnabled {
+		explanation.PriceGuardMaxUnitPrice = config.PriceGuardMaxUnitPrice
+	}
+
+	matches, disabled, err := matchRoutesForExplain(requestedModel)
+	if err != nil {
+		return nil, err
+	}
+	excludedRoutes := make([]ModelRoute, 0)
+	exclude := func(route ModelRoute, reason string, detail string) {
+		excludedRoutes = append(excludedRoutes, route)
+		explanation.Excluded = append(explanation.Excluded, RouteExplainExclusion{
+			RouteId:         route.Id,
+			ModelName:       route.ModelName,
+			Match:           matches[route.Id],
+			ProviderId:      route.ProviderId,
+			ProviderTokenId: route.ProviderTokenId,
+			Reason:          reason,
+			Detail:          detail,
+		})
+	}
+	for _, route := range disabled {
+		exclude(route, RouteExclusionDisabled, "")
+	}
+
+	selection, err := selectRouteAttempts(requestedModel, clientType, exclude)
+	if err != nil {
+		explanation.Error = err.Error()
+	}
+	if err := fillExclusionProviderNames(explanation.Excluded, excludedRoutes); err != nil {
+		return nil, err
+	}
+	if selection == nil {
+		return explanation, nil
+	}
+
+	attempts := selection.attempts
+	for i := range attempts {
+		attempts[i].Latency, attempts[i].LatencyKnown = common.GlobalRouteLatency.Get(attempts[i].Route.ProviderTokenId, attempts[i].Route.ModelName)
+	}
+	if strategy == RoutingStrategyLatency {
+		attempts = orderAttemptsByLatency(attempts, config.HealthEnabled, stream)
+	} else {
+		attempts = orderAttemptsByExpectedContribution(attempts, config.HealthEnabled)
+	}
+	tierTotals := make(map[int64]float64)
+	tierSizes := make(map[int64]int)
+	for _, attempt := range attempts {
+		tier := routeExplainTier(attempt, config.HealthEnabled)
+		tierTotals[tier] += nonNegativeContribution(attempt.Contribution)
+		tierSizes[tier]++
+	}
+	for i, attempt := range attempts {
+		metric := selection.metrics[attempt.Route.Id]
+		candidate := RouteExplainCandidate{
+			Rank:               i + 1,
+			RouteId:            attempt.Route.Id,
+			ModelName:          attempt.Route.ModelName,
+			Match:              matches[attempt.Route.Id],
+			ProviderId:         attempt.Provider.Id,
+			ProviderName:       attempt.Provider.Name,
+			ProviderTokenId:    attempt.Token.Id,
+			TokenName:          attempt.Token.Name,
+			TokenGroupName:     attempt.Token.GroupName,
+			HealthValue:        metric.HealthValue,
+			HealthSuccessCount: metric.HealthSuccessCount,
+			HealthErrorCount:   metric.HealthErrorCount,
+			UnitCostUSD:        metric.UnitCostUSD,
+			MaxUnitPriceUSD:    metric.MaxUnitPriceUSD,
+			ProviderBalanceUSD: metric.ProviderBalanceUSD,
+			RecentUsageCostUSD: metric.RecentUsageCostUSD,
+			ValueScore:         metric.ValueScore,
+			Contribution:       attempt.Contribution,
+			LatencyKnown:       attempt.LatencyKnown,
+			CooldownHalfOpen:   common.GlobalRouteCooldown.GetRouteCooldownStatus(attempt.Route.ProviderTokenId, attempt.Route.ModelName).HalfOpen,
+		}
+		if attempt.LatencyKnown {
+			latency := attempt.Latency
+			candidate.Latency = &latency
+		}
+		if strategy == RoutingStrategyValue {
+			tier := routeExplainTier(attempt, config.HealthEnabled)
+			if total := tierTotals[tier]; total > 0 {
+				candidate.FirstPickProbability = nonNegativeContribution(attempt.Contribution) / total
+			} else {
+				candidate.FirstPickProbability = 1 / float64(tierSizes[tier])
+			}
+		}
+		explanation.Plan = append(explanation.Plan, candidate)
+	}
+	return explanation, nil
+}
+
+// matchRoutesForExplain returns the match kind of every route serving
+// requestedModel, keyed by route id, and the matching disabled routes.
+func matchRoutesForExplain(requestedModel string) (map[int]string, []ModelRoute, error) {
+	var routes []ModelRoute
+	if err := DB.Order("id ASC").Find(&routes).Error; err != nil {
+		return nil, nil, err
+	}
+	lookups, err := loadProviderAliasLookups(routes)
+	if err != nil {
+		return nil, nil, err
+	}
+	requestedNormalized := common.NormalizeModelName(requestedModel)
+	requestedVersionKey := common.ToVersionAgnosticKey(requestedNormalized)
+	matches := make(map[int]string)
+	disabled := make([]ModelRoute, 0)
+	for _, route := range routes {
+		match := routeModelMatch(route.ModelName, requestedModel, requestedNormalized, requestedVersionKey, lookups[route.ProviderId])
+		if match == "" {
+			continue
+		}
+		matches[route.Id] = match
+		if !route.Enabled {
+			disabled = append(disabled, route)
+		}
+	}
+	return matches, disabled, nil
+}
+
+func fillExclusionProviderNames(exclusions []RouteExplainExclusion, routes []ModelRoute) error {
+	providerIds := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, route := range routes {
+		if !seen[route.ProviderId] {
+			seen[route.ProviderId] = true
+			providerIds = append(providerIds, route.ProviderId)
+		}
+	}
+	providers, err := loadProvidersByIDs(providerIds)
+	if err != nil {
+		return err
+	}
+	for i := range exclusions {
+		if provider := providers[exclusions[i].ProviderId]; provider != nil {
+			exclusions[i].ProviderName = provider.Name
+		}
+	}
+	return nil
+}
+
+// orderAttemptsByExpectedContribution is the deterministic counterpart of
+// the value strategy: health tiers first when enabled, then contribution.
+func orderAttemptsByExpectedContribution(attempts []RouteAttempt, healthEnabled bool) []RouteAttempt {
+	ordered := make([]RouteAttempt, len(attempts))
+	copy(ordered, attempts)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if healthEnabled && a.HealthValue != b.HealthValue {
+			return a.HealthValue > b.HealthValue
+		}
+		if a.Contribution != b.Contribution {
+			return a.Contribution > b.Contribution
+		}
+		return a.Route.Id < b.Route.Id
+	})
+	return ordered
+}
+
+func routeExplainTier(attempt RouteAttempt, healthEnabled bool) int64 {
+	if !healthEnabled {
+		return 0
+	}
+	return attempt.HealthValue
+}
+
+// nonNegativeContribution clamps negative contributions to zero like weightedShuffleAttempts.
+func nonNegativeContribution(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	return value
+}
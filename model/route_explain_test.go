@@ -0,0 +1,58 @@
+package model
+
+import "testing"
+
+func TestExplainRoutePlanReportsExclusionReasonsAndScores(t *testing.T) {
+	setupModelRouteTestDB(t)
+
+	for i := 1; i <= 4; i++ {
+		insertRouteCandidate(t, i, 100+i, 0, 10)
+	}
+	if err := DB.Create(&ModelPricing{ProviderId: 2, ModelName: "gpt-test", ModelRatio: 40, CompletionRatio: 1}).Error; err != nil {
+		t.Fatalf("create expensive pricing: %v", err)
+	}
+	if err := DB.Model(&ModelRoute{}).Where("provider_id = ?", 3).Update("allow_codex", true).Error; err != nil {
+		t.Fatalf("restrict route: %v", err)
+	}
+	if err := DB.Model(&ModelRoute{}).Where("provider_id = ?", 4).Update("enabled", false).Error; err != nil {
+		t.Fatalf("disable route: %v", err)
+	}
+
+	explanation, err := ExplainRoutePlan("GPT-Test", "", "", false)
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	if explanation.Strategy != RoutingStrategyValue || explanation.Error != "" {
+		t.Fatalf("unexpected explanation: %+v", explanation)
+	}
+	if len(explanation.Plan) != 1 {
+		t.Fatalf("expected one planned route, got %+v", explanation.Plan)
+	}
+	planned := explanation.Plan[0]
+	if planned.ProviderId != 1 || planned.Match != RouteMatchExact || planned.Rank != 1 || planned.FirstPickProbability != 1 || planned.Contribution <= 0 {
+		t.Fatalf("unexpected planned route: %+v", planned)
+	}
+
+	reasons := make(map[int]string)
+	for _, excluded := range explanation.Excluded {
+		reasons[excluded.ProviderId] = excluded.Reason
+	}
+	want := map[int]string{
+		2: RouteExclusionPriceGuard,
+		3: RouteExclusionClientNotAllowed,
+		4: RouteExclusionDisabled,
+	}
+	for providerId, reason := range want {
+		if reasons[providerId] != reason {
+			t.Fatalf("provider %d: expected exclusion %q, got %q (%+v)", providerId, reason, reasons[providerId], explanation.Excluded)
+		}
+	}
+
+	codex, err := ExplainRoutePlan("gpt-test", "codex", RoutingStrategyLatency, false)
+	if err != nil {
+		t.Fatalf("explain codex: %v", err)
+	}
+	if codex.Strategy != RoutingStrategyLatency || len(codex.Plan) != 2 {
+		t.Fatalf("expected the codex-only route to be planned for codex clients, got %+v", codex.Plan)
+	}
+}
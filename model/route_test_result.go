@@ -0,0 +1,114 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// RouteTestResult is the outcome of one admin-triggered route test.
+type RouteTestResult struct {
+	Id              int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	BatchId         string `json:"batch_id" gorm:"type:varchar(64);index"`
+	RouteId         int    `json:"route_id" gorm:"index"`
+	ProviderId      int    `json:"provider_id" gorm:"index"`
+	ProviderName    string `json:"provider_name" gorm:"type:varchar(128)"`
+	ProviderTokenId int    `json:"provider_token_id"`
+	ModelName       string `json:"model_name" gorm:"type:varchar(255);index"`
+	Stream          bool   `json:"stream"`
+	Success         bool   `json:"success"`
+	HttpStatus      int    `json:"http_status"`
+	LatencyMs       int    `json:"latency_ms"`
+	FirstTokenMs    int    `json:"first_token_ms"`
+	ResponseModel   string `json:"response_model" gorm:"type:varchar(255)"`
+	ErrorMessage    string `json:"error_message" gorm:"type:text"`
+	UpstreamBody    string `json:"upstream_body" gorm:"type:text"`
+	AutoDisabled    bool   `json:"auto_disabled"`
+	CreatedAt       int64  `json:"created_at" gorm:"index"`
+}
+
+// RouteTestResultQuery filters stored route test results.
+type RouteTestResultQuery struct {
+	Offset     int
+	Limit      int
+	BatchId    string
+	RouteId    int
+	ProviderId int
+	ModelName  string
+}
+
+func (r *RouteTestResult) Insert() error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = time.Now().Unix()
+	}
+	return DB.Create(r).Error
+}
+
+// QueryRouteTestResults returns matching results, newest first, and their
+// total count. A zero Limit returns every match.
+func QueryRouteTestResults(query RouteTestResultQuery) ([]*RouteTestResult, int64, error) {
+	db := DB.Model(&RouteTestResult{})
+	if batchId := strings.TrimSpace(query.BatchId); batchId != "" {
+		db = db.Where("batch_id = ?", batchId)
+	}
+	if query.RouteId > 0 {
+		db = db.Where("route_id = ?", query.RouteId)
+	}
+	if query.ProviderId > 0 {
+		db = db.Where("provider_id = ?", query.ProviderId)
+	}
+	if modelName := strings.TrimSpace(query.ModelName); modelName != "" {
+		db = db.Where("model_name = ?", modelName)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	db = db.Order("id DESC")
+	if query.Limit > 0 {
+		db = db.Offset(query.Offset).Limit(query.Limit)
+	}
+	var results []*RouteTestResult
+	if err := db.Find(&results).Error; err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// DeleteRouteTestResultsBefore prunes results created before cutoff.
+func DeleteRouteTestResultsBefore(cutoff int64) (int64, error) {
+	result := DB.Where("created_at < ?", cutoff).Delete(&RouteTestResult{})
+	return result.RowsAffected, result.Error
+}
+
+// RouteTestQuery selects the routes of an admin route test. Empty filters
+// select every route.
+type RouteTestQuery struct {
+	RouteIds    []int
+	ModelName   string
+	ProviderId  int
+	EnabledOnly bool
+}
+
+// GetRouteTestAttempts returns an attempt for every route matching query,
+// including disabled routes unless EnabledOnly is set. Provider or Token is
+// nil when the route references a deleted provider or token.
+func GetRouteTestAttempts(query RouteTestQuery) ([]RouteAttempt, error) {
+	db := DB.Model(&ModelRoute{})
+	if len(query.RouteIds) > 0 {
+		db = db.Where("id IN ?", query.RouteIds)
+	}
+	if modelName := strings.TrimSpace(query.ModelName); modelName != "" {
+		db = db.Where("model_name = ?", modelName)
+	}
+	if query.ProviderId > 0 {
+		db = db.Where("provider_id = ?", query.ProviderId)
+	}
+	if query.EnabledOnly {
+		db = db.Where("enabled = ?", true)
+	}
+	var routes []ModelRoute
+	if err := db.Order("provider_id ASC, model_name ASC, id ASC").Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	return buildRouteAttemptsForRoutes(routes)
+}
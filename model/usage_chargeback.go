@@ -0,0 +1,88 @@
+package model
+
+import "sort"
+
+// ChargebackRow totals the usage of one user over a period.
+type ChargebackRow struct {
+	UserId           int     `json:"user_id"`
+	Username         string  `json:"username"`
+	UserGroup        string  `json:"user_group"`
+	RequestCount     int64   `json:"request_count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	ChargebackUSD    float64 `json:"chargeback_usd"`
+}
+
+// ChargebackGroupTotal totals the rows of one user group.
+type ChargebackGroupTotal struct {
+	UserGroup     string  `json:"user_group"`
+	RequestCount  int64   `json:"request_count"`
+	CostUSD       float64 `json:"cost_usd"`
+	ChargebackUSD float64 `json:"chargeback_usd"`
+}
+
+// QueryChargebackReport totals upstream cost and internal chargeback per user
+// in [start, end). It reads the hourly rollups plus the raw rows after the
+// watermark, so pruned logs are still billed; both bounds are rounded down to
+// the hour. Users are reported under their current group.
+func QueryChargebackReport(start int64, end int64) ([]ChargebackRow, []ChargebackGroupTotal, error) {
+	start -= start % 3600
+	end -= end % 3600
+	watermark, err := GetUsageRollupWatermark()
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows []ChargebackRow
+	if err := usageStatsSource(UsageRollupHour, start, watermark).
+		Select(
+			"user_id",
+			"COALESCE(SUM(request_count), 0) AS request_count",
+			"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens",
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens",
+			"COALESCE(SUM(cost_usd), 0) AS cost_usd",
+			"COALESCE(SUM(chargeback_usd), 0) AS chargeback_usd",
+		).
+		Where("created_at < ?", end).
+		Group("user_id").
+		Order("user_id ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	userIds := make([]int, 0, len(rows))
+	for _, row := range rows {
+		userIds = append(userIds, row.UserId)
+	}
+	users := make(map[int]User, len(userIds))
+	for _, batch := range chunkInts(userIds, sqliteSingleInChunkSize) {
+		var found []User
+		if err := DB.Select("id", "username", "user_group").Where("id IN ?", batch).Find(&found).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, user := range found {
+			users[user.Id] = user
+		}
+	}
+
+	totals := make(map[string]*ChargebackGroupTotal)
+	for i := range rows {
+		user := users[rows[i].UserId]
+		rows[i].Username = user.Username
+		rows[i].UserGroup = user.UserGroup
+		total, ok := totals[user.UserGroup]
+		if !ok {
+			total = &ChargebackGroupTotal{UserGroup: user.UserGroup}
+			totals[user.UserGroup] = total
+		}
+		total.RequestCount += rows[i].RequestCount
+		total.CostUSD += rows[i].CostUSD
+		total.ChargebackUSD += rows[i].ChargebackUSD
+	}
+	groups := make([]ChargebackGroupTotal, 0, len(totals))
+	for _, total := range totals {
+		groups = append(groups, *total)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].UserGroup < groups[j].UserGroup })
+	return rows, groups, nil
+}
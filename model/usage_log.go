@@ -11,7 +11,7 @@ import (
 type UsageLog struct {
 	Id                    int64   `json:"id" gorm:"primaryKey;autoIncrement"`
 	UserId                int     `json:"user_id" gorm:"index"`
-	AggregatedTokenId     int     `json:"aggregated_token_id"`
+	AggregatedTokenId     int     `json:"aggregated_token_id" gorm:"index"`
 	ProviderId            int     `json:"provider_id" gorm:"index"`
 	ProviderName          string  `json:"provider_name" gorm:"type:varchar(128)"`
 	ProviderTokenId       int     `json:"provider_token_id"`
@@ -29,6 +29,9 @@ type UsageLog struct {
 	RequestedStream       bool    `json:"requested_stream"`
 	ResponseIsStream      bool    `json:"response_is_stream"`
 	CostUSD               float64 `json:"cost_usd"`
+	ChargebackUSD         float64 `json:"chargeback_usd" gorm:"default:0"`
+	CacheHit              bool    `json:"cache_hit" gorm:"default:false"`
+	CacheSavedUSD         float64 `json:"cache_saved_usd" gorm:"default:0"`
 	Status                int     `json:"status"`
 	ErrorMessage          string  `json:"error_message" gorm:"type:text"`
 	ErrorHttpStatus       int     `json:"error_http_status" gorm:"type:int"`
@@ -37,9 +40,14 @@ type UsageLog struct {
 	ClientIp              string  `json:"client_ip" gorm:"type:varchar(64)"`
 	UserAgent             string  `json:"user_agent" gorm:"type:varchar(512)"`
 	RequestId             string  `json:"request_id" gorm:"type:varchar(64);index"`
+	Hedge                 string  `json:"hedge" gorm:"type:varchar(16)"`
 	CreatedAt             int64   `json:"created_at" gorm:"index"`
 }
 
+// UsageLogErrorTypeHedgeCancelled marks the attempt of a hedged request that
+// was cancelled after the other attempt won; it says nothing about the route.
+const UsageLogErrorTypeHedgeCancelled = "hedge_cancelled"
+
 func (l *UsageLog) Insert() error {
 	l.CreatedAt = time.Now().Unix()
 	return DB.Model(&UsageLog{}).Create(map[string]interface{}{
@@ -62,6 +70,9 @@ func (l *UsageLog) Insert() error {
 		"requested_stream":        l.RequestedStream,
 		"response_is_stream":      l.ResponseIsStream,
 		"cost_usd":                l.CostUSD,
+		"chargeback_usd":          l.ChargebackUSD,
+		"cache_hit":               l.CacheHit,
+		"cache_saved_usd":         l.CacheSavedUSD,
 		"status":                  l.Status,
 		"error_message":           l.ErrorMessage,
 		"error_http_status":       l.ErrorHttpStatus,
@@ -70,6 +81,7 @@ func (l *UsageLog) Insert() error {
 		"client_ip":               l.ClientIp,
 		"user_agent":              l.UserAgent,
 		"request_id":              l.RequestId,
+		"hedge":                   l.Hedge,
 		"created_at":              l.CreatedAt,
 	}).Error
 }
@@ -159,7 +171,81 @@ func QueryUsageLogProviders(query UsageLogQuery) ([]string, error) {
 	return providers, err
 }
 
+// QueryUsageLogSummary totals the filtered logs. Without a keyword it reads
+// the daily rollups plus recent raw rows, so pruned logs are still counted;
+// keyword searches need raw rows and only cover the retained window.
 func QueryUsageLogSummary(query UsageLogQuery) (UsageLogSummary, error) {
+	if strings.TrimSpace(query.Keyword) != "" {
+		return queryRawUsageLogSummary(query)
+	}
+	watermark, err := GetUsageRollupWatermark()
+	if err != nil {
+		return UsageLogSummary{}, err
+	}
+
+	type usageLogSummaryRaw struct {
+		Total          int64
+		SuccessCount   int64
+		InputTokens    int64
+		OutputTokens   int64
+		CacheTokens    int64
+		TotalCost      float64
+		ResponseTimeMs float64
+	}
+
+	var raw usageLogSummaryRaw
+	err = applyUsageStatsFilters(usageStatsSource(UsageRollupDay, 0, watermark), query).
+		Select(
+			"COALESCE(SUM(request_count), 0) AS total",
+			"COALESCE(SUM(CASE WHEN success THEN request_count ELSE 0 END), 0) AS success_count",
+			"COALESCE(SUM(prompt_tokens), 0) AS input_tokens",
+			"COALESCE(SUM(completion_tokens), 0) AS output_tokens",
+			"COALESCE(SUM(cache_tokens), 0) AS cache_tokens",
+			"COALESCE(SUM(cost_usd), 0) AS total_cost",
+			"COALESCE(SUM(response_time_ms), 0) AS response_time_ms",
+		).
+		Scan(&raw).Error
+	if err != nil {
+		return UsageLogSummary{}, err
+	}
+
+	summary := UsageLogSummary{
+		Total:        raw.Total,
+		SuccessCount: raw.SuccessCount,
+		ErrorCount:   raw.Total - raw.SuccessCount,
+		InputTokens:  raw.InputTokens,
+		OutputTokens: raw.OutputTokens,
+		CacheTokens:  raw.CacheTokens,
+		TotalCost:    raw.TotalCost,
+	}
+	if raw.Total > 0 {
+		summary.AvgLatency = int64(math.Round(raw.ResponseTimeMs / float64(raw.Total)))
+	}
+	return summary, nil
+}
+
+// applyUsageStatsFilters is applyUsageLogFilters for usageStatsSource, which
+// has no keyword columns.
+func applyUsageStatsFilters(db *gorm.DB, query UsageLogQuery) *gorm.DB {
+	if query.UserID != nil {
+		db = db.Where("user_id = ?", *query.UserID)
+	}
+	if providerName := strings.TrimSpace(query.ProviderName); providerName != "" {
+		db = db.Where("provider_name = ?", providerName)
+	}
+	if query.ViewTab == "error" {
+		db = db.Where("success = ?", false)
+	}
+	switch query.Status {
+	case "success":
+		db = db.Where("success = ?", true)
+	case "error":
+		db = db.Where("success = ?", false)
+	}
+	return db
+}
+
+func queryRawUsageLogSummary(query UsageLogQuery) (UsageLogSummary, error) {
 	isErrorCondition := "(status <> 1 OR (error_message IS NOT NULL AND TRIM(error_message) <> ''))"
 	isSuccessCondition := "(status = 1 AND (error_message IS NULL OR TRIM(error_message) = ''))"
 
@@ -246,6 +332,8 @@ type DashboardStats struct {
 	TotalProviders   int64               `json:"total_providers"`
 	TotalModels      int64               `json:"total_models"`
 	TotalRoutes      int64               `json:"total_routes"`
+	CacheHitRequests int64               `json:"cache_hit_requests"`
+	CacheSavedUSD    float64             `json:"cache_saved_usd"`
 	ByProvider       []ProviderStat      `json:"by_provider"`
 	ByModel          []ModelStat         `json:"by_model"`
 	RecentRequests   []DailyRequestCount `json:"recent_requests"`
@@ -282,14 +370,38 @@ type DailyModelStat struct {
 	TokenCount int64  `json:"token_count"`
 }
 
-// GetDashboardStats returns aggregated stats for the admin dashboard
+// GetDashboardStats returns aggregated stats for the admin dashboard. Totals
+// read the daily rollups and the recent trends the hourly rollups, each plus
+// the raw rows after the rollup watermark.
 func GetDashboardStats() (*DashboardStats, error) {
 	stats := &DashboardStats{}
+	watermark, err := GetUsageRollupWatermark()
+	if err != nil {
+		return nil, err
+	}
 
-	// Total counts
-	DB.Model(&UsageLog{}).Count(&stats.TotalRequests)
-	DB.Model(&UsageLog{}).Where("status = 1 AND (error_message = '' OR error_message IS NULL)").Count(&stats.SuccessRequests)
+	// Total counts and response cache savings
+	var totals struct {
+		Total     int64
+		Success   int64
+		CacheHits int64
+		SavedUSD  float64
+	}
+	if err := usageStatsSource(UsageRollupDay, 0, watermark).
+		Select(
+			"COALESCE(SUM(request_count), 0) AS total",
+			"COALESCE(SUM(CASE WHEN success THEN request_count ELSE 0 END), 0) AS success",
+			"COALESCE(SUM(cache_hit_count), 0) AS cache_hits",
+			"COALESCE(SUM(cache_saved_usd), 0) AS saved_usd",
+		).
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	stats.TotalRequests = totals.Total
+	stats.SuccessRequests = totals.Success
 	stats.FailedRequests = stats.TotalRequests - stats.SuccessRequests
+	stats.CacheHitRequests = totals.CacheHits
+	stats.CacheSavedUSD = totals.SavedUSD
 	stats.TotalProviders = CountProviders()
 	stats.TotalRoutes = CountModelRoutes()
 
@@ -297,12 +409,14 @@ func GetDashboardStats() (*DashboardStats, error) {
 	stats.TotalModels = int64(len(models))
 
 	// By provider
-	DB.Model(&UsageLog{}).Select("provider_id, provider_name, count(*) as request_count").
+	usageStatsSource(UsageRollupDay, 0, watermark).
+		Select("provider_id, provider_name, SUM(request_count) as request_count").
 		Group("provider_id, provider_name").Order("request_count desc").
 		Limit(10).Scan(&stats.ByProvider)
 
 	// By model
-	DB.Model(&UsageLog{}).Select("model_name, count(*) as request_count").
+	usageStatsSource(UsageRollupDay, 0, watermark).
+		Select("model_name, SUM(request_count) as request_count").
 		Group("model_name").Order("request_count desc").
 		Limit(10).Scan(&stats.ByModel)
 
@@ -328,9 +442,8 @@ func GetDashboardStats() (*DashboardStats, error) {
 	}
 
 	var recentRows []dailyTrendRow
-	if err := DB.Model(&UsageLog{}).
-		Select(dateExpr+" AS date, COUNT(*) AS request_count, COALESCE(SUM(cost_usd), 0) AS cost_usd, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS token_count").
-		Where("created_at >= ?", startUnix).
+	if err := usageStatsSource(UsageRollupHour, startUnix, watermark).
+		Select(dateExpr + " AS date, COALESCE(SUM(request_count), 0) AS request_count, COALESCE(SUM(cost_usd), 0) AS cost_usd, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS token_count").
 		Group(dateExpr).
 		Order(dateExpr + " ASC").
 		Scan(&recentRows).Error; err != nil {
@@ -373,9 +486,9 @@ func GetDashboardStats() (*DashboardStats, error) {
 	}
 
 	var topModelRows []modelTokenTotalRow
-	if err := DB.Model(&UsageLog{}).
+	if err := usageStatsSource(UsageRollupHour, startUnix, watermark).
 		Select("model_name, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS token_count").
-		Where("created_at >= ? AND model_name IS NOT NULL AND TRIM(model_name) <> ''", startUnix).
+		Where("model_name IS NOT NULL AND TRIM(model_name) <> ''").
 		Group("model_name").
 		Order("token_count DESC").
 		Limit(8).
@@ -390,9 +503,9 @@ func GetDashboardStats() (*DashboardStats, error) {
 		}
 
 		var modelRows []modelDailyRow
-		if err := DB.Model(&UsageLog{}).
+		if err := usageStatsSource(UsageRollupHour, startUnix, watermark).
 			Select(dateExpr+" AS date, model_name, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS token_count").
-			Where("created_at >= ? AND model_name IN ?", startUnix, modelNames).
+			Where("model_name IN ?", modelNames).
 			Group(dateExpr + ", model_name").
 			Order(dateExpr + " ASC").
 			Scan(&modelRows).Error; err != nil {
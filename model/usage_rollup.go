@@ -0,0 +1,256 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	UsageRollupHour = "hour"
+	UsageRollupDay  = "day"
+
+	// usageRollupLag leaves room for usage logs that are inserted
+	// asynchronously after their hour ended.
+	usageRollupLag = 5 * time.Minute
+	// usageRollupChunkSeconds bounds the raw range aggregated per transaction.
+	usageRollupChunkSeconds = 24 * 3600
+	usageDeleteBatchSize    = 1000
+)
+
+const usageLogSuccessCondition = "(status = 1 AND (error_message IS NULL OR TRIM(error_message) = ''))"
+
+// UsageRollup aggregates usage_logs per hour or per local day. Dashboard and
+// log summary totals read rollups plus the raw rows after the watermark, so
+// raw rows can be pruned without losing history.
+type UsageRollup struct {
+	Id                int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Granularity       string  `json:"granularity" gorm:"type:varchar(8);uniqueIndex:idx_usage_rollup_key,priority:1"`
+	BucketStart       int64   `json:"bucket_start" gorm:"uniqueIndex:idx_usage_rollup_key,priority:2"`
+	UserId            int     `json:"user_id" gorm:"uniqueIndex:idx_usage_rollup_key,priority:3"`
+	AggregatedTokenId int     `json:"aggregated_token_id" gorm:"uniqueIndex:idx_usage_rollup_key,priority:4"`
+	ProviderId        int     `json:"provider_id" gorm:"uniqueIndex:idx_usage_rollup_key,priority:5"`
+	ModelName         string  `json:"model_name" gorm:"type:varchar(255);uniqueIndex:idx_usage_rollup_key,priority:6"`
+	TokenGroupName    string  `json:"token_group_name" gorm:"type:varchar(64);uniqueIndex:idx_usage_rollup_key,priority:7"`
+	Success           bool    `json:"success" gorm:"uniqueIndex:idx_usage_rollup_key,priority:8"`
+	ProviderName      string  `json:"provider_name" gorm:"type:varchar(128)"`
+	RequestCount      int64   `json:"request_count"`
+	PromptTokens      int64   `json:"prompt_tokens"`
+	CompletionTokens  int64   `json:"completion_tokens"`
+	CacheTokens       int64   `json:"cache_tokens"`
+	CostUSD           float64 `json:"cost_usd"`
+	ChargebackUSD     float64 `json:"chargeback_usd"`
+	CacheHitCount     int64   `json:"cache_hit_count"`
+	CacheSavedUSD     float64 `json:"cache_saved_usd"`
+	// ResponseTimeMs is the sum over the bucket; divide by RequestCount.
+	ResponseTimeMs int64 `json:"response_time_ms"`
+}
+
+// GetUsageRollupWatermark returns the first unix second not covered by the
+// hourly rollups, or 0 when nothing has been rolled up yet.
+func GetUsageRollupWatermark() (int64, error) {
+	var last sql.NullInt64
+	err := DB.Model(&UsageRollup{}).
+		Select("MAX(bucket_start)").
+		Where("granularity = ?", UsageRollupHour).
+		Row().Scan(&last)
+	if err != nil || !last.Valid {
+		return 0, err
+	}
+	return last.Int64 + 3600, nil
+}
+
+// RollupUsageLogs aggregates complete hours of usage_logs into hourly rollups
+// and refreshes the daily rollups of the affected local days. Rolled-up hours
+// are never recomputed, so raw rows before the watermark can be pruned. It
+// returns the number of hours rolled up.
+func RollupUsageLogs(now time.Time) (int, error) {
+	end := now.Add(-usageRollupLag).Unix()
+	end -= end % 3600
+	start, err := GetUsageRollupWatermark()
+	if err != nil {
+		return 0, err
+	}
+
+	hours := 0
+	for start < end {
+		var next sql.NullInt64
+		if err := DB.Model(&UsageLog{}).
+			Select("MIN(created_at)").
+			Where("created_at >= ? AND created_at < ?", start, end).
+			Row().Scan(&next); err != nil {
+			return hours, err
+		}
+		if !next.Valid {
+			break
+		}
+		chunkStart := next.Int64 - next.Int64%3600
+		chunkEnd := chunkStart + usageRollupChunkSeconds
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+		rolled, err := rollupUsageHours(chunkStart, chunkEnd)
+		if err != nil {
+			return hours, err
+		}
+		hours += rolled
+		start = chunkEnd
+	}
+	return hours, nil
+}
+
+func rollupUsageHours(start int64, end int64) (int, error) {
+	hours := make(map[int64]bool)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var rows []UsageRollup
+		if err := tx.Model(&UsageLog{}).
+			Select(
+				"created_at - (created_at % 3600) AS bucket_start",
+				"user_id",
+				"aggregated_token_id",
+				"provider_id",
+				"MAX(provider_name) AS provider_name",
+				"model_name",
+				"token_group_name",
+				usageLogSuccessCondition+" AS success",
+				"COUNT(*) AS request_count",
+				"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens",
+				"COALESCE(SUM(completion_tokens), 0) AS completion_tokens",
+				"COALESCE(SUM(cache_tokens), 0) AS cache_tokens",
+				"COALESCE(SUM(cost_usd), 0) AS cost_usd",
+				"COALESCE(SUM(chargeback_usd), 0) AS chargeback_usd",
+				"SUM(CASE WHEN cache_hit THEN 1 ELSE 0 END) AS cache_hit_count",
+				"COALESCE(SUM(cache_saved_usd), 0) AS cache_saved_usd",
+				"COALESCE(SUM(response_time_ms), 0) AS response_time_ms",
+			).
+			Where("created_at >= ? AND created_at < ?", start, end).
+			Group("created_at - (created_at % 3600), user_id, aggregated_token_id, provider_id, model_name, token_group_name, " + usageLogSuccessCondition).
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		days := make(map[int64]bool)
+		for i := range rows {
+			rows[i].Granularity = UsageRollupHour
+			hours[rows[i].BucketStart] = true
+			days[usageRollupDayStart(rows[i].BucketStart)] = true
+		}
+		if err := tx.CreateInBatches(rows, 200).Error; err != nil {
+			return err
+		}
+		for day := range days {
+			if err := refreshDailyUsageRollup(tx, day); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(hours), nil
+}
+
+// refreshDailyUsageRollup rebuilds the daily rows of a local day from its
+// hourly rows.
+func refreshDailyUsageRollup(tx *gorm.DB, dayStart int64) error {
+	dayEnd := time.Unix(dayStart, 0).AddDate(0, 0, 1).Unix()
+	var rows []UsageRollup
+	if err := tx.Model(&UsageRollup{}).
+		Select(
+			"user_id",
+			"aggregated_token_id",
+			"provider_id",
+			"MAX(provider_name) AS provider_name",
+			"model_name",
+			"token_group_name",
+			"success",
+			"SUM(request_count) AS request_count",
+			"SUM(prompt_tokens) AS prompt_tokens",
+			"SUM(completion_tokens) AS completion_tokens",
+			"SUM(cache_tokens) AS cache_tokens",
+			"SUM(cost_usd) AS cost_usd",
+			"SUM(chargeback_usd) AS chargeback_usd",
+			"SUM(cache_hit_count) AS cache_hit_count",
+			"SUM(cache_saved_usd) AS cache_saved_usd",
+			"SUM(response_time_ms) AS response_time_ms",
+		).
+		Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", UsageRollupHour, dayStart, dayEnd).
+		Group("user_id, aggregated_token_id, provider_id, model_name, token_group_name, success").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("granularity = ? AND bucket_start = ?", UsageRollupDay, dayStart).Delete(&UsageRollup{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	for i := range rows {
+		rows[i].Granularity = UsageRollupDay
+		rows[i].BucketStart = dayStart
+	}
+	return tx.CreateInBatches(rows, 200).Error
+}
+
+func usageRollupDayStart(ts int64) int64 {
+	t := time.Unix(ts, 0)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Unix()
+}
+
+// usageStatsSource unions rollups of the given granularity with the raw
+// usage_logs after the watermark. Both sides expose the rollup columns, with
+// the bucket start named created_at.
+func usageStatsSource(granularity string, since int64, watermark int64) *gorm.DB {
+	rollups := DB.Model(&UsageRollup{}).
+		Select("bucket_start AS created_at, user_id, aggregated_token_id, provider_id, provider_name, model_name, token_group_name, success, request_count, prompt_tokens, completion_tokens, cache_tokens, cost_usd, chargeback_usd, cache_hit_count, cache_saved_usd, response_time_ms").
+		Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", granularity, since, watermark)
+	rawSince := since
+	if watermark > rawSince {
+		rawSince = watermark
+	}
+	raw := DB.Model(&UsageLog{}).
+		Select("created_at, user_id, aggregated_token_id, provider_id, provider_name, model_name, token_group_name, "+usageLogSuccessCondition+" AS success, 1 AS request_count, prompt_tokens, completion_tokens, cache_tokens, cost_usd, chargeback_usd, CASE WHEN cache_hit THEN 1 ELSE 0 END AS cache_hit_count, cache_saved_usd, response_time_ms").
+		Where("created_at >= ?", rawSince)
+	return DB.Table("(? UNION ALL ?) AS usage_stats", rollups, raw)
+}
+
+// DeleteUsageLogsBefore deletes raw usage logs created before cutoff in
+// batches. Rows not covered by the hourly rollups yet are kept.
+func DeleteUsageLogsBefore(cutoff int64) (int64, error) {
+	watermark, err := GetUsageRollupWatermark()
+	if err != nil {
+		return 0, err
+	}
+	if cutoff > watermark {
+		cutoff = watermark
+	}
+	return deleteRowsCreatedBefore(&UsageLog{}, cutoff)
+}
+
+func deleteRowsCreatedBefore(table interface{}, cutoff int64) (int64, error) {
+	var deleted int64
+	for {
+		var ids []int64
+		if err := DB.Model(table).Where("created_at < ?", cutoff).
+			Order("id asc").Limit(usageDeleteBatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+		result := DB.Where("id IN ?", ids).Delete(table)
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if len(ids) < usageDeleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
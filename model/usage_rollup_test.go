@@ -0,0 +1,152 @@
+package model
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupUsageRollupTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "rollup.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	DB = db
+	if err := DB.AutoMigrate(&UsageLog{}, &UsageRollup{}, &LLMTrace{}, &Provider{}, &ModelRoute{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+}
+
+func insertUsageLogAt(t *testing.T, createdAt time.Time, log UsageLog) {
+	t.Helper()
+	log.CreatedAt = createdAt.Unix()
+	if err := DB.Create(&log).Error; err != nil {
+		t.Fatalf("insert usage log: %v", err)
+	}
+}
+
+func TestUsageRollupKeepsTotalsAfterPruning(t *testing.T) {
+	setupUsageRollupTestDB(t)
+	now := time.Now()
+	// Keep each pair of rows inside one hour.
+	old := now.AddDate(0, 0, -40).Truncate(time.Hour).Add(10 * time.Minute)
+	recent := now.Add(-3 * time.Hour).Truncate(time.Hour).Add(10 * time.Minute)
+
+	insertUsageLogAt(t, old, UsageLog{UserId: 1, AggregatedTokenId: 1, ProviderId: 1, ProviderName: "p1", ModelName: "gpt-4", PromptTokens: 10, CompletionTokens: 5, CostUSD: 0.5, ResponseTimeMs: 100, Status: 1})
+	insertUsageLogAt(t, old.Add(time.Minute), UsageLog{UserId: 1, AggregatedTokenId: 1, ProviderId: 1, ProviderName: "p1", ModelName: "gpt-4", Status: 0, ErrorMessage: "boom", ResponseTimeMs: 300})
+	insertUsageLogAt(t, recent, UsageLog{UserId: 2, AggregatedTokenId: 2, ProviderId: 2, ProviderName: "p2", ModelName: "claude", PromptTokens: 20, CompletionTokens: 10, CostUSD: 0.25, ResponseTimeMs: 200, Status: 1})
+	insertUsageLogAt(t, recent.Add(time.Minute), UsageLog{UserId: 2, AggregatedTokenId: 2, ProviderId: 2, ProviderName: "p2", ModelName: "claude", PromptTokens: 20, CompletionTokens: 10, CacheHit: true, CacheSavedUSD: 0.25, Status: 1})
+	insertUsageLogAt(t, now, UsageLog{UserId: 1, AggregatedTokenId: 1, ProviderId: 1, ProviderName: "p1", ModelName: "gpt-4", PromptTokens: 1, CompletionTokens: 1, CostUSD: 0.125, ResponseTimeMs: 400, Status: 1})
+
+	errorsOnly := UsageLogQuery{Status: "error"}
+	userOne := 1
+	userQuery := UsageLogQuery{UserID: &userOne}
+	before, err := GetDashboardStats()
+	if err != nil {
+		t.Fatalf("dashboard before rollup: %v", err)
+	}
+	summaryBefore, _ := QueryUsageLogSummary(UsageLogQuery{})
+	errorsBefore, _ := QueryUsageLogSummary(errorsOnly)
+	userBefore, _ := QueryUsageLogSummary(userQuery)
+
+	hours, err := RollupUsageLogs(now)
+	if err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if hours != 2 {
+		t.Fatalf("expected two rolled-up hours, got %d", hours)
+	}
+	if hours, err = RollupUsageLogs(now); err != nil || hours != 0 {
+		t.Fatalf("expected a second run to be a no-op, got %d, %v", hours, err)
+	}
+
+	deleted, err := DeleteUsageLogsBefore(now.AddDate(0, 0, -32).Unix())
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected the two old logs to be pruned, got %d", deleted)
+	}
+
+	after, err := GetDashboardStats()
+	if err != nil {
+		t.Fatalf("dashboard after pruning: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("dashboard changed after rollup and pruning:\nbefore %+v\nafter  %+v", before, after)
+	}
+	if after.TotalRequests != 5 || after.SuccessRequests != 4 || after.CacheHitRequests != 1 || after.CacheSavedUSD != 0.25 {
+		t.Fatalf("unexpected dashboard totals: %+v", after)
+	}
+
+	if summary, _ := QueryUsageLogSummary(UsageLogQuery{}); summary != summaryBefore || summary.Total != 5 || summary.AvgLatency != 200 {
+		t.Fatalf("summary changed: before %+v after %+v", summaryBefore, summary)
+	}
+	if summary, _ := QueryUsageLogSummary(errorsOnly); summary != errorsBefore || summary.Total != 1 || summary.ErrorCount != 1 {
+		t.Fatalf("error summary changed: before %+v after %+v", errorsBefore, summary)
+	}
+	if summary, _ := QueryUsageLogSummary(userQuery); summary != userBefore || summary.Total != 3 || summary.TotalCost != 0.625 {
+		t.Fatalf("user summary changed: before %+v after %+v", userBefore, summary)
+	}
+}
+
+func TestAggTokenCostKeepsTotalAfterPruning(t *testing.T) {
+	setupUsageRollupTestDB(t)
+	now := time.Now()
+	old := now.AddDate(0, 0, -40).Truncate(time.Hour).Add(10 * time.Minute)
+	insertUsageLogAt(t, old, UsageLog{UserId: 1, AggregatedTokenId: 1, ModelName: "gpt-4", CostUSD: 0.5, Status: 1})
+	insertUsageLogAt(t, now.Add(-2*time.Hour), UsageLog{UserId: 1, AggregatedTokenId: 1, ModelName: "gpt-4", CostUSD: 0.25, Status: 1})
+	insertUsageLogAt(t, now, UsageLog{UserId: 1, AggregatedTokenId: 1, ModelName: "gpt-4", CostUSD: 0.125, Status: 1})
+	insertUsageLogAt(t, now, UsageLog{UserId: 2, AggregatedTokenId: 2, ModelName: "gpt-4", CostUSD: 1, Status: 1})
+
+	start := now.AddDate(0, 0, -60).Unix()
+	end := now.Add(time.Hour).Unix()
+	before, err := GetAggTokenCostBetween(1, start, end)
+	if err != nil || before != 0.875 {
+		t.Fatalf("expected 0.875 before pruning, got %v, %v", before, err)
+	}
+
+	if _, err := RollupUsageLogs(now); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if deleted, err := DeleteUsageLogsBefore(now.AddDate(0, 0, -32).Unix()); err != nil || deleted != 1 {
+		t.Fatalf("expected the old log to be pruned, got %d, %v", deleted, err)
+	}
+
+	after, err := GetAggTokenCostBetween(1, start, end)
+	if err != nil || after != before {
+		t.Fatalf("billing total changed after pruning: before %v after %v, %v", before, after, err)
+	}
+	if cost, err := GetAggTokenCostBetween(1, now.AddDate(0, 0, -1).Unix(), end); err != nil || cost != 0.375 {
+		t.Fatalf("expected 0.375 for the last day, got %v, %v", cost, err)
+	}
+}
+
+func TestDeleteUsageLogsBeforeKeepsRowsNotRolledUp(t *testing.T) {
+	setupUsageRollupTestDB(t)
+	now := time.Now()
+	insertUsageLogAt(t, now.AddDate(0, 0, -40), UsageLog{UserId: 1, ModelName: "gpt-4", Status: 1})
+
+	deleted, err := DeleteUsageLogsBefore(now.AddDate(0, 0, -32).Unix())
+	if err != nil || deleted != 0 {
+		t.Fatalf("expected rows before the first rollup to be kept, got %d, %v", deleted, err)
+	}
+
+	if _, err := RollupUsageLogs(now); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	var daily int64
+	DB.Model(&UsageRollup{}).Where("granularity = ?", UsageRollupDay).Count(&daily)
+	if daily != 1 {
+		t.Fatalf("expected one daily rollup, got %d", daily)
+	}
+	deleted, err = DeleteUsageLogsBefore(now.AddDate(0, 0, -32).Unix())
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected the rolled-up row to be pruned, got %d, %v", deleted, err)
+	}
+}
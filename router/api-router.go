@@ -57,6 +57,7 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.GET("/system", controller.GetSystemInfo)
 			optionRoute.PUT("/", controller.UpdateOption)
 			optionRoute.POST("/test-proxy", controller.TestProxy)
+			optionRoute.POST("/test-alert", controller.TestAlert)
 		}
 
 		// === Embedded CPA Management (Root only) ===
@@ -89,6 +90,7 @@ func SetApiRouter(router *gin.Engine) {
 			providerRoute.GET("/:id/tokens", controller.GetProviderTokens)
 			providerRoute.GET("/status", controller.GetProviderStatus)
 			providerRoute.GET("/:id/pricing", controller.GetProviderPricing)
+			providerRoute.PUT("/pricing/:pricing_id", controller.UpdateModelPricingBilling)
 			providerRoute.GET("/:id/model-alias-mapping", controller.GetProviderModelAliasMapping)
 			providerRoute.PUT("/:id/model-alias-mapping", controller.UpdateProviderModelAliasMapping)
 			providerRoute.POST("/:id/tokens", controller.CreateProviderToken)
@@ -113,9 +115,17 @@ func SetApiRouter(router *gin.Engine) {
 			routeGroup.GET("/", controller.GetModelRoutes)
 			routeGroup.GET("/overview", controller.GetModelRouteOverview)
 			routeGroup.GET("/models", controller.GetAllModels)
+			routeGroup.GET("/explain", controller.ExplainRoute)
+			routeGroup.GET("/cooldown", controller.GetRouteCooldowns)
+			routeGroup.POST("/cooldown", controller.SetRouteCooldown)
+			routeGroup.POST("/cooldown/clear", controller.ClearRouteCooldown)
 			routeGroup.PUT("/:id", controller.UpdateRoute)
 			routeGroup.POST("/batch-update", controller.BatchUpdateRoutes)
 			routeGroup.POST("/rebuild", controller.RebuildRoutes)
+			routeGroup.POST("/test", controller.StartRouteTests)
+			routeGroup.GET("/test/:batch_id", controller.GetRouteTestBatch)
+			routeGroup.GET("/test-results", controller.GetRouteTestResults)
+			routeGroup.POST("/:id/test", controller.TestRoute)
 		}
 
 		// === System Prompts (Admin) ===
@@ -138,6 +148,7 @@ func SetApiRouter(router *gin.Engine) {
 		adminLogRoute.Use(middleware.AdminAuth(), middleware.NoTokenAuth())
 		{
 			adminLogRoute.GET("/", controller.GetAllLogs)
+			adminLogRoute.GET("/chargeback", controller.GetChargebackReport)
 		}
 
 		llmTraceRoute := apiRouter.Group("/llm-trace")
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"NewAPI-Gateway/controller"
+	"NewAPI-Gateway/middleware"
 	"embed"
 
 	"github.com/gin-gonic/gin"
@@ -9,5 +11,6 @@ import (
 func SetRouter(router *gin.Engine, buildFS embed.FS, indexPage []byte) {
 	SetApiRouter(router)
 	SetRelayRouter(router)
+	router.GET("/metrics", middleware.MetricsAuth(), controller.GetMetrics)
 	setWebRouter(router, buildFS, indexPage)
 }
@@ -9,7 +9,7 @@ import (
 
 func SetRelayRouter(router *gin.Engine) {
 	relay := router.Group("/")
-	relay.Use(middleware.AggTokenAuth())
+	relay.Use(middleware.AggTokenAuth(), middleware.AggTokenRateLimit())
 	{
 		// OpenAI compatible endpoints
 		relay.POST("/v1/chat/completions", controller.Relay)
@@ -34,6 +34,8 @@ func SetRelayRouter(router *gin.Engine) {
 		// Model listing
 		relay.GET("/v1/models", controller.ListModels)
 		relay.GET("/v1/models/:model", controller.GetModel)
+		relay.GET("/v1beta/models", controller.ListModels)
+		relay.GET("/v1beta/models/*path", controller.GetModel)
 
 		// Billing compatibility (fake, for client compat)
 		relay.GET("/dashboard/billing/subscription", controller.BillingSubscription)
@@ -0,0 +1,414 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlertRuleProviderBalance     = "provider_balance"
+	AlertRuleProviderSyncFailure = "provider_sync_failure"
+	AlertRuleTokenCooldown       = "token_cooldown"
+	AlertRuleCPAStopped          = "cpa_stopped"
+	AlertRuleRouteDead           = "route_dead"
+	AlertRuleTest                = "test"
+
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// Alert is one notification sent to the configured channels.
+type Alert struct {
+	Rule    string    `json:"rule"`
+	Status  string    `json:"status"`
+	Subject string    `json:"subject"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func (a Alert) key() string {
+	return a.Rule + "|" + a.Subject
+}
+
+// CPAAlertStatus is the embedded CPA runtime state needed by the CPA rule.
+type CPAAlertStatus struct {
+	Enabled   bool
+	State     string
+	LastError string
+}
+
+type activeAlert struct {
+	alert    Alert
+	lastSent time.Time
+}
+
+// alertManager evaluates alert rules and deduplicates notifications. State
+// is per process; every replica alerts on its own.
+type alertManager struct {
+	mu sync.Mutex
+
+	active             map[string]*activeAlert
+	syncFailures       map[int]int
+	tokenCooldownSince map[int]time.Time
+	cpaStatus          func() CPAAlertStatus
+
+	now     func() time.Time
+	deliver func(cfg common.AlertConfig, alert Alert) error
+}
+
+func newAlertManager() *alertManager {
+	return &alertManager{
+		active:             make(map[string]*activeAlert),
+		syncFailures:       make(map[int]int),
+		tokenCooldownSince: make(map[int]time.Time),
+		now:                time.Now,
+		deliver:            deliverAlert,
+	}
+}
+
+var alerts = newAlertManager()
+
+// alertEvaluationLock keeps evaluation rounds from overlapping when delivery
+// is slow.
+var alertEvaluationLock sync.Mutex
+
+// SetCPAAlertStatusSource wires the embedded CPA runtime into the CPA rule.
+func SetCPAAlertStatusSource(source func() CPAAlertStatus) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	alerts.cpaStatus = source
+}
+
+// recordProviderSyncResult tracks consecutive incomplete syncs per provider.
+func (m *alertManager) recordProviderSyncResult(providerId int, complete bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if complete {
+		delete(m.syncFailures, providerId)
+		return
+	}
+	m.syncFailures[providerId]++
+}
+
+// EvaluateAlerts checks every rule and sends new, repeated and resolved alerts.
+// A round is skipped while the previous one is still delivering.
+func EvaluateAlerts() {
+	if !alertEvaluationLock.TryLock() {
+		return
+	}
+	defer alertEvaluationLock.Unlock()
+	alerts.evaluate()
+}
+
+func (m *alertManager) evaluate() {
+	cfg := common.LoadAlertConfig()
+	if !cfg.Enabled {
+		return
+	}
+	firing := m.collectFiring(cfg)
+
+	now := m.now()
+	var outgoing []Alert
+	m.mu.Lock()
+	seen := make(map[string]bool, len(firing))
+	for _, alert := range firing {
+		key := alert.key()
+		seen[key] = true
+		state, ok := m.active[key]
+		if ok && now.Sub(state.lastSent) < cfg.QuietPeriod {
+			state.alert = alert
+			continue
+		}
+		alert.Time = now
+		m.active[key] = &activeAlert{alert: alert, lastSent: now}
+		outgoing = append(outgoing, alert)
+	}
+	for key, state := range m.active {
+		if seen[key] {
+			continue
+		}
+		resolved := state.alert
+		resolved.Status = AlertStatusResolved
+		resolved.Message = "已恢复：" + resolved.Message
+		resolved.Time = now
+		outgoing = append(outgoing, resolved)
+		delete(m.active, key)
+	}
+	deliver := m.deliver
+	m.mu.Unlock()
+
+	for _, alert := range outgoing {
+		if err := deliver(cfg, alert); err != nil {
+			common.SysError(fmt.Sprintf("[alert] deliver %s %s failed: %v", alert.Rule, alert.Subject, err))
+		}
+	}
+}
+
+func (m *alertManager) collectFiring(cfg common.AlertConfig) []Alert {
+	var firing []Alert
+	providers, err := model.GetEnabledProviders()
+	if err != nil {
+		common.SysError("[alert] failed to load providers: " + err.Error())
+	}
+
+	m.mu.Lock()
+	syncFailures := make(map[int]int, len(m.syncFailures))
+	for id, count := range m.syncFailures {
+		syncFailures[id] = count
+	}
+	cpaStatus := m.cpaStatus
+	m.mu.Unlock()
+
+	for _, provider := range providers {
+		if cfg.BalanceThresholdUSD > 0 && !provider.IsKeyOnly() {
+			if balance, ok := parseProviderBalanceUSD(provider.Balance); ok && balance < cfg.BalanceThresholdUSD {
+				firing = append(firing, Alert{
+					Rule:    AlertRuleProviderBalance,
+					Status:  AlertStatusFiring,
+					Subject: provider.Name,
+					Message: fmt.Sprintf("供应商 %s 余额 $%.2f 低于阈值 $%.2f", provider.Name, balance, cfg.BalanceThresholdUSD),
+				})
+			}
+		}
+		if cfg.SyncFailureThreshold > 0 && syncFailures[provider.Id] >= cfg.SyncFailureThreshold {
+			firing = append(firing, Alert{
+				Rule:    AlertRuleProviderSyncFailure,
+				Status:  AlertStatusFiring,
+				Subject: provider.Name,
+				Message: fmt.Sprintf("供应商 %s 已连续 %d 次同步失败，请检查访问令牌与上游状态", provider.Name, syncFailures[provider.Id]),
+			})
+		}
+	}
+
+	if cfg.TokenCooldownMinutes > 0 {
+		firing = append(firing, m.collectTokenCooldownAlerts(cfg)...)
+	}
+
+	if common.LoadRouteProbeConfig().Enabled {
+		firing = append(firing, collectRouteDeadAlerts()...)
+	}
+
+	if cfg.CPAStoppedEnabled && cpaStatus != nil {
+		status := cpaStatus()
+		if status.Enabled && status.State == "error" {
+			message := "内置 CPA 运行时意外停止"
+			if status.LastError != "" {
+				message += "：" + status.LastError
+			}
+			firing = append(firing, Alert{
+				Rule:    AlertRuleCPAStopped,
+				Status:  AlertStatusFiring,
+				Subject: "cpa",
+				Message: message,
+			})
+		}
+	}
+
+	sort.Slice(firing, func(i, j int) bool { return firing[i].key() < firing[j].key() })
+	return firing
+}
+
+// collectTokenCooldownAlerts reports tokens that stayed in token-level
+// cooldown for longer than the threshold. The streak starts at the earlier of
+// the first observation and the recorded last failure.
+func (m *alertManager) collectTokenCooldownAlerts(cfg common.AlertConfig) []Alert {
+	items, err := common.GlobalRouteCooldown.CooldownTokens()
+	if err != nil {
+		common.SysError("[alert] failed to list token cooldowns: " + err.Error())
+		return nil
+	}
+	now := m.now()
+	threshold := time.Duration(cfg.TokenCooldownMinutes) * time.Minute
+
+	m.mu.Lock()
+	current := make(map[int]bool, len(items))
+	var overdue []int
+	for _, item := range items {
+		id := item.ProviderTokenId
+		current[id] = true
+		since, ok := m.tokenCooldownSince[id]
+		if !ok {
+			since = now
+			if lastFailure := item.Record.LastFailureTime; !lastFailure.IsZero() && lastFailure.Before(since) {
+				since = lastFailure
+			}
+			m.tokenCooldownSince[id] = since
+		}
+		if now.Sub(since) >= threshold {
+			overdue = append(overdue, id)
+		}
+	}
+	for id := range m.tokenCooldownSince {
+		if !current[id] {
+			delete(m.tokenCooldownSince, id)
+		}
+	}
+	m.mu.Unlock()
+
+	firing := make([]Alert, 0, len(overdue))
+	for _, id := range overdue {
+		label := "#" + strconv.Itoa(id)
+		if token, err := model.GetProviderTokenById(id); err == nil && token != nil {
+			label = fmt.Sprintf("#%d %s", id, token.Name)
+			if provider, err := model.GetProviderById(token.ProviderId); err == nil && provider != nil {
+				label = fmt.Sprintf("%s / %s", provider.Name, label)
+			}
+		}
+		firing = append(firing, Alert{
+			Rule:    AlertRuleTokenCooldown,
+			Status:  AlertStatusFiring,
+			Subject: strconv.Itoa(id),
+			Message: fmt.Sprintf("上游令牌 %s 处于令牌级冷却已超过 %d 分钟", label, cfg.TokenCooldownMinutes),
+		})
+	}
+	return firing
+}
+
+// collectRouteDeadAlerts reports routes flagged dead by the active prober.
+func collectRouteDeadAlerts() []Alert {
+	dead := common.GlobalRouteProbe.DeadRoutes()
+	firing := make([]Alert, 0, len(dead))
+	for _, route := range dead {
+		label := "#" + strconv.Itoa(route.ProviderTokenId)
+		if token, err := model.GetProviderTokenById(route.ProviderTokenId); err == nil && token != nil {
+			label = fmt.Sprintf("#%d %s", route.ProviderTokenId, token.Name)
+			if provider, err := model.GetProviderById(token.ProviderId); err == nil && provider != nil {
+				label = fmt.Sprintf("%s / %s", provider.Name, label)
+			}
+		}
+		message := fmt.Sprintf("路由 %s 的模型 %s 已连续 %d 次主动探测失败", label, route.ModelName, route.Result.ConsecutiveFailures)
+		if route.Result.Message != "" {
+			message += "：" + route.Result.Message
+		}
+		firing = append(firing, Alert{
+			Rule:    AlertRuleRouteDead,
+			Status:  AlertStatusFiring,
+			Subject: strconv.Itoa(route.ProviderTokenId) + "#" + route.ModelName,
+			Message: message,
+		})
+	}
+	return firing
+}
+
+// parseProviderBalanceUSD reads the "$12.34" form written by syncBalance.
+func parseProviderBalanceUSD(raw string) (float64, bool) {
+	raw = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(raw), "$"))
+	if raw == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// SendTestAlert delivers a test notification through every configured channel,
+// regardless of whether alerting is enabled.
+func SendTestAlert() error {
+	cfg := common.LoadAlertConfig()
+	if cfg.WebhookURL == "" && cfg.EmailReceivers == "" {
+		return errors.New("未配置 Webhook 地址或告警邮箱")
+	}
+	return deliverAlert(cfg, Alert{
+		Rule:    AlertRuleTest,
+		Status:  AlertStatusFiring,
+		Subject: "test",
+		Message: "这是一条测试告警",
+		Time:    time.Now(),
+	})
+}
+
+var alertHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func deliverAlert(cfg common.AlertConfig, alert Alert) error {
+	var errs []error
+	if cfg.WebhookURL != "" {
+		if err := sendAlertWebhook(cfg.WebhookURL, cfg.WebhookFormat, alert); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if cfg.EmailReceivers != "" {
+		if common.SMTPServer == "" {
+			errs = append(errs, errors.New("email: SMTP 服务器未配置"))
+		} else if err := common.SendEmail(alertTitle(alert), cfg.EmailReceivers, alertEmailContent(alert)); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func sendAlertWebhook(url string, format string, alert Alert) error {
+	payload, err := buildAlertWebhookPayload(format, alert)
+	if err != nil {
+		return err
+	}
+	resp, err := alertHTTPClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func alertTitle(alert Alert) string {
+	label := "告警"
+	if alert.Status == AlertStatusResolved {
+		label = "恢复"
+	}
+	return fmt.Sprintf("[%s %s] %s", common.SystemName, label, alert.Rule)
+}
+
+func alertText(alert Alert) string {
+	return alertTitle(alert) + "\n" + alert.Message + "\n" + alert.Time.Format("2006-01-02 15:04:05")
+}
+
+func alertEmailContent(alert Alert) string {
+	return fmt.Sprintf("<p>%s</p><p>规则：%s<br>对象：%s<br>时间：%s</p>",
+		html.EscapeString(alert.Message), html.EscapeString(alert.Rule), html.EscapeString(alert.Subject),
+		alert.Time.Format("2006-01-02 15:04:05"))
+}
+
+// buildAlertWebhookPayload renders the alert for the webhook flavour. The
+// generic format posts the Alert itself.
+func buildAlertWebhookPayload(format string, alert Alert) ([]byte, error) {
+	switch format {
+	case common.AlertWebhookFormatSlack:
+		return json.Marshal(map[string]any{"text": alertText(alert)})
+	case common.AlertWebhookFormatFeishu:
+		return json.Marshal(map[string]any{
+			"msg_type": "text",
+			"content":  map[string]any{"text": alertText(alert)},
+		})
+	case common.AlertWebhookFormatDingTalk:
+		return json.Marshal(map[string]any{
+			"msgtype": "text",
+			"text":    map[string]any{"content": alertText(alert)},
+		})
+	default:
+		return json.Marshal(map[string]any{
+			"system":    common.SystemName,
+			"rule":      alert.Rule,
+			"status":    alert.Status,
+			"subject":   alert.Subject,
+			"message":   alert.Message,
+			"timestamp": alert.Time.Unix(),
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAlertTest(t *testing.T, options map[string]string) (*alertManager, *[]Alert, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "alert.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.Provider{}, &model.ProviderToken{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB := model.DB
+	model.DB = db
+
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{"AlertEnabled": "true"}
+	for key, value := range options {
+		common.OptionMap[key] = value
+	}
+	common.OptionMapRWMutex.Unlock()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+		model.DB = oldDB
+		_ = sqlDB.Close()
+	})
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sent := &[]Alert{}
+	manager := newAlertManager()
+	manager.now = func() time.Time { return now }
+	manager.deliver = func(cfg common.AlertConfig, alert Alert) error {
+		*sent = append(*sent, alert)
+		return nil
+	}
+	return manager, sent, &now
+}
+
+func TestAlertBalanceDeduplicatesAndResolves(t *testing.T) {
+	manager, sent, now := setupAlertTest(t, map[string]string{
+		"AlertBalanceThresholdUSD": "5",
+		"AlertQuietPeriodMinutes":  "60",
+	})
+	provider := &model.Provider{Name: "low", BaseURL: "http://low", Balance: "$1.20"}
+	if err := provider.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&model.Provider{Name: "rich", BaseURL: "http://rich", Balance: "$99.00"}).Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.evaluate()
+	manager.evaluate()
+	if len(*sent) != 1 || (*sent)[0].Rule != AlertRuleProviderBalance || (*sent)[0].Subject != "low" {
+		t.Fatalf("expected a single balance alert, got %+v", *sent)
+	}
+
+	*now = now.Add(61 * time.Minute)
+	manager.evaluate()
+	if len(*sent) != 2 || (*sent)[1].Status != AlertStatusFiring {
+		t.Fatalf("expected a repeat after the quiet period, got %+v", *sent)
+	}
+
+	model.DB.Model(provider).Update("balance", "$20.00")
+	manager.evaluate()
+	if len(*sent) != 3 || (*sent)[2].Status != AlertStatusResolved || (*sent)[2].Subject != "low" {
+		t.Fatalf("expected a resolved alert, got %+v", *sent)
+	}
+	manager.evaluate()
+	if len(*sent) != 3 {
+		t.Fatalf("expected no further alerts, got %+v", *sent)
+	}
+}
+
+func TestAlertSyncFailureThreshold(t *testing.T) {
+	manager, sent, _ := setupAlertTest(t, map[string]string{"AlertSyncFailureThreshold": "3"})
+	provider := &model.Provider{Name: "flaky", BaseURL: "http://flaky", ProviderType: model.ProviderTypeKeyOnly}
+	if err := provider.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.recordProviderSyncResult(provider.Id, false)
+	manager.recordProviderSyncResult(provider.Id, false)
+	manager.evaluate()
+	if len(*sent) != 0 {
+		t.Fatalf("expected no alert below threshold, got %+v", *sent)
+	}
+	manager.recordProviderSyncResult(provider.Id, false)
+	manager.evaluate()
+	if len(*sent) != 1 || (*sent)[0].Rule != AlertRuleProviderSyncFailure {
+		t.Fatalf("expected a sync failure alert, got %+v", *sent)
+	}
+	manager.recordProviderSyncResult(provider.Id, true)
+	manager.evaluate()
+	if len(*sent) != 2 || (*sent)[1].Status != AlertStatusResolved {
+		t.Fatalf("expected the alert to resolve after a successful sync, got %+v", *sent)
+	}
+}
+
+func TestAlertCPAStoppedAndDisabled(t *testing.T) {
+	manager, sent, _ := setupAlertTest(t, nil)
+	manager.cpaStatus = func() CPAAlertStatus {
+		return CPAAlertStatus{Enabled: true, State: "error", LastError: "exited"}
+	}
+	manager.evaluate()
+	if len(*sent) != 1 || (*sent)[0].Rule != AlertRuleCPAStopped || !strings.Contains((*sent)[0].Message, "exited") {
+		t.Fatalf("expected a CPA alert, got %+v", *sent)
+	}
+
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap["AlertEnabled"] = "false"
+	common.OptionMapRWMutex.Unlock()
+	manager.cpaStatus = func() CPAAlertStatus { return CPAAlertStatus{Enabled: true, State: "running"} }
+	manager.evaluate()
+	if len(*sent) != 1 {
+		t.Fatalf("expected disabled alerting to stay silent, got %+v", *sent)
+	}
+}
+
+func TestSendAlertWebhookFormats(t *testing.T) {
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = nil
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	alert := Alert{Rule: AlertRuleProviderBalance, Status: AlertStatusFiring, Subject: "p", Message: "余额不足", Time: time.Unix(1700000000, 0)}
+
+	if err := sendAlertWebhook(server.URL, common.AlertWebhookFormatGeneric, alert); err != nil {
+		t.Fatal(err)
+	}
+	if received["rule"] != AlertRuleProviderBalance || received["status"] != AlertStatusFiring || received["timestamp"] != float64(1700000000) {
+		t.Fatalf("unexpected generic payload: %v", received)
+	}
+
+	if err := sendAlertWebhook(server.URL, common.AlertWebhookFormatFeishu, alert); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := received["content"].(map[string]any)
+	if received["msg_type"] != "text" || !strings.Contains(content["text"].(string), "余额不足") {
+		t.Fatalf("unexpected feishu payload: %v", received)
+	}
+
+	if err := sendAlertWebhook(server.URL, common.AlertWebhookFormatDingTalk, alert); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := received["text"].(map[string]any)
+	if received["msgtype"] != "text" || !strings.Contains(text["content"].(string), "余额不足") {
+		t.Fatalf("unexpected dingtalk payload: %v", received)
+	}
+
+	if err := sendAlertWebhook(server.URL, common.AlertWebhookFormatSlack, alert); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(received["text"].(string), "余额不足") {
+		t.Fatalf("unexpected slack payload: %v", received)
+	}
+}
@@ -0,0 +1,49 @@
+package cpa
+
+import (
+	"NewAPI-Gateway/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cpaUpDesc      = prometheus.NewDesc("gateway_cpa_up", "1 if the embedded CPA runtime is enabled and ready.", nil, nil)
+	cpaEnabledDesc = prometheus.NewDesc("gateway_cpa_enabled", "1 if the embedded CPA runtime is enabled.", nil, nil)
+	cpaStateDesc   = prometheus.NewDesc("gateway_cpa_state", "Current embedded CPA lifecycle state (1 for the active state).", []string{"state"}, nil)
+)
+
+var cpaMetricStates = []State{StateStopped, StateStarting, StateRunning, StateStopping, StateError}
+
+// runtimeCollector reports the lifecycle of the default runtime at scrape time.
+type runtimeCollector struct{}
+
+func (runtimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cpaUpDesc
+	ch <- cpaEnabledDesc
+	ch <- cpaStateDesc
+}
+
+func (runtimeCollector) Collect(ch chan<- prometheus.Metric) {
+	var status Status
+	if runtime := DefaultRuntime(); runtime != nil && runtime.Manager != nil {
+		status = runtime.Manager.Status()
+	} else {
+		status.State = StateStopped
+	}
+	ch <- prometheus.MustNewConstMetric(cpaUpDesc, prometheus.GaugeValue, boolGauge(status.Enabled && status.Ready))
+	ch <- prometheus.MustNewConstMetric(cpaEnabledDesc, prometheus.GaugeValue, boolGauge(status.Enabled))
+	for _, state := range cpaMetricStates {
+		ch <- prometheus.MustNewConstMetric(cpaStateDesc, prometheus.GaugeValue, boolGauge(status.State == state), string(state))
+	}
+}
+
+func boolGauge(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func init() {
+	common.MetricsRegistry.MustRegister(runtimeCollector{})
+}
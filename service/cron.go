@@ -9,6 +9,10 @@ import (
 var syncTicker *time.Ticker
 var checkinTimer *time.Timer
 var refreshTicker *time.Ticker
+var alertTicker *time.Ticker
+var usageTicker *time.Ticker
+var probeTicker *time.Ticker
+var cooldownSnapshotTicker *time.Ticker
 var stopCron chan bool
 
 const (
@@ -26,10 +30,19 @@ func StartCronJobs() {
 	checkinTimer = time.NewTimer(durationUntilNextCheckin(time.Now()))
 	// Refresh expiring tokens every 2 minutes
 	refreshTicker = time.NewTicker(2 * time.Minute)
+	// Evaluate alert rules every minute
+	alertTicker = time.NewTicker(time.Minute)
+	// Roll up and prune usage data every 10 minutes
+	usageTicker = time.NewTicker(10 * time.Minute)
+	// Probe routes when enabled; the interval is checked every minute
+	probeTicker = time.NewTicker(time.Minute)
+	// Save route cooldown state every minute so it survives restarts
+	cooldownSnapshotTicker = time.NewTicker(time.Minute)
 
 	// Catch up one run on startup
 	go CheckinAllProviders()
 	go RefreshExpiringTokens()
+	go RunUsageMaintenance()
 
 	go func() {
 		for {
@@ -41,9 +54,21 @@ func StartCronJobs() {
 				checkinTimer.Reset(durationUntilNextCheckin(time.Now()))
 			case <-refreshTicker.C:
 				RefreshExpiringTokens()
+			case <-alertTicker.C:
+				go EvaluateAlerts()
+			case <-usageTicker.C:
+				go RunUsageMaintenance()
+			case <-probeTicker.C:
+				go RunRouteProbes()
+			case <-cooldownSnapshotTicker.C:
+				SnapshotRouteCooldowns()
 			case <-stopCron:
 				syncTicker.Stop()
 				refreshTicker.Stop()
+				alertTicker.Stop()
+				usageTicker.Stop()
+				probeTicker.Stop()
+				cooldownSnapshotTicker.Stop()
 				if !checkinTimer.Stop() {
 					select {
 					case <-checkinTimer.C:
@@ -55,14 +80,16 @@ func StartCronJobs() {
 		}
 	}()
 
-	common.SysLog("cron jobs started: sync every 5m, checkin daily at 00:05 local time, refresh tokens every 2m")
+	common.SysLog("cron jobs started: sync every 5m, checkin daily at 00:05 local time, refresh tokens every 2m, alerts every 1m, usage rollup every 10m, route probes checked every 1m, cooldown snapshot every 1m")
 }
 
 // StopCronJobs stops background tasks
 func StopCronJobs() {
 	if stopCron != nil {
 		stopCron <- true
+		stopCron = nil
 	}
+	SnapshotRouteCooldowns()
 }
 
 func syncAllProviders() {
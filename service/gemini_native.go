@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Gemini native API methods addressed as /v1beta/models/{model}:{method}.
+const (
+	geminiMethodGenerateContent       = "generateContent"
+	geminiMethodStreamGenerateContent = "streamGenerateContent"
+	geminiMethodCountTokens           = "countTokens"
+	geminiMethodEmbedContent          = "embedContent"
+	geminiMethodBatchEmbedContents    = "batchEmbedContents"
+)
+
+const geminiModelsPathPrefix = "/v1beta/models/"
+
+// ParseGeminiModelPath splits a Gemini native path such as
+// /v1beta/models/gemini-2.5-pro:streamGenerateContent into the model and the
+// method. ok is false for paths that do not address a model method.
+func ParseGeminiModelPath(path string) (modelName string, method string, ok bool) {
+	rest, found := strings.CutPrefix(path, geminiModelsPathPrefix)
+	if !found {
+		return "", "", false
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 || idx == len(rest)-1 {
+		return "", "", false
+	}
+	modelName, method = rest[:idx], rest[idx+1:]
+	if strings.Contains(modelName, "/") || strings.Contains(method, "/") {
+		return "", "", false
+	}
+	return modelName, method, true
+}
+
+func geminiModelPath(modelName string, method string) string {
+	return geminiModelsPathPrefix + modelName + ":" + method
+}
+
+// isGeminiSSEQuery reports whether a streamGenerateContent request asked for
+// server-sent events; without alt=sse Gemini streams a JSON array.
+func isGeminiSSEQuery(rawQuery string) bool {
+	values, err := url.ParseQuery(rawQuery)
+	return err == nil && strings.EqualFold(values.Get("alt"), "sse")
+}
+
+// stripGatewayKeyQuery drops the key query parameter, which carries the
+// gateway token for Gemini clients and must not reach the upstream.
+func stripGatewayKeyQuery(rawQuery string) string {
+	if rawQuery == "" || !strings.Contains(rawQuery, "key=") {
+		return rawQuery
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil || !values.Has("key") {
+		return rawQuery
+	}
+	values.Del("key")
+	return values.Encode()
+}
+
+// rewriteGeminiRequestModels points the model fields nested in Gemini
+// countTokens and batchEmbedContents bodies at the upstream model; the other
+// methods carry the model only in the path.
+func rewriteGeminiRequestModels(body []byte, method string, upstreamModel string) []byte {
+	if upstreamModel == "" || len(body) == 0 {
+		return body
+	}
+	if method != geminiMethodCountTokens && method != geminiMethodBatchEmbedContents {
+		return body
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body
+	}
+	target := "models/" + upstreamModel
+	changed := false
+	rewrite := func(request map[string]any) {
+		if current, ok := request["model"].(string); ok && current != target {
+			request["model"] = target
+			changed = true
+		}
+	}
+	switch method {
+	case geminiMethodCountTokens:
+		if request, ok := payload["generateContentRequest"].(map[string]any); ok {
+			rewrite(request)
+		}
+	case geminiMethodBatchEmbedContents:
+		requests, _ := payload["requests"].([]any)
+		for _, item := range requests {
+			if request, ok := item.(map[string]any); ok {
+				rewrite(request)
+			}
+		}
+	}
+	if !changed {
+		return body
+	}
+	updated, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return updated
+}
+
+// extractUsageFromGeminiArray reads usage from a streamGenerateContent
+// response sent without alt=sse: a JSON array of chunks whose usageMetadata
+// is cumulative, so the last chunk reporting it wins.
+func extractUsageFromGeminiArray(body []byte) usageMetrics {
+	var chunks []json.RawMessage
+	if err := json.Unmarshal(body, &chunks); err != nil {
+		return usageMetrics{}
+	}
+	out := usageMetrics{}
+	for _, chunk := range chunks {
+		if !bytes.Contains(chunk, []byte(`"usageMetadata"`)) {
+			continue
+		}
+		if usage := extractUsageAndModelFromJSON(chunk); usage.PromptTokens > 0 || usage.CompletionTokens > 0 {
+			out = usage
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"NewAPI-Gateway/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseGeminiModelPath(t *testing.T) {
+	cases := []struct {
+		path   string
+		model  string
+		method string
+		ok     bool
+	}{
+		{"/v1beta/models/gemini-2.5-pro:streamGenerateContent", "gemini-2.5-pro", "streamGenerateContent", true},
+		{"/v1beta/models/text-embedding-004:batchEmbedContents", "text-embedding-004", "batchEmbedContents", true},
+		{"/v1beta/models/gemini-2.5-pro", "", "", false},
+		{"/v1beta/models/:generateContent", "", "", false},
+		{"/v1beta/models/a/b:generateContent", "", "", false},
+		{"/v1/chat/completions", "", "", false},
+	}
+	for _, tc := range cases {
+		modelName, method, ok := ParseGeminiModelPath(tc.path)
+		if modelName != tc.model || method != tc.method || ok != tc.ok {
+			t.Fatalf("ParseGeminiModelPath(%q) = %q, %q, %v", tc.path, modelName, method, ok)
+		}
+	}
+}
+
+func newGeminiNativeContext(path string, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("agg_token", &model.AggregatedToken{Id: 1, UserId: 1})
+	c.Set("request_model", "gemini-alias")
+	c.Set("request_model_resolved", "gemini-upstream")
+	return c, recorder
+}
+
+func TestProxyRewritesGeminiNativePathAndNestedModels(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+
+	var upstreamURI, upstreamKey string
+	var upstreamBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamURI = r.URL.RequestURI()
+		upstreamKey = r.Header.Get("x-goog-api-key")
+		upstreamBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"embeddings":[{"values":[0.1]},{"values":[0.2]}]}`))
+	}))
+	defer upstream.Close()
+
+	c, recorder := newGeminiNativeContext("/v1beta/models/gemini-alias:batchEmbedContents?key=ag-secret&foo=1",
+		`{"requests":[{"model":"models/gemini-alias","content":{"parts":[{"text":"a"}]}},{"model":"models/gemini-alias","content":{"parts":[{"text":"b"}]}}]}`)
+	route := model.ModelRoute{Id: 1, ModelName: "gemini-upstream", ProviderId: 31, ProviderTokenId: 301, Enabled: true}
+	if err := ProxyToUpstream(c, route, &model.ProviderToken{Id: 301, ProviderId: 31, SkKey: "sk-up"}, &model.Provider{Id: 31, BaseURL: upstream.URL}); err != nil {
+		t.Fatalf("proxy attempt: %v", err)
+	}
+	if upstreamURI != "/v1beta/models/gemini-upstream:batchEmbedContents?foo=1" {
+		t.Fatalf("expected aliased path without the gateway key, got %s", upstreamURI)
+	}
+	if upstreamKey != "sk-up" {
+		t.Fatalf("expected upstream key header, got %q", upstreamKey)
+	}
+	if strings.Contains(string(upstreamBody), "gemini-alias") || strings.Count(string(upstreamBody), `"model":"models/gemini-upstream"`) != 2 {
+		t.Fatalf("expected nested models rewritten, got %s", upstreamBody)
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+}
+
+func TestProxyRecordsUsageOfGeminiJSONArrayStream(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"candidates":[{"content":{"parts":[{"text":"po"}]}}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":1}},` +
+			`{"candidates":[{"content":{"parts":[{"text":"ng"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":2},"modelVersion":"gemini-upstream"}]`))
+	}))
+	defer upstream.Close()
+
+	c, recorder := newGeminiNativeContext("/v1beta/models/gemini-alias:streamGenerateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"ping"}]}]}`)
+	route := model.ModelRoute{Id: 2, ModelName: "gemini-upstream", ProviderId: 32, ProviderTokenId: 302, Enabled: true}
+	if err := ProxyToUpstream(c, route, &model.ProviderToken{Id: 302, ProviderId: 32, SkKey: "sk-up"}, &model.Provider{Id: 32, BaseURL: upstream.URL}); err != nil {
+		t.Fatalf("proxy attempt: %v", err)
+	}
+	if !strings.HasPrefix(recorder.Body.String(), "[") {
+		t.Fatalf("expected the JSON array forwarded, got %s", recorder.Body.String())
+	}
+	logs := waitForUsageLogs(t, 302, 1)
+	if len(logs) != 1 || logs[0].PromptTokens != 7 || logs[0].CompletionTokens != 2 || !logs[0].RequestedStream {
+		t.Fatalf("expected usage from the last chunk, got %+v", logs)
+	}
+}
+
+func TestProxyWrapsConvertedGeminiStreamWithoutSSEInArray(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	if err := model.DB.Create(&model.ModelPricing{ModelName: "gemini-upstream", ProviderId: 33, SupportedEndpointTypes: `["openai"]`}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var upstreamBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"gemini-upstream","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	c, recorder := newGeminiNativeContext("/v1beta/models/gemini-alias:streamGenerateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"ping"}]}]}`)
+	route := model.ModelRoute{Id: 3, ModelName: "gemini-upstream", ProviderId: 33, ProviderTokenId: 303, Enabled: true}
+	if err := ProxyToUpstream(c, route, &model.ProviderToken{Id: 303, ProviderId: 33, SkKey: "sk-up"}, &model.Provider{Id: 33, BaseURL: upstream.URL}); err != nil {
+		t.Fatalf("proxy attempt: %v", err)
+	}
+	if strings.Contains(string(upstreamBody), `"stream":true`) {
+		t.Fatalf("expected a non-stream upstream request, got %s", upstreamBody)
+	}
+	body := recorder.Body.String()
+	if !strings.HasPrefix(body, "[{") || !strings.HasSuffix(body, "}]") || !strings.Contains(body, "pong") {
+		t.Fatalf("expected a single-chunk Gemini array, got %s", body)
+	}
+}
+
+func TestProxyRetriesWhenResponseConversionFails(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	if err := model.DB.Create(&model.ModelPricing{ModelName: "gemini-upstream", ProviderId: 34, SupportedEndpointTypes: `["openai"]`}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("not json"))
+	}))
+	defer upstream.Close()
+
+	c, recorder := newGeminiNativeContext("/v1beta/models/gemini-alias:generateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"ping"}]}]}`)
+	route := model.ModelRoute{Id: 4, ModelName: "gemini-upstream", ProviderId: 34, ProviderTokenId: 304, Enabled: true}
+	err := ProxyToUpstream(c, route, &model.ProviderToken{Id: 304, ProviderId: 34, SkKey: "sk-up"}, &model.Provider{Id: 34, BaseURL: upstream.URL})
+	if err == nil || !err.Retryable || err.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected a retryable 502, got %+v", err)
+	}
+	if !strings.Contains(string(err.UpstreamBody), `"status":"UNAVAILABLE"`) {
+		t.Fatalf("expected a Gemini error body, got %s", err.UpstreamBody)
+	}
+	if recorder.Body.Len() != 0 || c.Writer.Header().Get("Content-Type") != "" {
+		t.Fatalf("expected nothing written to the client, got %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HedgeRolePrimary = "primary"
+	HedgeRoleHedge   = "hedge"
+
+	hedgeRoleContextKey      = "hedge_role"
+	hedgeCancelledContextKey = "hedge_cancelled"
+)
+
+// HedgePolicy races a slow non-streaming attempt against the next route.
+type HedgePolicy struct {
+	cfg common.HedgeConfig
+}
+
+// NewHedgePolicy returns nil when hedging does not apply: the request streams,
+// or neither the token nor the model opted in.
+func NewHedgePolicy(c *gin.Context, aggToken *model.AggregatedToken, routingModel string) *HedgePolicy {
+	cfg := common.LoadHedgeConfig()
+	if !aggToken.HedgeEnabled && !cfg.ModelEnabled(routingModel) {
+		return nil
+	}
+	if RequestedStream(c) {
+		return nil
+	}
+	return &HedgePolicy{cfg: cfg}
+}
+
+// HedgeResult is the outcome of Run.
+type HedgeResult struct {
+	// Served is the attempt whose response was written to the client.
+	Served model.RouteAttempt
+	// Err is nil on success, otherwise the error to report: a non-retryable
+	// error when any attempt returned one, else the last error.
+	Err *ProxyAttemptError
+	// Used is the number of candidates consumed, Upstream the number of them
+	// that reached the upstream (cooldown and concurrency rejections excluded).
+	Used     int
+	Upstream int
+	// Saturated are the consumed candidates rejected by a max-in-flight limit.
+	Saturated []model.RouteAttempt
+}
+
+type hedgeFlight struct {
+	attempt model.RouteAttempt
+	ctx     *gin.Context
+	writer  *hedgeResponseWriter
+	cancel  context.CancelFunc
+	err     *ProxyAttemptError
+}
+
+// Run sends candidates[0] and, if it has not answered within the hedge delay,
+// candidates[1] in parallel; a hedge rejected by cooldown or a concurrency
+// limit moves on to the next candidate. The first success is written to the
+// client and the other attempt is cancelled. Run returns as soon as every
+// started attempt failed, so the caller continues with candidates[Used:].
+func (p *HedgePolicy) Run(c *gin.Context, candidates []model.RouteAttempt) HedgeResult {
+	result := HedgeResult{}
+	if len(candidates) == 0 {
+		return result
+	}
+	// Read the body once up front: the flights run concurrently and must not
+	// share the request body reader.
+	body, err := getRequestBodyBytes(c)
+	if err != nil {
+		result.Err = &ProxyAttemptError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "failed to read request body",
+			Retryable:  false,
+		}
+		return result
+	}
+	done := make(chan *hedgeFlight, len(candidates))
+	var inFlight []*hedgeFlight
+	launch := func(role string) {
+		flight := newHedgeFlight(c, body, candidates[result.Used], role)
+		result.Used++
+		inFlight = append(inFlight, flight)
+		go func() {
+			flight.err = ProxyToUpstream(flight.ctx, flight.attempt.Route, flight.attempt.Token, flight.attempt.Provider)
+			// Merged here rather than in Run: a cancelled loser may finish
+			// logging after Run returned.
+			if tokens := flight.ctx.GetInt64("relay_usage_tokens"); tokens > 0 {
+				addRelayUsageTokens(c, tokens)
+			}
+			done <- flight
+		}()
+	}
+
+	launch(HedgeRolePrimary)
+	timer := time.NewTimer(p.cfg.DelayFor(candidates[0].Route.ProviderTokenId, candidates[0].Route.ModelName))
+	defer timer.Stop()
+	hedged := false
+	var finalErr *ProxyAttemptError
+	for len(inFlight) > 0 {
+		select {
+		case <-timer.C:
+			if !hedged && result.Used < len(candidates) {
+				hedged = true
+				launch(HedgeRoleHedge)
+			}
+		case flight := <-done:
+			inFlight = removeHedgeFlight(inFlight, flight)
+			flight.cancel()
+			if flight.err == nil {
+				for _, loser := range inFlight {
+					loser.ctx.Set(hedgeCancelledContextKey, true)
+					loser.cancel()
+				}
+				flight.writer.copyTo(c)
+				result.Served = flight.attempt
+				result.Err = nil
+				if ServedFromCache(flight.ctx) {
+					c.Set(responseCacheHitContextKey, true)
+				} else {
+					result.Upstream++
+				}
+				return result
+			}
+			notSent := flight.err.CooldownRejected || flight.err.Saturated
+			if flight.err.Saturated {
+				result.Saturated = append(result.Saturated, flight.attempt)
+			}
+			if !notSent {
+				result.Upstream++
+			}
+			if !flight.err.Retryable && finalErr == nil {
+				finalErr = flight.err
+			}
+			result.Err = flight.err
+			// Keep one hedge running while candidates remain.
+			if hedged && notSent && len(inFlight) > 0 && result.Used < len(candidates) {
+				launch(HedgeRoleHedge)
+			}
+		}
+	}
+	if finalErr != nil {
+		result.Err = finalErr
+	}
+	return result
+}
+
+func removeHedgeFlight(flights []*hedgeFlight, target *hedgeFlight) []*hedgeFlight {
+	for i, flight := range flights {
+		if flight == target {
+			return append(flights[:i], flights[i+1:]...)
+		}
+	}
+	return flights
+}
+
+// newHedgeFlight runs an attempt on a copy of the request context with its
+// own cancellation, its own reader over body and a buffered response writer.
+func newHedgeFlight(c *gin.Context, body []byte, attempt model.RouteAttempt, role string) *hedgeFlight {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	hc := c.Copy()
+	hc.Request = c.Request.WithContext(ctx)
+	hc.Request.Body = io.NopCloser(bytes.NewReader(body))
+	writer := newHedgeResponseWriter()
+	hc.Writer = writer
+	hc.Set(hedgeRoleContextKey, role)
+	// Each flight counts its own tokens; they are merged into c once it ends.
+	hc.Set("relay_usage_tokens", int64(0))
+	if attempt.Route.ModelName != "" {
+		hc.Set("request_model_resolved", attempt.Route.ModelName)
+		hc.Set("request_model", attempt.Route.ModelName)
+	}
+	return &hedgeFlight{attempt: attempt, ctx: hc, writer: writer, cancel: cancel}
+}
+
+// hedgeCancelled reports whether the attempt lost a hedged race and was
+// cancelled; such failures say nothing about the route.
+func hedgeCancelled(c *gin.Context) bool {
+	return c.GetBool(hedgeCancelledContextKey)
+}
+
+// hedgeResponseWriter buffers the response of a hedged attempt until it wins.
+type hedgeResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newHedgeResponseWriter() *hedgeResponseWriter {
+	return &hedgeResponseWriter{header: make(http.Header)}
+}
+
+func (w *hedgeResponseWriter) Header() http.Header { return w.header }
+
+func (w *hedgeResponseWriter) WriteHeader(code int) {
+	if code > 0 && w.body.Len() == 0 {
+		w.status = code
+	}
+}
+
+func (w *hedgeResponseWriter) WriteHeaderNow() {}
+
+func (w *hedgeResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *hedgeResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *hedgeResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *hedgeResponseWriter) Size() int {
+	if w.status == 0 && w.body.Len() == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *hedgeResponseWriter) Written() bool {
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func (w *hedgeResponseWriter) Flush() {}
+
+func (w *hedgeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hedged responses cannot be hijacked")
+}
+
+func (w *hedgeResponseWriter) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func (w *hedgeResponseWriter) Pusher() http.Pusher { return nil }
+
+func (w *hedgeResponseWriter) copyTo(c *gin.Context) {
+	for key, values := range w.header {
+		c.Writer.Header()[key] = values
+	}
+	c.Status(w.Status())
+	_, _ = c.Writer.Write(w.body.Bytes())
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHedgePolicyServesFasterRouteAndCancelsPrimary(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	received := make(chan string, 2)
+	slowUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body is read.
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slowUpstream.Close()
+	fastUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4}}`))
+	}))
+	defer fastUpstream.Close()
+
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`)
+	policy := &HedgePolicy{cfg: common.HedgeConfig{Delay: 50 * time.Millisecond}}
+	candidates := []model.RouteAttempt{
+		{Route: model.ModelRoute{Id: 1, ModelName: "gpt-4", ProviderTokenId: 701}, Token: &model.ProviderToken{Id: 701}, Provider: &model.Provider{Id: 71, Name: "slow", BaseURL: slowUpstream.URL}},
+		{Route: model.ModelRoute{Id: 2, ModelName: "gpt-4", ProviderTokenId: 702}, Token: &model.ProviderToken{Id: 702}, Provider: &model.Provider{Id: 72, Name: "fast", BaseURL: fastUpstream.URL}},
+	}
+	started := time.Now()
+	result := policy.Run(c, candidates)
+	if result.Err != nil {
+		t.Fatalf("hedged run failed: %#v", result.Err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("hedged run took %v, want the fast route to win", elapsed)
+	}
+	if result.Served.Route.ProviderTokenId != 702 || result.Used != 2 || result.Upstream != 1 {
+		t.Fatalf("unexpected result: served %d, used %d, upstream %d", result.Served.Route.ProviderTokenId, result.Used, result.Upstream)
+	}
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4}}` {
+		t.Fatalf("unexpected client response %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	for i := 0; i < 2; i++ {
+		if body := <-received; !strings.Contains(body, `"hello"`) {
+			t.Fatalf("expected every upstream to receive the request body, got %q", body)
+		}
+	}
+
+	hedgeLogs := waitForUsageLogs(t, 702, 1)
+	if len(hedgeLogs) != 1 || hedgeLogs[0].Status != 1 || hedgeLogs[0].Hedge != HedgeRoleHedge {
+		t.Fatalf("unexpected hedge logs: %#v", hedgeLogs)
+	}
+	primaryLogs := waitForUsageLogs(t, 701, 1)
+	if len(primaryLogs) != 1 || primaryLogs[0].ErrorType != model.UsageLogErrorTypeHedgeCancelled || primaryLogs[0].Hedge != HedgeRolePrimary {
+		t.Fatalf("unexpected primary logs: %#v", primaryLogs)
+	}
+	if tokens := c.GetInt64("relay_usage_tokens"); tokens != 7 {
+		t.Fatalf("expected the winner's 7 tokens merged into the request, got %d", tokens)
+	}
+}
@@ -0,0 +1,1083 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chat wire formats the gateway can translate between. Values match the
+// endpoint type names used by ModelPricing.SupportedEndpointTypes.
+const (
+	relayFormatOpenAI    = "openai"
+	relayFormatAnthropic = "anthropic"
+	relayFormatGemini    = "gemini"
+)
+
+// Anthropic requires max_tokens; OpenAI and Gemini clients may omit it.
+const defaultAnthropicMaxTokens = 4096
+
+const defaultAnthropicVersion = "2023-06-01"
+
+// detectRelayFormat returns the chat format of a request path, or "" for
+// endpoints that are always forwarded untouched.
+func detectRelayFormat(path string) string {
+	switch {
+	case path == "/v1/chat/completions":
+		return relayFormatOpenAI
+	case path == "/v1/messages":
+		return relayFormatAnthropic
+	case strings.HasPrefix(path, "/v1beta/models/") &&
+		(strings.HasSuffix(path, ":generateContent") || strings.HasSuffix(path, ":streamGenerateContent")):
+		return relayFormatGemini
+	}
+	return ""
+}
+
+func isGeminiStreamPath(path string) bool {
+	return isGeminiPath(path) && strings.HasSuffix(path, ":streamGenerateContent")
+}
+
+// selectUpstreamFormat decides which format to send upstream. The client
+// format wins when the upstream supports it or when its capabilities are
+// unknown; otherwise the first convertible format the upstream supports is used.
+func selectUpstreamFormat(clientFormat string, supported []string) string {
+	if clientFormat == "" || len(supported) == 0 {
+		return clientFormat
+	}
+	available := make(map[string]bool, len(supported))
+	for _, endpointType := range supported {
+		available[strings.ToLower(strings.TrimSpace(endpointType))] = true
+	}
+	if available[clientFormat] {
+		return clientFormat
+	}
+	for _, format := range []string{relayFormatOpenAI, relayFormatAnthropic, relayFormatGemini} {
+		if available[format] {
+			return format
+		}
+	}
+	return clientFormat
+}
+
+// upstreamPathForFormat returns the upstream path and query for a converted
+// request.
+func upstreamPathForFormat(format string, modelName string, stream bool) (string, string) {
+	switch format {
+	case relayFormatAnthropic:
+		return "/v1/messages", ""
+	case relayFormatGemini:
+		if stream {
+			return "/v1beta/models/" + modelName + ":streamGenerateContent", "alt=sse"
+		}
+		return "/v1beta/models/" + modelName + ":generateContent", ""
+	default:
+		return "/v1/chat/completions", ""
+	}
+}
+
+// convertRequestBody translates a chat request from one format to another,
+// going through the OpenAI chat completions shape.
+func convertRequestBody(body []byte, from string, to string, modelName string, stream bool) ([]byte, error) {
+	var request map[string]any
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("invalid %s request body: %w", from, err)
+	}
+
+	var openAIRequest map[string]any
+	switch from {
+	case relayFormatAnthropic:
+		openAIRequest = anthropicToOpenAIRequest(request)
+	case relayFormatGemini:
+		openAIRequest = geminiToOpenAIRequest(request)
+	default:
+		openAIRequest = request
+	}
+	openAIRequest["model"] = modelName
+	openAIRequest["stream"] = stream
+
+	var converted map[string]any
+	switch to {
+	case relayFormatAnthropic:
+		converted = openAIToAnthropicRequest(openAIRequest)
+	case relayFormatGemini:
+		converted = openAIToGeminiRequest(openAIRequest)
+	default:
+		converted = openAIRequest
+		if stream {
+			converted["stream_options"] = map[string]any{"include_usage": true}
+		} else {
+			delete(converted, "stream_options")
+		}
+	}
+	return json.Marshal(converted)
+}
+
+func copyFields(dst map[string]any, src map[string]any, mapping map[string]string) {
+	for from, to := range mapping {
+		if value, ok := src[from]; ok && value != nil {
+			dst[to] = value
+		}
+	}
+}
+
+func asSlice(value any) []any {
+	items, _ := value.([]any)
+	return items
+}
+
+func asMap(value any) map[string]any {
+	item, _ := value.(map[string]any)
+	return item
+}
+
+func marshalJSONString(value any) string {
+	if value == nil {
+		return "{}"
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
+func parseJSONObject(raw string) map[string]any {
+	parsed := map[string]any{}
+	if strings.TrimSpace(raw) == "" {
+		return parsed
+	}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil || parsed == nil {
+		return map[string]any{}
+	}
+	return parsed
+}
+
+// parseDataURL splits "data:<mime>;base64,<data>".
+func parseDataURL(url string) (string, string, bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
+// openAIContentText flattens OpenAI message content to plain text.
+func openAIContentText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, part := range v {
+			if p := asMap(part); p != nil && getStringValue(p["type"]) == "text" {
+				texts = append(texts, fmt.Sprint(p["text"]))
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// ---- Anthropic <-> OpenAI requests ----
+
+func anthropicBlocksText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, block := range v {
+			if b := asMap(block); b != nil && getStringValue(b["type"]) == "text" {
+				texts = append(texts, fmt.Sprint(b["text"]))
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+func anthropicToOpenAIRequest(request map[string]any) map[string]any {
+	out := map[string]any{}
+	copyFields(out, request, map[string]string{
+		"max_tokens":     "max_tokens",
+		"temperature":    "temperature",
+		"top_p":          "top_p",
+		"stop_sequences": "stop",
+	})
+	if metadata := asMap(request["metadata"]); metadata != nil {
+		if userId := getStringValue(metadata["user_id"]); userId != "" {
+			out["user"] = userId
+		}
+	}
+
+	messages := []any{}
+	if system := anthropicBlocksText(request["system"]); system != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": system})
+	}
+	for _, raw := range asSlice(request["messages"]) {
+		message := asMap(raw)
+		if message == nil {
+			continue
+		}
+		role := getStringValue(message["role"])
+		if text, ok := message["content"].(string); ok {
+			messages = append(messages, map[string]any{"role": role, "content": text})
+			continue
+		}
+		var parts, toolCalls, toolResults []any
+		for _, rawBlock := range asSlice(message["content"]) {
+			block := asMap(rawBlock)
+			if block == nil {
+				continue
+			}
+			switch getStringValue(block["type"]) {
+			case "text":
+				parts = append(parts, map[string]any{"type": "text", "text": block["text"]})
+			case "image":
+				source := asMap(block["source"])
+				url := getStringValue(source["url"])
+				if getStringValue(source["type"]) == "base64" {
+					url = "data:" + getStringValue(source["media_type"]) + ";base64," + getStringValue(source["data"])
+				}
+				if url != "" {
+					parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+				}
+			case "tool_use":
+				toolCalls = append(toolCalls, map[string]any{
+					"id":   block["id"],
+					"type": "function",
+					"function": map[string]any{
+						"name":      block["name"],
+						"arguments": marshalJSONString(block["input"]),
+					},
+				})
+			case "tool_result":
+				toolResults = append(toolResults, map[string]any{
+					"role":         "tool",
+					"tool_call_id": block["tool_use_id"],
+					"content":      anthropicBlocksText(block["content"]),
+				})
+			}
+		}
+		// Tool results answer the preceding assistant turn, so they go first.
+		messages = append(messages, toolResults...)
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		converted := map[string]any{"role": role, "content": simplifyOpenAIParts(parts)}
+		if len(toolCalls) > 0 {
+			converted["tool_calls"] = toolCalls
+		}
+		messages = append(messages, converted)
+	}
+	out["messages"] = messages
+
+	var tools []any
+	for _, rawTool := range asSlice(request["tools"]) {
+		tool := asMap(rawTool)
+		// Server tools (web_search, bash, ...) have no OpenAI equivalent.
+		if tool == nil || (getStringValue(tool["type"]) != "" && getStringValue(tool["type"]) != "custom") {
+			continue
+		}
+		function := map[string]any{"name": tool["name"], "parameters": tool["input_schema"]}
+		if description, ok := tool["description"]; ok {
+			function["description"] = description
+		}
+		tools = append(tools, map[string]any{"type": "function", "function": function})
+	}
+	if len(tools) > 0 {
+		out["tools"] = tools
+	}
+	if choice := asMap(request["tool_choice"]); choice != nil {
+		switch getStringValue(choice["type"]) {
+		case "auto":
+			out["tool_choice"] = "auto"
+		case "any":
+			out["tool_choice"] = "required"
+		case "none":
+			out["tool_choice"] = "none"
+		case "tool":
+			out["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": choice["name"]}}
+		}
+	}
+	return out
+}
+
+// simplifyOpenAIParts collapses text-only parts into a string; nil means the
+// message carries tool calls only.
+func simplifyOpenAIParts(parts []any) any {
+	if len(parts) == 0 {
+		return nil
+	}
+	var texts []string
+	for _, part := range parts {
+		p := asMap(part)
+		if getStringValue(p["type"]) != "text" {
+			return parts
+		}
+		texts = append(texts, fmt.Sprint(p["text"]))
+	}
+	return strings.Join(texts, "\n")
+}
+
+func openAIContentToAnthropicBlocks(content any) []any {
+	var blocks []any
+	switch v := content.(type) {
+	case string:
+		if v != "" {
+			blocks = append(blocks, map[string]any{"type": "text", "text": v})
+		}
+	case []any:
+		for _, rawPart := range v {
+			part := asMap(rawPart)
+			switch getStringValue(part["type"]) {
+			case "text":
+				if text := fmt.Sprint(part["text"]); text != "" {
+					blocks = append(blocks, map[string]any{"type": "text", "text": text})
+				}
+			case "image_url":
+				url := getStringValue(asMap(part["image_url"])["url"])
+				if mimeType, data, ok := parseDataURL(url); ok {
+					blocks = append(blocks, map[string]any{"type": "image", "source": map[string]any{
+						"type": "base64", "media_type": mimeType, "data": data,
+					}})
+				} else if url != "" {
+					blocks = append(blocks, map[string]any{"type": "image", "source": map[string]any{"type": "url", "url": url}})
+				}
+			}
+		}
+	}
+	return blocks
+}
+
+// appendAnthropicMessage merges consecutive turns of the same role, since
+// Anthropic requires user and assistant messages to alternate.
+func appendAnthropicMessage(messages []any, role string, blocks []any) []any {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if len(messages) > 0 {
+		last := asMap(messages[len(messages)-1])
+		if getStringValue(last["role"]) == role {
+			last["content"] = append(asSlice(last["content"]), blocks...)
+			return messages
+		}
+	}
+	return append(messages, map[string]any{"role": role, "content": blocks})
+}
+
+func openAIToAnthropicRequest(request map[string]any) map[string]any {
+	out := map[string]any{"model": request["model"], "max_tokens": defaultAnthropicMaxTokens}
+	copyFields(out, request, map[string]string{
+		"max_completion_tokens": "max_tokens",
+		"temperature":           "temperature",
+		"top_p":                 "top_p",
+		"stream":                "stream",
+	})
+	if maxTokens, ok := request["max_tokens"]; ok && maxTokens != nil {
+		out["max_tokens"] = maxTokens
+	}
+	switch stop := request["stop"].(type) {
+	case string:
+		out["stop_sequences"] = []any{stop}
+	case []any:
+		out["stop_sequences"] = stop
+	}
+	if user := getStringValue(request["user"]); user != "" {
+		out["metadata"] = map[string]any{"user_id": user}
+	}
+
+	var systemTexts []string
+	messages := []any{}
+	for _, raw := range asSlice(request["messages"]) {
+		message := asMap(raw)
+		if message == nil {
+			continue
+		}
+		switch role := getStringValue(message["role"]); role {
+		case "system", "developer":
+			if text := openAIContentText(message["content"]); text != "" {
+				systemTexts = append(systemTexts, text)
+			}
+		case "tool":
+			messages = appendAnthropicMessage(messages, "user", []any{map[string]any{
+				"type":        "tool_result",
+				"tool_use_id": message["tool_call_id"],
+				"content":     openAIContentText(message["content"]),
+			}})
+		case "assistant":
+			blocks := openAIContentToAnthropicBlocks(message["content"])
+			for _, rawCall := range asSlice(message["tool_calls"]) {
+				call := asMap(rawCall)
+				function := asMap(call["function"])
+				blocks = append(blocks, map[string]any{
+					"type":  "tool_use",
+					"id":    call["id"],
+					"name":  function["name"],
+					"input": parseJSONObject(getStringValue(function["arguments"])),
+				})
+			}
+			messages = appendAnthropicMessage(messages, "assistant", blocks)
+		default:
+			messages = appendAnthropicMessage(messages, "user", openAIContentToAnthropicBlocks(message["content"]))
+		}
+	}
+	if len(systemTexts) > 0 {
+		out["system"] = strings.Join(systemTexts, "\n\n")
+	}
+	out["messages"] = messages
+
+	var tools []any
+	for _, rawTool := range asSlice(request["tools"]) {
+		function := asMap(asMap(rawTool)["function"])
+		if function == nil {
+			continue
+		}
+		schema := function["parameters"]
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		tool := map[string]any{"name": function["name"], "input_schema": schema}
+		if description, ok := function["description"]; ok {
+			tool["description"] = description
+		}
+		tools = append(tools, tool)
+	}
+	if len(tools) > 0 {
+		out["tools"] = tools
+	}
+	switch choice := request["tool_choice"].(type) {
+	case string:
+		switch choice {
+		case "auto":
+			out["tool_choice"] = map[string]any{"type": "auto"}
+		case "required":
+			out["tool_choice"] = map[string]any{"type": "any"}
+		case "none":
+			out["tool_choice"] = map[string]any{"type": "none"}
+		}
+	case map[string]any:
+		if name := getStringValue(asMap(choice["function"])["name"]); name != "" {
+			out["tool_choice"] = map[string]any{"type": "tool", "name": name}
+		}
+	}
+	return out
+}
+
+// ---- Gemini <-> OpenAI requests ----
+
+// cleanGeminiSchema drops JSON schema keywords Gemini rejects.
+func cleanGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		cleaned := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "$schema" || key == "additionalProperties" || key == "strict" {
+				continue
+			}
+			cleaned[key] = cleanGeminiSchema(value)
+		}
+		return cleaned
+	case []any:
+		cleaned := make([]any, len(v))
+		for i, value := range v {
+			cleaned[i] = cleanGeminiSchema(value)
+		}
+		return cleaned
+	}
+	return schema
+}
+
+func openAIContentToGeminiParts(content any) []any {
+	var parts []any
+	switch v := content.(type) {
+	case string:
+		if v != "" {
+			parts = append(parts, map[string]any{"text": v})
+		}
+	case []any:
+		for _, rawPart := range v {
+			part := asMap(rawPart)
+			switch getStringValue(part["type"]) {
+			case "text":
+				parts = append(parts, map[string]any{"text": part["text"]})
+			case "image_url":
+				url := getStringValue(asMap(part["image_url"])["url"])
+				if mimeType, data, ok := parseDataURL(url); ok {
+					parts = append(parts, map[string]any{"inlineData": map[string]any{"mimeType": mimeType, "data": data}})
+				} else if url != "" {
+					parts = append(parts, map[string]any{"fileData": map[string]any{"fileUri": url}})
+				}
+			}
+		}
+	}
+	return parts
+}
+
+func appendGeminiContent(contents []any, role string, parts []any) []any {
+	if len(parts) == 0 {
+		return contents
+	}
+	if len(contents) > 0 {
+		last := asMap(contents[len(contents)-1])
+		if getStringValue(last["role"]) == role {
+			last["parts"] = append(asSlice(last["parts"]), parts...)
+			return contents
+		}
+	}
+	return append(contents, map[string]any{"role": role, "parts": parts})
+}
+
+func openAIToGeminiRequest(request map[string]any) map[string]any {
+	out := map[string]any{}
+	contents := []any{}
+	var systemParts []any
+	toolNames := map[string]string{}
+	for _, raw := range asSlice(request["messages"]) {
+		message := asMap(raw)
+		if message == nil {
+			continue
+		}
+		switch getStringValue(message["role"]) {
+		case "system", "developer":
+			if text := openAIContentText(message["content"]); text != "" {
+				systemParts = append(systemParts, map[string]any{"text": text})
+			}
+		case "assistant":
+			parts := openAIContentToGeminiParts(message["content"])
+			for _, rawCall := range asSlice(message["tool_calls"]) {
+				call := asMap(rawCall)
+				function := asMap(call["function"])
+				name := getStringValue(function["name"])
+				toolNames[getStringValue(call["id"])] = name
+				parts = append(parts, map[string]any{"functionCall": map[string]any{
+					"name": name,
+					"args": parseJSONObject(getStringValue(function["arguments"])),
+				}})
+			}
+			contents = appendGeminiContent(contents, "model", parts)
+		case "tool":
+			contents = appendGeminiContent(contents, "user", []any{map[string]any{"functionResponse": map[string]any{
+				"name":     toolNames[getStringValue(message["tool_call_id"])],
+				"response": map[string]any{"content": openAIContentText(message["content"])},
+			}}})
+		default:
+			contents = appendGeminiContent(contents, "user", openAIContentToGeminiParts(message["content"]))
+		}
+	}
+	out["contents"] = contents
+	if len(systemParts) > 0 {
+		out["systemInstruction"] = map[string]any{"parts": systemParts}
+	}
+
+	generationConfig := map[string]any{}
+	copyFields(generationConfig, request, map[string]string{
+		"temperature":           "temperature",
+		"top_p":                 "topP",
+		"max_completion_tokens": "maxOutputTokens",
+	})
+	if maxTokens, ok := request["max_tokens"]; ok && maxTokens != nil {
+		generationConfig["maxOutputTokens"] = maxTokens
+	}
+	switch stop := request["stop"].(type) {
+	case string:
+		generationConfig["stopSequences"] = []any{stop}
+	case []any:
+		generationConfig["stopSequences"] = stop
+	}
+	if len(generationConfig) > 0 {
+		out["generationConfig"] = generationConfig
+	}
+
+	var declarations []any
+	for _, rawTool := range asSlice(request["tools"]) {
+		function := asMap(asMap(rawTool)["function"])
+		if function == nil {
+			continue
+		}
+		declaration := map[string]any{"name": function["name"]}
+		if description, ok := function["description"]; ok {
+			declaration["description"] = description
+		}
+		if parameters, ok := function["parameters"]; ok && parameters != nil {
+			declaration["parameters"] = cleanGeminiSchema(parameters)
+		}
+		declarations = append(declarations, declaration)
+	}
+	if len(declarations) > 0 {
+		out["tools"] = []any{map[string]any{"functionDeclarations": declarations}}
+	}
+	switch choice := request["tool_choice"].(type) {
+	case string:
+		modes := map[string]string{"auto": "AUTO", "required": "ANY", "none": "NONE"}
+		if mode, ok := modes[choice]; ok {
+			out["toolConfig"] = map[string]any{"functionCallingConfig": map[string]any{"mode": mode}}
+		}
+	case map[string]any:
+		if name := getStringValue(asMap(choice["function"])["name"]); name != "" {
+			out["toolConfig"] = map[string]any{"functionCallingConfig": map[string]any{
+				"mode": "ANY", "allowedFunctionNames": []any{name},
+			}}
+		}
+	}
+	return out
+}
+
+func geminiToOpenAIRequest(request map[string]any) map[string]any {
+	out := map[string]any{}
+	messages := []any{}
+	if system := geminiPartsText(asMap(request["systemInstruction"])["parts"]); system != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": system})
+	}
+
+	// Gemini matches function responses by name; OpenAI needs call ids.
+	pendingCalls := map[string][]string{}
+	callSeq := 0
+	for _, raw := range asSlice(request["contents"]) {
+		content := asMap(raw)
+		if content == nil {
+			continue
+		}
+		role := "user"
+		if getStringValue(content["role"]) == "model" {
+			role = "assistant"
+		}
+		var parts, toolCalls, toolResults []any
+		for _, rawPart := range asSlice(content["parts"]) {
+			part := asMap(rawPart)
+			switch {
+			case part["text"] != nil:
+				if thought, _ := part["thought"].(bool); !thought {
+					parts = append(parts, map[string]any{"type": "text", "text": part["text"]})
+				}
+			case part["inlineData"] != nil:
+				inline := asMap(part["inlineData"])
+				url := "data:" + getStringValue(inline["mimeType"]) + ";base64," + getStringValue(inline["data"])
+				parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+			case part["fileData"] != nil:
+				url := getStringValue(asMap(part["fileData"])["fileUri"])
+				parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+			case part["functionCall"] != nil:
+				call := asMap(part["functionCall"])
+				name := getStringValue(call["name"])
+				callSeq++
+				id := fmt.Sprintf("call_%d", callSeq)
+				pendingCalls[name] = append(pendingCalls[name], id)
+				toolCalls = append(toolCalls, map[string]any{
+					"id":       id,
+					"type":     "function",
+					"function": map[string]any{"name": name, "arguments": marshalJSONString(call["args"])},
+				})
+			case part["functionResponse"] != nil:
+				response := asMap(part["functionResponse"])
+				name := getStringValue(response["name"])
+				id := ""
+				if queue := pendingCalls[name]; len(queue) > 0 {
+					id, pendingCalls[name] = queue[0], queue[1:]
+				} else {
+					callSeq++
+					id = fmt.Sprintf("call_%d", callSeq)
+				}
+				toolResults = append(toolResults, map[string]any{
+					"role":         "tool",
+					"tool_call_id": id,
+					"content":      marshalJSONString(response["response"]),
+				})
+			}
+		}
+		messages = append(messages, toolResults...)
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		converted := map[string]any{"role": role, "content": simplifyOpenAIParts(parts)}
+		if len(toolCalls) > 0 {
+			converted["tool_calls"] = toolCalls
+		}
+		messages = append(messages, converted)
+	}
+	out["messages"] = messages
+
+	if config := asMap(request["generationConfig"]); config != nil {
+		copyFields(out, config, map[string]string{
+			"temperature":     "temperature",
+			"topP":            "top_p",
+			"maxOutputTokens": "max_tokens",
+			"stopSequences":   "stop",
+		})
+	}
+
+	var tools []any
+	for _, rawTool := range asSlice(request["tools"]) {
+		for _, rawDeclaration := range asSlice(asMap(rawTool)["functionDeclarations"]) {
+			declaration := asMap(rawDeclaration)
+			function := map[string]any{"name": declaration["name"]}
+			if description, ok := declaration["description"]; ok {
+				function["description"] = description
+			}
+			if parameters, ok := declaration["parameters"]; ok {
+				function["parameters"] = parameters
+			}
+			tools = append(tools, map[string]any{"type": "function", "function": function})
+		}
+	}
+	if len(tools) > 0 {
+		out["tools"] = tools
+	}
+	if config := asMap(asMap(request["toolConfig"])["functionCallingConfig"]); config != nil {
+		allowed := asSlice(config["allowedFunctionNames"])
+		switch strings.ToUpper(getStringValue(config["mode"])) {
+		case "AUTO":
+			out["tool_choice"] = "auto"
+		case "NONE":
+			out["tool_choice"] = "none"
+		case "ANY":
+			if len(allowed) == 1 {
+				out["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": allowed[0]}}
+			} else {
+				out["tool_choice"] = "required"
+			}
+		}
+	}
+	return out
+}
+
+func geminiPartsText(parts any) string {
+	var texts []string
+	for _, rawPart := range asSlice(parts) {
+		part := asMap(rawPart)
+		if text, ok := part["text"].(string); ok {
+			if thought, _ := part["thought"].(bool); !thought {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+// ---- Responses ----
+
+// chatResult is the format-neutral view of a chat completion.
+type chatResult struct {
+	Id           string
+	Model        string
+	Text         string
+	ToolCalls    []chatToolCall
+	FinishReason string // OpenAI vocabulary: stop, length, tool_calls, content_filter
+	Usage        chatUsage
+}
+
+type chatToolCall struct {
+	Id        string
+	Name      string
+	Arguments string
+}
+
+// chatUsage follows OpenAI semantics: PromptTokens includes cached tokens.
+type chatUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int
+}
+
+func anthropicUsageToChat(usage map[string]any) chatUsage {
+	cacheRead := getIntValue(usage["cache_read_input_tokens"])
+	return chatUsage{
+		PromptTokens:     getIntValue(usage["input_tokens"]) + cacheRead + getIntValue(usage["cache_creation_input_tokens"]),
+		CompletionTokens: getIntValue(usage["output_tokens"]),
+		CachedTokens:     cacheRead,
+	}
+}
+
+func geminiUsageToChat(usage map[string]any) chatUsage {
+	return chatUsage{
+		PromptTokens:     getIntValue(usage["promptTokenCount"]),
+		CompletionTokens: getIntValue(usage["candidatesTokenCount"]) + getIntValue(usage["thoughtsTokenCount"]),
+		CachedTokens:     getIntValue(usage["cachedContentTokenCount"]),
+	}
+}
+
+func openAIUsageToChat(usage map[string]any) chatUsage {
+	return chatUsage{
+		PromptTokens:     getIntValue(usage["prompt_tokens"]),
+		CompletionTokens: getIntValue(usage["completion_tokens"]),
+		CachedTokens:     getIntFromMap(usage, "prompt_tokens_details", "cached_tokens"),
+	}
+}
+
+func anthropicStopToFinish(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func finishToAnthropicStop(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+func geminiFinishToFinish(reason string, hasToolCalls bool) string {
+	switch strings.ToUpper(reason) {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func finishToGeminiFinish(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func parseChatResult(body []byte, format string) (chatResult, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return chatResult{}, err
+	}
+	result := chatResult{Id: getStringValue(payload["id"]), Model: getStringValue(payload["model"])}
+	switch format {
+	case relayFormatAnthropic:
+		for _, rawBlock := range asSlice(payload["content"]) {
+			block := asMap(rawBlock)
+			switch getStringValue(block["type"]) {
+			case "text":
+				result.Text += fmt.Sprint(block["text"])
+			case "tool_use":
+				result.ToolCalls = append(result.ToolCalls, chatToolCall{
+					Id:        getStringValue(block["id"]),
+					Name:      getStringValue(block["name"]),
+					Arguments: marshalJSONString(block["input"]),
+				})
+			}
+		}
+		result.FinishReason = anthropicStopToFinish(getStringValue(payload["stop_reason"]))
+		result.Usage = anthropicUsageToChat(asMap(payload["usage"]))
+	case relayFormatGemini:
+		result.Id = getStringValue(payload["responseId"])
+		result.Model = getStringValue(payload["modelVersion"])
+		candidates := asSlice(payload["candidates"])
+		finishReason := ""
+		if len(candidates) > 0 {
+			candidate := asMap(candidates[0])
+			finishReason = getStringValue(candidate["finishReason"])
+			for _, rawPart := range asSlice(asMap(candidate["content"])["parts"]) {
+				part := asMap(rawPart)
+				if call := asMap(part["functionCall"]); call != nil {
+					result.ToolCalls = append(result.ToolCalls, chatToolCall{
+						Id:        fmt.Sprintf("call_%d", len(result.ToolCalls)+1),
+						Name:      getStringValue(call["name"]),
+						Arguments: marshalJSONString(call["args"]),
+					})
+				}
+			}
+			result.Text = geminiPartsText(asMap(candidate["content"])["parts"])
+		}
+		result.FinishReason = geminiFinishToFinish(finishReason, len(result.ToolCalls) > 0)
+		result.Usage = geminiUsageToChat(asMap(payload["usageMetadata"]))
+	default:
+		choices := asSlice(payload["choices"])
+		if len(choices) > 0 {
+			choice := asMap(choices[0])
+			message := asMap(choice["message"])
+			result.Text = openAIContentText(message["content"])
+			for _, rawCall := range asSlice(message["tool_calls"]) {
+				call := asMap(rawCall)
+				function := asMap(call["function"])
+				result.ToolCalls = append(result.ToolCalls, chatToolCall{
+					Id:        getStringValue(call["id"]),
+					Name:      getStringValue(function["name"]),
+					Arguments: getStringValue(function["arguments"]),
+				})
+			}
+			result.FinishReason = getStringValue(choice["finish_reason"])
+		}
+		result.Usage = openAIUsageToChat(asMap(payload["usage"]))
+	}
+	return result, nil
+}
+
+func newChatResponseId(prefix string, id string) string {
+	if id != "" {
+		return id
+	}
+	return prefix + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+func renderChatResult(result chatResult, format string) map[string]any {
+	switch format {
+	case relayFormatAnthropic:
+		content := []any{}
+		if result.Text != "" {
+			content = append(content, map[string]any{"type": "text", "text": result.Text})
+		}
+		for _, call := range result.ToolCalls {
+			content = append(content, map[string]any{
+				"type":  "tool_use",
+				"id":    call.Id,
+				"name":  call.Name,
+				"input": parseJSONObject(call.Arguments),
+			})
+		}
+		return map[string]any{
+			"id":            newChatResponseId("msg_", result.Id),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         result.Model,
+			"content":       content,
+			"stop_reason":   finishToAnthropicStop(result.FinishReason),
+			"stop_sequence": nil,
+			"usage":         renderAnthropicUsage(result.Usage),
+		}
+	case relayFormatGemini:
+		parts := []any{}
+		if result.Text != "" {
+			parts = append(parts, map[string]any{"text": result.Text})
+		}
+		for _, call := range result.ToolCalls {
+			parts = append(parts, map[string]any{"functionCall": map[string]any{
+				"name": call.Name,
+				"args": parseJSONObject(call.Arguments),
+			}})
+		}
+		return map[string]any{
+			"candidates": []any{map[string]any{
+				"content":      map[string]any{"role": "model", "parts": parts},
+				"finishReason": finishToGeminiFinish(result.FinishReason),
+				"index":        0,
+			}},
+			"usageMetadata": renderGeminiUsage(result.Usage),
+			"modelVersion":  result.Model,
+		}
+	default:
+		message := map[string]any{"role": "assistant", "content": result.Text}
+		if len(result.ToolCalls) > 0 {
+			var toolCalls []any
+			for _, call := range result.ToolCalls {
+				toolCalls = append(toolCalls, map[string]any{
+					"id":       call.Id,
+					"type":     "function",
+					"function": map[string]any{"name": call.Name, "arguments": call.Arguments},
+				})
+			}
+			message["tool_calls"] = toolCalls
+			if result.Text == "" {
+				message["content"] = nil
+			}
+		}
+		return map[string]any{
+			"id":      newChatResponseId("chatcmpl-", result.Id),
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   result.Model,
+			"choices": []any{map[string]any{
+				"index":         0,
+				"message":       message,
+				"finish_reason": result.FinishReason,
+			}},
+			"usage": renderOpenAIUsage(result.Usage),
+		}
+	}
+}
+
+func renderOpenAIUsage(usage chatUsage) map[string]any {
+	rendered := map[string]any{
+		"prompt_tokens":     usage.PromptTokens,
+		"completion_tokens": usage.CompletionTokens,
+		"total_tokens":      usage.PromptTokens + usage.CompletionTokens,
+	}
+	if usage.CachedTokens > 0 {
+		rendered["prompt_tokens_details"] = map[string]any{"cached_tokens": usage.CachedTokens}
+	}
+	return rendered
+}
+
+func renderAnthropicUsage(usage chatUsage) map[string]any {
+	inputTokens := usage.PromptTokens - usage.CachedTokens
+	if inputTokens < 0 {
+		inputTokens = 0
+	}
+	rendered := map[string]any{"input_tokens": inputTokens, "output_tokens": usage.CompletionTokens}
+	if usage.CachedTokens > 0 {
+		rendered["cache_read_input_tokens"] = usage.CachedTokens
+	}
+	return rendered
+}
+
+func renderGeminiUsage(usage chatUsage) map[string]any {
+	rendered := map[string]any{
+		"promptTokenCount":     usage.PromptTokens,
+		"candidatesTokenCount": usage.CompletionTokens,
+		"totalTokenCount":      usage.PromptTokens + usage.CompletionTokens,
+	}
+	if usage.CachedTokens > 0 {
+		rendered["cachedContentTokenCount"] = usage.CachedTokens
+	}
+	return rendered
+}
+
+// convertResponseBody translates a non-streaming upstream response into the
+// client's format.
+func convertResponseBody(body []byte, from string, to string, modelName string) ([]byte, error) {
+	result, err := parseChatResult(body, from)
+	if err != nil {
+		return nil, err
+	}
+	if result.Model == "" {
+		result.Model = modelName
+	}
+	return json.Marshal(renderChatResult(result, to))
+}
+
+// convertErrorBody rewrites an upstream error payload into the client's error
+// shape, keeping the upstream message.
+func convertErrorBody(body []byte, statusCode int, to string) []byte {
+	info := extractUpstreamErrorInfo(body)
+	message := upstreamErrorText(info)
+	if message == "" {
+		message = strings.TrimSpace(string(body))
+	}
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return renderClientError(to, statusCode, info.Type, info.Code, message)
+}
+
+// renderClientError builds an error body in the given chat format.
+func renderClientError(format string, statusCode int, errorType string, code string, message string) []byte {
+	encoded, _ := json.Marshal(common.RenderRelayErrorBody(format, statusCode, errorType, code, message))
+	return encoded
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"NewAPI-Gateway/model"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSelectUpstreamFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    string
+		supported []string
+		want      string
+	}{
+		{"unknown capabilities passthrough", relayFormatAnthropic, nil, relayFormatAnthropic},
+		{"native support", relayFormatAnthropic, []string{"openai", "anthropic"}, relayFormatAnthropic},
+		{"openai only", relayFormatAnthropic, []string{"openai"}, relayFormatOpenAI},
+		{"gemini only", relayFormatOpenAI, []string{"gemini"}, relayFormatGemini},
+		{"non chat types passthrough", relayFormatOpenAI, []string{"jina-rerank"}, relayFormatOpenAI},
+		{"non chat path", "", []string{"openai"}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := selectUpstreamFormat(tc.client, tc.supported); got != tc.want {
+				t.Fatalf("selectUpstreamFormat = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConvertAnthropicRequestToOpenAI(t *testing.T) {
+	body := `{
+		"model":"claude-x","max_tokens":256,"system":[{"type":"text","text":"be brief"}],
+		"messages":[
+			{"role":"user","content":"weather?"},
+			{"role":"assistant","content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"sunny"},{"type":"text","text":"thanks"}]}
+		],
+		"tools":[{"name":"get_weather","description":"lookup","input_schema":{"type":"object"}}],
+		"tool_choice":{"type":"any"}
+	}`
+	converted, err := convertRequestBody([]byte(body), relayFormatAnthropic, relayFormatOpenAI, "gpt-x", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request struct {
+		Model         string           `json:"model"`
+		MaxTokens     int              `json:"max_tokens"`
+		Stream        bool             `json:"stream"`
+		StreamOptions map[string]any   `json:"stream_options"`
+		Messages      []map[string]any `json:"messages"`
+		Tools         []map[string]any `json:"tools"`
+		ToolChoice    any              `json:"tool_choice"`
+	}
+	if err := json.Unmarshal(converted, &request); err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "gpt-x" || request.MaxTokens != 256 || !request.Stream || request.StreamOptions["include_usage"] != true {
+		t.Fatalf("unexpected request envelope: %s", converted)
+	}
+	roles := []string{}
+	for _, message := range request.Messages {
+		roles = append(roles, message["role"].(string))
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,tool,user" {
+		t.Fatalf("unexpected roles %v in %s", roles, converted)
+	}
+	toolCalls := request.Messages[2]["tool_calls"].([]any)
+	function := toolCalls[0].(map[string]any)["function"].(map[string]any)
+	if function["name"] != "get_weather" || function["arguments"] != `{"city":"Paris"}` {
+		t.Fatalf("unexpected tool call: %#v", toolCalls)
+	}
+	if request.Messages[3]["tool_call_id"] != "toolu_1" || request.Messages[3]["content"] != "sunny" {
+		t.Fatalf("unexpected tool result: %#v", request.Messages[3])
+	}
+	if len(request.Tools) != 1 || request.ToolChoice != "required" {
+		t.Fatalf("unexpected tools: %s", converted)
+	}
+}
+
+func TestConvertOpenAIRequestToAnthropicMergesTurns(t *testing.T) {
+	body := `{
+		"model":"gpt-x","stop":"END",
+		"messages":[
+			{"role":"system","content":"sys"},
+			{"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]},
+			{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"a","arguments":"{\"x\":1}"}},{"id":"call_2","type":"function","function":{"name":"b","arguments":"{}"}}]},
+			{"role":"tool","tool_call_id":"call_1","content":"one"},
+			{"role":"tool","tool_call_id":"call_2","content":"two"}
+		]
+	}`
+	converted, err := convertRequestBody([]byte(body), relayFormatOpenAI, relayFormatAnthropic, "claude-x", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request struct {
+		MaxTokens     int              `json:"max_tokens"`
+		System        string           `json:"system"`
+		StopSequences []string         `json:"stop_sequences"`
+		Messages      []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(converted, &request); err != nil {
+		t.Fatal(err)
+	}
+	if request.MaxTokens != defaultAnthropicMaxTokens || request.System != "sys" || len(request.StopSequences) != 1 {
+		t.Fatalf("unexpected envelope: %s", converted)
+	}
+	if len(request.Messages) != 3 {
+		t.Fatalf("expected user/assistant/user turns, got %s", converted)
+	}
+	image := request.Messages[0]["content"].([]any)[1].(map[string]any)
+	if image["source"].(map[string]any)["media_type"] != "image/png" {
+		t.Fatalf("unexpected image block: %#v", image)
+	}
+	if results := request.Messages[2]["content"].([]any); len(results) != 2 {
+		t.Fatalf("expected both tool results merged into one user turn, got %#v", results)
+	}
+}
+
+func TestConvertOpenAIRequestToGemini(t *testing.T) {
+	body := `{"model":"gpt-x","max_tokens":64,"messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"},{"role":"assistant","tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},{"role":"tool","tool_call_id":"c1","content":"ok"}],"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object","additionalProperties":false}}}]}`
+	converted, err := convertRequestBody([]byte(body), relayFormatOpenAI, relayFormatGemini, "gemini-x", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(converted)
+	for _, want := range []string{`"systemInstruction"`, `"maxOutputTokens":64`, `"functionResponse":{"name":"f"`, `"role":"model"`} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %s in %s", want, text)
+		}
+	}
+	if strings.Contains(text, "additionalProperties") {
+		t.Fatalf("expected schema cleanup: %s", text)
+	}
+}
+
+func TestConvertResponseBodies(t *testing.T) {
+	anthropicBody := `{"id":"msg_1","model":"claude-x","content":[{"type":"text","text":"hi"},{"type":"tool_use","id":"toolu_1","name":"f","input":{"a":1}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":3}}`
+	converted, err := convertResponseBody([]byte(anthropicBody), relayFormatAnthropic, relayFormatOpenAI, "claude-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := extractUsageAndModelFromJSON(converted)
+	if usage.PromptTokens != 15 || usage.CompletionTokens != 3 || usage.CacheTokens != 5 {
+		t.Fatalf("unexpected usage %+v from %s", usage, converted)
+	}
+	if !strings.Contains(string(converted), `"finish_reason":"tool_calls"`) || !strings.Contains(string(converted), `"arguments":"{\"a\":1}"`) {
+		t.Fatalf("unexpected openai response: %s", converted)
+	}
+
+	openAIBody := `{"id":"chatcmpl-1","model":"gpt-x","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"length"}],"usage":{"prompt_tokens":7,"completion_tokens":2}}`
+	converted, err = convertResponseBody([]byte(openAIBody), relayFormatOpenAI, relayFormatAnthropic, "gpt-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]any
+	if err := json.Unmarshal(converted, &message); err != nil {
+		t.Fatal(err)
+	}
+	if message["type"] != "message" || message["stop_reason"] != "max_tokens" {
+		t.Fatalf("unexpected anthropic response: %s", converted)
+	}
+
+	geminiBody := `{"candidates":[{"content":{"role":"model","parts":[{"text":"yo"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":1},"modelVersion":"gemini-x"}`
+	if usage := extractUsageAndModelFromJSON([]byte(geminiBody)); usage.PromptTokens != 4 || usage.CompletionTokens != 1 {
+		t.Fatalf("expected usageMetadata to be extracted, got %+v", usage)
+	}
+	converted, err = convertResponseBody([]byte(geminiBody), relayFormatGemini, relayFormatOpenAI, "gemini-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(converted), `"content":"yo"`) {
+		t.Fatalf("unexpected openai response: %s", converted)
+	}
+}
+
+func feedStreamConverter(from string, to string, lines []string) string {
+	var out bytes.Buffer
+	converter := newStreamConverter(from, to, "m", &out)
+	for _, line := range lines {
+		converter.feed(line)
+	}
+	converter.finish()
+	return out.String()
+}
+
+func TestStreamConverterOpenAIToAnthropic(t *testing.T) {
+	out := feedStreamConverter(relayFormatOpenAI, relayFormatAnthropic, []string{
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":""}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"a\":1}"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"c1","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":4}}`,
+		`data: [DONE]`,
+	})
+	events := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_delta,content_block_stop,content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(events, ",") != want {
+		t.Fatalf("unexpected events %v\n%s", events, out)
+	}
+	if !strings.Contains(out, `"stop_reason":"tool_use"`) || !strings.Contains(out, `"output_tokens":4`) || !strings.Contains(out, `"partial_json":"{\"a\":1}"`) {
+		t.Fatalf("unexpected anthropic stream: %s", out)
+	}
+}
+
+func TestStreamConverterAnthropicToOpenAI(t *testing.T) {
+	out := feedStreamConverter(relayFormatAnthropic, relayFormatOpenAI, []string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`data: {"type":"content_block_stop","index":0}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+		`data: {"type":"message_stop"}`,
+	})
+	if !strings.Contains(out, `"content":"Hi"`) || !strings.Contains(out, `"finish_reason":"stop"`) {
+		t.Fatalf("unexpected openai stream: %s", out)
+	}
+	if !strings.Contains(out, `"prompt_tokens":12`) || !strings.Contains(out, `"completion_tokens":5`) || !strings.HasSuffix(out, "data: [DONE]\n\n") {
+		t.Fatalf("expected usage chunk and [DONE]: %s", out)
+	}
+}
+
+func TestStreamConverterGeminiToOpenAIAndBack(t *testing.T) {
+	out := feedStreamConverter(relayFormatGemini, relayFormatOpenAI, []string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"a"}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"b"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2}}`,
+	})
+	if !strings.Contains(out, `"content":"a"`) || !strings.Contains(out, `"content":"b"`) || !strings.Contains(out, `"prompt_tokens":3`) {
+		t.Fatalf("unexpected openai stream: %s", out)
+	}
+
+	out = feedStreamConverter(relayFormatOpenAI, relayFormatGemini, []string{
+		`data: {"choices":[{"index":0,"delta":{"content":"x"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`,
+	})
+	if !strings.Contains(out, `"text":"x"`) || !strings.Contains(out, `"finishReason":"STOP"`) || !strings.Contains(out, `"totalTokenCount":2`) {
+		t.Fatalf("unexpected gemini stream: %s", out)
+	}
+}
+
+func TestProxyTranslatesAnthropicClientToOpenAIOnlyUpstream(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	if err := model.DB.Create(&model.ModelPricing{ModelName: "gpt-4", ProviderId: 21, SupportedEndpointTypes: `["openai"]`}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var upstreamPath string
+	var upstreamBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		upstreamBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-alias","max_tokens":32,"system":"sys","messages":[{"role":"user","content":"ping"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("agg_token", &model.AggregatedToken{Id: 1, UserId: 1})
+	c.Set("request_model", "gpt-4")
+	c.Set("request_model_resolved", "gpt-4")
+
+	err := ProxyToUpstream(c, model.ModelRoute{Id: 1, ModelName: "gpt-4"}, &model.ProviderToken{Id: 401, SkKey: "sk"}, &model.Provider{Id: 21, BaseURL: upstream.URL})
+	if err != nil {
+		t.Fatalf("proxy attempt: %v", err)
+	}
+	if upstreamPath != "/v1/chat/completions" {
+		t.Fatalf("expected chat completions upstream path, got %s", upstreamPath)
+	}
+	if !strings.Contains(string(upstreamBody), `"role":"system"`) || !strings.Contains(string(upstreamBody), `"model":"gpt-4"`) {
+		t.Fatalf("unexpected upstream body: %s", upstreamBody)
+	}
+	var message struct {
+		Type    string           `json:"type"`
+		Content []map[string]any `json:"content"`
+		Usage   map[string]any   `json:"usage"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &message); err != nil {
+		t.Fatalf("decode client response: %v (%s)", err, recorder.Body.String())
+	}
+	if message.Type != "message" || len(message.Content) != 1 || message.Content[0]["text"] != "pong" {
+		t.Fatalf("unexpected client response: %s", recorder.Body.String())
+	}
+}
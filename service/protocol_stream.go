@@ -0,0 +1,409 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// streamConverter rewrites upstream SSE lines of one chat format into the
+// client's format. Upstream events are normalized into text deltas, tool call
+// deltas, a finish reason and usage, then rendered for the client.
+type streamConverter struct {
+	from  string
+	to    string
+	model string
+	w     io.Writer
+
+	id       string
+	created  int64
+	started  bool
+	finished bool
+
+	finishReason string
+	usage        chatUsage
+	sawToolCall  bool
+
+	// upstream state
+	anthropicToolIndex map[int]int
+	nextToolIndex      int
+
+	// anthropic client state
+	blockIndex  int
+	blockOpen   bool
+	blockIsText bool
+	openToolIdx int
+	toolBlocks  map[int]int
+
+	// gemini client state
+	pendingTools []chatToolCall
+}
+
+func newStreamConverter(from string, to string, modelName string, w io.Writer) *streamConverter {
+	return &streamConverter{
+		from:               from,
+		to:                 to,
+		model:              modelName,
+		w:                  w,
+		created:            time.Now().Unix(),
+		anthropicToolIndex: map[int]int{},
+		toolBlocks:         map[int]int{},
+		openToolIdx:        -1,
+	}
+}
+
+// feed consumes one upstream SSE line.
+func (s *streamConverter) feed(line string) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(trimmed, "data:"))
+	if data == "" || data == "[DONE]" {
+		return
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return
+	}
+	if errorText := upstreamErrorText(extractUpstreamErrorInfoFromPayload(payload)); payload["error"] != nil || getStringValue(payload["type"]) == "error" {
+		if errorText == "" {
+			errorText = "upstream stream error"
+		}
+		s.emitError(errorText)
+		return
+	}
+	switch s.from {
+	case relayFormatAnthropic:
+		s.feedAnthropic(payload)
+	case relayFormatGemini:
+		s.feedGemini(payload)
+	default:
+		s.feedOpenAI(payload)
+	}
+}
+
+func (s *streamConverter) mergeUsage(usage chatUsage) {
+	s.usage.PromptTokens = maxInt(s.usage.PromptTokens, usage.PromptTokens)
+	s.usage.CompletionTokens = maxInt(s.usage.CompletionTokens, usage.CompletionTokens)
+	s.usage.CachedTokens = maxInt(s.usage.CachedTokens, usage.CachedTokens)
+}
+
+func (s *streamConverter) feedOpenAI(payload map[string]any) {
+	if s.id == "" {
+		s.id = getStringValue(payload["id"])
+	}
+	if usage := asMap(payload["usage"]); usage != nil {
+		s.mergeUsage(openAIUsageToChat(usage))
+	}
+	choices := asSlice(payload["choices"])
+	if len(choices) == 0 {
+		return
+	}
+	choice := asMap(choices[0])
+	delta := asMap(choice["delta"])
+	if text, ok := delta["content"].(string); ok && text != "" {
+		s.emitText(text)
+	}
+	for _, rawCall := range asSlice(delta["tool_calls"]) {
+		call := asMap(rawCall)
+		function := asMap(call["function"])
+		index := getIntValue(call["index"])
+		if id, name := getStringValue(call["id"]), getStringValue(function["name"]); id != "" || name != "" {
+			s.emitToolStart(index, id, name)
+		}
+		if arguments, ok := function["arguments"].(string); ok && arguments != "" {
+			s.emitToolArgs(index, arguments)
+		}
+	}
+	if reason := getStringValue(choice["finish_reason"]); reason != "" {
+		s.finishReason = reason
+	}
+}
+
+func (s *streamConverter) feedAnthropic(payload map[string]any) {
+	switch getStringValue(payload["type"]) {
+	case "message_start":
+		message := asMap(payload["message"])
+		s.id = getStringValue(message["id"])
+		s.mergeUsage(anthropicUsageToChat(asMap(message["usage"])))
+	case "content_block_start":
+		block := asMap(payload["content_block"])
+		switch getStringValue(block["type"]) {
+		case "text":
+			if text := getStringValue(block["text"]); text != "" {
+				s.emitText(text)
+			}
+		case "tool_use":
+			toolIndex := s.nextToolIndex
+			s.nextToolIndex++
+			s.anthropicToolIndex[getIntValue(payload["index"])] = toolIndex
+			s.emitToolStart(toolIndex, getStringValue(block["id"]), getStringValue(block["name"]))
+		}
+	case "content_block_delta":
+		delta := asMap(payload["delta"])
+		switch getStringValue(delta["type"]) {
+		case "text_delta":
+			if text, ok := delta["text"].(string); ok && text != "" {
+				s.emitText(text)
+			}
+		case "input_json_delta":
+			if toolIndex, ok := s.anthropicToolIndex[getIntValue(payload["index"])]; ok {
+				if partial, _ := delta["partial_json"].(string); partial != "" {
+					s.emitToolArgs(toolIndex, partial)
+				}
+			}
+		}
+	case "message_delta":
+		if reason := getStringValue(asMap(payload["delta"])["stop_reason"]); reason != "" {
+			s.finishReason = anthropicStopToFinish(reason)
+		}
+		if usage := asMap(payload["usage"]); usage != nil {
+			s.mergeUsage(anthropicUsageToChat(usage))
+		}
+	}
+}
+
+func (s *streamConverter) feedGemini(payload map[string]any) {
+	if s.id == "" {
+		s.id = getStringValue(payload["responseId"])
+	}
+	if usage := asMap(payload["usageMetadata"]); usage != nil {
+		s.mergeUsage(geminiUsageToChat(usage))
+	}
+	candidates := asSlice(payload["candidates"])
+	if len(candidates) == 0 {
+		return
+	}
+	candidate := asMap(candidates[0])
+	for _, rawPart := range asSlice(asMap(candidate["content"])["parts"]) {
+		part := asMap(rawPart)
+		if call := asMap(part["functionCall"]); call != nil {
+			toolIndex := s.nextToolIndex
+			s.nextToolIndex++
+			s.emitToolStart(toolIndex, fmt.Sprintf("call_%d", toolIndex+1), getStringValue(call["name"]))
+			s.emitToolArgs(toolIndex, marshalJSONString(call["args"]))
+			continue
+		}
+		if text, ok := part["text"].(string); ok && text != "" {
+			if thought, _ := part["thought"].(bool); !thought {
+				s.emitText(text)
+			}
+		}
+	}
+	if reason := getStringValue(candidate["finishReason"]); reason != "" {
+		s.finishReason = geminiFinishToFinish(reason, s.sawToolCall)
+	}
+}
+
+// ---- client rendering ----
+
+func (s *streamConverter) writeData(payload any) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.w, "data: %s\n\n", encoded)
+}
+
+func (s *streamConverter) writeEvent(event string, payload any) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, encoded)
+}
+
+func (s *streamConverter) openAIChunk(delta map[string]any, finishReason any) map[string]any {
+	return map[string]any{
+		"id":      newChatResponseId("chatcmpl-", s.id),
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finishReason}},
+	}
+}
+
+func (s *streamConverter) ensureStarted() {
+	if s.started {
+		return
+	}
+	s.started = true
+	if s.id == "" {
+		s.id = newChatResponseId("", "")
+	}
+	switch s.to {
+	case relayFormatAnthropic:
+		s.writeEvent("message_start", map[string]any{
+			"type": "message_start",
+			"message": map[string]any{
+				"id":            "msg_" + strings.TrimPrefix(s.id, "msg_"),
+				"type":          "message",
+				"role":          "assistant",
+				"model":         s.model,
+				"content":       []any{},
+				"stop_reason":   nil,
+				"stop_sequence": nil,
+				"usage":         renderAnthropicUsage(s.usage),
+			},
+		})
+	case relayFormatOpenAI:
+		s.writeData(s.openAIChunk(map[string]any{"role": "assistant", "content": ""}, nil))
+	}
+}
+
+func (s *streamConverter) closeAnthropicBlock() {
+	if !s.blockOpen {
+		return
+	}
+	s.writeEvent("content_block_stop", map[string]any{"type": "content_block_stop", "index": s.blockIndex})
+	s.blockOpen = false
+	s.blockIndex++
+	s.openToolIdx = -1
+}
+
+func (s *streamConverter) emitText(text string) {
+	s.ensureStarted()
+	switch s.to {
+	case relayFormatAnthropic:
+		if !s.blockOpen || !s.blockIsText {
+			s.closeAnthropicBlock()
+			s.writeEvent("content_block_start", map[string]any{
+				"type":          "content_block_start",
+				"index":         s.blockIndex,
+				"content_block": map[string]any{"type": "text", "text": ""},
+			})
+			s.blockOpen, s.blockIsText = true, true
+		}
+		s.writeEvent("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": s.blockIndex,
+			"delta": map[string]any{"type": "text_delta", "text": text},
+		})
+	case relayFormatGemini:
+		s.writeData(map[string]any{
+			"candidates":   []any{map[string]any{"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": text}}}, "index": 0}},
+			"modelVersion": s.model,
+		})
+	default:
+		s.writeData(s.openAIChunk(map[string]any{"content": text}, nil))
+	}
+}
+
+func (s *streamConverter) emitToolStart(index int, id string, name string) {
+	s.ensureStarted()
+	s.sawToolCall = true
+	if id == "" {
+		id = fmt.Sprintf("call_%d", index+1)
+	}
+	switch s.to {
+	case relayFormatAnthropic:
+		s.closeAnthropicBlock()
+		s.writeEvent("content_block_start", map[string]any{
+			"type":          "content_block_start",
+			"index":         s.blockIndex,
+			"content_block": map[string]any{"type": "tool_use", "id": id, "name": name, "input": map[string]any{}},
+		})
+		s.blockOpen, s.blockIsText = true, false
+		s.openToolIdx = index
+		s.toolBlocks[index] = s.blockIndex
+	case relayFormatGemini:
+		s.pendingTools = append(s.pendingTools, chatToolCall{Id: id, Name: name})
+	default:
+		s.writeData(s.openAIChunk(map[string]any{"tool_calls": []any{map[string]any{
+			"index":    index,
+			"id":       id,
+			"type":     "function",
+			"function": map[string]any{"name": name, "arguments": ""},
+		}}}, nil))
+	}
+}
+
+func (s *streamConverter) emitToolArgs(index int, arguments string) {
+	switch s.to {
+	case relayFormatAnthropic:
+		blockIndex, ok := s.toolBlocks[index]
+		if !ok || index != s.openToolIdx {
+			return
+		}
+		s.writeEvent("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": blockIndex,
+			"delta": map[string]any{"type": "input_json_delta", "partial_json": arguments},
+		})
+	case relayFormatGemini:
+		if len(s.pendingTools) > 0 {
+			s.pendingTools[len(s.pendingTools)-1].Arguments += arguments
+		}
+	default:
+		s.writeData(s.openAIChunk(map[string]any{"tool_calls": []any{map[string]any{
+			"index":    index,
+			"function": map[string]any{"arguments": arguments},
+		}}}, nil))
+	}
+}
+
+func (s *streamConverter) emitError(message string) {
+	switch s.to {
+	case relayFormatAnthropic:
+		s.writeEvent("error", map[string]any{"type": "error", "error": map[string]any{"type": "api_error", "message": message}})
+	case relayFormatGemini:
+		s.writeData(map[string]any{"error": map[string]any{"code": 500, "message": message, "status": "INTERNAL"}})
+	default:
+		s.writeData(map[string]any{"error": map[string]any{"message": message, "type": "upstream_error"}})
+	}
+	s.finished = true
+}
+
+// finish emits the client's terminal events once the upstream stream ended
+// cleanly.
+func (s *streamConverter) finish() {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.ensureStarted()
+	finishReason := s.finishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	if s.sawToolCall && finishReason == "stop" {
+		finishReason = "tool_calls"
+	}
+	switch s.to {
+	case relayFormatAnthropic:
+		s.closeAnthropicBlock()
+		s.writeEvent("message_delta", map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": finishToAnthropicStop(finishReason), "stop_sequence": nil},
+			"usage": renderAnthropicUsage(s.usage),
+		})
+		s.writeEvent("message_stop", map[string]any{"type": "message_stop"})
+	case relayFormatGemini:
+		parts := []any{}
+		for _, call := range s.pendingTools {
+			parts = append(parts, map[string]any{"functionCall": map[string]any{"name": call.Name, "args": parseJSONObject(call.Arguments)}})
+		}
+		if len(parts) == 0 {
+			parts = append(parts, map[string]any{"text": ""})
+		}
+		s.writeData(map[string]any{
+			"candidates": []any{map[string]any{
+				"content":      map[string]any{"role": "model", "parts": parts},
+				"finishReason": finishToGeminiFinish(finishReason),
+				"index":        0,
+			}},
+			"usageMetadata": renderGeminiUsage(s.usage),
+			"modelVersion":  s.model,
+		})
+	default:
+		s.writeData(s.openAIChunk(map[string]any{}, finishReason))
+		usageChunk := s.openAIChunk(nil, nil)
+		usageChunk["choices"] = []any{}
+		usageChunk["usage"] = renderOpenAIUsage(s.usage)
+		s.writeData(usageChunk)
+		fmt.Fprint(s.w, "data: [DONE]\n\n")
+	}
+}
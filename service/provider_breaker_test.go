@@ -0,0 +1,81 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyToUpstreamTripsProviderBreakerOnEdgeErrors(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	oldBreaker := common.GlobalProviderBreaker
+	t.Cleanup(func() { common.GlobalProviderBreaker = oldBreaker })
+	common.GlobalProviderBreaker = common.NewProviderCircuitBreaker(func() common.ProviderBreakerConfig {
+		return common.ProviderBreakerConfig{Enabled: true, FailureThreshold: 2, Window: time.Minute, OpenDuration: time.Minute, MaxOpenDuration: time.Minute}
+	})
+
+	var calls int32
+	var mode atomic.Value
+	mode.Store("edge")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch mode.Load() {
+		case "app":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":{"message":"no available channel","type":"new_api_error"}}`))
+			return
+		case "ok":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(522)
+		_, _ = w.Write([]byte("<html>Connection timed out</html>"))
+	}))
+	defer upstream.Close()
+
+	route := model.ModelRoute{ModelName: "gpt-4", ProviderId: 93, ProviderTokenId: 903, Enabled: true}
+	token := &model.ProviderToken{Id: 903, ProviderId: 93}
+	provider := &model.Provider{Id: 93, Name: "breaker-provider", BaseURL: upstream.URL}
+	send := func() *ProxyAttemptError {
+		c, _ := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`)
+		return ProxyToUpstream(c, route, token, provider)
+	}
+
+	// A 2xx response restarts the count.
+	send()
+	mode.Store("ok")
+	send()
+	mode.Store("edge")
+	send()
+	if !common.GlobalProviderBreaker.IsProviderRoutable(93) {
+		t.Fatalf("expected a successful response to restart the failure count")
+	}
+
+	// JSON errors come from the NewAPI application: they neither count nor
+	// restart the count.
+	mode.Store("app")
+	send()
+	if !common.GlobalProviderBreaker.IsProviderRoutable(93) {
+		t.Fatalf("expected an application error not to count as an outage")
+	}
+	mode.Store("edge")
+	send()
+	if common.GlobalProviderBreaker.IsProviderRoutable(93) {
+		t.Fatalf("expected the application error to keep the earlier edge error counted")
+	}
+
+	proxyErr := send()
+	if proxyErr == nil || !proxyErr.CooldownRejected || !proxyErr.Retryable || proxyErr.RetryAfterSeconds != 60 {
+		t.Fatalf("expected the open breaker to reject the attempt locally, got %+v", proxyErr)
+	}
+	if got := atomic.LoadInt32(&calls); got != 5 {
+		t.Fatalf("expected no upstream call while open, got %d calls", got)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -48,6 +49,9 @@ var (
 	streamIdleTimeout = 3 * time.Minute
 )
 
+// requestDeadlineReason marks an attempt cut off by the retry policy deadline.
+const requestDeadlineReason = "request deadline exceeded"
+
 type ProxyAttemptError struct {
 	StatusCode int
 	Message    string
@@ -57,6 +61,13 @@ type ProxyAttemptError struct {
 	// and no upstream request was sent.
 	CooldownRejected  bool
 	RetryAfterSeconds int
+	// Saturated indicates a max-in-flight limit of the provider, token or route
+	// was reached; no upstream request was sent.
+	Saturated bool
+
+	// UpstreamStatus indicates StatusCode is the error status the upstream
+	// answered with, before any response was written to the client.
+	UpstreamStatus bool
 
 	// Upstream error details (when available).
 	UpstreamBody        []byte
@@ -100,24 +111,6 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 		resolvedModel = strings.TrimSpace(c.GetString("request_model"))
 	}
 
-	permit, retryAfter, ok := common.GlobalRouteCooldown.TryAcquireRouteAttempt(token.Id, resolvedModel)
-	if !ok {
-		retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
-		if retryAfterSeconds < 0 {
-			retryAfterSeconds = 0
-		}
-		return &ProxyAttemptError{
-			StatusCode:        0,
-			Message:           "route in cooldown",
-			Retryable:         true,
-			CooldownRejected:  true,
-			RetryAfterSeconds: retryAfterSeconds,
-		}
-	}
-	if permit != nil {
-		defer permit.Release()
-	}
-
 	// 1. Read original request body
 	bodyBytes, err := getRequestBodyBytes(c)
 	if err != nil {
@@ -134,13 +127,7 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 	if err != nil {
 		var invalidRequest *RouteSystemPromptInvalidRequestError
 		if errors.As(err, &invalidRequest) {
-			responseBody, _ := json.Marshal(map[string]any{
-				"error": map[string]any{
-					"message": invalidRequest.Error(),
-					"type":    "invalid_request_error",
-					"code":    "invalid_messages",
-				},
-			})
+			responseBody := renderClientError(detectRelayFormat(c.Request.URL.Path), http.StatusBadRequest, "invalid_request_error", "invalid_messages", invalidRequest.Error())
 			return &ProxyAttemptError{
 				StatusCode:          http.StatusBadRequest,
 				Message:             invalidRequest.Error(),
@@ -155,12 +142,102 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 			Retryable: true,
 		}
 	}
-	requestedStream := extractRequestedStream(bodyBytes)
+	requestedStream := extractRequestedStream(bodyBytes) || isGeminiStreamPath(c.Request.URL.Path)
+
+	// Serve byte-identical requests from the response cache before touching
+	// the route, so cooled-down routes can still answer from cache.
+	cacheLookup := newResponseCacheLookup(c, aggToken, resolvedModel, bodyBytes, requestedStream)
+	if cacheLookup != nil && cacheLookup.serve(c, aggToken, provider, token, requestId, startTime, requestedStream) {
+		return nil
+	}
+
+	// Admin route tests bypass the breaker and cooldown gates; their outcome
+	// is still recorded.
+	if !c.GetBool(routeTestContextKey) {
+		breakerPermit, breakerRetryAfter, ok := common.GlobalProviderBreaker.TryAcquire(provider.Id)
+		if !ok {
+			return &ProxyAttemptError{
+				StatusCode:        0,
+				Message:           "provider circuit open",
+				Retryable:         true,
+				CooldownRejected:  true,
+				RetryAfterSeconds: int(math.Ceil(breakerRetryAfter.Seconds())),
+			}
+		}
+		if breakerPermit != nil {
+			defer breakerPermit.Release()
+		}
+		permit, retryAfter, ok := common.GlobalRouteCooldown.TryAcquireRouteAttempt(token.Id, resolvedModel)
+		if !ok {
+			retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+			if retryAfterSeconds < 0 {
+				retryAfterSeconds = 0
+			}
+			return &ProxyAttemptError{
+				StatusCode:        0,
+				Message:           "route in cooldown",
+				Retryable:         true,
+				CooldownRejected:  true,
+				RetryAfterSeconds: retryAfterSeconds,
+			}
+		}
+		if permit != nil {
+			defer permit.Release()
+		}
+	}
+	releaseSlot, ok := common.GlobalRouteConcurrency.TryAcquire(routeConcurrencyLimits(route, token, provider))
+	if !ok {
+		common.ObserveRouteConcurrency("saturated")
+		return &ProxyAttemptError{
+			StatusCode: http.StatusTooManyRequests,
+			Message:    "route at max concurrency",
+			Retryable:  true,
+			Saturated:  true,
+		}
+	}
+	defer releaseSlot()
+
+	// Translate chat requests when the upstream does not serve the client's format.
+	upstreamPath := c.Request.URL.Path
+	upstreamQuery := stripGatewayKeyQuery(c.Request.URL.RawQuery)
+	clientFormat := detectRelayFormat(c.Request.URL.Path)
+	upstreamFormat := clientFormat
+	if clientFormat != "" {
+		upstreamFormat = selectUpstreamFormat(clientFormat, model.GetModelSupportedEndpointTypes(provider.Id, route.ModelName))
+	}
+	convertProtocol := upstreamFormat != clientFormat
+	upstreamModel := strings.TrimSpace(route.ModelName)
+	if upstreamModel == "" {
+		upstreamModel = resolvedModel
+	}
+	// A Gemini stream without alt=sse expects a JSON array, which a converted
+	// upstream stream cannot produce; it is sent upstream as a non-stream
+	// request and the converted response wrapped in an array.
+	geminiArrayResponse := convertProtocol && clientFormat == relayFormatGemini && requestedStream && !isGeminiSSEQuery(c.Request.URL.RawQuery)
+	if convertProtocol {
+		upstreamStream := requestedStream && !geminiArrayResponse
+		convertedBody, convertErr := convertRequestBody(bodyBytes, clientFormat, upstreamFormat, upstreamModel, upstreamStream)
+		if convertErr != nil {
+			return &ProxyAttemptError{
+				StatusCode:          http.StatusBadRequest,
+				Message:             convertErr.Error(),
+				Retryable:           false,
+				UpstreamBody:        renderClientError(clientFormat, http.StatusBadRequest, "invalid_request_error", "invalid_request", convertErr.Error()),
+				UpstreamContentType: "application/json",
+			}
+		}
+		bodyBytes = convertedBody
+		upstreamPath, upstreamQuery = upstreamPathForFormat(upstreamFormat, upstreamModel, upstreamStream)
+	} else if _, method, ok := ParseGeminiModelPath(upstreamPath); ok {
+		// Gemini native requests name the model in the path.
+		upstreamPath = geminiModelPath(upstreamModel, method)
+		bodyBytes = rewriteGeminiRequestModels(bodyBytes, method, upstreamModel)
+	}
 
 	// 2. Construct upstream URL
-	upstreamURL := strings.TrimRight(provider.BaseURL, "/") + c.Request.URL.Path
-	if c.Request.URL.RawQuery != "" {
-		upstreamURL += "?" + c.Request.URL.RawQuery
+	upstreamURL := strings.TrimRight(provider.BaseURL, "/") + upstreamPath
+	if upstreamQuery != "" {
+		upstreamURL += "?" + upstreamQuery
 	}
 
 	requestCtx := c.Request.Context()
@@ -168,6 +245,13 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 	var streamTimeoutReason atomic.Value
 	var streamMaxTimer *time.Timer
 	var streamIdleTimer *time.Timer
+	var deadlineTimer *time.Timer
+	deadline, hasDeadline := attemptDeadline(c)
+	if hasDeadline && !requestedStream {
+		var deadlineCancel context.CancelFunc
+		requestCtx, deadlineCancel = context.WithDeadline(requestCtx, deadline)
+		defer deadlineCancel()
+	}
 	if requestedStream {
 		requestCtx, streamCancel = context.WithCancel(requestCtx)
 		defer streamCancel()
@@ -182,6 +266,14 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 			streamIdleTimer = newStreamIdleTimer(streamIdleTimeout, streamCancel, &streamTimeoutReason)
 			defer streamIdleTimer.Stop()
 		}
+		// The request deadline cuts a stream off only until its first byte.
+		if hasDeadline {
+			deadlineTimer = time.AfterFunc(time.Until(deadline), func() {
+				streamTimeoutReason.Store(requestDeadlineReason)
+				streamCancel()
+			})
+			defer deadlineTimer.Stop()
+		}
 	}
 
 	// 3. Create upstream request
@@ -212,15 +304,17 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 	logProxyAuthDebug(c, req, requestId, provider, token)
 
 	// 6. Anthropic compatibility
-	if isAnthropicPath(c.Request.URL.Path) {
+	if isAnthropicPath(upstreamPath) {
 		req.Header.Set("x-api-key", token.SkKey)
 		if v := c.GetHeader("anthropic-version"); v != "" {
 			req.Header.Set("anthropic-version", v)
+		} else if convertProtocol {
+			req.Header.Set("anthropic-version", defaultAnthropicVersion)
 		}
 	}
 
 	// 7. Gemini compatibility
-	if isGeminiPath(c.Request.URL.Path) {
+	if isGeminiPath(upstreamPath) {
 		req.Header.Set("x-goog-api-key", token.SkKey)
 	}
 
@@ -236,6 +330,9 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 	resp, err := selectProxyHTTPClient(requestedStream).Do(req)
 	if err != nil {
 		timeoutReason := loadStreamTimeoutReason(&streamTimeoutReason)
+		if timeoutReason == "" && errors.Is(requestCtx.Err(), context.DeadlineExceeded) {
+			timeoutReason = requestDeadlineReason
+		}
 		errorText := err.Error()
 		if timeoutReason != "" {
 			errorText = timeoutReason + ": " + errorText
@@ -272,6 +369,9 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 		outcome := classifyProxyRequestError(err, c, timeoutReason)
 		if outcome.RecordRouteFailure {
 			common.GlobalRouteCooldown.RecordRouteFailure(token.Id, resolvedModel)
+			if timeoutReason == "" {
+				common.GlobalProviderBreaker.RecordFailure(provider.Id, err.Error())
+			}
 		}
 
 		return &ProxyAttemptError{
@@ -319,6 +419,12 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 		upstreamErr := extractUpstreamErrorInfo(respBody)
 		retryAfterSeconds := parseRetryAfterSeconds(resp.Header.Get("Retry-After"))
 
+		// Other error responses leave the breaker state alone; a half-open
+		// probe ending here only frees its slot.
+		if isProviderOutageResponse(resp, respBody) {
+			common.GlobalProviderBreaker.RecordFailure(provider.Id, fmt.Sprintf("upstream status %d: %s", resp.StatusCode, truncateBodyForLog(respBody, 200)))
+		}
+
 		if shouldMarkUnsupportedModel(resp.StatusCode, upstreamErr) {
 			common.GlobalRouteCooldown.MarkUnsupportedModel(token.Id, resolvedModel)
 		}
@@ -333,35 +439,51 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 		if isNonRetryableInvalidRequest(resp.StatusCode, upstreamErr) {
 			retryable = false
 		}
+		upstreamContentType := resp.Header.Get("Content-Type")
+		if convertProtocol {
+			respBody = convertErrorBody(respBody, resp.StatusCode, clientFormat)
+			upstreamContentType = "application/json"
+		}
 		return &ProxyAttemptError{
 			StatusCode:          resp.StatusCode,
 			Message:             "upstream request failed",
 			Retryable:           retryable,
+			UpstreamStatus:      true,
 			RetryAfterSeconds:   retryAfterSeconds,
 			UpstreamBody:        respBody,
-			UpstreamContentType: resp.Header.Get("Content-Type"),
+			UpstreamContentType: upstreamContentType,
 			UpstreamErrorCode:   upstreamErr.Code,
 			UpstreamErrorType:   upstreamErr.Type,
 		}
 	}
 
-	// 11. Copy response headers
-	for key, values := range resp.Header {
-		lowerKey := strings.ToLower(key)
-		// Skip hop-by-hop headers
-		if lowerKey == "transfer-encoding" || lowerKey == "connection" {
-			continue
-		}
-		for _, v := range values {
-			c.Writer.Header().Add(key, v)
-		}
-	}
+	common.GlobalProviderBreaker.RecordSuccess(provider.Id)
 
+	// 11. Write response
 	if responseIsStream {
-		// Stream SSE response
-		c.Writer.Header().Set("Cache-Control", "no-cache")
-		c.Writer.Header().Set("Connection", "keep-alive")
-		c.Status(resp.StatusCode)
+		// Stream SSE response. With stream failover enabled, output is held
+		// until the first content delta so a broken stream can be retried on
+		// the next route; headers are only copied once the stream is committed.
+		failoverCfg := common.LoadStreamFailoverConfig()
+		var firstContentTimer *time.Timer
+		out := newStreamResponseWriter(c, func() {
+			if firstContentTimer != nil {
+				firstContentTimer.Stop()
+			}
+			copyUpstreamResponseHeaders(c, resp.Header, convertProtocol)
+			c.Writer.Header().Set("Cache-Control", "no-cache")
+			c.Writer.Header().Set("Connection", "keep-alive")
+			c.Status(resp.StatusCode)
+		})
+		if !failoverCfg.Enabled {
+			out.commit()
+		} else if failoverCfg.FirstContentTimeout > 0 && streamCancel != nil {
+			firstContentTimer = time.AfterFunc(failoverCfg.FirstContentTimeout, func() {
+				streamTimeoutReason.Store("stream first content timeout")
+				streamCancel()
+			})
+			defer firstContentTimer.Stop()
+		}
 		flusher, ok := c.Writer.(http.Flusher)
 		scanner := bufio.NewScanner(resp.Body)
 		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
@@ -372,13 +494,24 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 		errorMsg := ""
 		streamCompleted := false
 		clientCanceled := false
+		var converter *streamConverter
+		if convertProtocol {
+			converter = newStreamConverter(upstreamFormat, clientFormat, resolvedModel, out)
+		}
 		for scanner.Scan() {
 			line := scanner.Text()
+			if deadlineTimer != nil {
+				deadlineTimer.Stop()
+			}
 			if streamIdleTimer != nil {
 				streamIdleTimer.Reset(streamIdleTimeout)
 			}
 			streamCapture.appendLine(line)
-			fmt.Fprintf(c.Writer, "%s\n", line)
+			if converter != nil {
+				converter.feed(line)
+			} else {
+				fmt.Fprintf(out, "%s\n", line)
+			}
 			eventCount++
 
 			if lineError := extractSSELineErrorMessage(line); lineError != "" && errorMsg == "" {
@@ -392,26 +525,22 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 			if hasData && firstTokenMs == 0 {
 				firstTokenMs = int(time.Since(startTime).Milliseconds())
 			}
-			if currentUsage.PromptTokens > streamUsage.PromptTokens {
-				streamUsage.PromptTokens = currentUsage.PromptTokens
-			}
-			if currentUsage.CompletionTokens > streamUsage.CompletionTokens {
-				streamUsage.CompletionTokens = currentUsage.CompletionTokens
-			}
-			if currentUsage.CacheTokens > streamUsage.CacheTokens {
-				streamUsage.CacheTokens = currentUsage.CacheTokens
-			}
-			if currentUsage.CostUSD > streamUsage.CostUSD {
-				streamUsage.CostUSD = currentUsage.CostUSD
-			}
-			if currentUsage.ModelName != "" {
-				streamUsage.ModelName = currentUsage.ModelName
+			mergeStreamUsage(&streamUsage, currentUsage)
+			if !out.committed {
+				if errorMsg != "" {
+					// Stop reading; the stream is retried on the next route.
+					break
+				}
+				if sseLineHasContent(line) || out.buffered() >= failoverCfg.MaxBufferBytes {
+					out.commit()
+				}
 			}
-			if ok {
+			if ok && out.committed {
 				flusher.Flush()
 			}
 		}
-		if scanErr := scanner.Err(); scanErr != nil {
+		scanErr := scanner.Err()
+		if scanErr != nil {
 			if reason := loadStreamTimeoutReason(&streamTimeoutReason); reason != "" {
 				errorMsg = appendStreamError(errorMsg, reason+": "+scanErr.Error())
 			} else if isClientCanceledError(scanErr, c) {
@@ -422,6 +551,16 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 			}
 		}
 		errorMsg = finalizeStreamError(errorMsg, eventCount, streamCompleted)
+		failover := !out.committed && shouldFailoverBufferedStream(errorMsg, clientCanceled, streamCompleted)
+		if converter != nil && scanErr == nil && !failover {
+			converter.finish()
+		}
+		if !failover && !clientCanceled {
+			out.commit()
+		}
+		if ok && out.committed {
+			flusher.Flush()
+		}
 		routeErrorMsg := errorMsg
 		if errorMsg != "" {
 			errorMsg = buildErrorMessage(errorMsg, c, bodyBytes)
@@ -451,6 +590,15 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 			ResponseBody:     []byte(streamCapture.String()),
 			ErrorMessage:     errorMsg,
 		})
+		if failover {
+			common.GlobalRouteCooldown.RecordRouteFailure(token.Id, resolvedModel)
+			common.SysLog(fmt.Sprintf("[relay-stream-failover] request_id=%s provider=%s token_id=%d: %s", requestId, provider.Name, token.Id, routeErrorMsg))
+			return &ProxyAttemptError{
+				StatusCode: http.StatusBadGateway,
+				Message:    "upstream stream failed before first content: " + routeErrorMsg,
+				Retryable:  true,
+			}
+		}
 		switch streamRouteOutcome(routeErrorMsg, clientCanceled, streamCompleted) {
 		case streamRouteOutcomeFailure:
 			common.GlobalRouteCooldown.RecordRouteFailure(token.Id, resolvedModel)
@@ -487,7 +635,9 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 				RequestBody:     bodyBytes,
 				ErrorMessage:    errorMsg,
 			})
-			common.GlobalRouteCooldown.RecordRouteFailure(token.Id, resolvedModel)
+			if !hedgeCancelled(c) {
+				common.GlobalRouteCooldown.RecordRouteFailure(token.Id, resolvedModel)
+			}
 			return &ProxyAttemptError{
 				StatusCode: http.StatusBadGateway,
 				Message:    "upstream response read failed: " + readErr.Error(),
@@ -505,14 +655,70 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 			logProxyErrorTrace(c, requestId, provider, token, errorMsg)
 		}
 
+		clientBody := respBody
+		if convertProtocol {
+			if errorMsg != "" {
+				clientBody = convertErrorBody(respBody, resp.StatusCode, clientFormat)
+			} else if converted, convertErr := convertResponseBody(respBody, upstreamFormat, clientFormat, resolvedModel); convertErr == nil {
+				clientBody = converted
+				if geminiArrayResponse {
+					clientBody = append(append([]byte("["), converted...), ']')
+				}
+			} else {
+				// Never hand the client a body in the upstream protocol; let
+				// the relay retry another route instead.
+				common.SysError(fmt.Sprintf("[relay-convert] request_id=%s %s->%s response conversion failed: %v", requestId, upstreamFormat, clientFormat, convertErr))
+				errorMsg = buildErrorMessage("upstream response conversion failed: "+convertErr.Error(), c, bodyBytes)
+				logProxyErrorTrace(c, requestId, provider, token, errorMsg)
+				usage := extractUsageAndModelFromJSON(respBody)
+				if usage.ModelName == "" {
+					usage.ModelName = c.GetString("request_model")
+				}
+				logUsage(
+					aggToken, provider, token, c, requestId,
+					usage, requestedStream, false, 0, int(time.Since(startTime).Milliseconds()), errorMsg,
+				)
+				captureLLMTrace(llmTraceInput{
+					AggToken:        aggToken,
+					Provider:        provider,
+					Token:           token,
+					Context:         c,
+					RequestId:       requestId,
+					ModelName:       usage.ModelName,
+					Method:          c.Request.Method,
+					Path:            c.Request.URL.Path,
+					StatusCode:      http.StatusBadGateway,
+					RequestedStream: requestedStream,
+					RequestBody:     bodyBytes,
+					ResponseBody:    respBody,
+					ErrorMessage:    errorMsg,
+				})
+				common.GlobalRouteCooldown.RecordRouteFailure(token.Id, resolvedModel)
+				message := "upstream response conversion failed: " + convertErr.Error()
+				return &ProxyAttemptError{
+					StatusCode:          http.StatusBadGateway,
+					Message:             message,
+					Retryable:           true,
+					UpstreamBody:        renderClientError(clientFormat, http.StatusBadGateway, "upstream_error", "response_conversion_failed", message),
+					UpstreamContentType: "application/json",
+				}
+			}
+		}
+		copyUpstreamResponseHeaders(c, resp.Header, convertProtocol)
+		if convertProtocol {
+			c.Writer.Header().Set("Content-Type", "application/json")
+		}
 		c.Status(resp.StatusCode)
-		_, _ = c.Writer.Write(respBody)
+		_, _ = c.Writer.Write(clientBody)
 
 		elapsed := time.Since(startTime).Milliseconds()
 		usage := extractUsageAndModelFromJSON(respBody)
 		if usage.ModelName == "" {
 			usage.ModelName = c.GetString("request_model")
 		}
+		if cacheLookup != nil && errorMsg == "" && resp.StatusCode == http.StatusOK {
+			cacheLookup.store(provider, resp.StatusCode, c.Writer.Header().Get("Content-Type"), clientBody, usage)
+		}
 		logUsage(
 			aggToken, provider, token, c, requestId,
 			usage, requestedStream, false, 0, int(elapsed), errorMsg,
@@ -542,6 +748,23 @@ func ProxyToUpstream(c *gin.Context, route model.ModelRoute, token *model.Provid
 	return nil
 }
 
+func copyUpstreamResponseHeaders(c *gin.Context, header http.Header, convertProtocol bool) {
+	for key, values := range header {
+		lowerKey := strings.ToLower(key)
+		// Skip hop-by-hop headers
+		if lowerKey == "transfer-encoding" || lowerKey == "connection" {
+			continue
+		}
+		// The body is rewritten, so the upstream length no longer applies.
+		if convertProtocol && lowerKey == "content-length" {
+			continue
+		}
+		for _, v := range values {
+			c.Writer.Header().Add(key, v)
+		}
+	}
+}
+
 type usageMetrics struct {
 	ModelName             string
 	PromptTokens          int
@@ -550,7 +773,18 @@ type usageMetrics struct {
 	CacheCreationTokens   int
 	CacheCreation5mTokens int
 	CacheCreation1hTokens int
+	// PromptExcludesCache is set for Anthropic usage, where input_tokens does
+	// not count cache reads and writes. Other formats include them.
+	PromptExcludesCache bool
+	// Audio and image tokens are part of the prompt/completion counts.
+	AudioPromptTokens     int
+	AudioCompletionTokens int
+	ImagePromptTokens     int
 	CostUSD               float64
+	// CacheHit marks a response served from the response cache; CostUSD is
+	// then forced to zero and CacheSavedUSD carries the avoided cost.
+	CacheHit      bool
+	CacheSavedUSD float64
 }
 
 func rewriteRequestModel(body []byte, targetModel string) []byte {
@@ -693,6 +927,26 @@ func getRequestBodyBytes(c *gin.Context) ([]byte, error) {
 	return bodyBytes, nil
 }
 
+// Relay context keys written by logUsage.
+const (
+	// relayCostContextKey accumulates the estimated cost of every attempt
+	// logged on a request context.
+	relayCostContextKey = "relay_cost_usd"
+	// relayFirstTokenContextKey holds the first token time of the last
+	// streamed attempt logged on a request context.
+	relayFirstTokenContextKey = "relay_first_token_ms"
+)
+
+// relayUsageTokensMu serializes updates of relay_usage_tokens, which hedged
+// flights merge into their parent context from their own goroutines.
+var relayUsageTokensMu sync.Mutex
+
+func addRelayUsageTokens(c *gin.Context, tokens int64) {
+	relayUsageTokensMu.Lock()
+	defer relayUsageTokensMu.Unlock()
+	c.Set("relay_usage_tokens", c.GetInt64("relay_usage_tokens")+tokens)
+}
+
 func logUsage(aggToken *model.AggregatedToken, provider *model.Provider, token *model.ProviderToken,
 	c *gin.Context, requestId string, usage usageMetrics, requestedStream bool, responseIsStream bool, firstTokenMs int,
 	responseTimeMs int, errorMsg string) {
@@ -704,18 +958,54 @@ func logUsage(aggToken *model.AggregatedToken, provider *model.Provider, token *
 
 	// Extract error key information
 	httpStatus, errorType, upstreamHost := extractErrorKeyInfo(errorMsg)
+	cancelledHedge := status == 0 && hedgeCancelled(c)
+	if cancelledHedge {
+		errorType = model.UsageLogErrorTypeHedgeCancelled
+	}
 
 	// Try to extract model from request path or body
 	if usage.ModelName == "" {
 		usage.ModelName = c.GetString("request_model")
 	}
-	if usage.CostUSD <= 0 {
-		usage.CostUSD = estimateUsageCostUSD(
-			provider.Id,
-			usage.ModelName,
-			usage.PromptTokens,
-			usage.CompletionTokens,
-		)
+	chargeback := 0.0
+	if usage.CacheHit {
+		usage.CostUSD = 0
+	} else {
+		if usage.CostUSD <= 0 {
+			usage.CostUSD = estimateUsageCostUSD(provider.Id, usage)
+		}
+		userGroup := ""
+		if user, ok := c.Get("user"); ok {
+			if u, ok := user.(*model.User); ok && u != nil {
+				userGroup = u.UserGroup
+			}
+		}
+		chargeback = chargebackUSD(provider.Id, usage, usage.CostUSD, userGroup)
+	}
+
+	if !usage.CacheHit && !cancelledHedge {
+		// Accumulated across attempts for per-token TPM accounting.
+		if consumed := int64(usage.PromptTokens + usage.CompletionTokens); consumed > 0 {
+			addRelayUsageTokens(c, consumed)
+		}
+		if usage.CostUSD > 0 {
+			c.Set(relayCostContextKey, c.GetFloat64(relayCostContextKey)+usage.CostUSD)
+		}
+		if firstTokenMs > 0 {
+			c.Set(relayFirstTokenContextKey, firstTokenMs)
+		}
+
+		common.ObserveRelayAttempt(usage.ModelName, provider.Name, status == 1, httpStatus, responseIsStream,
+			usage.PromptTokens, usage.CompletionTokens, responseTimeMs, firstTokenMs)
+		// Client errors say nothing about the speed or health of the route.
+		clientError := status == 0 && httpStatus >= 400 && httpStatus < 500 && httpStatus != http.StatusTooManyRequests
+		if token != nil && !clientError {
+			routeModel := strings.TrimSpace(c.GetString("request_model_resolved"))
+			if routeModel == "" {
+				routeModel = c.GetString("request_model")
+			}
+			common.GlobalRouteLatency.Observe(token.Id, routeModel, requestedStream, status == 1, responseTimeMs, firstTokenMs)
+		}
 	}
 
 	log := &model.UsageLog{
@@ -726,6 +1016,7 @@ func logUsage(aggToken *model.AggregatedToken, provider *model.Provider, token *
 		ProviderTokenId:       token.Id,
 		TokenGroupName:        strings.TrimSpace(token.GroupName),
 		ModelName:             usage.ModelName,
+		PromptTokens:          usage.PromptTokens,
 		CompletionTokens:      usage.CompletionTokens,
 		CacheTokens:           usage.CacheTokens,
 		CacheCreationTokens:   usage.CacheCreationTokens,
@@ -737,6 +1028,9 @@ func logUsage(aggToken *model.AggregatedToken, provider *model.Provider, token *
 		RequestedStream:       requestedStream,
 		ResponseIsStream:      responseIsStream,
 		CostUSD:               usage.CostUSD,
+		ChargebackUSD:         chargeback,
+		CacheHit:              usage.CacheHit,
+		CacheSavedUSD:         usage.CacheSavedUSD,
 		Status:                status,
 		ErrorMessage:          errorMsg,
 		ErrorHttpStatus:       httpStatus,
@@ -745,6 +1039,7 @@ func logUsage(aggToken *model.AggregatedToken, provider *model.Provider, token *
 		ClientIp:              c.ClientIP(),
 		UserAgent:             strings.TrimSpace(c.GetHeader("User-Agent")),
 		RequestId:             requestId,
+		Hedge:                 c.GetString(hedgeRoleContextKey),
 	}
 	go func() {
 		if err := log.Insert(); err != nil {
@@ -753,6 +1048,16 @@ func logUsage(aggToken *model.AggregatedToken, provider *model.Provider, token *
 	}()
 }
 
+// RequestedStream reports whether the client asked for a streaming response.
+// Unreadable bodies count as non-streaming.
+func RequestedStream(c *gin.Context) bool {
+	body, err := getRequestBodyBytes(c)
+	if err != nil {
+		return false
+	}
+	return extractRequestedStream(body) || isGeminiStreamPath(c.Request.URL.Path)
+}
+
 func extractRequestedStream(body []byte) bool {
 	if len(body) == 0 {
 		return false
@@ -1157,6 +1462,23 @@ func shouldTriggerRouteCooldown(statusCode int, upstreamErr upstreamErrorInfo) b
 	return false
 }
 
+// isProviderOutageResponse reports whether an error response came from the
+// site's edge rather than the NewAPI application: a gateway error or
+// Cloudflare challenge page without a JSON body.
+func isProviderOutageResponse(resp *http.Response, body []byte) bool {
+	if json.Valid(bytes.TrimSpace(body)) {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		520, 521, 522, 523, 524, 525, 526, 530:
+		return true
+	case http.StatusForbidden:
+		return isCloudflareChallenge(resp, body)
+	}
+	return false
+}
+
 func isNonRetryableInvalidRequest(statusCode int, upstreamErr upstreamErrorInfo) bool {
 	switch statusCode {
 	case 413, 422:
@@ -1395,6 +1717,9 @@ func extractUsageAndModelFromJSON(body []byte) usageMetrics {
 	if len(body) == 0 {
 		return usageMetrics{}
 	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return extractUsageFromGeminiArray(trimmed)
+	}
 	var payload map[string]interface{}
 	if err := json.Unmarshal(body, &payload); err != nil {
 		return usageMetrics{}
@@ -1410,6 +1735,18 @@ func extractUsageAndModelFromJSON(body []byte) usageMetrics {
 		out.ModelName = modelName
 	}
 	if usage == nil {
+		// Gemini reports usage as usageMetadata.
+		if metadata, ok := payload["usageMetadata"].(map[string]interface{}); ok {
+			geminiUsage := geminiUsageToChat(metadata)
+			out.PromptTokens = geminiUsage.PromptTokens
+			out.CompletionTokens = geminiUsage.CompletionTokens
+			out.CacheTokens = geminiUsage.CachedTokens
+			out.AudioPromptTokens = geminiModalityTokens(metadata["promptTokensDetails"], "AUDIO")
+			out.ImagePromptTokens = geminiModalityTokens(metadata["promptTokensDetails"], "IMAGE")
+			if out.ModelName == "" {
+				out.ModelName = getStringValue(payload["modelVersion"])
+			}
+		}
 		return out
 	}
 
@@ -1438,6 +1775,16 @@ func extractUsageAndModelFromJSON(body []byte) usageMetrics {
 	out.CacheCreation1hTokens = maxInt(out.CacheCreation1hTokens, getIntFromMap(usage, "cache_creation", "ephemeral_1h_input_tokens"))
 	cacheCreationSum := out.CacheCreation5mTokens + out.CacheCreation1hTokens
 	out.CacheCreationTokens = maxInt(out.CacheCreationTokens, cacheCreationSum)
+	_, hasAnthropicCacheRead := usage["cache_read_input_tokens"]
+	_, hasAnthropicCacheCreation := usage["cache_creation_input_tokens"]
+	out.PromptExcludesCache = hasAnthropicCacheRead || hasAnthropicCacheCreation
+
+	out.AudioPromptTokens = getIntFromMap(usage, "prompt_tokens_details", "audio_tokens")
+	out.AudioPromptTokens = maxInt(out.AudioPromptTokens, getIntFromMap(usage, "input_tokens_details", "audio_tokens"))
+	out.AudioCompletionTokens = getIntFromMap(usage, "completion_tokens_details", "audio_tokens")
+	out.AudioCompletionTokens = maxInt(out.AudioCompletionTokens, getIntFromMap(usage, "output_tokens_details", "audio_tokens"))
+	out.ImagePromptTokens = getIntFromMap(usage, "prompt_tokens_details", "image_tokens")
+	out.ImagePromptTokens = maxInt(out.ImagePromptTokens, getIntFromMap(usage, "input_tokens_details", "image_tokens"))
 
 	out.CostUSD = getFloatValue(usage["cost"])
 	if out.CostUSD == 0 {
@@ -1552,26 +1899,48 @@ func maxInt(a, b int) int {
 	return b
 }
 
-func estimateUsageCostUSD(providerId int, modelName string, promptTokens int, completionTokens int) float64 {
-	if modelName == "" {
-		return 0
-	}
-	pricing, err := model.GetModelPricingByProviderAndModel(providerId, modelName)
-	if err != nil || pricing == nil {
-		return 0
+func minInt(a, b int) int {
+	if a < b {
+		return a
 	}
-	if pricing.ModelPrice > 0 && promptTokens == 0 && completionTokens == 0 {
-		return pricing.ModelPrice
+	return b
+}
+
+// mergeStreamUsage folds the usage of one SSE event into the stream total.
+// Providers repeat or split counters across events (Anthropic sends input and
+// cache counts in message_start, output in message_delta), so keep the max.
+func mergeStreamUsage(total *usageMetrics, current usageMetrics) {
+	total.PromptTokens = maxInt(total.PromptTokens, current.PromptTokens)
+	total.CompletionTokens = maxInt(total.CompletionTokens, current.CompletionTokens)
+	total.CacheTokens = maxInt(total.CacheTokens, current.CacheTokens)
+	total.CacheCreationTokens = maxInt(total.CacheCreationTokens, current.CacheCreationTokens)
+	total.CacheCreation5mTokens = maxInt(total.CacheCreation5mTokens, current.CacheCreation5mTokens)
+	total.CacheCreation1hTokens = maxInt(total.CacheCreation1hTokens, current.CacheCreation1hTokens)
+	total.AudioPromptTokens = maxInt(total.AudioPromptTokens, current.AudioPromptTokens)
+	total.AudioCompletionTokens = maxInt(total.AudioCompletionTokens, current.AudioCompletionTokens)
+	total.ImagePromptTokens = maxInt(total.ImagePromptTokens, current.ImagePromptTokens)
+	total.PromptExcludesCache = total.PromptExcludesCache || current.PromptExcludesCache
+	if current.CostUSD > total.CostUSD {
+		total.CostUSD = current.CostUSD
+	}
+	if current.ModelName != "" {
+		total.ModelName = current.ModelName
 	}
-	modelRatio := pricing.ModelRatio
-	if modelRatio <= 0 {
+}
+
+// geminiModalityTokens sums the token counts of one modality in a Gemini
+// promptTokensDetails list.
+func geminiModalityTokens(details interface{}, modality string) int {
+	items, ok := details.([]interface{})
+	if !ok {
 		return 0
 	}
-	completionRatio := pricing.CompletionRatio
-	if completionRatio <= 0 {
-		completionRatio = 1
+	total := 0
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if ok && strings.EqualFold(getStringValue(entry["modality"]), modality) {
+			total += getIntValue(entry["tokenCount"])
+		}
 	}
-	inputCost := float64(promptTokens) * modelRatio / 500000.0
-	outputCost := float64(completionTokens) * modelRatio * completionRatio / 500000.0
-	return inputCost + outputCost
+	return total
 }
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseCacheablePaths are the endpoints whose non-streaming responses are
+// deterministic enough to replay for byte-identical requests.
+var responseCacheablePaths = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/embeddings":       true,
+}
+
+// responseCacheHitContextKey marks a request answered from the response cache.
+const responseCacheHitContextKey = "response_cache_hit"
+
+// ServedFromCache reports whether the response was written from the response
+// cache; no route served the request and no upstream was reached.
+func ServedFromCache(c *gin.Context) bool {
+	return c.GetBool(responseCacheHitContextKey)
+}
+
+type responseCacheLookup struct {
+	key string
+	cfg common.ResponseCacheConfig
+}
+
+// newResponseCacheLookup returns nil when the request is not cacheable: the
+// endpoint is not covered, the request streams, neither the token nor the
+// model opted in, or the client asked to bypass caches.
+func newResponseCacheLookup(c *gin.Context, aggToken *model.AggregatedToken, resolvedModel string, body []byte, requestedStream bool) *responseCacheLookup {
+	if requestedStream || c.Request.Method != http.MethodPost || !responseCacheablePaths[c.Request.URL.Path] {
+		return nil
+	}
+	cfg := common.LoadResponseCacheConfig()
+	if !aggToken.ResponseCacheEnabled && !cfg.ModelEnabled(resolvedModel) {
+		return nil
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return nil
+	}
+	key, ok := responseCacheKey(aggToken.UserId, c.Request.URL.Path, resolvedModel, body)
+	if !ok {
+		return nil
+	}
+	return &responseCacheLookup{key: key, cfg: cfg}
+}
+
+// responseCacheKey fingerprints the request after JSON normalization, so key
+// order and whitespace do not matter. Entries are scoped per user.
+func responseCacheKey(userId int, path string, resolvedModel string, body []byte) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil || payload == nil {
+		return "", false
+	}
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.New()
+	hash.Write([]byte(strconv.Itoa(userId)))
+	hash.Write([]byte{0})
+	hash.Write([]byte(path))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.ToLower(strings.TrimSpace(resolvedModel))))
+	hash.Write([]byte{0})
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// serve writes a cached response and logs it as a zero-cost cache hit.
+// Store errors are treated as misses.
+func (l *responseCacheLookup) serve(c *gin.Context, aggToken *model.AggregatedToken, provider *model.Provider, token *model.ProviderToken, requestId string, startTime time.Time, requestedStream bool) bool {
+	// Routes sharing the same effective body miss together; look up once.
+	missedKey := "response_cache_missed:" + l.key
+	if c.GetBool(missedKey) {
+		return false
+	}
+	entry, ok, err := common.GetResponseCacheStore().Get(l.key)
+	if err != nil {
+		common.ObserveResponseCache("error")
+		common.SysError(fmt.Sprintf("[response-cache] lookup failed: %v", err))
+		return false
+	}
+	if !ok {
+		c.Set(missedKey, true)
+		common.ObserveResponseCache("miss")
+		return false
+	}
+	common.ObserveResponseCache("hit")
+	c.Set(responseCacheHitContextKey, true)
+
+	if entry.ContentType != "" {
+		c.Writer.Header().Set("Content-Type", entry.ContentType)
+	}
+	c.Status(entry.StatusCode)
+	_, _ = c.Writer.Write(entry.Body)
+
+	modelName := entry.ModelName
+	if modelName == "" {
+		modelName = c.GetString("request_model")
+	}
+	logUsage(
+		aggToken, provider, token, c, requestId,
+		usageMetrics{
+			ModelName:        modelName,
+			PromptTokens:     entry.PromptTokens,
+			CompletionTokens: entry.CompletionTokens,
+			CacheHit:         true,
+			CacheSavedUSD:    entry.CostUSD,
+		},
+		requestedStream, false, 0, int(time.Since(startTime).Milliseconds()), "",
+	)
+	return true
+}
+
+// store saves a successful response as written to the client. Oversized
+// bodies are skipped.
+func (l *responseCacheLookup) store(provider *model.Provider, statusCode int, contentType string, body []byte, usage usageMetrics) {
+	if len(body) == 0 || len(body) > l.cfg.MaxEntryBytes {
+		return
+	}
+	costUSD := usage.CostUSD
+	if costUSD <= 0 {
+		costUSD = estimateUsageCostUSD(provider.Id, usage)
+	}
+	entry := &common.ResponseCacheEntry{
+		StatusCode:       statusCode,
+		ContentType:      contentType,
+		Body:             append([]byte(nil), body...),
+		ModelName:        usage.ModelName,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CostUSD:          costUSD,
+		CreatedAt:        time.Now().Unix(),
+	}
+	if err := common.GetResponseCacheStore().Set(l.key, entry, l.cfg.TTL, l.cfg.MaxEntries); err != nil {
+		common.ObserveResponseCache("error")
+		common.SysError(fmt.Sprintf("[response-cache] store failed: %v", err))
+		return
+	}
+	common.ObserveResponseCache("store")
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func useResponseCacheForTest(t *testing.T, options map[string]string) {
+	t.Helper()
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{}
+	for key, value := range options {
+		common.OptionMap[key] = value
+	}
+	common.OptionMapRWMutex.Unlock()
+	oldStore := common.GetResponseCacheStore()
+	common.SetResponseCacheStore(common.NewMemoryResponseCacheStore())
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+		common.SetResponseCacheStore(oldStore)
+	})
+}
+
+func newCountingJSONUpstream(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"cached answer"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`))
+	}))
+}
+
+// waitForUsageLogs waits for the asynchronous usage logs of one provider
+// token; logs of earlier tests may still land in the shared test DB.
+func waitForUsageLogs(t *testing.T, providerTokenId int, want int) []model.UsageLog {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var logs []model.UsageLog
+		if err := model.DB.Where("provider_token_id = ?", providerTokenId).Order("id asc").Find(&logs).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) >= want || time.Now().After(deadline) {
+			return logs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResponseCacheServesIdenticalRequestForOptedInToken(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	useResponseCacheForTest(t, nil)
+	var calls int32
+	upstream := newCountingJSONUpstream(&calls)
+	defer upstream.Close()
+	route := model.ModelRoute{ModelName: "gpt-4"}
+	provider := &model.Provider{Id: 1, Name: "p1", BaseURL: upstream.URL}
+
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"x"}],"temperature":0}`)
+	c.Set("agg_token", &model.AggregatedToken{Id: 1, UserId: 1, ResponseCacheEnabled: true})
+	if proxyErr := ProxyToUpstream(c, route, &model.ProviderToken{Id: 601}, provider); proxyErr != nil {
+		t.Fatalf("unexpected error: %v", proxyErr)
+	}
+	if ServedFromCache(c) {
+		t.Fatalf("expected the first request to reach the upstream")
+	}
+	first := recorder.Body.String()
+
+	// Same request with different key order and whitespace.
+	c, recorder = newRouteSystemPromptProxyContext(`{ "temperature":0, "messages":[{"content":"x","role":"user"}], "model":"gpt-4" }`)
+	c.Set("agg_token", &model.AggregatedToken{Id: 1, UserId: 1, ResponseCacheEnabled: true})
+	if proxyErr := ProxyToUpstream(c, route, &model.ProviderToken{Id: 601}, provider); proxyErr != nil {
+		t.Fatalf("unexpected error: %v", proxyErr)
+	}
+	if !ServedFromCache(c) {
+		t.Fatalf("expected the second request to be marked as served from cache")
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected a single upstream call, got %d", calls)
+	}
+	if recorder.Code != http.StatusOK || recorder.Body.String() != first || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected cached response: %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	logs := waitForUsageLogs(t, 601, 2)
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 usage logs, got %d", len(logs))
+	}
+	// Usage logs are inserted asynchronously, so their order is not fixed.
+	hit, miss := logs[0], logs[1]
+	if !hit.CacheHit {
+		hit, miss = miss, hit
+	}
+	if !hit.CacheHit || hit.CostUSD != 0 || hit.PromptTokens != 12 || hit.CompletionTokens != 3 || hit.Status != 1 {
+		t.Fatalf("unexpected cache hit log: %+v", hit)
+	}
+	if miss.CacheHit {
+		t.Fatalf("expected the first request to be a miss: %+v", miss)
+	}
+}
+
+func TestResponseCacheSkipsUnlessOptedIn(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	useResponseCacheForTest(t, map[string]string{"ResponseCacheModels": "gpt-4o"})
+	var calls int32
+	upstream := newCountingJSONUpstream(&calls)
+	defer upstream.Close()
+	provider := &model.Provider{Id: 1, BaseURL: upstream.URL}
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"x"}]}`
+
+	for i := 0; i < 2; i++ {
+		c, _ := newRouteSystemPromptProxyContext(body)
+		if proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 602}, provider); proxyErr != nil {
+			t.Fatalf("unexpected error: %v", proxyErr)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected uncached model to reach upstream twice, got %d", calls)
+	}
+
+	useResponseCacheForTest(t, map[string]string{"ResponseCacheModels": "gpt-4"})
+	for i := 0; i < 2; i++ {
+		c, _ := newRouteSystemPromptProxyContext(body)
+		if proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 602}, provider); proxyErr != nil {
+			t.Fatalf("unexpected error: %v", proxyErr)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected model opt-in to cache the second request, got %d calls", calls)
+	}
+
+	c, _ := newRouteSystemPromptProxyContext(body)
+	c.Request.Header.Set("Cache-Control", "no-cache")
+	if proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 602}, provider); proxyErr != nil {
+		t.Fatalf("unexpected error: %v", proxyErr)
+	}
+	if atomic.LoadInt32(&calls) != 4 {
+		t.Fatalf("expected Cache-Control: no-cache to bypass the cache, got %d calls", calls)
+	}
+}
+
+func TestResponseCacheKeyScopesUserAndModel(t *testing.T) {
+	body := []byte(`{"model":"m","input":"hello"}`)
+	base, ok := responseCacheKey(1, "/v1/embeddings", "m", body)
+	if !ok {
+		t.Fatal("expected JSON body to be cacheable")
+	}
+	if key, _ := responseCacheKey(2, "/v1/embeddings", "m", body); key == base {
+		t.Fatal("expected cache key to differ per user")
+	}
+	if key, _ := responseCacheKey(1, "/v1/embeddings", "m2", body); key == base {
+		t.Fatal("expected cache key to differ per resolved model")
+	}
+	if key, _ := responseCacheKey(1, "/v1/embeddings", "m", []byte(`{"input":"hello","model":"m"}`)); key != base {
+		t.Fatal("expected key order to be normalized")
+	}
+	if _, ok := responseCacheKey(1, "/v1/embeddings", "m", []byte(`not json`)); ok {
+		t.Fatal("expected invalid JSON to be uncacheable")
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons a RetryBudget stops the relay loop.
+const (
+	RetryStopMaxAttempts = "max_attempts"
+	RetryStopDeadline    = "deadline"
+)
+
+// retryDeadlineContextKey holds the time.Time at which the request deadline
+// cuts off the running attempt.
+const retryDeadlineContextKey = "retry_deadline"
+
+// RetryBudget applies the retry policy to one relay request across all its
+// routes and fallback models.
+type RetryBudget struct {
+	policy           common.RetryPolicy
+	start            time.Time
+	skippedProviders map[int]bool
+	stopReason       string
+}
+
+func NewRetryBudget(aggToken *model.AggregatedToken, modelName string) *RetryBudget {
+	return newRetryBudget(aggToken.RetryPolicyFor(modelName))
+}
+
+func newRetryBudget(policy common.RetryPolicy) *RetryBudget {
+	return &RetryBudget{
+		policy:           policy,
+		start:            time.Now(),
+		skippedProviders: make(map[int]bool),
+	}
+}
+
+// Exhausted reports whether no further attempt may start after
+// upstreamAttempts attempts reached the upstream.
+func (b *RetryBudget) Exhausted(upstreamAttempts int) bool {
+	if b.stopReason != "" {
+		return true
+	}
+	if b.policy.MaxAttempts > 0 && upstreamAttempts >= b.policy.MaxAttempts {
+		b.stopReason = RetryStopMaxAttempts
+	} else if b.policy.Deadline > 0 && time.Since(b.start) >= b.policy.Deadline {
+		b.stopReason = RetryStopDeadline
+	}
+	return b.stopReason != ""
+}
+
+// BindDeadline stores the deadline on the request so that ProxyToUpstream
+// bounds each attempt by it.
+func (b *RetryBudget) BindDeadline(c *gin.Context) {
+	if b.policy.Deadline > 0 {
+		c.Set(retryDeadlineContextKey, b.start.Add(b.policy.Deadline))
+	}
+}
+
+// attemptDeadline returns the deadline bound by BindDeadline, if any.
+func attemptDeadline(c *gin.Context) (time.Time, bool) {
+	value, ok := c.Get(retryDeadlineContextKey)
+	if !ok {
+		return time.Time{}, false
+	}
+	deadline, ok := value.(time.Time)
+	return deadline, ok
+}
+
+// StopReason returns RetryStopMaxAttempts or RetryStopDeadline once the
+// budget is exhausted, else "".
+func (b *RetryBudget) StopReason() string {
+	return b.stopReason
+}
+
+// Policy returns the policy in effect.
+func (b *RetryBudget) Policy() common.RetryPolicy {
+	return b.policy
+}
+
+// CanHedge reports whether two more upstream attempts fit the budget.
+func (b *RetryBudget) CanHedge(upstreamAttempts int) bool {
+	return b.policy.MaxAttempts <= 0 || upstreamAttempts+2 <= b.policy.MaxAttempts
+}
+
+// Wait sleeps for the backoff before the attempt following failedAttempts
+// upstream failures, ending early at the deadline. It returns false when the
+// client went away or the deadline passed.
+func (b *RetryBudget) Wait(c *gin.Context, failedAttempts int) bool {
+	delay := b.policy.BackoffBefore(failedAttempts)
+	if delay <= 0 {
+		return true
+	}
+	if b.policy.Deadline > 0 {
+		if remaining := b.policy.Deadline - time.Since(b.start); remaining < delay {
+			delay = remaining
+		}
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			return false
+		}
+	}
+	return !b.Exhausted(failedAttempts)
+}
+
+// Apply adjusts a failed attempt by the status rules: "never" makes it final,
+// "retry" makes it retryable and "other_provider" keeps it retryable but
+// excludes the attempt's provider from the rest of the request. Only error
+// statuses answered by the upstream are subject to the rules.
+func (b *RetryBudget) Apply(attempt model.RouteAttempt, proxyErr *ProxyAttemptError) {
+	if proxyErr == nil || !proxyErr.UpstreamStatus {
+		return
+	}
+	switch b.policy.RuleFor(proxyErr.StatusCode) {
+	case common.RetryRuleNever:
+		proxyErr.Retryable = false
+	case common.RetryRuleRetry:
+		proxyErr.Retryable = true
+	case common.RetryRuleOtherProvider:
+		proxyErr.Retryable = true
+		if attempt.Provider != nil {
+			b.skippedProviders[attempt.Provider.Id] = true
+		}
+	}
+}
+
+// Filter drops the attempts on providers excluded by an other_provider rule.
+func (b *RetryBudget) Filter(attempts []model.RouteAttempt) []model.RouteAttempt {
+	if len(b.skippedProviders) == 0 {
+		return attempts
+	}
+	kept := make([]model.RouteAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		if attempt.Provider != nil && b.skippedProviders[attempt.Provider.Id] {
+			continue
+		}
+		kept = append(kept, attempt)
+	}
+	return kept
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetAppliesStatusRulesToUpstreamErrors(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+
+	status := http.StatusTooManyRequests
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":{"message":"upstream error","type":"upstream_error"}}`))
+	}))
+	defer upstream.Close()
+
+	budget := newRetryBudget(common.RetryPolicy{
+		MaxAttempts: 3,
+		StatusRules: map[string]string{"429": common.RetryRuleOtherProvider, "5xx": common.RetryRuleNever},
+	})
+	first := model.RouteAttempt{
+		Route:    model.ModelRoute{ModelName: "gpt-4", ProviderId: 71, ProviderTokenId: 701, Enabled: true},
+		Token:    &model.ProviderToken{Id: 701, ProviderId: 71},
+		Provider: &model.Provider{Id: 71, Name: "retry-a", BaseURL: upstream.URL},
+	}
+	sameProvider := model.RouteAttempt{Route: model.ModelRoute{ProviderTokenId: 702}, Provider: first.Provider}
+	other := model.RouteAttempt{Route: model.ModelRoute{ProviderTokenId: 801}, Provider: &model.Provider{Id: 81}}
+
+	send := func() *ProxyAttemptError {
+		c, _ := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`)
+		proxyErr := ProxyToUpstream(c, first.Route, first.Token, first.Provider)
+		budget.Apply(first, proxyErr)
+		return proxyErr
+	}
+
+	proxyErr := send()
+	if proxyErr == nil || !proxyErr.UpstreamStatus || !proxyErr.Retryable {
+		t.Fatalf("expected retryable upstream 429, got %+v", proxyErr)
+	}
+	remaining := budget.Filter([]model.RouteAttempt{sameProvider, other})
+	if len(remaining) != 1 || remaining[0].Provider.Id != 81 {
+		t.Fatalf("expected other_provider to drop provider 71, got %+v", remaining)
+	}
+
+	status = http.StatusBadGateway
+	if proxyErr = send(); proxyErr == nil || proxyErr.Retryable {
+		t.Fatalf("expected 5xx never rule to make the error final, got %+v", proxyErr)
+	}
+
+	// Errors raised before reaching the upstream keep their own retryability.
+	local := &ProxyAttemptError{StatusCode: http.StatusBadGateway, Retryable: true}
+	budget.Apply(first, local)
+	if !local.Retryable {
+		t.Fatalf("expected status rules to skip local errors")
+	}
+
+	if budget.Exhausted(2) || !budget.CanHedge(1) || budget.CanHedge(2) {
+		t.Fatalf("unexpected budget before the limit")
+	}
+	if !budget.Exhausted(3) || budget.StopReason() != RetryStopMaxAttempts {
+		t.Fatalf("expected max attempts stop, got %q", budget.StopReason())
+	}
+}
+
+func TestRetryBudgetWaitStopsAtDeadline(t *testing.T) {
+	budget := newRetryBudget(common.RetryPolicy{
+		Deadline:   50 * time.Millisecond,
+		Backoff:    time.Second,
+		BackoffMax: time.Second,
+	})
+	c, _ := newRouteSystemPromptProxyContext(`{}`)
+
+	started := time.Now()
+	if budget.Wait(c, 1) {
+		t.Fatalf("expected the wait to end at the deadline")
+	}
+	if elapsed := time.Since(started); elapsed >= time.Second {
+		t.Fatalf("expected backoff clipped to the deadline, waited %s", elapsed)
+	}
+	if budget.StopReason() != RetryStopDeadline {
+		t.Fatalf("expected deadline stop, got %q", budget.StopReason())
+	}
+}
+
+func TestProxyToUpstreamCutsAttemptAtDeadline(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+			_, _ = w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	route := model.ModelRoute{ModelName: "gpt-4", ProviderId: 72, ProviderTokenId: 702, Enabled: true}
+	token := &model.ProviderToken{Id: 702, ProviderId: 72}
+	provider := &model.Provider{Id: 72, Name: "deadline", BaseURL: upstream.URL}
+	budget := newRetryBudget(common.RetryPolicy{Deadline: 100 * time.Millisecond})
+
+	c, _ := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`)
+	budget.BindDeadline(c)
+	started := time.Now()
+	proxyErr := ProxyToUpstream(c, route, token, provider)
+	if proxyErr == nil || !proxyErr.Retryable || !strings.Contains(proxyErr.Message, requestDeadlineReason) {
+		t.Fatalf("expected the attempt to be cut off at the deadline, got %+v", proxyErr)
+	}
+	if elapsed := time.Since(started); elapsed >= time.Second {
+		t.Fatalf("expected the attempt to end at the deadline, took %s", elapsed)
+	}
+
+	// A stream that sent its first byte runs past the deadline.
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	c.Request.Header.Set("Accept", "text/event-stream")
+	newRetryBudget(common.RetryPolicy{Deadline: 100 * time.Millisecond}).BindDeadline(c)
+	if proxyErr := ProxyToUpstream(c, route, token, provider); proxyErr != nil {
+		t.Fatalf("expected the stream to finish past the deadline, got %+v", proxyErr)
+	}
+	if !strings.Contains(recorder.Body.String(), "[DONE]") {
+		t.Fatalf("expected the full stream, got %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteAffinity pins a conversation to the route that served its previous
+// turn, so upstream prompt caches keep hitting the same key.
+type RouteAffinity struct {
+	session string
+	userId  int
+	cfg     common.RouteAffinityConfig
+}
+
+// NewRouteAffinity returns nil when affinity is disabled or no session can
+// be derived from the request.
+func NewRouteAffinity(c *gin.Context, aggToken *model.AggregatedToken) *RouteAffinity {
+	cfg := common.LoadRouteAffinityConfig()
+	if !cfg.Enabled {
+		return nil
+	}
+	headerValue := ""
+	if cfg.Header != "" {
+		headerValue = c.GetHeader(cfg.Header)
+	}
+	body, err := getRequestBodyBytes(c)
+	if err != nil {
+		return nil
+	}
+	session := routeAffinitySession(headerValue, body)
+	if session == "" {
+		return nil
+	}
+	return &RouteAffinity{session: session, userId: aggToken.UserId, cfg: cfg}
+}
+
+// routeAffinitySession identifies the conversation, in order of preference:
+// the session header, prompt_cache_key, metadata.user_id, or a hash of the
+// system prompt and the messages up to the first user message.
+func routeAffinitySession(headerValue string, body []byte) string {
+	if headerValue = strings.TrimSpace(headerValue); headerValue != "" {
+		return "header:" + headerValue
+	}
+	var payload struct {
+		PromptCacheKey    string            `json:"prompt_cache_key"`
+		Metadata          json.RawMessage   `json:"metadata"`
+		System            json.RawMessage   `json:"system"`
+		Instructions      json.RawMessage   `json:"instructions"`
+		SystemInstruction json.RawMessage   `json:"systemInstruction"`
+		Messages          []json.RawMessage `json:"messages"`
+		Contents          []json.RawMessage `json:"contents"`
+		Input             json.RawMessage   `json:"input"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	if key := strings.TrimSpace(payload.PromptCacheKey); key != "" {
+		return "prompt_cache_key:" + key
+	}
+	var metadata struct {
+		UserId string `json:"user_id"`
+	}
+	if len(payload.Metadata) > 0 && json.Unmarshal(payload.Metadata, &metadata) == nil {
+		if userId := strings.TrimSpace(metadata.UserId); userId != "" {
+			return "metadata:" + userId
+		}
+	}
+
+	messages := payload.Messages
+	if len(messages) == 0 {
+		messages = payload.Contents
+	}
+	if len(messages) == 0 && len(payload.Input) > 0 {
+		if err := json.Unmarshal(payload.Input, &messages); err != nil {
+			// A plain string input is a single user turn.
+			messages = []json.RawMessage{payload.Input}
+		}
+	}
+	leading := leadingMessagesThroughFirstUser(messages)
+	if len(leading) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, part := range [][]byte{payload.System, payload.Instructions, payload.SystemInstruction} {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+	for _, message := range leading {
+		hash.Write(message)
+		hash.Write([]byte{0})
+	}
+	return "messages:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// leadingMessagesThroughFirstUser returns the prefix every later turn of the
+// conversation repeats. Messages without a role count as user messages.
+func leadingMessagesThroughFirstUser(messages []json.RawMessage) []json.RawMessage {
+	for i, raw := range messages {
+		var message struct {
+			Role string `json:"role"`
+		}
+		_ = json.Unmarshal(raw, &message)
+		if message.Role == "" || strings.EqualFold(message.Role, "user") {
+			return messages[:i+1]
+		}
+	}
+	return nil
+}
+
+func (a *RouteAffinity) key(routingModel string) string {
+	hash := sha256.New()
+	hash.Write([]byte(strconv.Itoa(a.userId)))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.ToLower(strings.TrimSpace(routingModel))))
+	hash.Write([]byte{0})
+	hash.Write([]byte(a.session))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Prefer moves the route pinned for this session to the front. A pinned
+// route that is cooling down or no longer selectable is absent from attempts;
+// the order is kept and the session is re-pinned by the next success.
+func (a *RouteAffinity) Prefer(routingModel string, attempts []model.RouteAttempt) []model.RouteAttempt {
+	if a == nil || len(attempts) == 0 {
+		return attempts
+	}
+	pin, ok, err := common.GetRouteAffinityStore().Get(a.key(routingModel))
+	if err != nil {
+		common.ObserveRouteAffinity("error")
+		common.SysError(fmt.Sprintf("[route-affinity] lookup failed: %v", err))
+		return attempts
+	}
+	if !ok {
+		common.ObserveRouteAffinity("miss")
+		return attempts
+	}
+	for i, attempt := range attempts {
+		if attempt.Route.ProviderTokenId != pin.ProviderTokenId || attempt.Route.ModelName != pin.ModelName {
+			continue
+		}
+		common.ObserveRouteAffinity("hit")
+		if i == 0 {
+			return attempts
+		}
+		ordered := make([]model.RouteAttempt, 0, len(attempts))
+		ordered = append(ordered, attempt)
+		ordered = append(ordered, attempts[:i]...)
+		return append(ordered, attempts[i+1:]...)
+	}
+	common.ObserveRouteAffinity("unavailable")
+	return attempts
+}
+
+// Pin records the route that served this turn and refreshes the expiry.
+func (a *RouteAffinity) Pin(routingModel string, route model.ModelRoute) {
+	if a == nil {
+		return
+	}
+	pin := common.RouteAffinityPin{ProviderTokenId: route.ProviderTokenId, ModelName: route.ModelName}
+	if err := common.GetRouteAffinityStore().Set(a.key(routingModel), pin, a.cfg.TTL); err != nil {
+		common.ObserveRouteAffinity("error")
+		common.SysError(fmt.Sprintf("[route-affinity] store failed: %v", err))
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"testing"
+	"time"
+)
+
+func TestRouteAffinitySessionIsStableAcrossTurns(t *testing.T) {
+	firstTurn := []byte(`{"model":"claude","system":"be brief","messages":[{"role":"user","content":"hi"}]}`)
+	laterTurn := []byte(`{"model":"claude","system":"be brief","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"more"}]}`)
+	otherChat := []byte(`{"model":"claude","system":"be brief","messages":[{"role":"user","content":"bye"}]}`)
+
+	first := routeAffinitySession("", firstTurn)
+	if first == "" || first != routeAffinitySession("", laterTurn) {
+		t.Fatalf("expected turns of one conversation to share a session, got %q and %q", first, routeAffinitySession("", laterTurn))
+	}
+	if first == routeAffinitySession("", otherChat) {
+		t.Fatalf("expected different conversations to get different sessions")
+	}
+	if got := routeAffinitySession(" s-1 ", firstTurn); got != "header:s-1" {
+		t.Fatalf("expected the header to win, got %q", got)
+	}
+	if got := routeAffinitySession("", []byte(`{"prompt_cache_key":"k","metadata":{"user_id":"u"}}`)); got != "prompt_cache_key:k" {
+		t.Fatalf("expected prompt_cache_key to win over metadata, got %q", got)
+	}
+	if got := routeAffinitySession("", []byte(`{"metadata":{"user_id":"u"},"messages":[{"role":"user","content":"hi"}]}`)); got != "metadata:u" {
+		t.Fatalf("expected metadata.user_id, got %q", got)
+	}
+	if got := routeAffinitySession("", []byte(`{"input":[]}`)); got != "" {
+		t.Fatalf("expected no session without messages, got %q", got)
+	}
+}
+
+func TestRouteAffinityPrefersPinnedRouteAndRepins(t *testing.T) {
+	previous := common.GetRouteAffinityStore()
+	common.SetRouteAffinityStore(common.NewMemoryRouteAffinityStore(10))
+	t.Cleanup(func() { common.SetRouteAffinityStore(previous) })
+
+	affinity := &RouteAffinity{session: "header:s-1", userId: 1, cfg: common.RouteAffinityConfig{Enabled: true, TTL: time.Hour}}
+	attempts := []model.RouteAttempt{
+		{Route: model.ModelRoute{ProviderTokenId: 1, ModelName: "gpt-4o"}},
+		{Route: model.ModelRoute{ProviderTokenId: 2, ModelName: "gpt-4o"}},
+		{Route: model.ModelRoute{ProviderTokenId: 3, ModelName: "gpt-4o"}},
+	}
+	if got := affinity.Prefer("gpt-4o", attempts); got[0].Route.ProviderTokenId != 1 {
+		t.Fatalf("expected the order to be kept without a pin")
+	}
+
+	affinity.Pin("gpt-4o", attempts[2].Route)
+	got := affinity.Prefer("gpt-4o", attempts)
+	if got[0].Route.ProviderTokenId != 3 || got[1].Route.ProviderTokenId != 1 || got[2].Route.ProviderTokenId != 2 {
+		t.Fatalf("expected the pinned route first, got %+v", got)
+	}
+	other := &RouteAffinity{session: "header:s-1", userId: 2, cfg: affinity.cfg}
+	if got := other.Prefer("gpt-4o", attempts); got[0].Route.ProviderTokenId != 1 {
+		t.Fatalf("expected pins to be scoped per user")
+	}
+
+	// The pinned route is cooling down and missing from the plan.
+	cooling := attempts[:2]
+	if got := affinity.Prefer("gpt-4o", cooling); got[0].Route.ProviderTokenId != 1 {
+		t.Fatalf("expected the order to be kept when the pinned route is unavailable")
+	}
+	affinity.Pin("gpt-4o", cooling[1].Route)
+	if got := affinity.Prefer("gpt-4o", attempts); got[0].Route.ProviderTokenId != 2 {
+		t.Fatalf("expected the session to be re-pinned, got %+v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeConcurrencyLimits returns the max-in-flight limits an attempt counts
+// against: its provider, provider token and model route.
+func routeConcurrencyLimits(route model.ModelRoute, token *model.ProviderToken, provider *model.Provider) []common.ConcurrencyLimit {
+	return []common.ConcurrencyLimit{
+		{Key: "provider:" + strconv.Itoa(provider.Id), Max: provider.MaxConcurrency},
+		{Key: "token:" + strconv.Itoa(token.Id), Max: token.MaxConcurrency},
+		{Key: "route:" + strconv.Itoa(route.Id), Max: route.MaxConcurrency},
+	}
+}
+
+// ConcurrencyQueue lets one relay request wait for a saturated route. The
+// timeout covers every wait of the request together.
+type ConcurrencyQueue struct {
+	cfg      common.ConcurrencyQueueConfig
+	deadline time.Time
+}
+
+func NewConcurrencyQueue() *ConcurrencyQueue {
+	return &ConcurrencyQueue{cfg: common.LoadConcurrencyQueueConfig()}
+}
+
+// Wait blocks until one of the saturated attempts has capacity and returns its
+// index. On failure it returns the error to report to the client.
+func (q *ConcurrencyQueue) Wait(c *gin.Context, saturated []model.RouteAttempt) (int, *ProxyAttemptError) {
+	if q.deadline.IsZero() {
+		q.deadline = time.Now().Add(q.cfg.Timeout)
+		common.ObserveRouteConcurrency("queued")
+	}
+	candidates := make([][]common.ConcurrencyLimit, len(saturated))
+	for i, attempt := range saturated {
+		candidates[i] = routeConcurrencyLimits(attempt.Route, attempt.Token, attempt.Provider)
+	}
+	index, err := common.GlobalRouteConcurrency.Wait(c.Request.Context(), candidates, q.deadline, q.cfg.Size)
+	if err == nil {
+		return index, nil
+	}
+	switch {
+	case errors.Is(err, common.ErrConcurrencyQueueFull):
+		common.ObserveRouteConcurrency("queue_full")
+	case errors.Is(err, common.ErrConcurrencyQueueTimeout):
+		common.ObserveRouteConcurrency("queue_timeout")
+	}
+	return -1, &ProxyAttemptError{
+		StatusCode:        http.StatusTooManyRequests,
+		Message:           "all routes are at max concurrency: " + err.Error(),
+		Retryable:         true,
+		Saturated:         true,
+		RetryAfterSeconds: 1,
+	}
+}
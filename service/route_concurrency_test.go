@@ -0,0 +1,51 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProxyRejectsSaturatedTokenWithoutCallingUpstream(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	oldLimiter := common.GlobalRouteConcurrency
+	common.GlobalRouteConcurrency = common.NewConcurrencyLimiter()
+	t.Cleanup(func() { common.GlobalRouteConcurrency = oldLimiter })
+
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	route := model.ModelRoute{Id: 7, ModelName: "gpt-4"}
+	token := &model.ProviderToken{Id: 801, MaxConcurrency: 1}
+	provider := &model.Provider{Id: 81, BaseURL: upstream.URL}
+	release, ok := common.GlobalRouteConcurrency.TryAcquire(routeConcurrencyLimits(route, token, provider))
+	if !ok {
+		t.Fatal("holding the only slot should succeed")
+	}
+
+	c, _ := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`)
+	proxyErr := ProxyToUpstream(c, route, token, provider)
+	if proxyErr == nil || !proxyErr.Saturated || !proxyErr.Retryable || calls.Load() != 0 {
+		t.Fatalf("error = %#v, upstream calls = %d", proxyErr, calls.Load())
+	}
+
+	release()
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`)
+	if proxyErr := ProxyToUpstream(c, route, token, provider); proxyErr != nil {
+		t.Fatalf("attempt after release: %#v", proxyErr)
+	}
+	if recorder.Code != http.StatusOK || calls.Load() != 1 {
+		t.Fatalf("status = %d, upstream calls = %d", recorder.Code, calls.Load())
+	}
+	if got := common.GlobalRouteConcurrency.InFlight("token:801"); got != 0 {
+		t.Fatalf("slot not released after the attempt, in flight = %d", got)
+	}
+}
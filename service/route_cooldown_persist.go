@@ -0,0 +1,95 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var routeCooldownSnapshotLock sync.Mutex
+
+// SnapshotRouteCooldowns saves the in-memory route cooldown state to the
+// database so a restart does not forget routes known to be broken. Shared
+// (Redis) stores outlive the process and are not snapshotted.
+func SnapshotRouteCooldowns() {
+	if common.GlobalRouteCooldown.SharedStore() {
+		return
+	}
+	routeCooldownSnapshotLock.Lock()
+	defer routeCooldownSnapshotLock.Unlock()
+	snapshot, err := common.GlobalRouteCooldown.Snapshot()
+	if err != nil {
+		common.SysError("[route-cooldown] snapshot failed: " + err.Error())
+		return
+	}
+	now := time.Now().Unix()
+	states := make([]model.RouteCooldownState, 0, len(snapshot.Routes)+len(snapshot.Tokens)+len(snapshot.Unsupported))
+	for _, item := range snapshot.Routes {
+		states = append(states, routeCooldownStateFromRecord(common.RouteCooldownKindRoute, item.ProviderTokenId, item.ModelName, item.Record, now))
+	}
+	for _, item := range snapshot.Tokens {
+		states = append(states, routeCooldownStateFromRecord(common.RouteCooldownKindToken, item.ProviderTokenId, "", item.Record, now))
+	}
+	for _, item := range snapshot.Unsupported {
+		states = append(states, routeCooldownStateFromRecord(common.RouteCooldownKindUnsupported, item.ProviderTokenId, item.ModelName, common.RouteCooldownRecord{CooldownUntil: item.Until}, now))
+	}
+	if err := model.ReplaceRouteCooldownStates(states); err != nil {
+		common.SysError("[route-cooldown] failed to save snapshot: " + err.Error())
+	}
+}
+
+// RestoreRouteCooldowns loads the last snapshot into the in-memory store. Its
+// expiry times are absolute, so time spent offline counts toward cooldowns.
+func RestoreRouteCooldowns() {
+	if common.GlobalRouteCooldown.SharedStore() {
+		return
+	}
+	states, err := model.GetRouteCooldownStates()
+	if err != nil {
+		common.SysError("[route-cooldown] failed to load snapshot: " + err.Error())
+		return
+	}
+	if len(states) == 0 {
+		return
+	}
+	snapshot := common.RouteCooldownSnapshot{}
+	for _, state := range states {
+		record := common.RouteCooldownRecord{
+			ConsecutiveFailures: state.ConsecutiveFailures,
+			CooldownUntil:       time.Unix(state.CooldownUntil, 0),
+		}
+		if state.LastFailureTime > 0 {
+			record.LastFailureTime = time.Unix(state.LastFailureTime, 0)
+		}
+		switch state.Kind {
+		case common.RouteCooldownKindRoute:
+			snapshot.Routes = append(snapshot.Routes, common.RouteCooldownRouteItem{ProviderTokenId: state.ProviderTokenId, ModelName: state.ModelName, Record: record})
+		case common.RouteCooldownKindToken:
+			snapshot.Tokens = append(snapshot.Tokens, common.RouteCooldownTokenItem{ProviderTokenId: state.ProviderTokenId, Record: record})
+		case common.RouteCooldownKindUnsupported:
+			snapshot.Unsupported = append(snapshot.Unsupported, common.RouteCooldownUnsupportedItem{ProviderTokenId: state.ProviderTokenId, ModelName: state.ModelName, Until: record.CooldownUntil})
+		}
+	}
+	restored, err := common.GlobalRouteCooldown.Restore(snapshot)
+	if err != nil {
+		common.SysError("[route-cooldown] failed to restore snapshot: " + err.Error())
+	}
+	common.SysLog(fmt.Sprintf("[route-cooldown] restored %d of %d saved cooldown record(s)", restored, len(states)))
+}
+
+func routeCooldownStateFromRecord(kind string, providerTokenId int, modelName string, record common.RouteCooldownRecord, snapshotAt int64) model.RouteCooldownState {
+	state := model.RouteCooldownState{
+		Kind:                kind,
+		ProviderTokenId:     providerTokenId,
+		ModelName:           modelName,
+		ConsecutiveFailures: record.ConsecutiveFailures,
+		CooldownUntil:       record.CooldownUntil.Unix(),
+		SnapshotAt:          snapshotAt,
+	}
+	if !record.LastFailureTime.IsZero() {
+		state.LastFailureTime = record.LastFailureTime.Unix()
+	}
+	return state
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"strings"
+)
+
+// RoutingExplanation describes how a relay request for a model would be
+// routed, following the same token checks, virtual model expansion and
+// fallback chain as the relay handler.
+type RoutingExplanation struct {
+	Model        string `json:"model"`
+	ClientType   string `json:"client_type"`
+	Stream       bool   `json:"stream"`
+	TokenId      int    `json:"token_id"`
+	TokenName    string `json:"token_name"`
+	ModelAllowed bool   `json:"model_allowed"`
+	Virtual      bool   `json:"virtual"`
+	// Models lists the models the relay would try in order: the requested
+	// model and its fallback chain, or the targets of a virtual model.
+	Models []RoutingModelExplanation `json:"models"`
+}
+
+// RoutingModelExplanation is the plan of one model the relay would try.
+type RoutingModelExplanation struct {
+	Model string `json:"model"`
+	// Role is "primary", "fallback" or "virtual_target".
+	Role string `json:"role"`
+	// SkipReason is set when the relay would not route this model at all.
+	SkipReason string                  `json:"skip_reason,omitempty"`
+	Plan       *model.RouteExplanation `json:"plan,omitempty"`
+}
+
+// ExplainRouting returns the routing plan of a request for modelName from
+// clientType with aggToken; a nil aggToken is an unrestricted token. stream
+// tells whether the request would stream. Session affinity and max-in-flight
+// saturation depend on the live request and are not reflected.
+func ExplainRouting(modelName string, clientType string, stream bool, aggToken *model.AggregatedToken) (*RoutingExplanation, error) {
+	if aggToken == nil {
+		aggToken = &model.AggregatedToken{}
+	}
+	originalModel := strings.TrimSpace(modelName)
+	explanation := &RoutingExplanation{
+		Model:        originalModel,
+		ClientType:   clientType,
+		Stream:       stream,
+		TokenId:      aggToken.Id,
+		TokenName:    aggToken.Name,
+		ModelAllowed: aggToken.IsModelAllowed(originalModel),
+		Models:       []RoutingModelExplanation{},
+	}
+	if !explanation.ModelAllowed {
+		return explanation, nil
+	}
+
+	modelsToTry := []string{originalModel}
+	candidates, isVirtual := aggToken.VirtualModelCandidates(originalModel)
+	explanation.Virtual = isVirtual
+	if isVirtual {
+		modelsToTry = candidates
+	} else if chain, _, ok := common.GetModelFallbackChain(originalModel); ok && len(chain) > 0 {
+		modelsToTry = append(modelsToTry, chain...)
+	}
+
+	for idx, routingModel := range modelsToTry {
+		item := RoutingModelExplanation{Model: routingModel, Role: "primary"}
+		if isVirtual {
+			item.Role = "virtual_target"
+		} else if idx > 0 {
+			item.Role = "fallback"
+		}
+		if idx > 0 && !isVirtual && !aggToken.IsModelAllowed(routingModel) {
+			item.SkipReason = "model_not_allowed"
+			explanation.Models = append(explanation.Models, item)
+			continue
+		}
+		plan, err := model.ExplainRoutePlan(routingModel, clientType, aggToken.RoutingStrategyFor(originalModel, routingModel), stream)
+		if err != nil {
+			return nil, err
+		}
+		item.Plan = plan
+		explanation.Models = append(explanation.Models, item)
+	}
+	return explanation, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	routeProbeUserAgent   = "NewAPI-Gateway-RouteProbe"
+	routeProbeConcurrency = 4
+	// routeProbeMaxMessage bounds the upstream error kept in a probe result.
+	routeProbeMaxMessage = 300
+)
+
+var routeProbeLock sync.Mutex
+var routeProbeLastRun time.Time
+
+// RunRouteProbes probes every enabled route once the configured interval has
+// passed since the previous round. It is called every minute by the cron.
+func RunRouteProbes() {
+	cfg := common.LoadRouteProbeConfig()
+	if !cfg.Enabled {
+		return
+	}
+	if !routeProbeLock.TryLock() {
+		return
+	}
+	defer routeProbeLock.Unlock()
+	if !routeProbeLastRun.IsZero() && time.Since(routeProbeLastRun) < cfg.Interval {
+		return
+	}
+	routeProbeLastRun = time.Now()
+	probeAllRoutes(cfg)
+}
+
+// probeAllRoutes probes providers in parallel and the routes of one provider
+// one after another, so the per-provider cost cap is checked before every
+// probe.
+func probeAllRoutes(cfg common.RouteProbeConfig) {
+	attempts, err := model.GetProbeRouteAttempts()
+	if err != nil {
+		common.SysError("[route-probe] failed to load routes: " + err.Error())
+		return
+	}
+	active := make(map[string]bool, len(attempts))
+	var providerIds []int
+	byProvider := make(map[int][]model.RouteAttempt)
+	for _, attempt := range attempts {
+		active[routeProbeKey(attempt.Token.Id, attempt.Route.ModelName)] = true
+		if _, ok := byProvider[attempt.Provider.Id]; !ok {
+			providerIds = append(providerIds, attempt.Provider.Id)
+		}
+		byProvider[attempt.Provider.Id] = append(byProvider[attempt.Provider.Id], attempt)
+	}
+	common.GlobalRouteProbe.Retain(func(providerTokenId int, modelName string) bool {
+		return active[routeProbeKey(providerTokenId, modelName)]
+	})
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, routeProbeConcurrency)
+	for _, providerId := range providerIds {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(routes []model.RouteAttempt) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			for _, attempt := range routes {
+				probeRoute(attempt, cfg)
+			}
+		}(byProvider[providerId])
+	}
+	wg.Wait()
+
+	dead := common.GlobalRouteProbe.DeadRoutes()
+	common.SysLog(fmt.Sprintf("[route-probe] probed %d route(s) on %d provider(s), %d flagged dead", len(attempts), len(providerIds), len(dead)))
+}
+
+func routeProbeKey(providerTokenId int, modelName string) string {
+	return fmt.Sprintf("%d#%s", providerTokenId, strings.TrimSpace(modelName))
+}
+
+// probeRoute sends a minimal chat completion through ProxyToUpstream, which
+// records the outcome in the route cooldown manager and the usage logs like
+// any relay attempt. Only a 2xx response counts as success. Routes whose model
+// serves no chat endpoint would reject the probe, so they are skipped.
+func probeRoute(attempt model.RouteAttempt, cfg common.RouteProbeConfig) {
+	provider, token, route := attempt.Provider, attempt.Token, attempt.Route
+	if !supportsChatProbe(model.GetModelSupportedEndpointTypes(provider.Id, route.ModelName)) {
+		common.GlobalRouteProbe.RecordSkip(token.Id, route.ModelName, "model has no chat endpoint")
+		common.ObserveRouteProbe("skipped")
+		return
+	}
+	if cfg.ProviderDailyCostUSD > 0 && common.GlobalRouteProbe.ProviderSpentUSD(provider.Id) >= cfg.ProviderDailyCostUSD {
+		common.GlobalRouteProbe.RecordSkip(token.Id, route.ModelName, "provider probe cost cap reached")
+		common.ObserveRouteProbe("skipped")
+		return
+	}
+
+	c, _ := newRouteCheckContext(route.ModelName, false, routeProbeUserAgent)
+	startTime := time.Now()
+	proxyErr := ProxyToUpstream(c, route, token, provider)
+	latencyMs := int(time.Since(startTime).Milliseconds())
+	common.GlobalRouteProbe.AddProviderCost(provider.Id, c.GetFloat64(relayCostContextKey))
+
+	if proxyErr != nil && (proxyErr.CooldownRejected || proxyErr.Saturated) {
+		reason := "route in cooldown"
+		if proxyErr.Saturated {
+			reason = "route at max concurrency"
+		}
+		common.GlobalRouteProbe.RecordSkip(token.Id, route.ModelName, reason)
+		common.ObserveRouteProbe("skipped")
+		return
+	}
+
+	httpStatus := c.Writer.Status()
+	success := proxyErr == nil && httpStatus >= 200 && httpStatus < 300
+	message := ""
+	if proxyErr != nil {
+		httpStatus = proxyErr.StatusCode
+		message = proxyErr.Message
+		if len(proxyErr.UpstreamBody) > 0 {
+			message += ": " + truncateBodyForLog(proxyErr.UpstreamBody, routeProbeMaxMessage)
+		}
+	}
+	previous, _ := common.GlobalRouteProbe.Get(token.Id, route.ModelName)
+	result := common.GlobalRouteProbe.Record(token.Id, route.ModelName, success, latencyMs, httpStatus, message, cfg.DeadAfterFailures)
+	if success {
+		common.ObserveRouteProbe("success")
+	} else {
+		common.ObserveRouteProbe("failure")
+	}
+	if result.Dead != previous.Dead {
+		state := "recovered"
+		if result.Dead {
+			state = fmt.Sprintf("flagged dead after %d failed probe(s): %s", result.ConsecutiveFailures, message)
+		}
+		common.SysLog(fmt.Sprintf("[route-probe] provider=%s token_id=%d model=%s %s", provider.Name, token.Id, route.ModelName, state))
+	}
+}
+
+// supportsChatProbe reports whether a model with the given endpoint types
+// accepts the chat probe; unknown capabilities are probed.
+func supportsChatProbe(endpointTypes []string) bool {
+	if len(endpointTypes) == 0 {
+		return true
+	}
+	for _, endpointType := range endpointTypes {
+		switch strings.ToLower(strings.TrimSpace(endpointType)) {
+		case relayFormatOpenAI, relayFormatAnthropic, relayFormatGemini:
+			return true
+		}
+	}
+	return false
+}
+
+// newRouteCheckContext builds the relay context of a probe or route test: a
+// one-token "ping" chat completion logged under aggregated token 0 that
+// bypasses the response cache. The returned writer buffers the response.
+func newRouteCheckContext(modelName string, stream bool, userAgent string) (*gin.Context, *hedgeResponseWriter) {
+	body, _ := json.Marshal(map[string]any{
+		"model":      modelName,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+		"max_tokens": 1,
+		"stream":     stream,
+	})
+	writer := newHedgeResponseWriter()
+	c, _ := gin.CreateTestContext(writer)
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cache-Control", "no-store")
+	req.Header.Set("User-Agent", userAgent)
+	c.Request = req
+	c.Set("agg_token", &model.AggregatedToken{Name: "route-check"})
+	c.Set("request_model_original", modelName)
+	c.Set("request_model", modelName)
+	c.Set("request_model_resolved", modelName)
+	return c, writer
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRouteProbeFlagsDeadRouteAndStopsAtProviderCostCap(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	useResponseCacheForTest(t, map[string]string{"CooldownEnabled": "false"})
+	oldProbe := common.GlobalRouteProbe
+	common.GlobalRouteProbe = common.NewRouteProbeTracker()
+	t.Cleanup(func() { common.GlobalRouteProbe = oldProbe })
+
+	var healthy atomic.Bool
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("User-Agent") != routeProbeUserAgent || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected probe request: %s %s", r.URL.Path, r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream down","type":"server_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"pong"}}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`))
+	}))
+	defer upstream.Close()
+	if err := model.DB.Create(&model.ModelPricing{ProviderId: 92, ModelName: "gpt-4", ModelRatio: 1, CompletionRatio: 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	attempt := model.RouteAttempt{
+		Route:    model.ModelRoute{ModelName: "gpt-4", ProviderId: 92, ProviderTokenId: 902, Enabled: true},
+		Token:    &model.ProviderToken{Id: 902, ProviderId: 92},
+		Provider: &model.Provider{Id: 92, Name: "probe-provider", BaseURL: upstream.URL},
+	}
+	cfg := common.RouteProbeConfig{Enabled: true, DeadAfterFailures: 2, ProviderDailyCostUSD: 0.00001}
+	for i := 0; i < 2; i++ {
+		probeRoute(attempt, cfg)
+	}
+	result, ok := common.GlobalRouteProbe.Get(902, "gpt-4")
+	if !ok || !result.Dead || result.Status != common.RouteProbeStatusFailure || result.HttpStatus != http.StatusBadGateway {
+		t.Fatalf("expected the route to be flagged dead, got %+v", result)
+	}
+
+	healthy.Store(true)
+	probeRoute(attempt, cfg)
+	if result, _ = common.GlobalRouteProbe.Get(902, "gpt-4"); result.Dead || result.Status != common.RouteProbeStatusSuccess {
+		t.Fatalf("expected a successful probe to clear the dead flag, got %+v", result)
+	}
+
+	// 12 prompt + 3 completion tokens cost $0.000036, above the cap.
+	probeRoute(attempt, cfg)
+	if result, _ = common.GlobalRouteProbe.Get(902, "gpt-4"); result.Status != common.RouteProbeStatusSkipped {
+		t.Fatalf("expected the provider cost cap to skip the probe, got %+v", result)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 upstream probes, got %d", got)
+	}
+	if logs := waitForUsageLogs(t, 902, 3); len(logs) != 3 || logs[0].AggregatedTokenId != 0 {
+		t.Fatalf("expected probes to be logged under aggregated token 0, got %d log(s)", len(logs))
+	}
+}
+
+func TestRouteProbeCountsClientErrorsAsFailureAndSkipsNonChatModels(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	useResponseCacheForTest(t, map[string]string{"CooldownEnabled": "false"})
+	oldProbe := common.GlobalRouteProbe
+	common.GlobalRouteProbe = common.NewRouteProbeTracker()
+	t.Cleanup(func() { common.GlobalRouteProbe = oldProbe })
+
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"invalid api key","type":"authentication_error"}}`))
+	}))
+	defer upstream.Close()
+	if err := model.DB.Create(&model.ModelPricing{ProviderId: 93, ModelName: "text-embedding-3-small", SupportedEndpointTypes: `["embeddings"]`}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &model.Provider{Id: 93, Name: "probe-provider", BaseURL: upstream.URL}
+	cfg := common.RouteProbeConfig{Enabled: true, DeadAfterFailures: 1}
+	probeRoute(model.RouteAttempt{
+		Route:    model.ModelRoute{ModelName: "gpt-4", ProviderId: 93, ProviderTokenId: 903, Enabled: true},
+		Token:    &model.ProviderToken{Id: 903, ProviderId: 93},
+		Provider: provider,
+	}, cfg)
+	if result, _ := common.GlobalRouteProbe.Get(903, "gpt-4"); result.Status != common.RouteProbeStatusFailure || !result.Dead || result.HttpStatus != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 probe to fail, got %+v", result)
+	}
+
+	probeRoute(model.RouteAttempt{
+		Route:    model.ModelRoute{ModelName: "text-embedding-3-small", ProviderId: 93, ProviderTokenId: 904, Enabled: true},
+		Token:    &model.ProviderToken{Id: 904, ProviderId: 93},
+		Provider: provider,
+	}, cfg)
+	if result, _ := common.GlobalRouteProbe.Get(904, "text-embedding-3-small"); result.Status != common.RouteProbeStatusSkipped {
+		t.Fatalf("expected the embedding route to be skipped, got %+v", result)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected only the chat route to be probed, got %d call(s)", got)
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	routeTestUserAgent = "NewAPI-Gateway-RouteTest"
+	// routeTestContextKey marks an admin route test, which bypasses the
+	// cooldown gate in ProxyToUpstream.
+	routeTestContextKey = "route_test"
+	// routeTestMaxBodyBytes bounds the upstream body kept in a result.
+	routeTestMaxBodyBytes = 4096
+
+	RouteTestDefaultConcurrency = 4
+	RouteTestMaxConcurrency     = 16
+	// routeTestMaxBatches is the number of batches kept in memory for
+	// progress reporting; their results stay in the database.
+	routeTestMaxBatches = 20
+)
+
+// RouteTestOptions controls an admin route test.
+type RouteTestOptions struct {
+	Stream bool
+	// AutoDisable disables the route on hard failures: 401 or an upstream
+	// that reports the model as missing or not permitted.
+	AutoDisable bool
+	Concurrency int
+}
+
+// RunRouteTest sends a one-token test request through a route with the same
+// code path as a relay attempt, stores the result and returns it.
+func RunRouteTest(attempt model.RouteAttempt, opts RouteTestOptions, batchId string) *model.RouteTestResult {
+	route := attempt.Route
+	result := &model.RouteTestResult{
+		BatchId:         batchId,
+		RouteId:         route.Id,
+		ProviderId:      route.ProviderId,
+		ProviderTokenId: route.ProviderTokenId,
+		ModelName:       route.ModelName,
+		Stream:          opts.Stream,
+	}
+	if attempt.Provider == nil || attempt.Token == nil {
+		result.ErrorMessage = "route provider or token no longer exists"
+		storeRouteTestResult(result)
+		return result
+	}
+	result.ProviderName = attempt.Provider.Name
+
+	c, writer := newRouteCheckContext(route.ModelName, opts.Stream, routeTestUserAgent)
+	c.Set(routeTestContextKey, true)
+	startTime := time.Now()
+	proxyErr := ProxyToUpstream(c, route, attempt.Token, attempt.Provider)
+	result.LatencyMs = int(time.Since(startTime).Milliseconds())
+	result.FirstTokenMs = c.GetInt(relayFirstTokenContextKey)
+
+	if proxyErr == nil {
+		result.Success = true
+		result.HttpStatus = writer.Status()
+		result.ResponseModel = routeTestResponseModel(writer.body.Bytes(), opts.Stream)
+		storeRouteTestResult(result)
+		return result
+	}
+
+	result.HttpStatus = proxyErr.StatusCode
+	result.ErrorMessage = proxyErr.Message
+	result.UpstreamBody = truncateBodyForLog(proxyErr.UpstreamBody, routeTestMaxBodyBytes)
+	result.ResponseModel = extractUsageAndModelFromJSON(proxyErr.UpstreamBody).ModelName
+	if opts.AutoDisable && route.Enabled && isHardRouteTestFailure(proxyErr) {
+		if err := model.UpdateModelRouteFields(route.Id, map[string]interface{}{"enabled": false}); err != nil {
+			common.SysError(fmt.Sprintf("[route-test] failed to disable route %d: %v", route.Id, err))
+		} else {
+			result.AutoDisabled = true
+			common.SysLog(fmt.Sprintf("[route-test] disabled route %d (%s / %s) after HTTP %d", route.Id, attempt.Provider.Name, route.ModelName, proxyErr.StatusCode))
+		}
+	}
+	storeRouteTestResult(result)
+	return result
+}
+
+func storeRouteTestResult(result *model.RouteTestResult) {
+	if err := result.Insert(); err != nil {
+		common.SysError("[route-test] failed to store result: " + err.Error())
+	}
+}
+
+// isHardRouteTestFailure reports failures that will not heal by retrying:
+// rejected credentials or a model the upstream does not serve.
+func isHardRouteTestFailure(proxyErr *ProxyAttemptError) bool {
+	if proxyErr.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	upstreamErr := extractUpstreamErrorInfo(proxyErr.UpstreamBody)
+	if upstreamErr.Code == "" {
+		upstreamErr.Code = proxyErr.UpstreamErrorCode
+	}
+	if upstreamErr.Type == "" {
+		upstreamErr.Type = proxyErr.UpstreamErrorType
+	}
+	return shouldMarkUnsupportedModel(proxyErr.StatusCode, upstreamErr)
+}
+
+// routeTestResponseModel returns the model name reported in a response body.
+func routeTestResponseModel(body []byte, stream bool) string {
+	if !stream {
+		return extractUsageAndModelFromJSON(body).ModelName
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if usage, _ := extractUsageAndModelFromSSELine(scanner.Text()); usage.ModelName != "" {
+			return usage.ModelName
+		}
+	}
+	return ""
+}
+
+// RouteTestBatch reports the progress of a bulk route test.
+type RouteTestBatch struct {
+	Id           string `json:"id"`
+	Total        int    `json:"total"`
+	Done         int    `json:"done"`
+	Succeeded    int    `json:"succeeded"`
+	Failed       int    `json:"failed"`
+	AutoDisabled int    `json:"auto_disabled"`
+	Running      bool   `json:"running"`
+	StartedAt    int64  `json:"started_at"`
+	FinishedAt   int64  `json:"finished_at"`
+}
+
+var routeTestBatchesLock sync.Mutex
+var routeTestBatches = make(map[string]*RouteTestBatch)
+
+// StartRouteTestBatch tests attempts in the background, at most
+// opts.Concurrency at a time, and returns the new batch.
+func StartRouteTestBatch(attempts []model.RouteAttempt, opts RouteTestOptions) RouteTestBatch {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = RouteTestDefaultConcurrency
+	}
+	if opts.Concurrency > RouteTestMaxConcurrency {
+		opts.Concurrency = RouteTestMaxConcurrency
+	}
+	batch := &RouteTestBatch{
+		Id:        uuid.New().String(),
+		Total:     len(attempts),
+		Running:   true,
+		StartedAt: time.Now().Unix(),
+	}
+	routeTestBatchesLock.Lock()
+	pruneRouteTestBatchesLocked()
+	routeTestBatches[batch.Id] = batch
+	snapshot := *batch
+	routeTestBatchesLock.Unlock()
+
+	go func() {
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, opts.Concurrency)
+		for _, attempt := range attempts {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(attempt model.RouteAttempt) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				result := RunRouteTest(attempt, opts, batch.Id)
+				routeTestBatchesLock.Lock()
+				defer routeTestBatchesLock.Unlock()
+				batch.Done++
+				if result.Success {
+					batch.Succeeded++
+				} else {
+					batch.Failed++
+				}
+				if result.AutoDisabled {
+					batch.AutoDisabled++
+				}
+			}(attempt)
+		}
+		wg.Wait()
+		routeTestBatchesLock.Lock()
+		batch.Running = false
+		batch.FinishedAt = time.Now().Unix()
+		done := *batch
+		routeTestBatchesLock.Unlock()
+		common.SysLog(fmt.Sprintf("[route-test] batch %s finished: %d route(s), %d failed, %d disabled", done.Id, done.Total, done.Failed, done.AutoDisabled))
+	}()
+	return snapshot
+}
+
+// pruneRouteTestBatchesLocked drops the oldest finished batches beyond
+// routeTestMaxBatches.
+func pruneRouteTestBatchesLocked() {
+	if len(routeTestBatches) < routeTestMaxBatches {
+		return
+	}
+	finished := make([]*RouteTestBatch, 0, len(routeTestBatches))
+	for _, batch := range routeTestBatches {
+		if !batch.Running {
+			finished = append(finished, batch)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt < finished[j].StartedAt })
+	for i := 0; i < len(finished) && len(routeTestBatches) >= routeTestMaxBatches; i++ {
+		delete(routeTestBatches, finished[i].Id)
+	}
+}
+
+// GetRouteTestBatch returns the progress of a batch started by this process.
+func GetRouteTestBatch(id string) (RouteTestBatch, bool) {
+	routeTestBatchesLock.Lock()
+	defer routeTestBatchesLock.Unlock()
+	batch, ok := routeTestBatches[id]
+	if !ok {
+		return RouteTestBatch{}, false
+	}
+	return *batch, true
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouteTestReportsStreamTimingAndAutoDisablesOnUnauthorized(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	if err := model.DB.AutoMigrate(&model.ModelRoute{}, &model.RouteTestResult{}); err != nil {
+		t.Fatal(err)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != routeTestUserAgent {
+			t.Errorf("unexpected user agent: %s", r.Header.Get("User-Agent"))
+		}
+		if r.Header.Get("Authorization") == "Bearer revoked" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		time.Sleep(5 * time.Millisecond)
+		_, _ = w.Write([]byte("data: {\"model\":\"gpt-4-0613\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"pong\"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	provider := &model.Provider{Id: 93, Name: "test-provider", BaseURL: upstream.URL}
+	routes := []model.ModelRoute{
+		{ModelName: "gpt-4", ProviderId: 93, ProviderTokenId: 931, Enabled: true},
+		{ModelName: "gpt-4", ProviderId: 93, ProviderTokenId: 932, Enabled: true},
+	}
+	if err := model.DB.Create(&routes).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ok := RunRouteTest(model.RouteAttempt{
+		Route:    routes[0],
+		Token:    &model.ProviderToken{Id: 931, ProviderId: 93, SkKey: "valid"},
+		Provider: provider,
+	}, RouteTestOptions{Stream: true, AutoDisable: true}, "batch-1")
+	if !ok.Success || ok.HttpStatus != http.StatusOK || ok.ResponseModel != "gpt-4-0613" || ok.FirstTokenMs <= 0 {
+		t.Fatalf("unexpected stream test result: %+v", ok)
+	}
+
+	failed := RunRouteTest(model.RouteAttempt{
+		Route:    routes[1],
+		Token:    &model.ProviderToken{Id: 932, ProviderId: 93, SkKey: "revoked"},
+		Provider: provider,
+	}, RouteTestOptions{AutoDisable: true}, "batch-1")
+	if failed.Success || failed.HttpStatus != http.StatusUnauthorized || !failed.AutoDisabled || failed.UpstreamBody == "" {
+		t.Fatalf("unexpected failed test result: %+v", failed)
+	}
+	var stored model.ModelRoute
+	if err := model.DB.First(&stored, routes[1].Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Enabled {
+		t.Fatal("expected the unauthorized route to be disabled")
+	}
+
+	results, total, err := model.QueryRouteTestResults(model.RouteTestResultQuery{BatchId: "batch-1"})
+	if err != nil || total != 2 || len(results) != 2 {
+		t.Fatalf("expected 2 stored results, got %d (%v)", total, err)
+	}
+}
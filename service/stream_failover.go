@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamResponseWriter holds SSE output until the stream is committed. Before
+// commit nothing (not even headers) reaches the client, so the relay can still
+// move on to the next route.
+type streamResponseWriter struct {
+	c         *gin.Context
+	onCommit  func()
+	buffer    bytes.Buffer
+	committed bool
+}
+
+func newStreamResponseWriter(c *gin.Context, onCommit func()) *streamResponseWriter {
+	return &streamResponseWriter{c: c, onCommit: onCommit}
+}
+
+func (w *streamResponseWriter) Write(p []byte) (int, error) {
+	if !w.committed {
+		return w.buffer.Write(p)
+	}
+	return w.c.Writer.Write(p)
+}
+
+func (w *streamResponseWriter) buffered() int {
+	return w.buffer.Len()
+}
+
+// commit writes headers and any buffered output; later writes go straight to
+// the client.
+func (w *streamResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if w.onCommit != nil {
+		w.onCommit()
+	}
+	if w.buffer.Len() > 0 {
+		_, _ = w.c.Writer.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+}
+
+// shouldFailoverBufferedStream reports whether an uncommitted stream is broken
+// and can be retried elsewhere. A stream that completed without content is a
+// valid (empty) answer and is delivered as is.
+func shouldFailoverBufferedStream(errorMsg string, clientCanceled bool, streamCompleted bool) bool {
+	if clientCanceled {
+		return false
+	}
+	return errorMsg != "" || !streamCompleted
+}
+
+// sseLineHasContent reports whether an SSE line carries generated output
+// (text, reasoning or tool calls) in any of the supported wire formats.
+func sseLineHasContent(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "data:") {
+		return false
+	}
+	dataContent := strings.TrimSpace(strings.TrimPrefix(trimmed, "data:"))
+	if dataContent == "" || dataContent == "[DONE]" {
+		return false
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(dataContent), &payload); err != nil {
+		return false
+	}
+
+	eventType := getStringValue(payload["type"])
+	if eventType == "content_block_delta" {
+		return true
+	}
+	if strings.HasPrefix(eventType, "response.") && strings.HasSuffix(eventType, ".delta") {
+		return true
+	}
+
+	for _, rawChoice := range asSlice(payload["choices"]) {
+		choice := asMap(rawChoice)
+		if getStringValue(choice["text"]) != "" {
+			return true
+		}
+		delta := asMap(choice["delta"])
+		for _, field := range []string{"content", "reasoning_content", "reasoning"} {
+			switch value := delta[field].(type) {
+			case string:
+				if value != "" {
+					return true
+				}
+			case []interface{}:
+				if len(value) > 0 {
+					return true
+				}
+			}
+		}
+		if len(asSlice(delta["tool_calls"])) > 0 || delta["function_call"] != nil {
+			return true
+		}
+	}
+
+	for _, rawCandidate := range asSlice(payload["candidates"]) {
+		content := asMap(asMap(rawCandidate)["content"])
+		for _, rawPart := range asSlice(content["parts"]) {
+			part := asMap(rawPart)
+			if getStringValue(part["text"]) != "" || part["functionCall"] != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func enableStreamFailoverForTest(t *testing.T, options map[string]string) {
+	t.Helper()
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{"StreamFailoverEnabled": "true"}
+	for key, value := range options {
+		common.OptionMap[key] = value
+	}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+	})
+}
+
+func newSSEUpstream(lines ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Upstream-Marker", "1")
+		for _, line := range lines {
+			_, _ = w.Write([]byte(line + "\n\n"))
+		}
+	}))
+}
+
+func TestStreamFailoverRetriesErrorBeforeFirstContent(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	enableStreamFailoverForTest(t, nil)
+
+	broken := newSSEUpstream(
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`data: {"error":{"message":"overloaded","type":"server_error"}}`,
+	)
+	defer broken.Close()
+	healthy := newSSEUpstream(
+		`data: {"id":"c2","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"}}]}`,
+		`data: {"id":"c2","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	)
+	defer healthy.Close()
+
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"x"}]}`)
+	proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 501}, &model.Provider{BaseURL: broken.URL})
+	if proxyErr == nil || !proxyErr.Retryable {
+		t.Fatalf("expected retryable failover error, got %#v", proxyErr)
+	}
+	if c.Writer.Written() || recorder.Body.Len() != 0 || c.Writer.Header().Get("X-Upstream-Marker") != "" {
+		t.Fatalf("expected nothing written before first content, got %q", recorder.Body.String())
+	}
+
+	if proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 502}, &model.Provider{BaseURL: healthy.URL}); proxyErr != nil {
+		t.Fatalf("expected second route to succeed, got %v", proxyErr)
+	}
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || !strings.Contains(body, `"content":"hi"`) || strings.Contains(body, "overloaded") {
+		t.Fatalf("unexpected client stream: %d %s", recorder.Code, body)
+	}
+}
+
+func TestStreamFailoverKeepsStreamAfterFirstContent(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	enableStreamFailoverForTest(t, nil)
+
+	upstream := newSSEUpstream(
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"partial"}}]}`,
+		`data: {"error":{"message":"overloaded","type":"server_error"}}`,
+	)
+	defer upstream.Close()
+
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"x"}]}`)
+	if proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 503}, &model.Provider{BaseURL: upstream.URL}); proxyErr != nil {
+		t.Fatalf("expected committed stream to be delivered, got %v", proxyErr)
+	}
+	if !strings.Contains(recorder.Body.String(), "partial") || !strings.Contains(recorder.Body.String(), "overloaded") {
+		t.Fatalf("expected full passthrough after commit: %s", recorder.Body.String())
+	}
+}
+
+func TestStreamFailoverReleasesAfterBufferLimit(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	enableStreamFailoverForTest(t, map[string]string{"StreamFailoverMaxBufferBytes": "1024"})
+
+	padding := strings.Repeat("x", 1100)
+	upstream := newSSEUpstream(
+		`: `+padding,
+		`data: {"error":{"message":"late failure"}}`,
+	)
+	defer upstream.Close()
+
+	c, recorder := newRouteSystemPromptProxyContext(`{"model":"gpt-4","stream":true,"messages":[]}`)
+	if proxyErr := ProxyToUpstream(c, model.ModelRoute{ModelName: "gpt-4"}, &model.ProviderToken{Id: 504}, &model.Provider{BaseURL: upstream.URL}); proxyErr != nil {
+		t.Fatalf("expected stream to be committed once the buffer limit is hit, got %v", proxyErr)
+	}
+	if !strings.Contains(recorder.Body.String(), "late failure") {
+		t.Fatalf("expected passthrough after buffer limit: %s", recorder.Body.String())
+	}
+}
+
+func TestSSELineHasContent(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{`data: {"choices":[{"delta":{"role":"assistant"}}]}`, false},
+		{`data: {"choices":[{"delta":{"content":""}}]}`, false},
+		{`data: {"choices":[{"delta":{"content":"a"}}]}`, true},
+		{`data: {"choices":[{"delta":{"reasoning_content":"think"}}]}`, true},
+		{`data: {"choices":[{"delta":{"tool_calls":[{"index":0}]}}]}`, true},
+		{`data: {"choices":[{"text":"a"}]}`, true},
+		{`data: {"type":"message_start","message":{}}`, false},
+		{`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"a"}}`, true},
+		{`data: {"type":"response.output_text.delta","delta":"a"}`, true},
+		{`data: {"type":"response.created"}`, false},
+		{`data: {"candidates":[{"content":{"parts":[{"text":"a"}]}}]}`, true},
+		{`data: [DONE]`, false},
+		{`event: content_block_delta`, false},
+	}
+	for _, tc := range tests {
+		if got := sseLineHasContent(tc.line); got != tc.want {
+			t.Fatalf("sseLineHasContent(%s) = %v, want %v", tc.line, got, tc.want)
+		}
+	}
+}
@@ -15,16 +15,32 @@ import (
 
 // SyncProvider synchronizes pricing, tokens, and balance from an upstream provider
 func SyncProvider(provider *model.Provider) error {
+	startTime := time.Now()
+	complete, err := syncProvider(provider)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	} else if !complete {
+		result = "partial"
+	}
+	common.ObserveProviderSync(provider.Name, result, time.Since(startTime))
+	alerts.recordProviderSyncResult(provider.Id, result == "success")
+	return err
+}
+
+// syncProvider reports whether every sync step succeeded. Step failures of
+// regular providers are logged rather than returned.
+func syncProvider(provider *model.Provider) (bool, error) {
 	if provider.IsKeyOnly() {
 		if err := syncKeyOnlyProvider(provider); err != nil {
 			clearErr := clearProviderSyncState(provider)
 			if clearErr != nil {
-				return fmt.Errorf("sync key-only provider failed: %w; clear provider sync state failed: %v", err, clearErr)
+				return false, fmt.Errorf("sync key-only provider failed: %w; clear provider sync state failed: %v", err, clearErr)
 			}
-			return err
+			return false, err
 		}
 		provider.UpdateLastSyncedTime()
-		return nil
+		return true, nil
 	}
 
 	client := NewUpstreamClient(provider.BaseURL, provider.AccessToken, provider.UserID)
@@ -58,7 +74,7 @@ func SyncProvider(provider *model.Provider) error {
 		provider.UpdateLastSyncedTime()
 	}
 
-	return nil
+	return success, nil
 }
 
 // getModelTimeoutDays returns the number of days after which a model is considered stale
@@ -118,9 +134,21 @@ func cleanupStaleModels(provider *model.Provider) {
 type openAIModelsResponse struct {
 	Data []struct {
 		ID string `json:"id"`
+		// Context window fields used by common OpenAI-compatible servers
+		// (OpenRouter/Together, Groq, vLLM).
+		ContextLength    int `json:"context_length"`
+		ContextWindow    int `json:"context_window"`
+		MaxModelLen      int `json:"max_model_len"`
+		MaxContextLength int `json:"max_context_length"`
 	} `json:"data"`
 }
 
+// discoveredModel is a model listed by an upstream /v1/models endpoint.
+type discoveredModel struct {
+	Name          string
+	ContextLength int
+}
+
 func syncKeyOnlyProvider(provider *model.Provider) error {
 	apiKey := strings.TrimSpace(provider.ApiKey)
 	if apiKey == "" {
@@ -147,7 +175,7 @@ func syncKeyOnlyProvider(provider *model.Provider) error {
 	return nil
 }
 
-func fetchOpenAIModels(baseURL string, apiKey string) ([]string, error) {
+func fetchOpenAIModels(baseURL string, apiKey string) ([]discoveredModel, error) {
 	url := strings.TrimRight(strings.TrimSpace(baseURL), "/") + "/v1/models"
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -177,14 +205,21 @@ func fetchOpenAIModels(baseURL string, apiKey string) ([]string, error) {
 	}
 
 	seen := make(map[string]bool)
-	models := make([]string, 0, len(payload.Data))
+	models := make([]discoveredModel, 0, len(payload.Data))
 	for _, item := range payload.Data {
 		id := strings.TrimSpace(item.ID)
 		if id == "" || seen[id] {
 			continue
 		}
 		seen[id] = true
-		models = append(models, id)
+		contextLength := 0
+		for _, candidate := range []int{item.ContextLength, item.ContextWindow, item.MaxModelLen, item.MaxContextLength} {
+			if candidate > 0 {
+				contextLength = candidate
+				break
+			}
+		}
+		models = append(models, discoveredModel{Name: id, ContextLength: contextLength})
 	}
 	if len(models) == 0 {
 		return nil, fmt.Errorf("no models returned")
@@ -211,7 +246,7 @@ func upsertKeyOnlyToken(provider *model.Provider, apiKey string) error {
 	return model.DeleteProviderTokensNotInIds(provider.Id, []int{0})
 }
 
-func syncKeyOnlyPricing(provider *model.Provider, models []string) error {
+func syncKeyOnlyPricing(provider *model.Provider, models []discoveredModel) error {
 	// Clean up stale models before syncing
 	cleanupStaleModels(provider)
 
@@ -222,16 +257,17 @@ func syncKeyOnlyPricing(provider *model.Provider, models []string) error {
 	enableGroupsJSON, _ := json.Marshal([]string{"default"})
 	supportedEndpointTypesJSON, _ := json.Marshal([]string{})
 	now := time.Now().Unix()
-	for _, modelName := range models {
+	for _, discovered := range models {
 		mp := &model.ModelPricing{
-			ModelName:              modelName,
+			ModelName:              discovered.Name,
 			ProviderId:             provider.Id,
 			EnableGroups:           string(enableGroupsJSON),
 			SupportedEndpointTypes: string(supportedEndpointTypesJSON),
+			ContextLength:          discovered.ContextLength,
 			LastSynced:             now,
 		}
 		if err := model.UpsertModelPricingSilent(mp); err != nil {
-			common.SysLog(fmt.Sprintf("upsert pricing failed for model %s: %v", modelName, err))
+			common.SysLog(fmt.Sprintf("upsert pricing failed for model %s: %v", discovered.Name, err))
 		}
 	}
 
@@ -287,6 +323,11 @@ func syncPricing(client *UpstreamClient, provider *model.Provider) error {
 			ModelPrice:             p.ModelPrice,
 			EnableGroups:           string(enableGroupsJSON),
 			SupportedEndpointTypes: string(supportedEndpointTypesJSON),
+			CacheRatio:             p.CacheRatio,
+			CacheCreationRatio:     p.CreateCacheRatio,
+			AudioRatio:             p.AudioRatio,
+			AudioCompletionRatio:   p.AudioCompletionRatio,
+			ImageRatio:             p.ImageRatio,
 			LastSynced:             now,
 		}
 		if err := model.UpsertModelPricing(mp); err != nil {
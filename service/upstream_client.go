@@ -52,6 +52,12 @@ type UpstreamPricing struct {
 	CompletionRatio        float64  `json:"completion_ratio"`
 	EnableGroups           []string `json:"enable_groups"`
 	SupportedEndpointTypes []string `json:"supported_endpoint_types"`
+	// Optional billing ratios; only some upstream versions report them.
+	CacheRatio           float64 `json:"cache_ratio"`
+	CreateCacheRatio     float64 `json:"create_cache_ratio"`
+	AudioRatio           float64 `json:"audio_ratio"`
+	AudioCompletionRatio float64 `json:"audio_completion_ratio"`
+	ImageRatio           float64 `json:"image_ratio"`
 }
 
 type UpstreamEndpointInfo struct {
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+)
+
+// estimateUsageCostUSD prices a response with the provider's synced pricing
+// and the price book overrides. It returns 0 when the model has no usable
+// pricing.
+func estimateUsageCostUSD(providerId int, usage usageMetrics) float64 {
+	pricing := effectiveModelPricing(providerId, usage.ModelName)
+	if pricing == nil {
+		return 0
+	}
+	return usageCostUSD(pricing, usage)
+}
+
+// effectiveModelPricing returns the synced pricing of a model with the price
+// book cost overrides applied, or nil when neither prices the model.
+func effectiveModelPricing(providerId int, modelName string) *model.ModelPricing {
+	if modelName == "" {
+		return nil
+	}
+	pricing, err := model.GetModelPricingByProviderAndModel(providerId, modelName)
+	entry, hasEntry := common.FindPriceBookEntry(providerId, modelName)
+	if err != nil || pricing == nil {
+		if !hasEntry {
+			return nil
+		}
+		pricing = &model.ModelPricing{ProviderId: providerId, ModelName: modelName}
+	}
+	if hasEntry {
+		applyPriceOverride(pricing, entry.ModelRatio, entry.CompletionRatio, entry.ModelPrice)
+	}
+	return pricing
+}
+
+func applyPriceOverride(pricing *model.ModelPricing, modelRatio *float64, completionRatio *float64, modelPrice *float64) {
+	if modelRatio != nil {
+		pricing.ModelRatio = *modelRatio
+	}
+	if completionRatio != nil {
+		pricing.CompletionRatio = *completionRatio
+	}
+	if modelPrice != nil {
+		pricing.ModelPrice = *modelPrice
+	}
+}
+
+// chargebackUSD is the internal sale price of a response: the price book sale
+// price when set, otherwise the cost, times the markup of the user's group.
+func chargebackUSD(providerId int, usage usageMetrics, costUSD float64, userGroup string) float64 {
+	saleUSD := costUSD
+	if entry, ok := common.FindPriceBookEntry(providerId, usage.ModelName); ok && entry.HasSalePrice() {
+		if pricing := effectiveModelPricing(providerId, usage.ModelName); pricing != nil {
+			applyPriceOverride(pricing, entry.SaleModelRatio, entry.SaleCompletionRatio, entry.SaleModelPrice)
+			// Upstream long-context tiers would replace the sale ratios.
+			pricing.PriceTiers = ""
+			saleUSD = usageCostUSD(pricing, usage)
+		}
+	}
+	return saleUSD * common.PriceBookGroupMarkup(userGroup)
+}
+
+// usageCostUSD bills cache reads/writes, audio and image tokens at their own
+// ratios of the input price, after picking the long-context tier by the full
+// input size. Unset ratios fall back to the plain prompt/completion price.
+func usageCostUSD(pricing *model.ModelPricing, usage usageMetrics) float64 {
+	if pricing.ModelPrice > 0 && usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return pricing.ModelPrice
+	}
+
+	cacheCreation5m := usage.CacheCreation5mTokens
+	cacheCreation1h := usage.CacheCreation1hTokens
+	// Writes reported without a TTL split are billed as 5-minute writes.
+	cacheCreation5m += maxInt(0, usage.CacheCreationTokens-cacheCreation5m-cacheCreation1h)
+	cachedTokens := usage.CacheTokens + cacheCreation5m + cacheCreation1h
+	inputTokens := usage.PromptTokens
+	if usage.PromptExcludesCache {
+		inputTokens += cachedTokens
+	}
+
+	modelRatio, completionRatio := pricing.PricingRatiosForPrompt(inputTokens)
+	if modelRatio <= 0 {
+		return 0
+	}
+	if completionRatio <= 0 {
+		completionRatio = 1
+	}
+	cacheCreationRatio := ratioOrDefault(pricing.CacheCreationRatio, 1)
+	audioRatio := ratioOrDefault(pricing.AudioRatio, 1)
+
+	textPromptTokens := maxInt(0, inputTokens-cachedTokens-usage.AudioPromptTokens-usage.ImagePromptTokens)
+	promptUnits := float64(textPromptTokens) +
+		float64(usage.CacheTokens)*ratioOrDefault(pricing.CacheRatio, 1) +
+		float64(cacheCreation5m)*cacheCreationRatio +
+		float64(cacheCreation1h)*ratioOrDefault(pricing.CacheCreation1hRatio, cacheCreationRatio) +
+		float64(usage.AudioPromptTokens)*audioRatio +
+		float64(usage.ImagePromptTokens)*ratioOrDefault(pricing.ImageRatio, 1)
+
+	audioCompletionTokens := minInt(usage.AudioCompletionTokens, usage.CompletionTokens)
+	audioCompletionRatio := completionRatio
+	if pricing.AudioCompletionRatio > 0 {
+		audioCompletionRatio = audioRatio * pricing.AudioCompletionRatio
+	}
+	completionUnits := float64(usage.CompletionTokens-audioCompletionTokens)*completionRatio +
+		float64(audioCompletionTokens)*audioCompletionRatio
+
+	// A model ratio of 1 is $2 per 1M tokens.
+	return (promptUnits + completionUnits) * modelRatio / 500000.0
+}
+
+func ratioOrDefault(ratio float64, fallback float64) float64 {
+	if ratio > 0 {
+		return ratio
+	}
+	return fallback
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"NewAPI-Gateway/model"
+	"math"
+	"testing"
+)
+
+func assertCostUSD(t *testing.T, name string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-9 {
+		t.Fatalf("%s: cost = %.9f, want %.9f", name, got, want)
+	}
+}
+
+func TestUsageCostBillsAnthropicCacheAndLongContextTier(t *testing.T) {
+	// $3 input / $15 output per 1M, cache read 0.1x, 5m write 1.25x, 1h write
+	// 2x, doubled input and 1.5x output above 200K input tokens.
+	pricing := &model.ModelPricing{
+		ModelRatio:           1.5,
+		CompletionRatio:      5,
+		CacheRatio:           0.1,
+		CacheCreationRatio:   1.25,
+		CacheCreation1hRatio: 2,
+		PriceTiers:           `[{"min_prompt_tokens":200000,"model_ratio":3,"completion_ratio":3.75}]`,
+	}
+	// Streams report input and cache counts in message_start, output in
+	// message_delta.
+	var usage usageMetrics
+	for _, line := range []string{
+		`data: {"type":"message_start","message":{"model":"claude-sonnet","usage":{"input_tokens":1000,"output_tokens":1,"cache_read_input_tokens":10000,"cache_creation_input_tokens":3000,"cache_creation":{"ephemeral_5m_input_tokens":2000,"ephemeral_1h_input_tokens":1000}}}}`,
+		`data: {"type":"message_delta","usage":{"output_tokens":500}}`,
+	} {
+		current, _ := extractUsageAndModelFromSSELine(line)
+		mergeStreamUsage(&usage, current)
+	}
+	if !usage.PromptExcludesCache {
+		t.Fatal("anthropic usage should be marked as excluding cache tokens from input_tokens")
+	}
+	want := (1000*3 + 10000*0.3 + 2000*3.75 + 1000*6 + 500*15) / 1e6
+	assertCostUSD(t, "short context", usageCostUSD(pricing, usage), want)
+
+	usage.PromptTokens = 200000
+	want = (200000*6 + 10000*0.6 + 2000*7.5 + 1000*12 + 500*22.5) / 1e6
+	assertCostUSD(t, "long context", usageCostUSD(pricing, usage), want)
+}
+
+func TestUsageCostWithoutExtraRatiosMatchesPlainTokenPricing(t *testing.T) {
+	pricing := &model.ModelPricing{ModelRatio: 1.25, CompletionRatio: 4}
+	usage := extractUsageAndModelFromJSON([]byte(`{"usage":{"prompt_tokens":2000,"completion_tokens":100,"prompt_tokens_details":{"cached_tokens":1500,"audio_tokens":200}}}`))
+	if usage.PromptExcludesCache || usage.AudioPromptTokens != 200 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	assertCostUSD(t, "plain", usageCostUSD(pricing, usage), (2000*2.5+100*10)/1e6)
+
+	pricing.CacheRatio = 0.5
+	assertCostUSD(t, "cached", usageCostUSD(pricing, usage), (500*2.5+1500*1.25+100*10)/1e6)
+}
+
+func TestUsageLogRecordsPriceBookCostAndChargeback(t *testing.T) {
+	setupRouteSystemPromptProxyTest(t)
+	useResponseCacheForTest(t, map[string]string{
+		"PriceBook":            `[{"model":"gpt-4","model_ratio":5},{"model":"GPT-4","provider_id":91,"model_ratio":0.5,"sale_model_ratio":1}]`,
+		"PriceBookGroupMarkup": `{"research":1.5}`,
+	})
+	if err := model.DB.Create(&model.ModelPricing{ProviderId: 91, ModelName: "gpt-4", ModelRatio: 1, CompletionRatio: 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	upstream := newCountingJSONUpstream(&calls)
+	defer upstream.Close()
+
+	c, _ := newRouteSystemPromptProxyContext(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`)
+	c.Set("user", &model.User{Id: 1, UserGroup: "research"})
+	route := model.ModelRoute{ModelName: "gpt-4"}
+	if proxyErr := ProxyToUpstream(c, route, &model.ProviderToken{Id: 901}, &model.Provider{Id: 91, BaseURL: upstream.URL}); proxyErr != nil {
+		t.Fatalf("proxy: %#v", proxyErr)
+	}
+	logs := waitForUsageLogs(t, 901, 1)
+	if len(logs) != 1 {
+		t.Fatalf("expected one usage log, got %d", len(logs))
+	}
+	// 12 prompt + 3 completion tokens: cost at the provider override ratio
+	// 0.5, chargeback at the sale ratio 1 with the 1.5x group markup.
+	assertCostUSD(t, "cost", logs[0].CostUSD, (12*1+3*2)/1e6)
+	assertCostUSD(t, "chargeback", logs[0].ChargebackUSD, (12*2+3*4)/1e6*1.5)
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"NewAPI-Gateway/common"
+	"NewAPI-Gateway/model"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var usageMaintenanceLock sync.Mutex
+
+// RunUsageMaintenance rolls usage logs up into the hourly and daily rollups,
+// then prunes raw usage logs, route test results and LLM traces past their
+// retention.
+func RunUsageMaintenance() {
+	if !usageMaintenanceLock.TryLock() {
+		return
+	}
+	defer usageMaintenanceLock.Unlock()
+
+	now := time.Now()
+	hours, err := model.RollupUsageLogs(now)
+	if err != nil {
+		common.SysError("[usage] rollup failed: " + err.Error())
+	} else if hours > 0 {
+		common.SysLog(fmt.Sprintf("[usage] rolled up %d hour(s) of usage logs", hours))
+	}
+
+	cfg := common.LoadUsageRetentionConfig()
+	if cfg.UsageLogDays > 0 {
+		deleted, err := model.DeleteUsageLogsBefore(now.AddDate(0, 0, -cfg.UsageLogDays).Unix())
+		if err != nil {
+			common.SysError("[usage] failed to prune usage logs: " + err.Error())
+		} else if deleted > 0 {
+			common.SysLog(fmt.Sprintf("[usage] pruned %d usage log(s) older than %d days", deleted, cfg.UsageLogDays))
+		}
+		deleted, err = model.DeleteRouteTestResultsBefore(now.AddDate(0, 0, -cfg.UsageLogDays).Unix())
+		if err != nil {
+			common.SysError("[usage] failed to prune route test results: " + err.Error())
+		} else if deleted > 0 {
+			common.SysLog(fmt.Sprintf("[usage] pruned %d route test result(s) older than %d days", deleted, cfg.UsageLogDays))
+		}
+	}
+	if cfg.LLMTraceDays > 0 {
+		deleted, err := model.DeleteLLMTracesBefore(now.AddDate(0, 0, -cfg.LLMTraceDays).Unix())
+		if err != nil {
+			common.SysError("[usage] failed to prune llm traces: " + err.Error())
+		} else if deleted > 0 {
+			common.SysLog(fmt.Sprintf("[usage] pruned %d llm trace(s) older than %d days", deleted, cfg.LLMTraceDays))
+		}
+	}
+}
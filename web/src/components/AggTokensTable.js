@@ -62,6 +62,16 @@ const AggTokensTable = () => {
             model_limits_enabled: false,
             model_limits: '',
             allow_ips: '',
+            daily_budget_usd: 0,
+            monthly_budget_usd: 0,
+            daily_token_budget: 0,
+            monthly_token_budget: 0,
+            rate_limit_rpm: 0,
+            rate_limit_tpm: 0,
+            response_cache_enabled: false,
+            hedge_enabled: false,
+            routing_strategy: '',
+            retry_policy: '',
         });
         setShowModal(true);
     };
@@ -72,8 +82,17 @@ const AggTokensTable = () => {
     };
 
     const saveToken = async () => {
-        if (editToken.id) {
-            const res = await API.put('/api/agg-token/', editToken);
+        const payload = {
+            ...editToken,
+            daily_budget_usd: Number(editToken.daily_budget_usd) || 0,
+            monthly_budget_usd: Number(editToken.monthly_budget_usd) || 0,
+            daily_token_budget: parseInt(editToken.daily_token_budget, 10) || 0,
+            monthly_token_budget: parseInt(editToken.monthly_token_budget, 10) || 0,
+            rate_limit_rpm: parseInt(editToken.rate_limit_rpm, 10) || 0,
+            rate_limit_tpm: parseInt(editToken.rate_limit_tpm, 10) || 0,
+        };
+        if (payload.id) {
+            const res = await API.put('/api/agg-token/', payload);
             const { success, message } = res.data;
             if (success) {
                 showSuccess('更新成功');
@@ -83,7 +102,7 @@ const AggTokensTable = () => {
                 showError(message);
             }
         } else {
-            const res = await API.post('/api/agg-token/', editToken);
+            const res = await API.post('/api/agg-token/', payload);
             const { success, data, message } = res.data;
             if (success) {
                 showSuccess(`令牌创建成功：${data}`);
@@ -261,6 +280,92 @@ const AggTokensTable = () => {
                         </div>
                     )}
 
+                    <div style={{ display: 'grid', gridTemplateColumns: '1fr 1fr', gap: '0 1rem' }}>
+                        <Input
+                            label="每日预算（USD，0 不限）"
+                            type="number"
+                            min="0"
+                            step="0.01"
+                            value={editToken?.daily_budget_usd ?? 0}
+                            onChange={(e) => setEditToken({ ...editToken, daily_budget_usd: e.target.value })}
+                        />
+                        <Input
+                            label="每月预算（USD，0 不限）"
+                            type="number"
+                            min="0"
+                            step="0.01"
+                            value={editToken?.monthly_budget_usd ?? 0}
+                            onChange={(e) => setEditToken({ ...editToken, monthly_budget_usd: e.target.value })}
+                        />
+                        <Input
+                            label="每日 Token 上限（0 不限）"
+                            type="number"
+                            min="0"
+                            step="1"
+                            value={editToken?.daily_token_budget ?? 0}
+                            onChange={(e) => setEditToken({ ...editToken, daily_token_budget: e.target.value })}
+                        />
+                        <Input
+                            label="每月 Token 上限（0 不限）"
+                            type="number"
+                            min="0"
+                            step="1"
+                            value={editToken?.monthly_token_budget ?? 0}
+                            onChange={(e) => setEditToken({ ...editToken, monthly_token_budget: e.target.value })}
+                        />
+                        <Input
+                            label="每分钟请求数 RPM（0 不限）"
+                            type="number"
+                            min="0"
+                            step="1"
+                            value={editToken?.rate_limit_rpm ?? 0}
+                            onChange={(e) => setEditToken({ ...editToken, rate_limit_rpm: e.target.value })}
+                        />
+                        <Input
+                            label="每分钟 Token 数 TPM（0 不限）"
+                            type="number"
+                            min="0"
+                            step="1"
+                            value={editToken?.rate_limit_tpm ?? 0}
+                            onChange={(e) => setEditToken({ ...editToken, rate_limit_tpm: e.target.value })}
+                        />
+                    </div>
+
+                    <div style={{ display: 'flex', alignItems: 'center', marginBottom: '1rem' }}>
+                        <input
+                            type="checkbox"
+                            id="response_cache_enabled"
+                            checked={editToken?.response_cache_enabled || false}
+                            onChange={(e) => setEditToken({ ...editToken, response_cache_enabled: e.target.checked })}
+                            style={{ marginRight: '0.5rem' }}
+                        />
+                        <label htmlFor="response_cache_enabled">启用响应缓存（相同的非流式请求直接返回缓存结果，不计费）</label>
+                    </div>
+
+                    <div style={{ display: 'flex', alignItems: 'center', marginBottom: '1rem' }}>
+                        <input
+                            type="checkbox"
+                            id="hedge_enabled"
+                            checked={editToken?.hedge_enabled || false}
+                            onChange={(e) => setEditToken({ ...editToken, hedge_enabled: e.target.checked })}
+                            style={{ marginRight: '0.5rem' }}
+                        />
+                        <label htmlFor="hedge_enabled">启用对冲请求（非流式请求超过对冲延迟时并行请求下一条路由，可能产生双倍费用）</label>
+                    </div>
+
+                    <div style={{ marginBottom: '1rem' }}>
+                        <label style={{ display: 'block', fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '0.5rem' }}>路由策略</label>
+                        <select
+                            className='filter-select'
+                            value={editToken?.routing_strategy || ''}
+                            onChange={(e) => setEditToken({ ...editToken, routing_strategy: e.target.value })}
+                        >
+                            <option value=''>默认（按系统设置的低延迟模型列表）</option>
+                            <option value='value'>性价比优先</option>
+                            <option value='latency'>低延迟优先</option>
+                        </select>
+                    </div>
+
                     <div style={{ marginBottom: '1rem' }}>
                         <label style={{ display: 'block', fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '0.5rem' }}>IP 白名单（每行一个，留空不限制）</label>
                         <textarea
@@ -275,6 +380,23 @@ const AggTokensTable = () => {
                             }}
                         />
                     </div>
+
+                    <div style={{ marginBottom: '1rem' }}>
+                        <label style={{ display: 'block', fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '0.5rem' }}>重试策略（JSON，留空沿用系统设置）</label>
+                        <textarea
+                            rows={4}
+                            value={editToken?.retry_policy || ''}
+                            onChange={(e) => setEditToken({ ...editToken, retry_policy: e.target.value })}
+                            placeholder={'{"max_attempts": 3, "deadline_seconds": 60, "status_rules": {"429": "other_provider"}}'}
+                            style={{
+                                padding: '0.5rem',
+                                borderRadius: 'var(--radius-md)',
+                                border: '1px solid var(--border-color)',
+                                width: '100%',
+                                fontFamily: 'monospace'
+                            }}
+                        />
+                    </div>
                 </div>
             </Modal>
         </>
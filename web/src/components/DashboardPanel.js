@@ -5,7 +5,8 @@ import {
   XCircle,
   Server,
   Box,
-  GitBranch
+  GitBranch,
+  Database
 } from 'lucide-react';
 import { API, showError } from '../helpers';
 import Card from './ui/Card';
@@ -84,6 +85,12 @@ const DashboardPanel = () => {
         <StatCard title='活跃供应商' value={stats.total_providers} icon={Server} color='purple' />
         <StatCard title='可用模型' value={stats.total_models} icon={Box} color='cyan' />
         <StatCard title='路由条目' value={stats.total_routes} icon={GitBranch} color='orange' />
+        <StatCard
+          title='缓存命中（节省 $）'
+          value={`${stats.cache_hit_requests || 0} / ${(stats.cache_saved_usd || 0).toFixed(4)}`}
+          icon={Database}
+          color='green'
+        />
       </div>
 
       <DashboardTrendCards
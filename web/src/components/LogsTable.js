@@ -429,6 +429,11 @@ const LogsTable = ({ selfOnly }) => {
                       )}
                     </>
                   )}
+                  {log.hedge && (
+                    <Badge color='gray' style={{ marginLeft: '0.5rem' }}>
+                      {log.hedge === 'hedge' ? '对冲请求' : '对冲主请求'}
+                    </Badge>
+                  )}
                   <span className='log-time'>{formatTime(log.created_at)}</span>
                 </div>
               </div>
@@ -383,6 +383,47 @@ const renderCooldownStatus = (route) => {
     );
 };
 
+const renderProbeStatus = (route) => {
+    if (!route.probe_status) return null;
+    const probedAt = route.probed_at ? new Date(route.probed_at * 1000).toLocaleTimeString() : '';
+    let label = '探测成功';
+    let color = 'var(--success)';
+    if (route.probe_dead) {
+        label = `已失效（连续 ${route.probe_consecutive_failures} 次探测失败）`;
+        color = 'var(--error)';
+    } else if (route.probe_status === 'failure') {
+        label = `探测失败 ${route.probe_consecutive_failures} 次`;
+        color = 'var(--warning)';
+    } else if (route.probe_status === 'skipped') {
+        label = '本轮未探测';
+        color = 'var(--text-secondary)';
+    }
+    return (
+        <div style={{ ...helperTextStyle, marginTop: '0.18rem' }} title={route.probe_message || ''}>
+            <span style={{ color, fontWeight: 500 }}>{label}</span>
+            {route.probe_status !== 'skipped' && route.probe_latency_ms > 0 && ` · ${route.probe_latency_ms}ms`}
+            {probedAt && ` · ${probedAt}`}
+        </div>
+    );
+};
+
+const renderRouteTestResult = (result) => {
+    if (!result) return null;
+    const detail = result.success
+        ? [result.response_model, `${result.latency_ms}ms`, result.first_token_ms > 0 ? `首字 ${result.first_token_ms}ms` : '']
+        : [result.http_status ? `HTTP ${result.http_status}` : '', result.auto_disabled ? '已自动禁用' : ''];
+    return (
+        <div style={{ ...helperTextStyle, marginTop: '0.18rem' }} title={result.upstream_body || result.error_message || ''}>
+            <span style={{ color: result.success ? 'var(--success)' : 'var(--error)', fontWeight: 500 }}>
+                {result.success ? '测试通过' : '测试失败'}
+            </span>
+            {detail.filter(Boolean).map((item) => ` · ${item}`)}
+        </div>
+    );
+};
+
+const routeTestPollIntervalMs = 2000;
+
 const sortRoutesForDisplay = (rows) => [...rows].sort((a, b) => {
     const healthA = Number(a.health_value);
     const healthB = Number(b.health_value);
@@ -410,6 +451,9 @@ const ModelRoutesTable = () => {
     const [systemPrompts, setSystemPrompts] = useState([]);
     const [promptsLoading, setPromptsLoading] = useState(true);
     const [promptsError, setPromptsError] = useState('');
+    const [testingRouteIds, setTestingRouteIds] = useState({});
+    const [routeTestResults, setRouteTestResults] = useState({});
+    const [batchTesting, setBatchTesting] = useState(false);
     const promptRequestId = useRef(0);
 
     const handleDetailSort = useCallback((column) => {
@@ -474,6 +518,10 @@ const ModelRoutesTable = () => {
                         const freshPromptId = normalizeSystemPromptId(freshRoute.system_prompt_id);
                         if (draftPromptId !== freshPromptId) remaining.system_prompt_id = draftPromptId;
                     }
+                    if (Object.prototype.hasOwnProperty.call(draft, 'max_concurrency')
+                        && Number(draft.max_concurrency) !== Number(freshRoute.max_concurrency || 0)) {
+                        remaining.max_concurrency = draft.max_concurrency;
+                    }
                     if (Object.keys(remaining).length > 0) reconciledDrafts[id] = remaining;
                 });
                 return reconciledDrafts;
@@ -673,11 +721,13 @@ const ModelRoutesTable = () => {
             const baseDraft = {
                 enabled: original.enabled,
                 system_prompt_id: normalizeSystemPromptId(original.system_prompt_id),
+                max_concurrency: Number(original.max_concurrency || 0),
                 ...(prev[routeId] || {})
             };
             const nextDraft = { ...baseDraft, ...patch };
             const unchanged = nextDraft.enabled === original.enabled
-                && normalizeSystemPromptId(nextDraft.system_prompt_id) === normalizeSystemPromptId(original.system_prompt_id);
+                && normalizeSystemPromptId(nextDraft.system_prompt_id) === normalizeSystemPromptId(original.system_prompt_id)
+                && Number(nextDraft.max_concurrency) === Number(original.max_concurrency || 0);
             if (unchanged) {
                 const next = { ...prev };
                 delete next[routeId];
@@ -698,11 +748,13 @@ const ModelRoutesTable = () => {
                 const current = {
                     enabled: original.enabled,
                     system_prompt_id: normalizeSystemPromptId(original.system_prompt_id),
+                    max_concurrency: Number(original.max_concurrency || 0),
                     ...(next[route.id] || {})
                 };
                 current.enabled = enabled;
                 const unchanged = current.enabled === original.enabled
-                    && normalizeSystemPromptId(current.system_prompt_id) === normalizeSystemPromptId(original.system_prompt_id);
+                    && normalizeSystemPromptId(current.system_prompt_id) === normalizeSystemPromptId(original.system_prompt_id)
+                    && Number(current.max_concurrency) === Number(original.max_concurrency || 0);
                 if (unchanged) {
                     delete next[route.id];
                 } else {
@@ -726,6 +778,10 @@ const ModelRoutesTable = () => {
                 && draftPromptId !== normalizeSystemPromptId(original.system_prompt_id)) {
                 item.system_prompt_id = draftPromptId;
             }
+            if (Object.prototype.hasOwnProperty.call(value, 'max_concurrency')
+                && Number(value.max_concurrency) !== Number(original.max_concurrency || 0)) {
+                item.max_concurrency = Number(value.max_concurrency);
+            }
             return item;
         });
         if (items.length === 0) {
@@ -812,6 +868,76 @@ const ModelRoutesTable = () => {
         }
     };
 
+    const testRoute = async (route) => {
+        setTestingRouteIds((current) => ({ ...current, [route.id]: true }));
+        try {
+            const res = await API.post(`/api/route/${route.id}/test`, {});
+            const { success, message, data } = res.data;
+            if (!success) {
+                showError(message || '路由测试失败');
+                return;
+            }
+            setRouteTestResults((current) => ({ ...current, [route.id]: data }));
+            if (data.success) {
+                showSuccess('路由测试通过');
+            } else {
+                showError(`路由测试失败：${data.error_message || `HTTP ${data.http_status}`}`);
+            }
+        } catch (e) {
+            showError('路由测试失败');
+        } finally {
+            setTestingRouteIds((current) => {
+                const next = { ...current };
+                delete next[route.id];
+                return next;
+            });
+        }
+    };
+
+    const testModelRoutes = async (modelName) => {
+        setBatchTesting(true);
+        try {
+            const res = await API.post('/api/route/test', { model: modelName, enabled_only: true });
+            const { success, message, data } = res.data;
+            if (!success) {
+                showError(message || '启动路由测试失败');
+                return;
+            }
+            let batch = data;
+            let results = [];
+            while (batch.running) {
+                await new Promise((resolve) => setTimeout(resolve, routeTestPollIntervalMs));
+                const pollRes = await API.get(`/api/route/test/${batch.id}`);
+                if (!pollRes.data.success) {
+                    showError(pollRes.data.message || '获取路由测试进度失败');
+                    return;
+                }
+                batch = pollRes.data.data.batch;
+                results = pollRes.data.data.results || [];
+            }
+            setRouteTestResults((current) => {
+                const next = { ...current };
+                results.forEach((result) => {
+                    next[result.route_id] = result;
+                });
+                return next;
+            });
+            const summary = `路由测试完成：${batch.succeeded} 条通过，${batch.failed} 条失败`;
+            if (batch.failed > 0) {
+                showError(summary);
+            } else {
+                showSuccess(summary);
+            }
+            if (batch.auto_disabled > 0) {
+                await loadOverview();
+            }
+        } catch (e) {
+            showError('路由测试失败');
+        } finally {
+            setBatchTesting(false);
+        }
+    };
+
     const copyModelName = async (modelName) => {
         const ok = await copy(modelName);
         if (ok) {
@@ -1010,6 +1136,18 @@ const ModelRoutesTable = () => {
                                         >
                                             全部禁用
                                         </Button>
+                                        <Button
+                                            type="button"
+                                            variant="secondary"
+                                            size="sm"
+                                            className="routes-batch-status-button"
+                                            onClick={() => testModelRoutes(selectedEntry.modelName)}
+                                            loading={batchTesting}
+                                            disabled={saving || batchTesting}
+                                            title="向该模型的全部已启用路由发送测试请求"
+                                        >
+                                            测试全部
+                                        </Button>
                                         <label className="routes-switch" style={{ display: 'inline-flex', alignItems: 'center', gap: '0.35rem', fontSize: '0.8rem', color: 'var(--text-secondary)' }}>
                                             <input
                                                 type="checkbox"
@@ -1186,6 +1324,16 @@ const ModelRoutesTable = () => {
                                                             </Td>
                                                             <Td style={cellTopStyle}>
                                                                 {renderCooldownStatus(route)}
+                                                                {renderProbeStatus(route)}
+                                                                {renderRouteTestResult(routeTestResults[route.id])}
+                                                                <button
+                                                                    type="button"
+                                                                    onClick={() => testRoute(route)}
+                                                                    disabled={!route.id || Boolean(testingRouteIds[route.id])}
+                                                                    style={{ border: 'none', background: 'none', color: 'var(--primary-600)', cursor: 'pointer', fontSize: '0.78rem', padding: 0, marginTop: '0.25rem' }}
+                                                                >
+                                                                    {testingRouteIds[route.id] ? '测试中...' : '测试'}
+                                                                </button>
                                                             </Td>
                                                             <Td style={cellMiddleStyle}>
                                                                 <button
@@ -1238,6 +1386,19 @@ const ModelRoutesTable = () => {
                                                                         </>
                                                                     )}
                                                                 </select>
+                                                                <input
+                                                                    type="number"
+                                                                    min="0"
+                                                                    aria-label={`${route.provider_name || '路由'}最大并发`}
+                                                                    title="最大并发（0 为不限制）"
+                                                                    placeholder="最大并发"
+                                                                    value={Number(route.max_concurrency || 0)}
+                                                                    disabled={saving}
+                                                                    onChange={(e) => updateDraft(route.id, {
+                                                                        max_concurrency: Math.max(0, parseInt(e.target.value, 10) || 0)
+                                                                    })}
+                                                                    style={{ ...promptSelectStyle, marginTop: '0.35rem' }}
+                                                                />
                                                             </Td>
                                                             <Td style={cellTopStyle}>
                                                                 <div style={{ display: 'flex', flexDirection: 'column', gap: '0.35rem', alignItems: 'flex-start' }}>
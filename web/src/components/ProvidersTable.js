@@ -676,6 +676,12 @@ const ProvidersTable = () => {
               onChange={(e) => setEditProvider({ ...editProvider, priority: parseInt(e.target.value) || 0 })}
             />
           </div>
+          <Input
+            label="最大并发（0 为不限制）"
+            type="number"
+            value={editProvider?.max_concurrency || 0}
+            onChange={(e) => setEditProvider({ ...editProvider, max_concurrency: Math.max(0, parseInt(e.target.value) || 0) })}
+          />
 
           {!isKeyOnlyProvider && (
             <div style={{ display: 'flex', alignItems: 'center', marginBottom: '1rem' }}>
@@ -31,7 +31,52 @@ const SystemSetting = () => {
     RoutingHealthAdjustmentEnabled: 'true',
     RoutingPriceGuardEnabled: 'true',
     RoutingPriceGuardMaxUnitPrice: '75',
+    RoutingLatencyModels: '',
+    StreamFailoverEnabled: 'false',
+    StreamFailoverMaxBufferBytes: '65536',
+    StreamFailoverFirstContentTimeoutSeconds: '15',
+    RouteAffinityEnabled: 'false',
+    RouteAffinityTTLSeconds: '3600',
+    RouteAffinityHeader: 'X-Session-Id',
+    HedgeModels: '',
+    HedgeDelayMs: '1000',
+    HedgeAdaptiveDelayEnabled: 'true',
+    RouteProbeEnabled: 'false',
+    RouteProbeIntervalMinutes: '10',
+    RouteProbeProviderDailyCostUSD: '0.1',
+    RouteProbeDeadAfterFailures: '3',
+    ProviderBreakerEnabled: 'false',
+    ProviderBreakerFailureThreshold: '10',
+    ProviderBreakerWindowSeconds: '60',
+    ProviderBreakerOpenSeconds: '60',
+    ProviderBreakerMaxOpenSeconds: '600',
+    RetryMaxAttempts: '0',
+    RetryDeadlineSeconds: '0',
+    RetryBackoffMs: '0',
+    RetryBackoffMaxMs: '5000',
+    RetryStatusRules: '',
+    RetryModelPolicies: '',
+    ConcurrencyQueueSize: '100',
+    ConcurrencyQueueTimeoutMs: '10000',
+    ResponseCacheModels: '',
+    ResponseCacheTTLSeconds: '3600',
+    ResponseCacheMaxEntryBytes: '1048576',
+    ResponseCacheMaxEntries: '1000',
+    AlertEnabled: 'false',
+    AlertWebhookURL: '',
+    AlertWebhookFormat: 'generic',
+    AlertEmailReceivers: '',
+    AlertBalanceThresholdUSD: '0',
+    AlertSyncFailureThreshold: '3',
+    AlertKeyCooldownMinutes: '30',
+    AlertCPAStoppedEnabled: 'true',
+    AlertQuietPeriodMinutes: '60',
+    VirtualModels: '',
+    PriceBook: '',
+    PriceBookGroupMarkup: '',
     LLMTraceEnabled: 'false',
+    UsageLogRetentionDays: '0',
+    LLMTraceRetentionDays: '0',
   });
   const [originInputs, setOriginInputs] = useState({});
   const [dbInfo, setDbInfo] = useState({ driver: '', sqlitePath: '' });
@@ -88,6 +133,13 @@ const SystemSetting = () => {
       case 'RegisterEnabled':
       case 'RoutingHealthAdjustmentEnabled':
       case 'RoutingPriceGuardEnabled':
+      case 'StreamFailoverEnabled':
+      case 'RouteAffinityEnabled':
+      case 'HedgeAdaptiveDelayEnabled':
+      case 'RouteProbeEnabled':
+      case 'ProviderBreakerEnabled':
+      case 'AlertEnabled':
+      case 'AlertCPAStoppedEnabled':
       case 'LLMTraceEnabled':
       case 'ProxyEnabled':
         value = inputs[key] === 'true' ? 'false' : 'true';
@@ -123,7 +175,23 @@ const SystemSetting = () => {
       name === 'RoutingUsageWindowHours' ||
       name === 'RoutingBaseWeightFactor' ||
       name === 'RoutingValueScoreFactor' ||
-      name === 'RoutingPriceGuardMaxUnitPrice'
+      name === 'RoutingPriceGuardMaxUnitPrice' ||
+      name === 'RoutingLatencyModels' ||
+      name === 'StreamFailoverMaxBufferBytes' ||
+      name === 'StreamFailoverFirstContentTimeoutSeconds' ||
+      name.startsWith('ResponseCache') ||
+      name === 'RouteAffinityTTLSeconds' ||
+      name === 'RouteAffinityHeader' ||
+      name === 'HedgeModels' ||
+      name === 'HedgeDelayMs' ||
+      (name.startsWith('RouteProbe') && name !== 'RouteProbeEnabled') ||
+      (name.startsWith('ProviderBreaker') && name !== 'ProviderBreakerEnabled') ||
+      name.startsWith('Retry') ||
+      name.startsWith('ConcurrencyQueue') ||
+      name.endsWith('RetentionDays') ||
+      name === 'VirtualModels' ||
+      name.startsWith('PriceBook') ||
+      (name.startsWith('Alert') && name !== 'AlertWebhookFormat')
     ) {
       setInputs((inputs) => ({ ...inputs, [name]: value }));
     } else {
@@ -246,6 +314,17 @@ const SystemSetting = () => {
       return;
     }
 
+    const rawFailoverBufferBytes = Number.parseInt(String(inputs.StreamFailoverMaxBufferBytes || '').trim(), 10);
+    const rawFailoverTimeout = Number.parseInt(String(inputs.StreamFailoverFirstContentTimeoutSeconds || '').trim(), 10);
+    if (!Number.isInteger(rawFailoverBufferBytes) || rawFailoverBufferBytes < 1024 || rawFailoverBufferBytes > 8388608) {
+      showError('流式缓冲上限必须是 1024 到 8388608 字节');
+      return;
+    }
+    if (!Number.isInteger(rawFailoverTimeout) || rawFailoverTimeout < 0 || rawFailoverTimeout > 600) {
+      showError('首个内容超时必须是 0 到 600 秒');
+      return;
+    }
+
     const nextWindow = String(rawWindow);
     const nextBaseFactor = String(rawBaseFactor);
     const nextValueFactor = String(rawValueFactor);
@@ -271,6 +350,320 @@ const SystemSetting = () => {
     if (originInputs['RoutingPriceGuardMaxUnitPrice'] !== nextPriceGuardMaxUnitPrice) {
       await updateOption('RoutingPriceGuardMaxUnitPrice', nextPriceGuardMaxUnitPrice);
     }
+    const nextLatencyModels = String(inputs.RoutingLatencyModels || '').split(',').map((m) => m.trim()).filter(Boolean).join(',');
+    if (originInputs['RoutingLatencyModels'] !== nextLatencyModels) {
+      await updateOption('RoutingLatencyModels', nextLatencyModels);
+    }
+    if (originInputs['StreamFailoverMaxBufferBytes'] !== String(rawFailoverBufferBytes)) {
+      await updateOption('StreamFailoverMaxBufferBytes', String(rawFailoverBufferBytes));
+    }
+    if (originInputs['StreamFailoverFirstContentTimeoutSeconds'] !== String(rawFailoverTimeout)) {
+      await updateOption('StreamFailoverFirstContentTimeoutSeconds', String(rawFailoverTimeout));
+    }
+  };
+
+  const submitResponseCache = async () => {
+    const rawTTL = Number.parseInt(String(inputs.ResponseCacheTTLSeconds || '').trim(), 10);
+    const rawEntryBytes = Number.parseInt(String(inputs.ResponseCacheMaxEntryBytes || '').trim(), 10);
+    const rawEntries = Number.parseInt(String(inputs.ResponseCacheMaxEntries || '').trim(), 10);
+    if (!Number.isInteger(rawTTL) || rawTTL < 1 || rawTTL > 604800) {
+      showError('响应缓存有效期必须是 1 到 604800 秒');
+      return;
+    }
+    if (!Number.isInteger(rawEntryBytes) || rawEntryBytes < 1024 || rawEntryBytes > 16777216) {
+      showError('单条缓存上限必须是 1024 到 16777216 字节');
+      return;
+    }
+    if (!Number.isInteger(rawEntries) || rawEntries < 1 || rawEntries > 100000) {
+      showError('内存缓存条目上限必须是 1 到 100000');
+      return;
+    }
+    const nextModels = String(inputs.ResponseCacheModels || '').split(',').map((m) => m.trim()).filter(Boolean).join(',');
+    if (originInputs['ResponseCacheModels'] !== nextModels) {
+      await updateOption('ResponseCacheModels', nextModels);
+    }
+    if (originInputs['ResponseCacheTTLSeconds'] !== String(rawTTL)) {
+      await updateOption('ResponseCacheTTLSeconds', String(rawTTL));
+    }
+    if (originInputs['ResponseCacheMaxEntryBytes'] !== String(rawEntryBytes)) {
+      await updateOption('ResponseCacheMaxEntryBytes', String(rawEntryBytes));
+    }
+    if (originInputs['ResponseCacheMaxEntries'] !== String(rawEntries)) {
+      await updateOption('ResponseCacheMaxEntries', String(rawEntries));
+    }
+  };
+
+  const submitRouteAffinity = async () => {
+    const rawTTL = Number.parseInt(String(inputs.RouteAffinityTTLSeconds || '').trim(), 10);
+    if (!Number.isInteger(rawTTL) || rawTTL < 60 || rawTTL > 86400) {
+      showError('会话粘性有效期必须是 60 到 86400 秒');
+      return;
+    }
+    const nextHeader = String(inputs.RouteAffinityHeader || '').trim();
+    if (/[\s:]/.test(nextHeader)) {
+      showError('会话请求头名称不能包含空白或冒号');
+      return;
+    }
+    if (originInputs['RouteAffinityTTLSeconds'] !== String(rawTTL)) {
+      await updateOption('RouteAffinityTTLSeconds', String(rawTTL));
+    }
+    if (originInputs['RouteAffinityHeader'] !== nextHeader) {
+      await updateOption('RouteAffinityHeader', nextHeader);
+    }
+  };
+
+  const submitHedge = async () => {
+    const rawDelay = Number.parseInt(String(inputs.HedgeDelayMs || '').trim(), 10);
+    if (!Number.isInteger(rawDelay) || rawDelay < 50 || rawDelay > 60000) {
+      showError('对冲延迟必须是 50 到 60000 毫秒');
+      return;
+    }
+    const nextModels = String(inputs.HedgeModels || '').split(',').map((m) => m.trim()).filter(Boolean).join(',');
+    if (originInputs['HedgeModels'] !== nextModels) {
+      await updateOption('HedgeModels', nextModels);
+    }
+    if (originInputs['HedgeDelayMs'] !== String(rawDelay)) {
+      await updateOption('HedgeDelayMs', String(rawDelay));
+    }
+  };
+
+  const submitRouteProbe = async () => {
+    const rawInterval = Number.parseInt(String(inputs.RouteProbeIntervalMinutes || '').trim(), 10);
+    if (!Number.isInteger(rawInterval) || rawInterval < 1 || rawInterval > 1440) {
+      showError('探测间隔必须是 1 到 1440 分钟');
+      return;
+    }
+    const rawCost = Number.parseFloat(String(inputs.RouteProbeProviderDailyCostUSD || '').trim());
+    if (!Number.isFinite(rawCost) || rawCost < 0 || rawCost > 1000) {
+      showError('每日探测成本上限必须是 0 到 1000 美元');
+      return;
+    }
+    const rawFailures = Number.parseInt(String(inputs.RouteProbeDeadAfterFailures || '').trim(), 10);
+    if (!Number.isInteger(rawFailures) || rawFailures < 1 || rawFailures > 100) {
+      showError('连续失败次数必须是 1 到 100');
+      return;
+    }
+    if (originInputs['RouteProbeIntervalMinutes'] !== String(rawInterval)) {
+      await updateOption('RouteProbeIntervalMinutes', String(rawInterval));
+    }
+    if (originInputs['RouteProbeProviderDailyCostUSD'] !== String(rawCost)) {
+      await updateOption('RouteProbeProviderDailyCostUSD', String(rawCost));
+    }
+    if (originInputs['RouteProbeDeadAfterFailures'] !== String(rawFailures)) {
+      await updateOption('RouteProbeDeadAfterFailures', String(rawFailures));
+    }
+  };
+
+  const submitProviderBreaker = async () => {
+    const rawThreshold = Number.parseInt(String(inputs.ProviderBreakerFailureThreshold || '').trim(), 10);
+    if (!Number.isInteger(rawThreshold) || rawThreshold < 1 || rawThreshold > 1000) {
+      showError('失败次数阈值必须是 1 到 1000');
+      return;
+    }
+    const rawWindow = Number.parseInt(String(inputs.ProviderBreakerWindowSeconds || '').trim(), 10);
+    if (!Number.isInteger(rawWindow) || rawWindow < 1 || rawWindow > 3600) {
+      showError('统计窗口必须是 1 到 3600 秒');
+      return;
+    }
+    const rawOpen = Number.parseInt(String(inputs.ProviderBreakerOpenSeconds || '').trim(), 10);
+    if (!Number.isInteger(rawOpen) || rawOpen < 1 || rawOpen > 86400) {
+      showError('熔断时长必须是 1 到 86400 秒');
+      return;
+    }
+    const rawMaxOpen = Number.parseInt(String(inputs.ProviderBreakerMaxOpenSeconds || '').trim(), 10);
+    if (!Number.isInteger(rawMaxOpen) || rawMaxOpen < rawOpen || rawMaxOpen > 86400) {
+      showError('最长熔断时长必须不小于熔断时长且不超过 86400 秒');
+      return;
+    }
+    if (originInputs['ProviderBreakerFailureThreshold'] !== String(rawThreshold)) {
+      await updateOption('ProviderBreakerFailureThreshold', String(rawThreshold));
+    }
+    if (originInputs['ProviderBreakerWindowSeconds'] !== String(rawWindow)) {
+      await updateOption('ProviderBreakerWindowSeconds', String(rawWindow));
+    }
+    if (originInputs['ProviderBreakerOpenSeconds'] !== String(rawOpen)) {
+      await updateOption('ProviderBreakerOpenSeconds', String(rawOpen));
+    }
+    if (originInputs['ProviderBreakerMaxOpenSeconds'] !== String(rawMaxOpen)) {
+      await updateOption('ProviderBreakerMaxOpenSeconds', String(rawMaxOpen));
+    }
+  };
+
+  const submitRetryPolicy = async () => {
+    const rawMaxAttempts = Number.parseInt(String(inputs.RetryMaxAttempts || '').trim(), 10);
+    if (!Number.isInteger(rawMaxAttempts) || rawMaxAttempts < 0 || rawMaxAttempts > 100) {
+      showError('最大尝试次数必须是 0 到 100');
+      return;
+    }
+    const rawDeadline = Number.parseInt(String(inputs.RetryDeadlineSeconds || '').trim(), 10);
+    if (!Number.isInteger(rawDeadline) || rawDeadline < 0 || rawDeadline > 3600) {
+      showError('请求总时限必须是 0 到 3600 秒');
+      return;
+    }
+    const rawBackoff = Number.parseInt(String(inputs.RetryBackoffMs || '').trim(), 10);
+    if (!Number.isInteger(rawBackoff) || rawBackoff < 0 || rawBackoff > 60000) {
+      showError('重试间隔必须是 0 到 60000 毫秒');
+      return;
+    }
+    const rawBackoffMax = Number.parseInt(String(inputs.RetryBackoffMaxMs || '').trim(), 10);
+    if (!Number.isInteger(rawBackoffMax) || rawBackoffMax < 0 || rawBackoffMax > 60000) {
+      showError('最大重试间隔必须是 0 到 60000 毫秒');
+      return;
+    }
+    const jsonValues = {};
+    for (const [key, label] of [['RetryStatusRules', '状态码规则'], ['RetryModelPolicies', '模型重试策略']]) {
+      let nextValue = String(inputs[key] || '').trim();
+      if (nextValue !== '') {
+        try {
+          nextValue = JSON.stringify(JSON.parse(nextValue), null, 2);
+        } catch (e) {
+          showError(`${label}不是合法的 JSON`);
+          return;
+        }
+      }
+      jsonValues[key] = nextValue;
+    }
+    if (originInputs['RetryMaxAttempts'] !== String(rawMaxAttempts)) {
+      await updateOption('RetryMaxAttempts', String(rawMaxAttempts));
+    }
+    if (originInputs['RetryDeadlineSeconds'] !== String(rawDeadline)) {
+      await updateOption('RetryDeadlineSeconds', String(rawDeadline));
+    }
+    if (originInputs['RetryBackoffMs'] !== String(rawBackoff)) {
+      await updateOption('RetryBackoffMs', String(rawBackoff));
+    }
+    if (originInputs['RetryBackoffMaxMs'] !== String(rawBackoffMax)) {
+      await updateOption('RetryBackoffMaxMs', String(rawBackoffMax));
+    }
+    for (const [key, nextValue] of Object.entries(jsonValues)) {
+      if (originInputs[key] !== nextValue) {
+        await updateOption(key, nextValue);
+      }
+    }
+  };
+
+  const submitConcurrencyQueue = async () => {
+    const rawSize = Number.parseInt(String(inputs.ConcurrencyQueueSize || '').trim(), 10);
+    if (!Number.isInteger(rawSize) || rawSize < 0 || rawSize > 10000) {
+      showError('排队上限必须是 0 到 10000');
+      return;
+    }
+    const rawTimeout = Number.parseInt(String(inputs.ConcurrencyQueueTimeoutMs || '').trim(), 10);
+    if (!Number.isInteger(rawTimeout) || rawTimeout < 100 || rawTimeout > 300000) {
+      showError('排队超时必须是 100 到 300000 毫秒');
+      return;
+    }
+    if (originInputs['ConcurrencyQueueSize'] !== String(rawSize)) {
+      await updateOption('ConcurrencyQueueSize', String(rawSize));
+    }
+    if (originInputs['ConcurrencyQueueTimeoutMs'] !== String(rawTimeout)) {
+      await updateOption('ConcurrencyQueueTimeoutMs', String(rawTimeout));
+    }
+  };
+
+  const submitVirtualModels = async () => {
+    let nextValue = String(inputs.VirtualModels || '').trim();
+    if (nextValue !== '') {
+      try {
+        nextValue = JSON.stringify(JSON.parse(nextValue), null, 2);
+      } catch (e) {
+        showError('虚拟模型配置不是合法的 JSON');
+        return;
+      }
+    }
+    if (originInputs['VirtualModels'] !== nextValue) {
+      await updateOption('VirtualModels', nextValue);
+    }
+  };
+
+  const submitPriceBook = async () => {
+    const next = {};
+    for (const key of ['PriceBook', 'PriceBookGroupMarkup']) {
+      let value = String(inputs[key] || '').trim();
+      if (value !== '') {
+        try {
+          value = JSON.stringify(JSON.parse(value), null, 2);
+        } catch (e) {
+          showError(key === 'PriceBook' ? '价目表不是合法的 JSON' : '分组加价倍率不是合法的 JSON');
+          return;
+        }
+      }
+      next[key] = value;
+    }
+    for (const key of Object.keys(next)) {
+      if (originInputs[key] !== next[key]) {
+        await updateOption(key, next[key]);
+      }
+    }
+  };
+
+  const submitRetention = async () => {
+    const rawUsageDays = Number.parseInt(String(inputs.UsageLogRetentionDays || '0').trim(), 10);
+    const rawTraceDays = Number.parseInt(String(inputs.LLMTraceRetentionDays || '0').trim(), 10);
+    if (!Number.isInteger(rawUsageDays) || rawUsageDays < 0 || rawUsageDays > 3650 || (rawUsageDays > 0 && rawUsageDays < 32)) {
+      showError('使用日志保留天数必须是 0 或 32 到 3650');
+      return;
+    }
+    if (!Number.isInteger(rawTraceDays) || rawTraceDays < 0 || rawTraceDays > 3650) {
+      showError('LLM 追踪保留天数必须是 0 到 3650');
+      return;
+    }
+    if (originInputs['UsageLogRetentionDays'] !== String(rawUsageDays)) {
+      await updateOption('UsageLogRetentionDays', String(rawUsageDays));
+    }
+    if (originInputs['LLMTraceRetentionDays'] !== String(rawTraceDays)) {
+      await updateOption('LLMTraceRetentionDays', String(rawTraceDays));
+    }
+  };
+
+  const submitAlert = async () => {
+    const rawBalance = Number.parseFloat(String(inputs.AlertBalanceThresholdUSD || '0').trim());
+    const rawSyncFailures = Number.parseInt(String(inputs.AlertSyncFailureThreshold || '0').trim(), 10);
+    const rawKeyCooldown = Number.parseInt(String(inputs.AlertKeyCooldownMinutes || '0').trim(), 10);
+    const rawQuiet = Number.parseInt(String(inputs.AlertQuietPeriodMinutes || '').trim(), 10);
+    if (!Number.isFinite(rawBalance) || rawBalance < 0 || rawBalance > 1000000) {
+      showError('余额告警阈值必须在 0 到 1000000 之间');
+      return;
+    }
+    if (!Number.isInteger(rawSyncFailures) || rawSyncFailures < 0 || rawSyncFailures > 1000) {
+      showError('同步失败次数阈值必须是 0 到 1000');
+      return;
+    }
+    if (!Number.isInteger(rawKeyCooldown) || rawKeyCooldown < 0 || rawKeyCooldown > 10080) {
+      showError('令牌冷却告警时长必须是 0 到 10080 分钟');
+      return;
+    }
+    if (!Number.isInteger(rawQuiet) || rawQuiet < 1 || rawQuiet > 10080) {
+      showError('告警静默期必须是 1 到 10080 分钟');
+      return;
+    }
+    const next = {
+      AlertWebhookURL: String(inputs.AlertWebhookURL || '').trim(),
+      AlertEmailReceivers: String(inputs.AlertEmailReceivers || '').trim(),
+      AlertBalanceThresholdUSD: String(rawBalance),
+      AlertSyncFailureThreshold: String(rawSyncFailures),
+      AlertKeyCooldownMinutes: String(rawKeyCooldown),
+      AlertQuietPeriodMinutes: String(rawQuiet),
+    };
+    for (const [key, value] of Object.entries(next)) {
+      if (originInputs[key] !== value) {
+        await updateOption(key, value);
+      }
+    }
+  };
+
+  const testAlert = async () => {
+    try {
+      const res = await API.post('/api/option/test-alert');
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess('测试告警已发送');
+      } else {
+        showError(message || '测试告警发送失败');
+      }
+    } catch (error) {
+      showError('测试告警发送失败：' + error.message);
+    }
   };
 
   const Checkbox = ({ label, name, checked, onChange }) => (
@@ -352,6 +745,34 @@ const SystemSetting = () => {
           name='LLMTraceEnabled'
           onChange={handleCheckboxChange}
         />
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', margin: '1rem 0' }}>
+          使用日志每 10 分钟汇总为小时/天统计，仪表盘与日志汇总读取汇总数据；超过保留天数的原始记录分批删除，统计总量不受影响。填 0 表示永久保留。
+        </p>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='使用日志保留天数'
+            type='number'
+            name='UsageLogRetentionDays'
+            onChange={handleInputChange}
+            value={inputs.UsageLogRetentionDays}
+            min='0'
+            max='3650'
+            step='1'
+            placeholder='0 或至少 32'
+          />
+          <Input
+            label='LLM 追踪保留天数'
+            type='number'
+            name='LLMTraceRetentionDays'
+            onChange={handleInputChange}
+            value={inputs.LLMTraceRetentionDays}
+            min='0'
+            max='3650'
+            step='1'
+            placeholder='默认 0'
+          />
+        </div>
+        <Button onClick={submitRetention} variant="secondary" disabled={loading}>保存数据保留设置</Button>
 
         <div style={{ borderTop: '1px solid var(--border-color)', margin: '1.5rem 0' }}></div>
 
@@ -481,9 +902,577 @@ const SystemSetting = () => {
         <p style={{ fontSize: '0.8125rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
           当前规则固定为“按本小时失败次数扣减健康值”，每到下一个整点小时自动重置为 0；这里不再提供惩罚系数、奖励系数、倍率上下限等旧参数配置。
         </p>
+        <div style={{ borderTop: '1px dashed var(--border-color)', margin: '1rem 0' }}></div>
+        <div style={{ marginBottom: '0.5rem', fontWeight: 600, color: 'var(--text-primary)' }}>低延迟路由</div>
+        <p style={{ fontSize: '0.8125rem', color: 'var(--text-secondary)', marginBottom: '0.75rem' }}>
+          列出的模型默认按实时首字延迟（EWMA）在同一健康层内选择最快的路由，适合 Claude Code 等交互式客户端；聚合令牌上单独设置的路由策略优先。统计仅保存在当前进程内存中，15 分钟无请求的路由会重新探测。
+        </p>
+        <div style={{ marginBottom: '1rem' }}>
+          <Input
+            label='低延迟路由模型（逗号分隔）'
+            name='RoutingLatencyModels'
+            onChange={handleInputChange}
+            value={inputs.RoutingLatencyModels}
+            placeholder='例如：claude-sonnet-4-5,gpt-4o'
+          />
+        </div>
+        <div style={{ borderTop: '1px dashed var(--border-color)', margin: '1rem 0' }}></div>
+        <div style={{ marginBottom: '0.5rem', fontWeight: 600, color: 'var(--text-primary)' }}>流式故障转移</div>
+        <p style={{ fontSize: '0.8125rem', color: 'var(--text-secondary)', marginBottom: '0.75rem' }}>
+          开启后，流式响应会先缓冲到出现首个内容（或超过缓冲上限）再发送给客户端；在此之前上游报错、中断或超时未产出内容时，自动切换到下一条路由重试。
+        </p>
+        <div style={{ marginBottom: '0.75rem' }}>
+          <Checkbox
+            checked={inputs.StreamFailoverEnabled === 'true'}
+            label='启用首个内容前的流式故障转移'
+            name='StreamFailoverEnabled'
+            onChange={handleCheckboxChange}
+          />
+        </div>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='缓冲上限（字节）'
+            type='number'
+            name='StreamFailoverMaxBufferBytes'
+            onChange={handleInputChange}
+            value={inputs.StreamFailoverMaxBufferBytes}
+            min='1024'
+            max='8388608'
+            step='1024'
+            placeholder='默认 65536'
+            disabled={inputs.StreamFailoverEnabled !== 'true'}
+          />
+          <Input
+            label='首个内容超时（秒，0 不限）'
+            type='number'
+            name='StreamFailoverFirstContentTimeoutSeconds'
+            onChange={handleInputChange}
+            value={inputs.StreamFailoverFirstContentTimeoutSeconds}
+            min='0'
+            max='600'
+            step='1'
+            placeholder='默认 15'
+            disabled={inputs.StreamFailoverEnabled !== 'true'}
+          />
+        </div>
         <Button onClick={submitRoutingTuning} variant="secondary" disabled={loading}>保存路由策略参数</Button>
       </Card>
 
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>响应缓存</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          对 /v1/chat/completions 与 /v1/embeddings 的非流式请求做精确匹配缓存；令牌开启“响应缓存”或模型在下方列表中时生效，命中记录为零费用。
+        </p>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='全局缓存模型（逗号分隔）'
+            name='ResponseCacheModels'
+            onChange={handleInputChange}
+            value={inputs.ResponseCacheModels}
+            placeholder='例如：text-embedding-3-small'
+          />
+          <Input
+            label='有效期（秒）'
+            type='number'
+            name='ResponseCacheTTLSeconds'
+            onChange={handleInputChange}
+            value={inputs.ResponseCacheTTLSeconds}
+            min='1'
+            max='604800'
+            step='1'
+            placeholder='默认 3600'
+          />
+          <Input
+            label='单条上限（字节）'
+            type='number'
+            name='ResponseCacheMaxEntryBytes'
+            onChange={handleInputChange}
+            value={inputs.ResponseCacheMaxEntryBytes}
+            min='1024'
+            max='16777216'
+            step='1024'
+            placeholder='默认 1048576'
+          />
+          <Input
+            label='内存条目上限'
+            type='number'
+            name='ResponseCacheMaxEntries'
+            onChange={handleInputChange}
+            value={inputs.ResponseCacheMaxEntries}
+            min='1'
+            max='100000'
+            step='1'
+            placeholder='默认 1000'
+          />
+        </div>
+        <Button onClick={submitResponseCache} variant="secondary" disabled={loading}>保存响应缓存设置</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>会话粘性</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          同一会话的后续请求优先使用上次成功的路由，以便命中上游的 Prompt 缓存。会话按请求头、prompt_cache_key、metadata.user_id 或首条用户消息的哈希识别；上次路由冷却或不可用时自动改绑到新的路由。
+        </p>
+        <div style={{ marginBottom: '0.75rem' }}>
+          <Checkbox
+            checked={inputs.RouteAffinityEnabled === 'true'}
+            label='启用会话粘性路由'
+            name='RouteAffinityEnabled'
+            onChange={handleCheckboxChange}
+          />
+        </div>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='有效期（秒）'
+            type='number'
+            name='RouteAffinityTTLSeconds'
+            onChange={handleInputChange}
+            value={inputs.RouteAffinityTTLSeconds}
+            min='60'
+            max='86400'
+            step='1'
+            placeholder='默认 3600'
+          />
+          <Input
+            label='会话请求头'
+            name='RouteAffinityHeader'
+            onChange={handleInputChange}
+            value={inputs.RouteAffinityHeader}
+            placeholder='默认 X-Session-Id，留空不读取'
+          />
+        </div>
+        <Button onClick={submitRouteAffinity} variant="secondary" disabled={loading}>保存会话粘性设置</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>对冲请求</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          非流式请求在对冲延迟内未返回时，并行向下一条路由再发一次请求，先成功者返回给客户端，另一条被取消。两次请求都会记录在使用日志中，可能产生双倍费用，建议只对 Embeddings、Rerank 等短请求开启。令牌开启“对冲请求”或模型在下方列表中时生效。
+        </p>
+        <div style={{ marginBottom: '0.75rem' }}>
+          <Checkbox
+            checked={inputs.HedgeAdaptiveDelayEnabled === 'true'}
+            label='按路由实时 P90 耗时自动设置对冲延迟'
+            name='HedgeAdaptiveDelayEnabled'
+            onChange={handleCheckboxChange}
+          />
+        </div>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='全局对冲模型（逗号分隔）'
+            name='HedgeModels'
+            onChange={handleInputChange}
+            value={inputs.HedgeModels}
+            placeholder='例如：text-embedding-3-small'
+          />
+          <Input
+            label='对冲延迟（毫秒）'
+            type='number'
+            name='HedgeDelayMs'
+            onChange={handleInputChange}
+            value={inputs.HedgeDelayMs}
+            min='50'
+            max='60000'
+            step='50'
+            placeholder='默认 1000，无耗时样本时使用'
+          />
+        </div>
+        <Button onClick={submitHedge} variant="secondary" disabled={loading}>保存对冲请求设置</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>路由主动探测</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          按间隔向每条启用的路由发送一次最小请求（max_tokens=1），结果计入路由冷却与健康度，并显示在路由总览中。连续失败达到次数的路由会被标记为失效，开启告警时发送“路由失效”告警。探测请求会产生少量费用并记录在使用日志中（聚合令牌 ID 为 0），每个供应商每天的探测费用达到上限后停止探测，0 表示不限。
+        </p>
+        <div style={{ marginBottom: '0.75rem' }}>
+          <Checkbox
+            checked={inputs.RouteProbeEnabled === 'true'}
+            label='启用路由主动探测'
+            name='RouteProbeEnabled'
+            onChange={handleCheckboxChange}
+          />
+        </div>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='探测间隔（分钟）'
+            type='number'
+            name='RouteProbeIntervalMinutes'
+            onChange={handleInputChange}
+            value={inputs.RouteProbeIntervalMinutes}
+            min='1'
+            max='1440'
+            step='1'
+            placeholder='默认 10'
+          />
+          <Input
+            label='每个供应商每日探测成本上限（美元）'
+            type='number'
+            name='RouteProbeProviderDailyCostUSD'
+            onChange={handleInputChange}
+            value={inputs.RouteProbeProviderDailyCostUSD}
+            min='0'
+            max='1000'
+            step='0.01'
+            placeholder='默认 0.1，0 表示不限'
+          />
+          <Input
+            label='判定失效的连续失败次数'
+            type='number'
+            name='RouteProbeDeadAfterFailures'
+            onChange={handleInputChange}
+            value={inputs.RouteProbeDeadAfterFailures}
+            min='1'
+            max='100'
+            step='1'
+            placeholder='默认 3'
+          />
+        </div>
+        <Button onClick={submitRouteProbe} variant="secondary" disabled={loading}>保存主动探测设置</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>供应商熔断</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          供应商站点整体不可用（网络/DNS/TLS 错误、网关错误页或 Cloudflare 挑战页）时，统计窗口内的失败次数达到阈值即熔断该供应商的全部路由，期间请求直接尝试其他供应商。熔断到期后放行一个半开探测请求：成功则恢复，失败则熔断时长翻倍（不超过最长熔断时长）。供应商返回任何正常响应都会重新计数。
+        </p>
+        <div style={{ marginBottom: '0.75rem' }}>
+          <Checkbox
+            checked={inputs.ProviderBreakerEnabled === 'true'}
+            label='启用供应商熔断'
+            name='ProviderBreakerEnabled'
+            onChange={handleCheckboxChange}
+          />
+        </div>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='失败次数阈值'
+            type='number'
+            name='ProviderBreakerFailureThreshold'
+            onChange={handleInputChange}
+            value={inputs.ProviderBreakerFailureThreshold}
+            min='1'
+            max='1000'
+            step='1'
+            placeholder='默认 10'
+          />
+          <Input
+            label='统计窗口（秒）'
+            type='number'
+            name='ProviderBreakerWindowSeconds'
+            onChange={handleInputChange}
+            value={inputs.ProviderBreakerWindowSeconds}
+            min='1'
+            max='3600'
+            step='1'
+            placeholder='默认 60'
+          />
+          <Input
+            label='熔断时长（秒）'
+            type='number'
+            name='ProviderBreakerOpenSeconds'
+            onChange={handleInputChange}
+            value={inputs.ProviderBreakerOpenSeconds}
+            min='1'
+            max='86400'
+            step='1'
+            placeholder='默认 60'
+          />
+          <Input
+            label='最长熔断时长（秒）'
+            type='number'
+            name='ProviderBreakerMaxOpenSeconds'
+            onChange={handleInputChange}
+            value={inputs.ProviderBreakerMaxOpenSeconds}
+            min='1'
+            max='86400'
+            step='1'
+            placeholder='默认 600'
+          />
+        </div>
+        <Button onClick={submitProviderBreaker} variant="secondary" disabled={loading}>保存供应商熔断设置</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>重试策略</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          限制单个请求在各路由和降级模型间的重试：最大尝试次数只统计实际发往上游的请求，总时限到达后不再发起新的尝试（0 为不限制）。重试间隔在每次失败后翻倍，不超过最大重试间隔。状态码规则按状态码或 4xx/5xx 指定 retry（重试）、never（直接返回给客户端）或 other_provider（只在其他供应商上重试）。模型重试策略可按模型覆盖以上设置，聚合令牌也可单独设置重试策略。流式与非流式请求同样适用。
+        </p>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='最大尝试次数'
+            type='number'
+            name='RetryMaxAttempts'
+            onChange={handleInputChange}
+            value={inputs.RetryMaxAttempts}
+            min='0'
+            max='100'
+            step='1'
+            placeholder='0 为不限制'
+          />
+          <Input
+            label='请求总时限（秒）'
+            type='number'
+            name='RetryDeadlineSeconds'
+            onChange={handleInputChange}
+            value={inputs.RetryDeadlineSeconds}
+            min='0'
+            max='3600'
+            step='1'
+            placeholder='0 为不限制'
+          />
+          <Input
+            label='重试间隔（毫秒）'
+            type='number'
+            name='RetryBackoffMs'
+            onChange={handleInputChange}
+            value={inputs.RetryBackoffMs}
+            min='0'
+            max='60000'
+            step='100'
+            placeholder='0 为立即重试'
+          />
+          <Input
+            label='最大重试间隔（毫秒）'
+            type='number'
+            name='RetryBackoffMaxMs'
+            onChange={handleInputChange}
+            value={inputs.RetryBackoffMaxMs}
+            min='0'
+            max='60000'
+            step='100'
+            placeholder='默认 5000'
+          />
+        </div>
+        <div style={{ fontSize: '0.875rem', marginBottom: '0.5rem' }}>状态码规则</div>
+        <textarea
+          value={inputs.RetryStatusRules}
+          name='RetryStatusRules'
+          onChange={handleInputChange}
+          rows={4}
+          placeholder={'{\n  "400": "never",\n  "413": "never",\n  "429": "other_provider"\n}'}
+          style={{
+            padding: '0.75rem',
+            borderRadius: 'var(--radius-md)',
+            border: '1px solid var(--border-color)',
+            width: '100%',
+            fontFamily: 'monospace',
+            resize: 'vertical',
+            marginBottom: '1rem'
+          }}
+        />
+        <div style={{ fontSize: '0.875rem', marginBottom: '0.5rem' }}>模型重试策略</div>
+        <textarea
+          value={inputs.RetryModelPolicies}
+          name='RetryModelPolicies'
+          onChange={handleInputChange}
+          rows={6}
+          placeholder={'{\n  "gpt-4o": {"max_attempts": 3, "deadline_seconds": 60, "status_rules": {"5xx": "retry"}}\n}'}
+          style={{
+            padding: '0.75rem',
+            borderRadius: 'var(--radius-md)',
+            border: '1px solid var(--border-color)',
+            width: '100%',
+            fontFamily: 'monospace',
+            resize: 'vertical',
+            marginBottom: '1rem'
+          }}
+        />
+        <Button onClick={submitRetryPolicy} variant="secondary" disabled={loading}>保存重试策略</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>并发排队</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          供应商、令牌和路由可分别设置最大并发（0 为不限制）。达到上限的路由会被跳过，优先尝试其他路由；所有候选路由都满载时请求进入排队，超时或队列已满返回 429。并发计数按网关实例独立统计。
+        </p>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='排队上限（请求数）'
+            type='number'
+            name='ConcurrencyQueueSize'
+            onChange={handleInputChange}
+            value={inputs.ConcurrencyQueueSize}
+            min='0'
+            max='10000'
+            placeholder='默认 100，0 表示不排队'
+          />
+          <Input
+            label='排队超时（毫秒）'
+            type='number'
+            name='ConcurrencyQueueTimeoutMs'
+            onChange={handleInputChange}
+            value={inputs.ConcurrencyQueueTimeoutMs}
+            min='100'
+            max='300000'
+            step='100'
+            placeholder='默认 10000'
+          />
+        </div>
+        <Button onClick={submitConcurrencyQueue} variant="secondary" disabled={loading}>保存并发排队设置</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>虚拟模型</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          网关级模型名，映射到一组真实模型：权重大于 0 的目标按权重随机排序依次尝试，权重为 0 的目标作为备用按顺序追加。虚拟模型会出现在模型列表中，并覆盖同名的真实模型。
+        </p>
+        <textarea
+          value={inputs.VirtualModels}
+          name='VirtualModels'
+          onChange={handleInputChange}
+          rows={8}
+          placeholder={'{\n  "team-default": [\n    {"model": "gpt-4o", "weight": 3},\n    {"model": "claude-sonnet-4", "weight": 1}\n  ]\n}'}
+          style={{
+            padding: '0.75rem',
+            borderRadius: 'var(--radius-md)',
+            border: '1px solid var(--border-color)',
+            width: '100%',
+            fontFamily: 'monospace',
+            resize: 'vertical',
+            marginBottom: '1rem'
+          }}
+        />
+        <Button onClick={submitVirtualModels} variant="secondary" disabled={loading}>保存虚拟模型</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>内部价目表</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          覆盖上游同步的模型价格（用于日志成本 cost_usd），并设置内部售价用于部门结算（chargeback_usd）。provider_id 为 0 或省略时对所有供应商生效，指定供应商的条目优先；未设置售价时按成本结算。结算金额再乘以用户所在分组的加价倍率（未配置的分组为 1）。
+        </p>
+        <textarea
+          value={inputs.PriceBook}
+          name='PriceBook'
+          onChange={handleInputChange}
+          rows={8}
+          placeholder={'[\n  {"model": "claude-sonnet-4", "model_ratio": 1.5, "completion_ratio": 5, "sale_model_ratio": 2},\n  {"model": "gpt-4o", "provider_id": 3, "model_price": 0.01}\n]'}
+          style={{
+            padding: '0.75rem',
+            borderRadius: 'var(--radius-md)',
+            border: '1px solid var(--border-color)',
+            width: '100%',
+            fontFamily: 'monospace',
+            resize: 'vertical',
+            marginBottom: '1rem'
+          }}
+        />
+        <textarea
+          value={inputs.PriceBookGroupMarkup}
+          name='PriceBookGroupMarkup'
+          onChange={handleInputChange}
+          rows={3}
+          placeholder={'{"research": 1.2, "marketing": 1.1}'}
+          style={{
+            padding: '0.75rem',
+            borderRadius: 'var(--radius-md)',
+            border: '1px solid var(--border-color)',
+            width: '100%',
+            fontFamily: 'monospace',
+            resize: 'vertical',
+            marginBottom: '1rem'
+          }}
+        />
+        <Button onClick={submitPriceBook} variant="secondary" disabled={loading}>保存价目表</Button>
+      </Card>
+
+      <Card padding="1.5rem">
+        <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>告警通知</h3>
+        <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>
+          每分钟检查一次规则，通过 Webhook 与邮件（使用下方 SMTP 配置）发送；同一告警在静默期内不重复发送，条件解除时发送恢复通知。阈值填 0 表示关闭该规则。
+        </p>
+        <div style={{ display: 'flex', gap: '1.5rem', flexWrap: 'wrap', marginBottom: '0.75rem' }}>
+          <Checkbox
+            checked={inputs.AlertEnabled === 'true'}
+            label='启用告警'
+            name='AlertEnabled'
+            onChange={handleCheckboxChange}
+          />
+          <Checkbox
+            checked={inputs.AlertCPAStoppedEnabled === 'true'}
+            label='内置 CPA 意外停止时告警'
+            name='AlertCPAStoppedEnabled'
+            onChange={handleCheckboxChange}
+          />
+        </div>
+        <div style={{ display: 'grid', gridTemplateColumns: 'repeat(auto-fill, minmax(220px, 1fr))', gap: '1rem', marginBottom: '1rem' }}>
+          <Input
+            label='Webhook 地址'
+            name='AlertWebhookURL'
+            onChange={handleInputChange}
+            value={inputs.AlertWebhookURL}
+            placeholder='https://example.com/hook'
+          />
+          <div style={{ display: 'flex', flexDirection: 'column', gap: '0.35rem' }}>
+            <label style={{ fontSize: '0.875rem', color: 'var(--text-secondary)' }}>Webhook 格式</label>
+            <select
+              name='AlertWebhookFormat'
+              value={inputs.AlertWebhookFormat}
+              onChange={handleInputChange}
+              style={{
+                padding: '0.5rem',
+                borderRadius: 'var(--radius-md)',
+                border: '1px solid var(--border-color)',
+                backgroundColor: 'var(--bg-primary)',
+                color: 'var(--text-primary)',
+              }}
+            >
+              <option value='generic'>通用 JSON</option>
+              <option value='slack'>Slack</option>
+              <option value='feishu'>飞书</option>
+              <option value='dingtalk'>钉钉</option>
+            </select>
+          </div>
+          <Input
+            label='告警邮箱（多个用 ; 分隔）'
+            name='AlertEmailReceivers'
+            onChange={handleInputChange}
+            value={inputs.AlertEmailReceivers}
+            placeholder='ops@example.com'
+          />
+          <Input
+            label='余额低于（USD）'
+            type='number'
+            name='AlertBalanceThresholdUSD'
+            onChange={handleInputChange}
+            value={inputs.AlertBalanceThresholdUSD}
+            min='0'
+            step='0.01'
+          />
+          <Input
+            label='连续同步失败次数'
+            type='number'
+            name='AlertSyncFailureThreshold'
+            onChange={handleInputChange}
+            value={inputs.AlertSyncFailureThreshold}
+            min='0'
+            step='1'
+          />
+          <Input
+            label='令牌冷却超过（分钟）'
+            type='number'
+            name='AlertKeyCooldownMinutes'
+            onChange={handleInputChange}
+            value={inputs.AlertKeyCooldownMinutes}
+            min='0'
+            step='1'
+          />
+          <Input
+            label='静默期（分钟）'
+            type='number'
+            name='AlertQuietPeriodMinutes'
+            onChange={handleInputChange}
+            value={inputs.AlertQuietPeriodMinutes}
+            min='1'
+            step='1'
+          />
+        </div>
+        <div style={{ display: 'flex', gap: '0.75rem' }}>
+          <Button onClick={submitAlert} variant="secondary" disabled={loading}>保存告警设置</Button>
+          <Button onClick={testAlert} variant="secondary" disabled={loading}>发送测试告警</Button>
+        </div>
+      </Card>
+
       <Card padding="1.5rem">
         <h3 style={{ fontSize: '1.1rem', fontWeight: 'bold', marginBottom: '0.5rem' }}>配置 SMTP</h3>
         <p style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '1rem' }}>用以支持系统的邮件发送</p>
@@ -31,6 +31,7 @@ const ProviderDetail = () => {
     const [showTokenModal, setShowTokenModal] = useState(false);
     const [editToken, setEditToken] = useState(null);
     const [selectedPricing, setSelectedPricing] = useState(null);
+    const [billingDraft, setBillingDraft] = useState(null);
     const [aliasMapping, setAliasMapping] = useState({});
     const [aliasMappingInput, setAliasMappingInput] = useState('{}');
     const [aliasLoading, setAliasLoading] = useState(false);
@@ -141,6 +142,36 @@ const ProviderDetail = () => {
     };
 
 
+    const billingRatioFields = [
+        { key: 'cache_ratio', label: '缓存读取倍率' },
+        { key: 'cache_creation_ratio', label: '缓存写入倍率（5 分钟）' },
+        { key: 'cache_creation_1h_ratio', label: '缓存写入倍率（1 小时）' },
+        { key: 'audio_ratio', label: '音频输入倍率' },
+        { key: 'audio_completion_ratio', label: '音频输出倍率（相对音频输入）' },
+        { key: 'image_ratio', label: '图片输入倍率' },
+    ];
+
+    const openPricingDetail = (pricingItem) => {
+        setSelectedPricing(pricingItem);
+        const draft = { price_tiers: pricingItem.price_tiers || '' };
+        billingRatioFields.forEach(({ key }) => { draft[key] = String(pricingItem[key] || 0); });
+        setBillingDraft(draft);
+    };
+
+    const saveBilling = async () => {
+        const payload = { price_tiers: billingDraft.price_tiers.trim() };
+        billingRatioFields.forEach(({ key }) => { payload[key] = Number(billingDraft[key]) || 0; });
+        try {
+            const res = await API.put(`/api/provider/pricing/${selectedPricing.id}`, payload);
+            const { success, message, data } = res.data;
+            if (success) {
+                showSuccess('计费倍率已保存');
+                setSelectedPricing(data);
+                setPricing((prev) => prev.map((item) => (item.id === data.id ? data : item)));
+            } else showError(message);
+        } catch (e) { showError('保存计费倍率失败'); }
+    };
+
     const deleteToken = async (tokenId) => {
         if (!window.confirm('确定要删除此令牌吗？相关路由也会被删除。')) return;
         const res = await API.delete(`/api/provider/token/${tokenId}`);
@@ -568,7 +599,7 @@ const ProviderDetail = () => {
                                     <Td>{renderPerTokenPriceCell(bestGroupPricing.promptPrice)}</Td>
                                     <Td>{renderPerTokenPriceCell(bestGroupPricing.completionPrice)}</Td>
                                     <Td>{renderPerCallPriceCell(bestGroupPricing.perCallPrice)}</Td>
-                                    <Td><Button size="sm" variant="secondary" onClick={() => setSelectedPricing(p)}>详情</Button></Td>
+                                    <Td><Button size="sm" variant="secondary" onClick={() => openPricingDetail(p)}>详情</Button></Td>
                                 </Tr>
                             );
                         })}
@@ -905,6 +936,41 @@ const ProviderDetail = () => {
                                 </Tbody>
                             </Table>
                         </Card>
+
+                        {billingDraft && !isPerRequestBilling(selectedPricing) && (
+                            <Card>
+                                <div style={{ fontWeight: '600' }}>计费倍率</div>
+                                <div style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginTop: '0.25rem' }}>
+                                    用于日志成本估算，倍率相对提示价格；0 表示按普通提示/补全价格计费。上游同步到的倍率会覆盖这里的设置。
+                                </div>
+                                <div style={{ marginTop: '0.75rem', display: 'grid', gridTemplateColumns: 'repeat(2, minmax(0, 1fr))', gap: '0.5rem' }}>
+                                    {billingRatioFields.map(({ key, label }) => (
+                                        <Input
+                                            key={key}
+                                            label={label}
+                                            type="number"
+                                            value={billingDraft[key]}
+                                            onChange={(e) => setBillingDraft({ ...billingDraft, [key]: e.target.value })}
+                                        />
+                                    ))}
+                                </div>
+                                <div style={{ display: 'flex', flexDirection: 'column', marginTop: '0.5rem' }}>
+                                    <label style={{ fontSize: '0.875rem', color: 'var(--text-secondary)', marginBottom: '0.5rem' }}>
+                                        长上下文分段（JSON，输入超过 min_prompt_tokens 时替换模型/补全倍率）
+                                    </label>
+                                    <textarea
+                                        rows={3}
+                                        placeholder='[{"min_prompt_tokens":200000,"model_ratio":3,"completion_ratio":3.75}]'
+                                        value={billingDraft.price_tiers}
+                                        onChange={(e) => setBillingDraft({ ...billingDraft, price_tiers: e.target.value })}
+                                        style={{ padding: '0.5rem', borderRadius: 'var(--radius-md)', border: '1px solid var(--border-color)', width: '100%', fontFamily: 'monospace' }}
+                                    />
+                                </div>
+                                <div style={{ marginTop: '0.75rem' }}>
+                                    <Button variant="primary" onClick={saveBilling}>保存计费倍率</Button>
+                                </div>
+                            </Card>
+                        )}
                     </div>
                 )}
             </Modal>
@@ -924,6 +990,9 @@ const ProviderDetail = () => {
                 <div style={{ display: 'flex', flexDirection: 'column', gap: '0.5rem' }}>
                     <Input label="名称" placeholder="令牌名称" value={editToken?.name || ''} onChange={(e) => setEditToken({ ...editToken, name: e.target.value })} />
                     <Input label="分组名称" placeholder="默认（default）" value={editToken?.group_name || ''} onChange={(e) => setEditToken({ ...editToken, group_name: e.target.value })} />
+                    {editToken?.id && (
+                        <Input label="最大并发（0 为不限制）" type="number" value={editToken?.max_concurrency || 0} onChange={(e) => setEditToken({ ...editToken, max_concurrency: Math.max(0, parseInt(e.target.value) || 0) })} />
+                    )}
                     <div style={{ display: 'flex', gap: '1rem' }}>
                         <div style={{ display: 'flex', alignItems: 'center' }}>
                             <input type="checkbox" id="token_status" checked={(editToken?.status || 0) === 1} onChange={(e) => setEditToken({ ...editToken, status: e.target.checked ? 1 : 0 })} style={{ marginRight: '0.5rem' }} />
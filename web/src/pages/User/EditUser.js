@@ -103,6 +103,16 @@ const EditUser = () => {
             value={display_name}
             autoComplete='new-password'
           />
+          {userId && (
+            <Input
+              label='结算分组'
+              name='user_group'
+              placeholder={'默认 default，用于内部价目表的分组加价'}
+              onChange={handleInputChange}
+              value={inputs.user_group || ''}
+              autoComplete='off'
+            />
+          )}
           <Input
             label='已绑定的 GitHub 账户'
             name='github_id'